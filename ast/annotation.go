@@ -0,0 +1,58 @@
+package ast
+
+// Annotations is a side table of values attached to nodes under string
+// keys, so that passes such as a resolver or type checker can record their
+// results without the node types having fields for them. Keys are usually
+// prefixed with the name of the pass that owns them, e.g. "resolve.scope".
+//
+// Nodes are identified by pointer, so annotations don't follow nodes that
+// are copied or replaced; use Update to carry them over. The zero value is
+// not usable; create tables with make or a composite literal.
+type Annotations map[Node]map[string]any
+
+// Set annotates n with v under key, replacing any previous value.
+func (a Annotations) Set(n Node, key string, v any) {
+	m := a[n]
+	if m == nil {
+		m = make(map[string]any)
+		a[n] = m
+	}
+	m[key] = v
+}
+
+// Get returns the value n is annotated with under key, and whether there is
+// one.
+func (a Annotations) Get(n Node, key string) (any, bool) {
+	v, ok := a[n][key]
+	return v, ok
+}
+
+// Delete removes the annotation of n under key, if any.
+func (a Annotations) Delete(n Node, key string) {
+	m := a[n]
+	delete(m, key)
+	if len(m) == 0 {
+		delete(a, n)
+	}
+}
+
+// Update moves the annotations of old to new, where they take precedence
+// over those new already has. It returns new, so that it can wrap the
+// transformation of a node like CommentMap.Update.
+func (a Annotations) Update(old, new Node) Node {
+	if old == new {
+		return new
+	}
+	for key, v := range a[old] {
+		a.Set(new, key, v)
+	}
+	delete(a, old)
+	return new
+}
+
+// Annotation returns the value n is annotated with under key in a, if there
+// is one and it is a T.
+func Annotation[T any](a Annotations, n Node, key string) (T, bool) {
+	v, ok := a[n][key].(T)
+	return v, ok
+}
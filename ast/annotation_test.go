@@ -0,0 +1,48 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+)
+
+func TestAnnotations(t *testing.T) {
+	program := parse(t, "let x = 1; x + 2")
+	let := program.Statements[0].(*ast.LetStatement)
+	use := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression).Left
+
+	a := ast.Annotations{}
+	a.Set(let.Name, "resolve.decl", true)
+	a.Set(use, "resolve.decl", let.Name)
+	a.Set(use, "types.type", "int")
+
+	if decl, ok := ast.Annotation[*ast.Identifier](a, use, "resolve.decl"); !ok || decl != let.Name {
+		t.Errorf("use not annotated with its declaration. got=%v", decl)
+	}
+	if _, ok := ast.Annotation[*ast.Identifier](a, let.Name, "resolve.decl"); ok {
+		t.Errorf("Annotation returned a value of the wrong type")
+	}
+	if v, ok := a.Get(let.Name, "types.type"); ok {
+		t.Errorf("unexpected annotation %v", v)
+	}
+
+	a.Delete(let.Name, "resolve.decl")
+	if _, ok := a[let.Name]; ok {
+		t.Errorf("node without annotations still in the table")
+	}
+
+	replacement := &ast.Identifier{Value: "x"}
+	a.Set(replacement, "types.type", "unknown")
+	if got := a.Update(use, replacement); got != replacement {
+		t.Errorf("Update returned %v, expected the new node", got)
+	}
+	if typ, _ := ast.Annotation[string](a, replacement, "types.type"); typ != "int" {
+		t.Errorf("annotations of the old node did not take precedence. got=%q", typ)
+	}
+	if _, ok := a.Get(replacement, "resolve.decl"); !ok {
+		t.Errorf("annotation not carried over by Update")
+	}
+	if len(a) != 1 {
+		t.Errorf("table has %d nodes, want 1", len(a))
+	}
+}
@@ -0,0 +1,833 @@
+package ast
+
+import (
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/j4nu5/monkey/token"
+)
+
+type Node interface {
+	TokenLiteral() string
+	String() string
+	Pos() token.Position // Position of the node's first character.
+	End() token.Position // Position just past the node's last character.
+}
+
+type Statement interface {
+	Node
+	statementNode()
+}
+
+type Expression interface {
+	Node
+	expressionNode()
+}
+
+// Program is the root node of every AST the parser produces.
+type Program struct {
+	Statements []Statement
+
+	// Comments associates the program's comments with nearby nodes. It is
+	// only populated when the lexer was created with lexer.ScanComments.
+	Comments CommentMap
+}
+
+func (p *Program) TokenLiteral() string {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].TokenLiteral()
+	}
+	return ""
+}
+
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 && p.Statements[0] != nil {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+func (p *Program) End() token.Position {
+	if n := len(p.Statements); n > 0 && p.Statements[n-1] != nil {
+		return p.Statements[n-1].End()
+	}
+	return token.Position{}
+}
+
+// String renders the program on a single line. Like that of every node, it
+// is valid source that parses back into an Equivalent tree, provided the
+// program passes Check.
+func (p *Program) String() string { return statementsString(p.Statements) }
+
+// statementsString joins statements with spaces. Expression statements
+// have no semicolon of their own, so one is added to all but the last, lest
+// the next statement continue the expression, as in `f; (x)`.
+func statementsString(stmts []Statement) string {
+	var out bytes.Buffer
+	for i, s := range stmts {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		out.WriteString(s.String())
+		if _, ok := s.(*ExpressionStatement); ok && i < len(stmts)-1 {
+			out.WriteString(";")
+		}
+	}
+	return out.String()
+}
+
+// Statements.
+
+// LetStatement binds Value to Name. When the statement destructures a tuple
+// (`let x, y = f();`), Names holds every target in order and Name is
+// Names[0]; otherwise Names is nil.
+type LetStatement struct {
+	Token token.Token // token.LET
+	Name  *Identifier
+	Names []*Identifier
+	Value Expression
+}
+
+func (ls *LetStatement) statementNode()       {}
+func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position  { return exprEnd(ls.Value, ls.Token) }
+func (ls *LetStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ls.TokenLiteral() + " ")
+	if len(ls.Names) > 0 {
+		names := []string{}
+		for _, n := range ls.Names {
+			names = append(names, n.String())
+		}
+		out.WriteString(strings.Join(names, ", "))
+	} else {
+		out.WriteString(ls.Name.String())
+	}
+	out.WriteString(" = ")
+	if ls.Value != nil {
+		out.WriteString(ls.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// ConstStatement binds Value to Name like a LetStatement, but the binding may
+// not be reassigned afterwards.
+type ConstStatement struct {
+	Token token.Token // token.CONST
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ConstStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ConstStatement) End() token.Position  { return exprEnd(cs.Value, cs.Token) }
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(" = ")
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+type ReturnStatement struct {
+	Token       token.Token // token.RETURN
+	ReturnValue Expression
+}
+
+func (rs *ReturnStatement) statementNode()       {}
+func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position  { return exprEnd(rs.ReturnValue, rs.Token) }
+func (rs *ReturnStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(rs.TokenLiteral() + " ")
+	if rs.ReturnValue != nil {
+		out.WriteString(rs.ReturnValue.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// WhileStatement is `while (Condition) { Body }`. It runs Body for as long as
+// Condition holds.
+type WhileStatement struct {
+	Token     token.Token // token.WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return exprEnd(ws.Condition, ws.Token)
+}
+func (ws *WhileStatement) String() string {
+	return "while (" + ws.Condition.String() + ") " + ws.Body.String()
+}
+
+// ForStatement is `for (Variable in Iterable) { Body }`. It runs Body once
+// per element of Iterable, each time in a scope of its own binding Variable
+// to the element.
+type ForStatement struct {
+	Token    token.Token // token.FOR
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return exprEnd(fs.Iterable, fs.Token)
+}
+func (fs *ForStatement) String() string {
+	return "for (" + fs.Variable.String() + " in " + fs.Iterable.String() + ") " + fs.Body.String()
+}
+
+// BreakStatement is `break;`. It ends the innermost enclosing loop.
+type BreakStatement struct {
+	Token token.Token // token.BREAK
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position  { return bs.Token.End() }
+func (bs *BreakStatement) String() string       { return bs.TokenLiteral() + ";" }
+
+// ContinueStatement is `continue;`. It ends the current iteration of the
+// innermost enclosing loop.
+type ContinueStatement struct {
+	Token token.Token // token.CONTINUE
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position  { return cs.Token.End() }
+func (cs *ContinueStatement) String() string       { return cs.TokenLiteral() + ";" }
+
+// ImportStatement names a module to load, e.g. `import "lib/strings";`.
+type ImportStatement struct {
+	Token token.Token // token.IMPORT
+	Path  *StringLiteral
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImportStatement) End() token.Position {
+	if is.Path != nil {
+		return is.Path.End()
+	}
+	return is.Token.End()
+}
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " \"" + is.Path.Value + "\";"
+}
+
+// Name returns the name the statement binds the module to: the last element
+// of its path, without the ".monkey" extension. For `import "lib/strings";`,
+// it is "strings".
+func (is *ImportStatement) Name() string {
+	if is.Path == nil {
+		return ""
+	}
+	return strings.TrimSuffix(path.Base(is.Path.Value), ".monkey")
+}
+
+// ExpressionStatement wraps an expression used on its own line, e.g. `x + 10;`.
+type ExpressionStatement struct {
+	Token      token.Token // The first token of the expression.
+	Expression Expression
+}
+
+func (es *ExpressionStatement) statementNode()       {}
+func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position  { return exprEnd(es.Expression, es.Token) }
+func (es *ExpressionStatement) String() string {
+	if es.Expression != nil {
+		return es.Expression.String()
+	}
+	return ""
+}
+
+type BlockStatement struct {
+	Token      token.Token // token.LBRACE
+	Statements []Statement
+	Rbrace     token.Token
+}
+
+func (bs *BlockStatement) statementNode()       {}
+func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position  { return closeEnd(bs.Rbrace, bs.Token) }
+func (bs *BlockStatement) String() string {
+	if len(bs.Statements) == 0 {
+		return "{}"
+	}
+	return "{ " + statementsString(bs.Statements) + " }"
+}
+
+// Expressions.
+
+// BlockExpression is a brace block used as an expression, e.g.
+// `let y = { let t = f(); t * t };`. It evaluates to the value of its last
+// statement.
+type BlockExpression struct {
+	Token token.Token // token.LBRACE
+	Block *BlockStatement
+}
+
+func (be *BlockExpression) expressionNode()      {}
+func (be *BlockExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BlockExpression) Pos() token.Position  { return be.Token.Pos }
+func (be *BlockExpression) End() token.Position {
+	if be.Block != nil {
+		return be.Block.End()
+	}
+	return be.Token.End()
+}
+func (be *BlockExpression) String() string { return be.Block.String() }
+
+type Identifier struct {
+	Token token.Token // token.IDENT
+	Value string
+}
+
+func (i *Identifier) expressionNode()      {}
+func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
+func (i *Identifier) End() token.Position  { return i.Token.End() }
+func (i *Identifier) String() string       { return i.Value }
+
+type IntegerLiteral struct {
+	Token token.Token // token.INT
+	Value int64
+}
+
+func (il *IntegerLiteral) expressionNode()      {}
+func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position  { return il.Token.End() }
+func (il *IntegerLiteral) String() string       { return il.Token.Literal }
+
+type FloatLiteral struct {
+	Token token.Token // token.FLOAT
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position  { return fl.Token.End() }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
+type StringLiteral struct {
+	Token token.Token // token.STRING
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End() }
+func (sl *StringLiteral) String() string       { return `"` + sl.Value + `"` }
+
+// InterpolatedString is a string literal with embedded `${...}` expressions.
+// Strings holds the literal text around the expressions, so it always has
+// one more element than Exprs: "a ${x} b" has Strings ["a ", " b"] and Exprs
+// [x].
+type InterpolatedString struct {
+	Token   token.Token // token.INTERP_START
+	Strings []string
+	Exprs   []Expression
+	Close   token.Token // token.INTERP_END
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) End() token.Position  { return closeEnd(is.Close, is.Token) }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("\"")
+	for i, e := range is.Exprs {
+		out.WriteString(is.Strings[i])
+		out.WriteString("${")
+		out.WriteString(e.String())
+		out.WriteString("}")
+	}
+	out.WriteString(is.Strings[len(is.Strings)-1])
+	out.WriteString("\"")
+
+	return out.String()
+}
+
+type Boolean struct {
+	Token token.Token // token.TRUE or token.FALSE
+	Value bool
+}
+
+func (b *Boolean) expressionNode()      {}
+func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
+func (b *Boolean) End() token.Position  { return b.Token.End() }
+func (b *Boolean) String() string       { return b.Token.Literal }
+
+type PrefixExpression struct {
+	Token    token.Token // The prefix operator, e.g. `!`.
+	Operator string
+	Right    Expression
+}
+
+func (pe *PrefixExpression) expressionNode()      {}
+func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position  { return exprEnd(pe.Right, pe.Token) }
+func (pe *PrefixExpression) String() string {
+	return "(" + pe.Operator + pe.Right.String() + ")"
+}
+
+type InfixExpression struct {
+	Token    token.Token // The infix operator, e.g. `+`.
+	Left     Expression
+	Operator string
+	Right    Expression
+}
+
+func (ie *InfixExpression) expressionNode()      {}
+func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return exprPos(ie.Left, ie.Token) }
+func (ie *InfixExpression) End() token.Position  { return exprEnd(ie.Right, ie.Token) }
+func (ie *InfixExpression) String() string {
+	return "(" + ie.Left.String() + " " + ie.Operator + " " + ie.Right.String() + ")"
+}
+
+// AssignExpression is `Name = Value`. It rebinds the nearest binding of Name
+// and evaluates to Value.
+type AssignExpression struct {
+	Token token.Token // token.ASSIGN
+	Name  *Identifier
+	Value Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position {
+	if ae.Name != nil {
+		return ae.Name.Pos()
+	}
+	return ae.Token.Pos
+}
+func (ae *AssignExpression) End() token.Position { return exprEnd(ae.Value, ae.Token) }
+func (ae *AssignExpression) String() string {
+	return "(" + ae.Name.String() + " = " + ae.Value.String() + ")"
+}
+
+// ParenExpression is an expression in parentheses, kept so that tools can
+// reproduce what was written. It evaluates to its Expression. String omits
+// the parentheses, as String already parenthesizes every operation.
+type ParenExpression struct {
+	Token      token.Token // token.LPAREN
+	Expression Expression
+	Rparen     token.Token
+}
+
+func (pe *ParenExpression) expressionNode()      {}
+func (pe *ParenExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *ParenExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *ParenExpression) End() token.Position  { return closeEnd(pe.Rparen, pe.Token) }
+func (pe *ParenExpression) String() string       { return pe.Expression.String() }
+
+type IfExpression struct {
+	Token       token.Token // token.IF
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) expressionNode()      {}
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IfExpression) End() token.Position {
+	switch {
+	case ie.Alternative != nil:
+		return ie.Alternative.End()
+	case ie.Consequence != nil:
+		return ie.Consequence.End()
+	}
+	return exprEnd(ie.Condition, ie.Token)
+}
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("if (")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(ie.Consequence.String())
+	if ie.Alternative != nil {
+		out.WriteString(" else ")
+		out.WriteString(ie.Alternative.String())
+	}
+
+	return out.String()
+}
+
+// TryExpression is `try { Body } catch (Param) { Handler }`. It evaluates
+// to the value of Body, or, if Body fails with a runtime error, to the value
+// of Handler, run with the error bound to Param.
+type TryExpression struct {
+	Token   token.Token // token.TRY
+	Body    *BlockStatement
+	Param   *Identifier
+	Handler *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TryExpression) End() token.Position {
+	switch {
+	case te.Handler != nil:
+		return te.Handler.End()
+	case te.Param != nil:
+		return te.Param.End()
+	case te.Body != nil:
+		return te.Body.End()
+	}
+	return te.Token.End()
+}
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Body.String())
+	out.WriteString(" catch (")
+	out.WriteString(te.Param.String())
+	out.WriteString(") ")
+	out.WriteString(te.Handler.String())
+
+	return out.String()
+}
+
+type FunctionLiteral struct {
+	Token      token.Token // token.FUNCTION
+	Parameters []*Identifier
+	Body       *BlockStatement
+
+	// Variadic is set when the last parameter is written `rest...` and
+	// collects all remaining arguments into an array.
+	Variadic bool
+}
+
+func (fl *FunctionLiteral) expressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End()
+}
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+	if fl.Variadic && len(params) > 0 {
+		params[len(params)-1] += "..."
+	}
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+
+	return out.String()
+}
+
+type CallExpression struct {
+	Token     token.Token // token.LPAREN
+	Function  Expression  // Identifier or FunctionLiteral.
+	Arguments []Expression
+	Rparen    token.Token
+}
+
+func (ce *CallExpression) expressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return exprPos(ce.Function, ce.Token) }
+func (ce *CallExpression) End() token.Position  { return closeEnd(ce.Rparen, ce.Token) }
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+type ArrayLiteral struct {
+	Token    token.Token // token.LBRACKET
+	Elements []Expression
+	Rbracket token.Token
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position  { return closeEnd(al.Rbracket, al.Token) }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type IndexExpression struct {
+	Token    token.Token // token.LBRACKET
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return exprPos(ie.Left, ie.Token) }
+func (ie *IndexExpression) End() token.Position  { return closeEnd(ie.Rbracket, ie.Token) }
+func (ie *IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+
+// SliceExpression is `left[low:high]`. Low and High are nil when the
+// corresponding bound is omitted.
+type SliceExpression struct {
+	Token    token.Token // token.LBRACKET
+	Left     Expression
+	Low      Expression
+	High     Expression
+	Rbracket token.Token
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return exprPos(se.Left, se.Token) }
+func (se *SliceExpression) End() token.Position  { return closeEnd(se.Rbracket, se.Token) }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(" + se.Left.String() + "[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+type HashLiteral struct {
+	Token  token.Token // token.LBRACE
+	Pairs  []*HashPair // In source order.
+	Rbrace token.Token
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position  { return closeEnd(hl.Rbrace, hl.Token) }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// SpreadExpression is `value...` in a call's arguments or an array literal,
+// expanding the elements of an array in place.
+type SpreadExpression struct {
+	Token token.Token // token.ELLIPSIS
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) Pos() token.Position  { return exprPos(se.Value, se.Token) }
+func (se *SpreadExpression) End() token.Position  { return se.Token.End() }
+func (se *SpreadExpression) String() string       { return se.Value.String() + "..." }
+
+// TupleLiteral is a bare comma-separated list of expressions. It only appears
+// where the grammar allows multiple values, i.e. `return a, b;`.
+type TupleLiteral struct {
+	Token    token.Token // The first token.COMMA.
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) expressionNode()      {}
+func (tl *TupleLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TupleLiteral) Pos() token.Position {
+	if len(tl.Elements) > 0 {
+		return exprPos(tl.Elements[0], tl.Token)
+	}
+	return tl.Token.Pos
+}
+func (tl *TupleLiteral) End() token.Position {
+	if n := len(tl.Elements); n > 0 {
+		return exprEnd(tl.Elements[n-1], tl.Token)
+	}
+	return tl.Token.End()
+}
+func (tl *TupleLiteral) String() string {
+	elements := []string{}
+	for _, el := range tl.Elements {
+		elements = append(elements, el.String())
+	}
+	return strings.Join(elements, ", ")
+}
+
+// QuoteExpression is `quote(<expression>)`. Its Node is kept unevaluated.
+type QuoteExpression struct {
+	Token  token.Token // token.QUOTE
+	Node   Expression
+	Rparen token.Token
+}
+
+func (qe *QuoteExpression) expressionNode()      {}
+func (qe *QuoteExpression) TokenLiteral() string { return qe.Token.Literal }
+func (qe *QuoteExpression) Pos() token.Position  { return qe.Token.Pos }
+func (qe *QuoteExpression) End() token.Position  { return closeEnd(qe.Rparen, qe.Token) }
+func (qe *QuoteExpression) String() string {
+	return qe.TokenLiteral() + "(" + qe.Node.String() + ")"
+}
+
+// UnquoteExpression is `unquote(<expression>)`, which is only meaningful
+// inside a QuoteExpression.
+type UnquoteExpression struct {
+	Token  token.Token // token.UNQUOTE
+	Node   Expression
+	Rparen token.Token
+}
+
+func (ue *UnquoteExpression) expressionNode()      {}
+func (ue *UnquoteExpression) TokenLiteral() string { return ue.Token.Literal }
+func (ue *UnquoteExpression) Pos() token.Position  { return ue.Token.Pos }
+func (ue *UnquoteExpression) End() token.Position  { return closeEnd(ue.Rparen, ue.Token) }
+func (ue *UnquoteExpression) String() string {
+	return ue.TokenLiteral() + "(" + ue.Node.String() + ")"
+}
+
+type MacroLiteral struct {
+	Token      token.Token // token.MACRO
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Pos() token.Position  { return ml.Token.Pos }
+func (ml *MacroLiteral) End() token.Position {
+	if ml.Body != nil {
+		return ml.Body.End()
+	}
+	return ml.Token.End()
+}
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
+// exprPos returns the start of e, falling back to the start of tok for the
+// missing expressions left behind by parse errors.
+func exprPos(e Expression, tok token.Token) token.Position {
+	if e == nil {
+		return tok.Pos
+	}
+	return e.Pos()
+}
+
+// exprEnd returns the end of e, falling back to the end of tok for the
+// missing expressions left behind by parse errors.
+func exprEnd(e Expression, tok token.Token) token.Position {
+	if e == nil {
+		return tok.End()
+	}
+	return e.End()
+}
+
+// closeEnd returns the end of a closing delimiter, falling back to the end of
+// the opening one for nodes that were never closed or were built by hand.
+func closeEnd(close, open token.Token) token.Position {
+	if close.Type == "" {
+		return open.End()
+	}
+	return close.End()
+}
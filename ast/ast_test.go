@@ -0,0 +1,79 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/token"
+)
+
+func TestString(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "myVar"},
+					Value: "myVar",
+				},
+				Value: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "anotherVar"},
+					Value: "anotherVar",
+				},
+			},
+		},
+	}
+
+	if program.String() != "let myVar = anotherVar;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestTupleString(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	x, y := ident("x"), ident("y")
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  x,
+				Names: []*Identifier{x, y},
+				Value: ident("pair"),
+			},
+			&ReturnStatement{
+				Token: token.Token{Type: token.RETURN, Literal: "return"},
+				ReturnValue: &TupleLiteral{
+					Token:    token.Token{Type: token.COMMA, Literal: ","},
+					Elements: []Expression{ident("y"), ident("x")},
+				},
+			},
+		},
+	}
+
+	if program.String() != "let x, y = pair; return y, x;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestImportName(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"math", "math"},
+		{"lib/strings", "strings"},
+		{"../util.monkey", "util"},
+	}
+
+	for _, tt := range tests {
+		stmt := &ImportStatement{
+			Token: token.Token{Type: token.IMPORT, Literal: "import"},
+			Path:  &StringLiteral{Token: token.Token{Type: token.STRING, Literal: tt.path}, Value: tt.path},
+		}
+		if name := stmt.Name(); name != tt.expected {
+			t.Errorf("Name() of import %q wrong. want=%q, got=%q", tt.path, tt.expected, name)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+// Package build provides constructors for AST nodes, for code generators and
+// tests that assemble trees without parsing source.
+//
+// The constructors fill in the tokens the parser would have produced, minus
+// their positions, so that TokenLiteral and String work as usual:
+//
+//	build.Let("x", build.Infix(build.Int(1), "+", build.Ident("y")))
+package build
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/token"
+)
+
+func tok(t token.TokenType, literal string) token.Token {
+	return token.Token{Type: t, Literal: literal}
+}
+
+// Program returns a program consisting of stmts.
+func Program(stmts ...ast.Statement) *ast.Program {
+	return &ast.Program{Statements: list(stmts)}
+}
+
+// Statements.
+
+// Let returns `let name = value;`.
+func Let(name string, value ast.Expression) *ast.LetStatement {
+	return &ast.LetStatement{Token: tok(token.LET, "let"), Name: Ident(name), Value: value}
+}
+
+// LetMulti returns the destructuring `let names[0], names[1], ... = value;`.
+// It panics if names is empty.
+func LetMulti(names []string, value ast.Expression) *ast.LetStatement {
+	if len(names) == 0 {
+		panic("build.LetMulti: no names")
+	}
+	idents := idents(names)
+	return &ast.LetStatement{Token: tok(token.LET, "let"), Name: idents[0], Names: idents, Value: value}
+}
+
+// Const returns `const name = value;`.
+func Const(name string, value ast.Expression) *ast.ConstStatement {
+	return &ast.ConstStatement{Token: tok(token.CONST, "const"), Name: Ident(name), Value: value}
+}
+
+// Return returns `return value;`. Several values are returned as a tuple.
+func Return(values ...ast.Expression) *ast.ReturnStatement {
+	stmt := &ast.ReturnStatement{Token: tok(token.RETURN, "return")}
+	switch len(values) {
+	case 0:
+	case 1:
+		stmt.ReturnValue = values[0]
+	default:
+		stmt.ReturnValue = Tuple(values...)
+	}
+	return stmt
+}
+
+// While returns `while (cond) { body }`.
+func While(cond ast.Expression, body ...ast.Statement) *ast.WhileStatement {
+	return &ast.WhileStatement{Token: tok(token.WHILE, "while"), Condition: cond, Body: Block(body...)}
+}
+
+// For returns `for (name in iterable) { body }`.
+func For(name string, iterable ast.Expression, body ...ast.Statement) *ast.ForStatement {
+	return &ast.ForStatement{Token: tok(token.FOR, "for"), Variable: Ident(name), Iterable: iterable, Body: Block(body...)}
+}
+
+// Break returns `break;`.
+func Break() *ast.BreakStatement {
+	return &ast.BreakStatement{Token: tok(token.BREAK, "break")}
+}
+
+// Continue returns `continue;`.
+func Continue() *ast.ContinueStatement {
+	return &ast.ContinueStatement{Token: tok(token.CONTINUE, "continue")}
+}
+
+// Import returns `import "path";`.
+func Import(path string) *ast.ImportStatement {
+	return &ast.ImportStatement{Token: tok(token.IMPORT, "import"), Path: Str(path)}
+}
+
+// Expr returns an expression statement consisting of e.
+func Expr(e ast.Expression) *ast.ExpressionStatement {
+	return &ast.ExpressionStatement{Token: firstToken(e), Expression: e}
+}
+
+// Block returns a block statement consisting of stmts.
+func Block(stmts ...ast.Statement) *ast.BlockStatement {
+	return &ast.BlockStatement{
+		Token:      tok(token.LBRACE, "{"),
+		Statements: list(stmts),
+		Rbrace:     tok(token.RBRACE, "}"),
+	}
+}
+
+// Expressions.
+
+// Ident returns the identifier name.
+func Ident(name string) *ast.Identifier {
+	return &ast.Identifier{Token: tok(token.IDENT, name), Value: name}
+}
+
+// Int returns the integer literal v.
+func Int(v int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Token: tok(token.INT, strconv.FormatInt(v, 10)), Value: v}
+}
+
+// Float returns the float literal v.
+func Float(v float64) *ast.FloatLiteral {
+	return &ast.FloatLiteral{Token: tok(token.FLOAT, formatFloat(v)), Value: v}
+}
+
+// formatFloat returns v as it would be written in source: with a decimal
+// point, so that it doesn't read as an integer.
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// Str returns the string literal s.
+func Str(s string) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: tok(token.STRING, s), Value: s}
+}
+
+// Bool returns true or false.
+func Bool(v bool) *ast.Boolean {
+	if v {
+		return &ast.Boolean{Token: tok(token.TRUE, "true"), Value: true}
+	}
+	return &ast.Boolean{Token: tok(token.FALSE, "false"), Value: false}
+}
+
+// Interpolated returns a string interpolating exprs between strs, i.e.
+// "strs[0]${exprs[0]}strs[1]...". It panics unless there is one more string
+// than there are expressions.
+func Interpolated(strs []string, exprs ...ast.Expression) *ast.InterpolatedString {
+	if len(strs) != len(exprs)+1 || len(exprs) == 0 {
+		panic(fmt.Sprintf("build.Interpolated: %d strings for %d expressions", len(strs), len(exprs)))
+	}
+	return &ast.InterpolatedString{
+		Token:   tok(token.INTERP_START, strs[0]),
+		Strings: strs,
+		Exprs:   exprs,
+		Close:   tok(token.INTERP_END, strs[len(strs)-1]),
+	}
+}
+
+// Prefix returns `<op><right>`, e.g. `-x`.
+func Prefix(op string, right ast.Expression) *ast.PrefixExpression {
+	return &ast.PrefixExpression{Token: tok(token.TokenType(op), op), Operator: op, Right: right}
+}
+
+// Infix returns `<left> <op> <right>`, e.g. `x + 1`.
+func Infix(left ast.Expression, op string, right ast.Expression) *ast.InfixExpression {
+	return &ast.InfixExpression{Token: tok(token.TokenType(op), op), Left: left, Operator: op, Right: right}
+}
+
+// Assign returns `name = value`.
+func Assign(name string, value ast.Expression) *ast.AssignExpression {
+	return &ast.AssignExpression{Token: tok(token.ASSIGN, "="), Name: Ident(name), Value: value}
+}
+
+// Paren returns `(exp)`.
+func Paren(exp ast.Expression) *ast.ParenExpression {
+	return &ast.ParenExpression{Token: tok(token.LPAREN, "("), Expression: exp, Rparen: tok(token.RPAREN, ")")}
+}
+
+// If returns `if (cond) { consequence }`, with an else branch unless
+// alternative is nil.
+func If(cond ast.Expression, consequence, alternative *ast.BlockStatement) *ast.IfExpression {
+	return &ast.IfExpression{
+		Token:       tok(token.IF, "if"),
+		Condition:   cond,
+		Consequence: consequence,
+		Alternative: alternative,
+	}
+}
+
+// Try returns `try { body } catch (param) { handler }`.
+func Try(body *ast.BlockStatement, param string, handler *ast.BlockStatement) *ast.TryExpression {
+	return &ast.TryExpression{Token: tok(token.TRY, "try"), Body: body, Param: Ident(param), Handler: handler}
+}
+
+// Fn returns `fn(params) { body }`.
+func Fn(params []string, body ...ast.Statement) *ast.FunctionLiteral {
+	return &ast.FunctionLiteral{Token: tok(token.FUNCTION, "fn"), Parameters: idents(params), Body: Block(body...)}
+}
+
+// VariadicFn returns `fn(params...) { body }`, whose last parameter collects
+// the remaining arguments. It panics if params is empty.
+func VariadicFn(params []string, body ...ast.Statement) *ast.FunctionLiteral {
+	if len(params) == 0 {
+		panic("build.VariadicFn: no parameters")
+	}
+	fn := Fn(params, body...)
+	fn.Variadic = true
+	return fn
+}
+
+// Macro returns `macro(params) { body }`.
+func Macro(params []string, body ...ast.Statement) *ast.MacroLiteral {
+	return &ast.MacroLiteral{Token: tok(token.MACRO, "macro"), Parameters: idents(params), Body: Block(body...)}
+}
+
+// Call returns `fn(args)`.
+func Call(fn ast.Expression, args ...ast.Expression) *ast.CallExpression {
+	return &ast.CallExpression{
+		Token:     tok(token.LPAREN, "("),
+		Function:  fn,
+		Arguments: list(args),
+		Rparen:    tok(token.RPAREN, ")"),
+	}
+}
+
+// Array returns `[elems]`.
+func Array(elems ...ast.Expression) *ast.ArrayLiteral {
+	return &ast.ArrayLiteral{
+		Token:    tok(token.LBRACKET, "["),
+		Elements: list(elems),
+		Rbracket: tok(token.RBRACKET, "]"),
+	}
+}
+
+// Index returns `left[index]`.
+func Index(left, index ast.Expression) *ast.IndexExpression {
+	return &ast.IndexExpression{
+		Token:    tok(token.LBRACKET, "["),
+		Left:     left,
+		Index:    index,
+		Rbracket: tok(token.RBRACKET, "]"),
+	}
+}
+
+// Slice returns `left[low:high]`. Either bound may be nil to omit it.
+func Slice(left, low, high ast.Expression) *ast.SliceExpression {
+	return &ast.SliceExpression{
+		Token:    tok(token.LBRACKET, "["),
+		Left:     left,
+		Low:      low,
+		High:     high,
+		Rbracket: tok(token.RBRACKET, "]"),
+	}
+}
+
+// Hash returns `{pairs}`, keeping the pairs in order.
+func Hash(pairs ...*ast.HashPair) *ast.HashLiteral {
+	return &ast.HashLiteral{
+		Token:  tok(token.LBRACE, "{"),
+		Pairs:  list(pairs),
+		Rbrace: tok(token.RBRACE, "}"),
+	}
+}
+
+// Pair returns the hash pair `key: value`.
+func Pair(key, value ast.Expression) *ast.HashPair {
+	return &ast.HashPair{Key: key, Value: value}
+}
+
+// Spread returns `value...`.
+func Spread(value ast.Expression) *ast.SpreadExpression {
+	return &ast.SpreadExpression{Token: tok(token.ELLIPSIS, "..."), Value: value}
+}
+
+// Tuple returns `elems[0], elems[1], ...`, as returned by `return a, b;`.
+func Tuple(elems ...ast.Expression) *ast.TupleLiteral {
+	return &ast.TupleLiteral{Token: tok(token.COMMA, ","), Elements: list(elems)}
+}
+
+// BlockExpr returns the block expression `{ stmts }`.
+func BlockExpr(stmts ...ast.Statement) *ast.BlockExpression {
+	return &ast.BlockExpression{Token: tok(token.LBRACE, "{"), Block: Block(stmts...)}
+}
+
+// Quote returns `quote(node)`.
+func Quote(node ast.Expression) *ast.QuoteExpression {
+	return &ast.QuoteExpression{Token: tok(token.QUOTE, "quote"), Node: node, Rparen: tok(token.RPAREN, ")")}
+}
+
+// Unquote returns `unquote(node)`.
+func Unquote(node ast.Expression) *ast.UnquoteExpression {
+	return &ast.UnquoteExpression{Token: tok(token.UNQUOTE, "unquote"), Node: node, Rparen: tok(token.RPAREN, ")")}
+}
+
+func idents(names []string) []*ast.Identifier {
+	idents := make([]*ast.Identifier, len(names))
+	for i, name := range names {
+		idents[i] = Ident(name)
+	}
+	return idents
+}
+
+// list returns s, or an empty slice instead of nil, as the parser does.
+func list[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// firstToken returns the token an expression statement consisting of e
+// would start with.
+func firstToken(e ast.Expression) token.Token {
+	for {
+		switch x := e.(type) {
+		case *ast.InfixExpression:
+			e = x.Left
+		case *ast.AssignExpression:
+			if x.Name == nil {
+				return x.Token
+			}
+			return x.Name.Token
+		case *ast.CallExpression:
+			e = x.Function
+		case *ast.IndexExpression:
+			e = x.Left
+		case *ast.SliceExpression:
+			e = x.Left
+		case *ast.SpreadExpression:
+			e = x.Value
+		case *ast.TupleLiteral:
+			if len(x.Elements) == 0 {
+				return x.Token
+			}
+			e = x.Elements[0]
+		case nil:
+			return token.Token{}
+		default:
+			return tokenOf(e)
+		}
+	}
+}
+
+// tokenOf returns the Token field of e.
+func tokenOf(e ast.Expression) token.Token {
+	switch x := e.(type) {
+	case *ast.Identifier:
+		return x.Token
+	case *ast.IntegerLiteral:
+		return x.Token
+	case *ast.FloatLiteral:
+		return x.Token
+	case *ast.StringLiteral:
+		return x.Token
+	case *ast.InterpolatedString:
+		return x.Token
+	case *ast.Boolean:
+		return x.Token
+	case *ast.PrefixExpression:
+		return x.Token
+	case *ast.ParenExpression:
+		return x.Token
+	case *ast.IfExpression:
+		return x.Token
+	case *ast.TryExpression:
+		return x.Token
+	case *ast.FunctionLiteral:
+		return x.Token
+	case *ast.MacroLiteral:
+		return x.Token
+	case *ast.ArrayLiteral:
+		return x.Token
+	case *ast.HashLiteral:
+		return x.Token
+	case *ast.BlockExpression:
+		return x.Token
+	case *ast.QuoteExpression:
+		return x.Token
+	case *ast.UnquoteExpression:
+		return x.Token
+	}
+	return token.Token{}
+}
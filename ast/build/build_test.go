@@ -0,0 +1,102 @@
+package build_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	. "github.com/j4nu5/monkey/ast/build"
+	"github.com/j4nu5/monkey/ast/printer"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		built ast.Node
+		input string
+	}{
+		{Let("x", Infix(Int(1), "+", Prefix("-", Ident("y")))), "let x = 1 + -y;"},
+		{LetMulti([]string{"a", "b"}, Call(Ident("f"), Spread(Ident("xs")))), "let a, b = f(xs...);"},
+		{Const("c", Bool(false)), "const c = false;"},
+		{Expr(Infix(Paren(Infix(Int(1), "+", Int(2))), "*", Int(3))), "(1 + 2) * 3;"},
+		{Return(Ident("a"), Int(2)), "return a, 2;"},
+		{Return(Str("s")), `return "s";`},
+		{Import("lib/math"), `import "lib/math";`},
+		{Expr(Index(Array(Int(1), Str("two")), Int(0))), `[1, "two"][0];`},
+		{Expr(Slice(Str("hello"), Int(1), nil)), `"hello"[1:];`},
+		{Expr(Slice(Ident("xs"), nil, Prefix("-", Int(1)))), `xs[:-1];`},
+		{Expr(Hash(Pair(Str("k"), Bool(true)), Pair(Int(1), Hash()))), `{"k": true, 1: {}};`},
+		{
+			Expr(If(Infix(Ident("a"), "<", Ident("b")), Block(Expr(Ident("a"))), nil)),
+			"if (a < b) { a }",
+		},
+		{
+			Expr(If(Ident("a"), Block(), Block(Return(Int(1))))),
+			"if (a) {} else { return 1; }",
+		},
+		{
+			Let("f", VariadicFn([]string{"x", "rest"}, Expr(Call(Ident("g"), Ident("rest"))))),
+			"let f = fn(x, rest...) { g(rest) };",
+		},
+		{Expr(Call(Fn(nil))), "fn() {}();"},
+		{
+			Expr(Try(Block(Expr(Call(Ident("f")))), "err", Block(Expr(Ident("err"))))),
+			"try { f() } catch (err) { err }",
+		},
+		{
+			While(Infix(Ident("i"), "<", Int(3)), Expr(If(Ident("d"), Block(Break()), Block(Continue())))),
+			"while (i < 3) { if (d) { break; } else { continue; } }",
+		},
+		{For("x", Ident("xs"), Expr(Call(Ident("f"), Ident("x")))), "for (x in xs) { f(x) }"},
+		{Expr(Assign("n", Infix(Ident("n"), "+", Int(1)))), "n = n + 1;"},
+		{Expr(Interpolated([]string{"a ", ""}, Ident("x"))), `"a ${x}";`},
+		{Let("v", BlockExpr(Let("y", Int(1)), Expr(Ident("y")))), "let v = { let y = 1; y };"},
+		{
+			Let("m", Macro([]string{"a"}, Expr(Quote(Infix(Unquote(Ident("a")), "*", Int(2)))))),
+			"let m = macro(a) { quote(unquote(a) * 2) };",
+		},
+		{Program(Let("x", Int(5)), Expr(Ident("x"))), "let x = 5; x"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %q", tt.input, p.Errors())
+		}
+
+		var expected ast.Node = program
+		if _, ok := tt.built.(*ast.Program); !ok {
+			expected = program.Statements[0]
+		}
+
+		if !ast.Equal(tt.built, expected) {
+			t.Errorf("built %q, expected the tree of %q", printer.String(tt.built), tt.input)
+		}
+		if tt.built.String() != expected.String() {
+			t.Errorf("String() wrong. expected=%q, got=%q", expected.String(), tt.built.String())
+		}
+		if tt.built.TokenLiteral() != expected.TokenLiteral() {
+			t.Errorf("TokenLiteral() wrong. expected=%q, got=%q", expected.TokenLiteral(), tt.built.TokenLiteral())
+		}
+	}
+}
+
+func TestBuildPanics(t *testing.T) {
+	tests := map[string]func(){
+		"LetMulti":     func() { LetMulti(nil, Int(1)) },
+		"VariadicFn":   func() { VariadicFn(nil) },
+		"Interpolated": func() { Interpolated([]string{"a"}, Ident("x")) },
+	}
+
+	for name, f := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,386 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/j4nu5/monkey/token"
+)
+
+// A CheckError describes a malformed node found by Check.
+type CheckError struct {
+	Pos  token.Position // Position of Node, if it has one.
+	Node Node
+	Msg  string
+}
+
+func (e *CheckError) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// Operators the parser produces.
+var (
+	prefixOperators = map[string]bool{"!": true, "-": true}
+	infixOperators  = map[string]bool{
+		"+": true, "-": true, "*": true, "/": true, "%": true,
+		"&": true, "|": true, "^": true, "<<": true, ">>": true,
+		"<": true, ">": true, "==": true, "!=": true,
+		"&&": true, "||": true, "??": true,
+	}
+)
+
+// Check reports the ways in which the tree rooted at node is malformed, i.e.
+// could not have been produced by a parse without errors: missing children,
+// nil list entries, identifiers that aren't valid names, negative integer
+// literals, strings that can't be written as literals, unknown operators,
+// spreads and tuples in places the grammar doesn't allow them and the like.
+// The errors are *CheckErrors, ordered as Inspect visits the offending
+// nodes; the result is nil for a well-formed tree.
+//
+// Parsers recovering from errors leave partial trees behind, so passes that
+// assume well-formed input should Check it first.
+func Check(node Node) []error {
+	c := &checker{allowed: make(map[Expression]bool)}
+	if isMissing(node) {
+		return []error{&CheckError{Msg: "missing root node"}}
+	}
+	Inspect(node, c.check)
+	return c.errors
+}
+
+type checker struct {
+	errors  []error
+	allowed map[Expression]bool // Spreads and tuples in valid positions.
+}
+
+func (c *checker) errorf(n Node, format string, a ...interface{}) {
+	c.errors = append(c.errors, &CheckError{Pos: safePos(n), Node: n, Msg: fmt.Sprintf(format, a...)})
+}
+
+// child reports child of n as missing, if it is.
+func (c *checker) child(n Node, child Node, name string) {
+	if isMissing(child) {
+		c.errorf(n, "%s has no %s", describe(n), name)
+	}
+}
+
+func (c *checker) check(n Node) bool {
+	if n == nil {
+		return true
+	}
+	if isMissing(n) {
+		return false // Reported as a missing child of its parent.
+	}
+
+	switch n := n.(type) {
+	case *Program:
+		checkList(c, n, "statement", n.Statements)
+
+	case *LetStatement:
+		c.child(n, n.Name, "name")
+		if len(n.Names) > 0 {
+			checkList(c, n, "name", n.Names)
+			if len(n.Names) < 2 {
+				c.errorf(n, "destructuring let statement has %d name", len(n.Names))
+			}
+			if n.Name != n.Names[0] {
+				c.errorf(n, "let statement Name is not Names[0]")
+			}
+		}
+		c.child(n, n.Value, "value")
+
+	case *ConstStatement:
+		c.child(n, n.Name, "name")
+		c.child(n, n.Value, "value")
+
+	case *ReturnStatement:
+		c.child(n, n.ReturnValue, "return value")
+		if t, ok := n.ReturnValue.(*TupleLiteral); ok {
+			c.allowed[t] = true
+		}
+
+	case *WhileStatement:
+		c.child(n, n.Condition, "condition")
+		c.child(n, n.Body, "body")
+
+	case *ForStatement:
+		c.child(n, n.Variable, "variable")
+		c.child(n, n.Iterable, "iterable")
+		c.child(n, n.Body, "body")
+
+	case *ImportStatement:
+		c.child(n, n.Path, "path")
+
+	case *ExpressionStatement:
+		c.child(n, n.Expression, "expression")
+
+	case *BlockStatement:
+		checkList(c, n, "statement", n.Statements)
+
+	case *BlockExpression:
+		c.child(n, n.Block, "block")
+		if n.Block != nil && len(n.Block.Statements) == 0 {
+			c.errorf(n, "block expression is empty")
+		}
+
+	case *Identifier:
+		switch {
+		case n.Value == "":
+			c.errorf(n, "identifier has an empty name")
+		case !isName(n.Value):
+			c.errorf(n, "identifier %q is not a valid name", n.Value)
+		case token.LookupIdent(n.Value) != token.IDENT:
+			c.errorf(n, "identifier %q is a keyword", n.Value)
+		}
+
+	case *IntegerLiteral:
+		if n.Value < 0 {
+			c.errorf(n, "integer literal %d is negative", n.Value)
+		}
+
+	case *FloatLiteral:
+		switch {
+		case math.IsNaN(n.Value) || math.IsInf(n.Value, 0):
+			c.errorf(n, "float literal %v is not a number", n.Value)
+		case n.Value < 0:
+			c.errorf(n, "float literal %v is negative", n.Value)
+		}
+
+	case *StringLiteral:
+		c.stringText(n, n.Value)
+
+	case *InterpolatedString:
+		if len(n.Exprs) == 0 || len(n.Strings) != len(n.Exprs)+1 {
+			c.errorf(n, "interpolated string has %d strings for %d expressions",
+				len(n.Strings), len(n.Exprs))
+		}
+		checkList(c, n, "expression", n.Exprs)
+		for _, s := range n.Strings {
+			c.stringText(n, s)
+		}
+
+	case *PrefixExpression:
+		if !prefixOperators[n.Operator] {
+			c.errorf(n, "unknown prefix operator %q", n.Operator)
+		}
+		c.child(n, n.Right, "operand")
+
+	case *InfixExpression:
+		if !infixOperators[n.Operator] {
+			c.errorf(n, "unknown infix operator %q", n.Operator)
+		}
+		c.child(n, n.Left, "left operand")
+		c.child(n, n.Right, "right operand")
+
+	case *AssignExpression:
+		c.child(n, n.Name, "name")
+		c.child(n, n.Value, "value")
+
+	case *ParenExpression:
+		c.child(n, n.Expression, "expression")
+
+	case *IfExpression:
+		c.child(n, n.Condition, "condition")
+		c.child(n, n.Consequence, "consequence")
+
+	case *TryExpression:
+		c.child(n, n.Body, "body")
+		c.child(n, n.Param, "catch parameter")
+		c.child(n, n.Handler, "handler")
+
+	case *FunctionLiteral:
+		checkList(c, n, "parameter", n.Parameters)
+		if n.Variadic && len(n.Parameters) == 0 {
+			c.errorf(n, "variadic function literal has no parameters")
+		}
+		c.child(n, n.Body, "body")
+
+	case *MacroLiteral:
+		checkList(c, n, "parameter", n.Parameters)
+		c.child(n, n.Body, "body")
+
+	case *CallExpression:
+		c.child(n, n.Function, "function")
+		checkList(c, n, "argument", n.Arguments)
+		c.allowSpreads(n.Arguments)
+
+	case *ArrayLiteral:
+		checkList(c, n, "element", n.Elements)
+		c.allowSpreads(n.Elements)
+
+	case *IndexExpression:
+		c.child(n, n.Left, "operand")
+		c.child(n, n.Index, "index")
+
+	case *SliceExpression:
+		c.child(n, n.Left, "operand")
+
+	case *HashLiteral:
+		for i, pair := range n.Pairs {
+			if pair == nil {
+				c.errorf(n, "hash literal has a nil pair at index %d", i)
+				continue
+			}
+			c.child(n, pair.Key, fmt.Sprintf("key at index %d", i))
+			c.child(n, pair.Value, fmt.Sprintf("value at index %d", i))
+		}
+
+	case *TupleLiteral:
+		if !c.allowed[n] {
+			c.errorf(n, "tuple outside of a return statement")
+		}
+		if len(n.Elements) < 2 {
+			c.errorf(n, "tuple has %d elements", len(n.Elements))
+		}
+		checkList(c, n, "element", n.Elements)
+
+	case *SpreadExpression:
+		if !c.allowed[n] {
+			c.errorf(n, "spread outside of an argument or element list")
+		}
+		c.child(n, n.Value, "operand")
+
+	case *QuoteExpression:
+		c.child(n, n.Node, "operand")
+
+	case *UnquoteExpression:
+		c.child(n, n.Node, "operand")
+
+	case *CommentGroup:
+		if len(n.List) == 0 {
+			c.errorf(n, "comment group is empty")
+		}
+		checkList(c, n, "comment", n.List)
+	}
+
+	return true
+}
+
+func (c *checker) allowSpreads(list []Expression) {
+	for _, e := range list {
+		if s, ok := e.(*SpreadExpression); ok {
+			c.allowed[s] = true
+		}
+	}
+}
+
+// stringText reports text of n, if it couldn't appear in a string literal.
+func (c *checker) stringText(n Node, text string) {
+	switch {
+	case strings.Contains(text, `"`):
+		c.errorf(n, "string contains a double quote")
+	case strings.Contains(text, "${"):
+		c.errorf(n, "string contains an interpolation opener")
+	case strings.IndexByte(text, 0) >= 0:
+		c.errorf(n, "string contains a NUL byte")
+	}
+}
+
+// isName reports whether s consists of the characters the lexer accepts in
+// identifiers.
+func isName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkList reports the missing entries in list, a field of n.
+func checkList[T Node](c *checker, n Node, what string, list []T) {
+	for i, e := range list {
+		if isMissing(e) {
+			c.errorf(n, "%s has a nil %s at index %d", describe(n), what, i)
+		}
+	}
+}
+
+// describe names the type of n in messages, e.g. "if expression".
+func describe(n Node) string {
+	switch n.(type) {
+	case *Program:
+		return "program"
+	case *LetStatement:
+		return "let statement"
+	case *ConstStatement:
+		return "const statement"
+	case *ReturnStatement:
+		return "return statement"
+	case *WhileStatement:
+		return "while statement"
+	case *ForStatement:
+		return "for statement"
+	case *ImportStatement:
+		return "import statement"
+	case *ExpressionStatement:
+		return "expression statement"
+	case *BlockStatement:
+		return "block"
+	case *BlockExpression:
+		return "block expression"
+	case *InterpolatedString:
+		return "interpolated string"
+	case *PrefixExpression:
+		return "prefix expression"
+	case *InfixExpression:
+		return "infix expression"
+	case *AssignExpression:
+		return "assignment"
+	case *ParenExpression:
+		return "parenthesized expression"
+	case *IfExpression:
+		return "if expression"
+	case *TryExpression:
+		return "try expression"
+	case *FunctionLiteral:
+		return "function literal"
+	case *MacroLiteral:
+		return "macro literal"
+	case *CallExpression:
+		return "call expression"
+	case *ArrayLiteral:
+		return "array literal"
+	case *IndexExpression:
+		return "index expression"
+	case *SliceExpression:
+		return "slice expression"
+	case *HashLiteral:
+		return "hash literal"
+	case *TupleLiteral:
+		return "tuple"
+	case *SpreadExpression:
+		return "spread expression"
+	case *QuoteExpression:
+		return "quote expression"
+	case *UnquoteExpression:
+		return "unquote expression"
+	case *CommentGroup:
+		return "comment group"
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+// isMissing reports whether n is nil, or a nil pointer stored in an
+// interface.
+func isMissing(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// safePos returns the position of n. The positions of malformed nodes may
+// depend on missing children, so a failure yields the zero position.
+func safePos(n Node) (pos token.Position) {
+	defer func() {
+		if recover() != nil {
+			pos = token.Position{}
+		}
+	}()
+	return n.Pos()
+}
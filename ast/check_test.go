@@ -0,0 +1,135 @@
+package ast_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/ast/build"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+func TestCheckWellFormed(t *testing.T) {
+	program := parse(t, `let a, b = f(xs...);
+		const c = fn(x, rest...) { "${x}" };
+		if ((a < b)) { return [a, {"k": b}][0], -b; } else { { import "m"; c } }
+		let m = macro(q) { quote(unquote(q) + 1) };`)
+
+	if errs := ast.Check(program); errs != nil {
+		t.Errorf("Check reported errors for a parsed program: %v", errs)
+	}
+}
+
+func TestCheckMalformed(t *testing.T) {
+	var nilIdent *ast.Identifier
+
+	tests := []struct {
+		node     ast.Node
+		expected []string
+	}{
+		{
+			build.Program(build.Let("x", nil), nil),
+			[]string{"-: program has a nil statement at index 1", "-: let statement has no value"},
+		},
+		{
+			build.Expr(build.If(build.Ident(""), nil, nil)),
+			[]string{"-: if expression has no consequence", "-: identifier has an empty name"},
+		},
+		{
+			build.Expr(&ast.AssignExpression{Value: build.Int(1)}),
+			[]string{"-: assignment has no name"},
+		},
+		{
+			&ast.ForStatement{Variable: build.Ident("in"), Iterable: build.Ident("xs")},
+			[]string{"-: for statement has no body", `-: identifier "in" is a keyword`},
+		},
+		{
+			&ast.TryExpression{Body: build.Block(), Param: build.Ident("if")},
+			[]string{"-: try expression has no handler", `-: identifier "if" is a keyword`},
+		},
+		{
+			build.Fn([]string{"a"}, build.Return(build.Infix(nilIdent, "**", build.Int(1)))),
+			[]string{`-: unknown infix operator "**"`, "-: infix expression has no left operand"},
+		},
+		{
+			build.Let("s", build.Spread(build.Array(build.Spread(build.Ident("xs"))))),
+			[]string{"-: spread outside of an argument or element list"},
+		},
+		{
+			build.Array(build.Float(-1.5), build.Float(math.Inf(1))),
+			[]string{"-: float literal -1.5 is negative", "-: float literal +Inf is not a number"},
+		},
+		{
+			build.Hash(build.Pair(build.Str("k"), nil), nil),
+			[]string{"-: hash literal has no value at index 0", "-: hash literal has a nil pair at index 1"},
+		},
+		{
+			&ast.ReturnStatement{ReturnValue: &ast.TupleLiteral{Elements: []ast.Expression{build.Int(1)}}},
+			[]string{"-: tuple has 1 elements"},
+		},
+		{
+			build.Let("t", build.Tuple(build.Int(1), build.Int(2))),
+			[]string{"-: tuple outside of a return statement"},
+		},
+		{
+			build.Let("if", build.Call(build.Ident("x1"), build.Int(-1))),
+			[]string{
+				`-: identifier "if" is a keyword`,
+				`-: identifier "x1" is not a valid name`,
+				"-: integer literal -1 is negative",
+			},
+		},
+		{
+			build.Expr(build.Array(build.Str(`say "hi"`), build.Interpolated([]string{"${", ""}, build.Ident("x")))),
+			[]string{"-: string contains a double quote", "-: string contains an interpolation opener"},
+		},
+		{
+			build.Expr(build.BlockExpr()),
+			[]string{"-: block expression is empty"},
+		},
+		{
+			&ast.LetStatement{Name: build.Ident("a"), Names: []*ast.Identifier{build.Ident("b"), nil}, Value: build.Int(1)},
+			[]string{
+				"-: let statement has a nil name at index 1",
+				"-: let statement Name is not Names[0]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		errs := ast.Check(tt.node)
+		if len(errs) != len(tt.expected) {
+			t.Errorf("Check(%q) returned %d errors, want %d: %v", tt.node, len(errs), len(tt.expected), errs)
+			continue
+		}
+		for i, err := range errs {
+			if err.Error() != tt.expected[i] {
+				t.Errorf("Check(%q) error %d wrong. want=%q, got=%q", tt.node, i, tt.expected[i], err)
+			}
+		}
+	}
+}
+
+func TestCheckPartialTree(t *testing.T) {
+	p := parser.New(lexer.New("let x = 1;\nif (x) { y + }"))
+	program := p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+
+	errs := ast.Check(program)
+	if len(errs) != 1 {
+		t.Fatalf("Check returned %d errors, want 1: %v", len(errs), errs)
+	}
+	checkErr := errs[0].(*ast.CheckError)
+	if checkErr.Msg != "infix expression has no right operand" || checkErr.Pos.String() != "2:10" {
+		t.Errorf("error wrong. got=%q", checkErr)
+	}
+}
+
+func TestCheckNil(t *testing.T) {
+	if errs := ast.Check(nil); len(errs) != 1 {
+		t.Errorf("Check(nil) returned %v", errs)
+	}
+}
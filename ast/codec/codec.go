@@ -0,0 +1,873 @@
+// Package codec implements a compact binary encoding of parsed programs, so
+// that embedders can cache them and skip lexing and parsing on warm starts.
+//
+// The encoding preserves everything the parser records: token types,
+// literals and positions, the distinction between nil and empty lists, and
+// the program's CommentMap. It is versioned; data written by an
+// incompatible version of this package is rejected with an error wrapping
+// ErrVersion, so a stale cache can simply be discarded. Keying cache entries
+// by the script's source remains up to the caller.
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/token"
+)
+
+// Version is the version of the encoding written by Encode. It changes
+// whenever the encoding does, including when node types are added.
+const Version = 6
+
+// ErrVersion is wrapped by the errors Decode returns for data written with a
+// different Version.
+var ErrVersion = errors.New("codec: unsupported encoding version")
+
+// magic starts every encoded program.
+const magic = "MAST"
+
+// maxLen bounds the lengths of strings and lists read by Decode, so that
+// corrupt data can't make it allocate arbitrary amounts of memory.
+const maxLen = 1 << 24
+
+// Node tags. They are part of the format: append new ones and bump Version
+// rather than renumbering.
+const (
+	tagNil = iota
+	tagProgram
+	tagLet
+	tagConst
+	tagReturn
+	tagImport
+	tagExpressionStatement
+	tagBlock
+	tagBlockExpression
+	tagIdentifier
+	tagInteger
+	tagString
+	tagInterpolated
+	tagBoolean
+	tagPrefix
+	tagInfix
+	tagParen
+	tagIf
+	tagFunction
+	tagMacro
+	tagCall
+	tagArray
+	tagIndex
+	tagHash
+	tagTuple
+	tagSpread
+	tagQuote
+	tagUnquote
+	tagFloat
+	tagTry
+	tagWhile
+	tagFor
+	tagBreak
+	tagContinue
+	tagAssign
+	tagSlice
+)
+
+// codecError carries errors out of the recursive encoder and decoder.
+type codecError struct{ err error }
+
+func catch(err *error) {
+	if r := recover(); r != nil {
+		ce, ok := r.(codecError)
+		if !ok {
+			panic(r)
+		}
+		*err = ce.err
+	}
+}
+
+// Encode writes the binary encoding of program to w.
+func Encode(w io.Writer, program *ast.Program) (err error) {
+	defer catch(&err)
+
+	e := &encoder{
+		w:       bufio.NewWriter(w),
+		strings: make(map[string]int),
+		nodes:   make(map[ast.Node]int),
+	}
+	e.w.WriteString(magic)
+	e.uint(Version)
+	e.node(program)
+	e.comments(program.Comments)
+	return e.w.Flush()
+}
+
+type encoder struct {
+	w       *bufio.Writer
+	strings map[string]int   // Index of each string written so far.
+	nodes   map[ast.Node]int // Pre-order index of each node written so far.
+}
+
+func (e *encoder) uint(x uint64) {
+	var buf [10]byte
+	e.w.Write(buf[:binary.PutUvarint(buf[:], x)])
+}
+
+func (e *encoder) int(x int64) {
+	// Zig-zag encoding, as in encoding/binary.
+	e.uint(uint64(x<<1) ^ uint64(x>>63))
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.w.WriteByte(1)
+	} else {
+		e.w.WriteByte(0)
+	}
+}
+
+// string writes s once; repetitions refer back to the first occurrence.
+func (e *encoder) string(s string) {
+	if i, ok := e.strings[s]; ok {
+		e.uint(uint64(i) + 1)
+		return
+	}
+	e.strings[s] = len(e.strings)
+	e.uint(0)
+	e.uint(uint64(len(s)))
+	e.w.WriteString(s)
+}
+
+func (e *encoder) token(t token.Token) {
+	e.string(string(t.Type))
+	e.string(t.Literal)
+	e.string(t.Pos.Filename)
+	e.int(int64(t.Pos.Line))
+	e.int(int64(t.Pos.Column))
+}
+
+// length writes the length of a list, distinguishing nil from empty ones.
+func (e *encoder) length(n int, isNil bool) {
+	if isNil {
+		e.uint(0)
+	} else {
+		e.uint(uint64(n) + 1)
+	}
+}
+
+func encodeList[T ast.Node](e *encoder, list []T) {
+	e.length(len(list), list == nil)
+	for _, n := range list {
+		e.node(n)
+	}
+}
+
+func (e *encoder) tag(tag int, n ast.Node) {
+	e.uint(uint64(tag))
+	e.nodes[n] = len(e.nodes)
+}
+
+func (e *encoder) node(node ast.Node) {
+	if isNil(node) {
+		e.uint(tagNil)
+		return
+	}
+
+	switch n := node.(type) {
+	case *ast.Program:
+		e.tag(tagProgram, n)
+		encodeList(e, n.Statements)
+
+	case *ast.LetStatement:
+		e.tag(tagLet, n)
+		e.token(n.Token)
+		encodeList(e, n.Names)
+		if n.Names == nil {
+			e.node(n.Name)
+		}
+		e.node(n.Value)
+
+	case *ast.ConstStatement:
+		e.tag(tagConst, n)
+		e.token(n.Token)
+		e.node(n.Name)
+		e.node(n.Value)
+
+	case *ast.ReturnStatement:
+		e.tag(tagReturn, n)
+		e.token(n.Token)
+		e.node(n.ReturnValue)
+
+	case *ast.WhileStatement:
+		e.tag(tagWhile, n)
+		e.token(n.Token)
+		e.node(n.Condition)
+		e.node(n.Body)
+
+	case *ast.ForStatement:
+		e.tag(tagFor, n)
+		e.token(n.Token)
+		e.node(n.Variable)
+		e.node(n.Iterable)
+		e.node(n.Body)
+
+	case *ast.BreakStatement:
+		e.tag(tagBreak, n)
+		e.token(n.Token)
+
+	case *ast.ContinueStatement:
+		e.tag(tagContinue, n)
+		e.token(n.Token)
+
+	case *ast.ImportStatement:
+		e.tag(tagImport, n)
+		e.token(n.Token)
+		e.node(n.Path)
+
+	case *ast.ExpressionStatement:
+		e.tag(tagExpressionStatement, n)
+		e.token(n.Token)
+		e.node(n.Expression)
+
+	case *ast.BlockStatement:
+		e.tag(tagBlock, n)
+		e.token(n.Token)
+		encodeList(e, n.Statements)
+		e.token(n.Rbrace)
+
+	case *ast.BlockExpression:
+		e.tag(tagBlockExpression, n)
+		e.token(n.Token)
+		e.node(n.Block)
+
+	case *ast.Identifier:
+		e.tag(tagIdentifier, n)
+		e.token(n.Token)
+		e.string(n.Value)
+
+	case *ast.IntegerLiteral:
+		e.tag(tagInteger, n)
+		e.token(n.Token)
+		e.int(n.Value)
+
+	case *ast.FloatLiteral:
+		e.tag(tagFloat, n)
+		e.token(n.Token)
+		e.uint(math.Float64bits(n.Value))
+
+	case *ast.StringLiteral:
+		e.tag(tagString, n)
+		e.token(n.Token)
+		e.string(n.Value)
+
+	case *ast.InterpolatedString:
+		e.tag(tagInterpolated, n)
+		e.token(n.Token)
+		e.length(len(n.Strings), n.Strings == nil)
+		for _, s := range n.Strings {
+			e.string(s)
+		}
+		encodeList(e, n.Exprs)
+		e.token(n.Close)
+
+	case *ast.Boolean:
+		e.tag(tagBoolean, n)
+		e.token(n.Token)
+		e.bool(n.Value)
+
+	case *ast.PrefixExpression:
+		e.tag(tagPrefix, n)
+		e.token(n.Token)
+		e.string(n.Operator)
+		e.node(n.Right)
+
+	case *ast.InfixExpression:
+		e.tag(tagInfix, n)
+		e.token(n.Token)
+		e.node(n.Left)
+		e.string(n.Operator)
+		e.node(n.Right)
+
+	case *ast.AssignExpression:
+		e.tag(tagAssign, n)
+		e.token(n.Token)
+		e.node(n.Name)
+		e.node(n.Value)
+
+	case *ast.ParenExpression:
+		e.tag(tagParen, n)
+		e.token(n.Token)
+		e.node(n.Expression)
+		e.token(n.Rparen)
+
+	case *ast.IfExpression:
+		e.tag(tagIf, n)
+		e.token(n.Token)
+		e.node(n.Condition)
+		e.node(n.Consequence)
+		e.node(n.Alternative)
+
+	case *ast.TryExpression:
+		e.tag(tagTry, n)
+		e.token(n.Token)
+		e.node(n.Body)
+		e.node(n.Param)
+		e.node(n.Handler)
+
+	case *ast.FunctionLiteral:
+		e.tag(tagFunction, n)
+		e.token(n.Token)
+		encodeList(e, n.Parameters)
+		e.node(n.Body)
+		e.bool(n.Variadic)
+
+	case *ast.MacroLiteral:
+		e.tag(tagMacro, n)
+		e.token(n.Token)
+		encodeList(e, n.Parameters)
+		e.node(n.Body)
+
+	case *ast.CallExpression:
+		e.tag(tagCall, n)
+		e.token(n.Token)
+		e.node(n.Function)
+		encodeList(e, n.Arguments)
+		e.token(n.Rparen)
+
+	case *ast.ArrayLiteral:
+		e.tag(tagArray, n)
+		e.token(n.Token)
+		encodeList(e, n.Elements)
+		e.token(n.Rbracket)
+
+	case *ast.IndexExpression:
+		e.tag(tagIndex, n)
+		e.token(n.Token)
+		e.node(n.Left)
+		e.node(n.Index)
+		e.token(n.Rbracket)
+
+	case *ast.SliceExpression:
+		e.tag(tagSlice, n)
+		e.token(n.Token)
+		e.node(n.Left)
+		e.node(n.Low)
+		e.node(n.High)
+		e.token(n.Rbracket)
+
+	case *ast.HashLiteral:
+		e.tag(tagHash, n)
+		e.token(n.Token)
+		e.length(len(n.Pairs), n.Pairs == nil)
+		for _, pair := range n.Pairs {
+			e.node(pair.Key)
+			e.node(pair.Value)
+		}
+		e.token(n.Rbrace)
+
+	case *ast.TupleLiteral:
+		e.tag(tagTuple, n)
+		e.token(n.Token)
+		encodeList(e, n.Elements)
+
+	case *ast.SpreadExpression:
+		e.tag(tagSpread, n)
+		e.token(n.Token)
+		e.node(n.Value)
+
+	case *ast.QuoteExpression:
+		e.tag(tagQuote, n)
+		e.token(n.Token)
+		e.node(n.Node)
+		e.token(n.Rparen)
+
+	case *ast.UnquoteExpression:
+		e.tag(tagUnquote, n)
+		e.token(n.Token)
+		e.node(n.Node)
+		e.token(n.Rparen)
+
+	default:
+		panic(codecError{fmt.Errorf("codec: unsupported node type %T", node)})
+	}
+}
+
+// comments writes cmap, referring to nodes by their pre-order index.
+func (e *encoder) comments(cmap ast.CommentMap) {
+	e.length(len(cmap), cmap == nil)
+	for node, groups := range cmap {
+		i, ok := e.nodes[node]
+		if !ok {
+			panic(codecError{fmt.Errorf("codec: comments attached to %T outside of the program", node)})
+		}
+		e.uint(uint64(i))
+		e.uint(uint64(len(groups)))
+		for _, g := range groups {
+			e.uint(uint64(len(g.List)))
+			for _, c := range g.List {
+				e.token(c.Token)
+			}
+		}
+	}
+}
+
+// Decode reads a program written by Encode.
+func Decode(r io.Reader) (program *ast.Program, err error) {
+	defer catch(&err)
+
+	d := &decoder{r: bufio.NewReader(r)}
+
+	header := make([]byte, len(magic))
+	d.read(header)
+	if string(header) != magic {
+		return nil, errors.New("codec: not an encoded program")
+	}
+	if v := d.uint(); v != Version {
+		return nil, fmt.Errorf("%w %d, want %d", ErrVersion, v, Version)
+	}
+
+	program, ok := d.node().(*ast.Program)
+	if !ok {
+		d.fail("expected a program")
+	}
+	program.Comments = d.comments()
+	return program, nil
+}
+
+type decoder struct {
+	r       *bufio.Reader
+	strings []string
+	nodes   []ast.Node // In pre-order, as numbered by the encoder.
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	panic(codecError{fmt.Errorf("codec: "+format, a...)})
+}
+
+func (d *decoder) read(buf []byte) {
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		panic(codecError{err})
+	}
+}
+
+func (d *decoder) uint() uint64 {
+	x, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		panic(codecError{err})
+	}
+	return x
+}
+
+func (d *decoder) int() int64 {
+	u := d.uint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (d *decoder) bool() bool {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		panic(codecError{io.ErrUnexpectedEOF})
+	}
+	return b != 0
+}
+
+// count reads a length that is bounded by maxLen.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > maxLen {
+		d.fail("length %d out of range", n)
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	i := d.count()
+	if i > 0 {
+		if i > len(d.strings) {
+			d.fail("string reference %d out of range", i)
+		}
+		return d.strings[i-1]
+	}
+
+	buf := make([]byte, d.count())
+	d.read(buf)
+	s := string(buf)
+	d.strings = append(d.strings, s)
+	return s
+}
+
+func (d *decoder) token() token.Token {
+	return token.Token{
+		Type:    token.TokenType(d.string()),
+		Literal: d.string(),
+		Pos: token.Position{
+			Filename: d.string(),
+			Line:     int(d.int()),
+			Column:   int(d.int()),
+		},
+	}
+}
+
+// length reads the length of a list written by encoder.length, reporting
+// whether the list is nil.
+func (d *decoder) length() (int, bool) {
+	n := d.count()
+	if n == 0 {
+		return 0, true
+	}
+	return n - 1, false
+}
+
+func decodeList[T ast.Node](d *decoder) []T {
+	n, isNil := d.length()
+	if isNil {
+		return nil
+	}
+	list := []T{}
+	for i := 0; i < n; i++ {
+		list = append(list, decodeAs[T](d))
+	}
+	return list
+}
+
+// decodeAs decodes a node that must be a T, or nil.
+func decodeAs[T ast.Node](d *decoder) T {
+	var zero T
+	n := d.node()
+	if n == nil {
+		return zero
+	}
+	t, ok := n.(T)
+	if !ok {
+		d.fail("unexpected %T in place of %T", n, zero)
+	}
+	return t
+}
+
+func (d *decoder) expr() ast.Expression { return decodeAs[ast.Expression](d) }
+
+func (d *decoder) ident() *ast.Identifier { return decodeAs[*ast.Identifier](d) }
+
+func (d *decoder) block() *ast.BlockStatement { return decodeAs[*ast.BlockStatement](d) }
+
+// register numbers n like the encoder did.
+func (d *decoder) register(n ast.Node) {
+	d.nodes = append(d.nodes, n)
+}
+
+func (d *decoder) node() ast.Node {
+	switch tag := d.uint(); tag {
+	case tagNil:
+		return nil
+
+	case tagProgram:
+		n := &ast.Program{}
+		d.register(n)
+		n.Statements = decodeList[ast.Statement](d)
+		return n
+
+	case tagLet:
+		n := &ast.LetStatement{Token: d.token()}
+		d.register(n)
+		n.Names = decodeList[*ast.Identifier](d)
+		if n.Names == nil {
+			n.Name = d.ident()
+		} else if len(n.Names) > 0 {
+			n.Name = n.Names[0]
+		}
+		n.Value = d.expr()
+		return n
+
+	case tagConst:
+		n := &ast.ConstStatement{Token: d.token()}
+		d.register(n)
+		n.Name = d.ident()
+		n.Value = d.expr()
+		return n
+
+	case tagReturn:
+		n := &ast.ReturnStatement{Token: d.token()}
+		d.register(n)
+		n.ReturnValue = d.expr()
+		return n
+
+	case tagImport:
+		n := &ast.ImportStatement{Token: d.token()}
+		d.register(n)
+		n.Path = decodeAs[*ast.StringLiteral](d)
+		return n
+
+	case tagExpressionStatement:
+		n := &ast.ExpressionStatement{Token: d.token()}
+		d.register(n)
+		n.Expression = d.expr()
+		return n
+
+	case tagBlock:
+		n := &ast.BlockStatement{Token: d.token()}
+		d.register(n)
+		n.Statements = decodeList[ast.Statement](d)
+		n.Rbrace = d.token()
+		return n
+
+	case tagBlockExpression:
+		n := &ast.BlockExpression{Token: d.token()}
+		d.register(n)
+		n.Block = d.block()
+		return n
+
+	case tagIdentifier:
+		n := &ast.Identifier{Token: d.token()}
+		d.register(n)
+		n.Value = d.string()
+		return n
+
+	case tagInteger:
+		n := &ast.IntegerLiteral{Token: d.token()}
+		d.register(n)
+		n.Value = d.int()
+		return n
+
+	case tagFloat:
+		n := &ast.FloatLiteral{Token: d.token()}
+		d.register(n)
+		n.Value = math.Float64frombits(d.uint())
+		return n
+
+	case tagString:
+		n := &ast.StringLiteral{Token: d.token()}
+		d.register(n)
+		n.Value = d.string()
+		return n
+
+	case tagInterpolated:
+		n := &ast.InterpolatedString{Token: d.token()}
+		d.register(n)
+		if count, isNil := d.length(); !isNil {
+			n.Strings = []string{}
+			for i := 0; i < count; i++ {
+				n.Strings = append(n.Strings, d.string())
+			}
+		}
+		n.Exprs = decodeList[ast.Expression](d)
+		n.Close = d.token()
+		return n
+
+	case tagBoolean:
+		n := &ast.Boolean{Token: d.token()}
+		d.register(n)
+		n.Value = d.bool()
+		return n
+
+	case tagPrefix:
+		n := &ast.PrefixExpression{Token: d.token()}
+		d.register(n)
+		n.Operator = d.string()
+		n.Right = d.expr()
+		return n
+
+	case tagInfix:
+		n := &ast.InfixExpression{Token: d.token()}
+		d.register(n)
+		n.Left = d.expr()
+		n.Operator = d.string()
+		n.Right = d.expr()
+		return n
+
+	case tagAssign:
+		n := &ast.AssignExpression{Token: d.token()}
+		d.register(n)
+		n.Name = d.ident()
+		n.Value = d.expr()
+		return n
+
+	case tagParen:
+		n := &ast.ParenExpression{Token: d.token()}
+		d.register(n)
+		n.Expression = d.expr()
+		n.Rparen = d.token()
+		return n
+
+	case tagIf:
+		n := &ast.IfExpression{Token: d.token()}
+		d.register(n)
+		n.Condition = d.expr()
+		n.Consequence = d.block()
+		n.Alternative = d.block()
+		return n
+
+	case tagWhile:
+		n := &ast.WhileStatement{Token: d.token()}
+		d.register(n)
+		n.Condition = d.expr()
+		n.Body = d.block()
+		return n
+
+	case tagFor:
+		n := &ast.ForStatement{Token: d.token()}
+		d.register(n)
+		n.Variable = d.ident()
+		n.Iterable = d.expr()
+		n.Body = d.block()
+		return n
+
+	case tagBreak:
+		n := &ast.BreakStatement{Token: d.token()}
+		d.register(n)
+		return n
+
+	case tagContinue:
+		n := &ast.ContinueStatement{Token: d.token()}
+		d.register(n)
+		return n
+
+	case tagTry:
+		n := &ast.TryExpression{Token: d.token()}
+		d.register(n)
+		n.Body = d.block()
+		n.Param = d.ident()
+		n.Handler = d.block()
+		return n
+
+	case tagFunction:
+		n := &ast.FunctionLiteral{Token: d.token()}
+		d.register(n)
+		n.Parameters = decodeList[*ast.Identifier](d)
+		n.Body = d.block()
+		n.Variadic = d.bool()
+		return n
+
+	case tagMacro:
+		n := &ast.MacroLiteral{Token: d.token()}
+		d.register(n)
+		n.Parameters = decodeList[*ast.Identifier](d)
+		n.Body = d.block()
+		return n
+
+	case tagCall:
+		n := &ast.CallExpression{Token: d.token()}
+		d.register(n)
+		n.Function = d.expr()
+		n.Arguments = decodeList[ast.Expression](d)
+		n.Rparen = d.token()
+		return n
+
+	case tagArray:
+		n := &ast.ArrayLiteral{Token: d.token()}
+		d.register(n)
+		n.Elements = decodeList[ast.Expression](d)
+		n.Rbracket = d.token()
+		return n
+
+	case tagIndex:
+		n := &ast.IndexExpression{Token: d.token()}
+		d.register(n)
+		n.Left = d.expr()
+		n.Index = d.expr()
+		n.Rbracket = d.token()
+		return n
+
+	case tagSlice:
+		n := &ast.SliceExpression{Token: d.token()}
+		d.register(n)
+		n.Left = d.expr()
+		n.Low = d.expr()
+		n.High = d.expr()
+		n.Rbracket = d.token()
+		return n
+
+	case tagHash:
+		n := &ast.HashLiteral{Token: d.token()}
+		d.register(n)
+		if count, isNil := d.length(); !isNil {
+			n.Pairs = []*ast.HashPair{}
+			for i := 0; i < count; i++ {
+				n.Pairs = append(n.Pairs, &ast.HashPair{Key: d.expr(), Value: d.expr()})
+			}
+		}
+		n.Rbrace = d.token()
+		return n
+
+	case tagTuple:
+		n := &ast.TupleLiteral{Token: d.token()}
+		d.register(n)
+		n.Elements = decodeList[ast.Expression](d)
+		return n
+
+	case tagSpread:
+		n := &ast.SpreadExpression{Token: d.token()}
+		d.register(n)
+		n.Value = d.expr()
+		return n
+
+	case tagQuote:
+		n := &ast.QuoteExpression{Token: d.token()}
+		d.register(n)
+		n.Node = d.expr()
+		n.Rparen = d.token()
+		return n
+
+	case tagUnquote:
+		n := &ast.UnquoteExpression{Token: d.token()}
+		d.register(n)
+		n.Node = d.expr()
+		n.Rparen = d.token()
+		return n
+
+	default:
+		d.fail("unknown node tag %d", tag)
+		return nil
+	}
+}
+
+func (d *decoder) comments() ast.CommentMap {
+	n, isNil := d.length()
+	if isNil {
+		return nil
+	}
+
+	cmap := ast.CommentMap{}
+	for i := 0; i < n; i++ {
+		index := d.count()
+		if index >= len(d.nodes) {
+			d.fail("comments attached to unknown node %d", index)
+		}
+		node := d.nodes[index]
+
+		groups := d.count()
+		for j := 0; j < groups; j++ {
+			g := &ast.CommentGroup{}
+			comments := d.count()
+			for k := 0; k < comments; k++ {
+				g.List = append(g.List, &ast.Comment{Token: d.token()})
+			}
+			cmap[node] = append(cmap[node], g)
+		}
+	}
+	return cmap
+}
+
+// isNil reports whether n is nil or a nil pointer.
+func isNil(n ast.Node) bool {
+	switch n := n.(type) {
+	case nil:
+		return true
+	case *ast.Identifier:
+		return n == nil
+	case *ast.StringLiteral:
+		return n == nil
+	case *ast.BlockStatement:
+		return n == nil
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package codec_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/ast/codec"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+const source = `// Compute things.
+import "math";
+let a, b = g(-2); // trailing
+const c = (a + b) * 3.25;
+let f = fn(x, rest...) {
+	// leading
+	if (x > c) { return x, "big" } else { { x } }
+	// dangling
+};
+let h = {"k": [f(a, rest...), f[0], f[1:], f[:a]], true: "s${a}t${b}u"};
+let m = macro(q) { quote(unquote(q) + 1) };
+try { f(1) } catch (err) { err["message"] }
+while (a < 10) { if (a == 5) { break; } continue; }
+for (x in h) { a = b = f(x); }
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.NewFile("script.monkey", input, lexer.ScanComments))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func encode(t *testing.T, program *ast.Program) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, program); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	program := parse(t, source)
+
+	decoded, err := codec.Decode(bytes.NewReader(encode(t, program)))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if !ast.Equal(program, decoded) {
+		t.Errorf("decoded program differs.\nwant=%s\ngot=%s", program, decoded)
+	}
+	// Tokens, positions and nil-ness of lists are kept too.
+	if !reflect.DeepEqual(program.Statements, decoded.Statements) {
+		t.Errorf("decoded statements are not deeply equal")
+	}
+	if errs := ast.Check(decoded); len(errs) > 0 {
+		t.Errorf("decoded program is malformed: %v", errs)
+	}
+
+	want, got := program.Comments.Comments(), decoded.Comments.Comments()
+	if len(want) != len(got) {
+		t.Fatalf("wrong number of comment groups. want=%d, got=%d", len(want), len(got))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(want[i], got[i]) {
+			t.Errorf("comment group %d wrong. want=%q, got=%q", i, want[i].Text(), got[i].Text())
+		}
+	}
+	// Comments stay attached to the corresponding nodes.
+	for node, groups := range decoded.Comments {
+		if decoded.Comments.Filter(node) == nil || len(groups) == 0 {
+			t.Errorf("comments attached to %T outside of the decoded tree", node)
+		}
+	}
+	let := decoded.Statements[1].(*ast.LetStatement)
+	if let.Name != let.Names[0] {
+		t.Errorf("let.Name is not let.Names[0]")
+	}
+	if len(decoded.Comments[let]) != 1 {
+		t.Errorf("trailing comment not attached to %q", let)
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	program := parse(t, "")
+
+	decoded, err := codec.Decode(bytes.NewReader(encode(t, program)))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if decoded.Statements == nil || len(decoded.Statements) != 0 {
+		t.Errorf("wrong statements. got=%#v", decoded.Statements)
+	}
+}
+
+func TestDecodeVersion(t *testing.T) {
+	data := encode(t, parse(t, "1"))
+	data[4] = codec.Version + 1 // The version follows the 4-byte magic.
+
+	_, err := codec.Decode(bytes.NewReader(data))
+	if !errors.Is(err, codec.ErrVersion) {
+		t.Errorf("expected ErrVersion. got=%v", err)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	data := encode(t, parse(t, source))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("JUNK"), data[4:]...)},
+		{"truncated", data[:len(data)/2]},
+		{"bad tag", append(append([]byte(nil), data[:5]...), 0x7f)},
+	}
+
+	for _, tt := range tests {
+		_, err := codec.Decode(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+		if errors.Is(err, codec.ErrVersion) {
+			t.Errorf("%s: unexpected ErrVersion", tt.name)
+		}
+	}
+
+	// Every prefix of valid data is rejected rather than misread.
+	for i := 0; i < len(data); i++ {
+		_, err := codec.Decode(bytes.NewReader(data[:i]))
+		if err == nil {
+			t.Fatalf("prefix of length %d decoded without error", i)
+		}
+		if i > 5 && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("prefix of length %d: expected io.ErrUnexpectedEOF. got=%v", i, err)
+		}
+	}
+}
+
+func TestEncodeUnsupported(t *testing.T) {
+	program := parse(t, "1")
+	program.Comments = ast.CommentMap{parse(t, "2"): nil}
+
+	if err := codec.Encode(io.Discard, program); err == nil {
+		t.Errorf("expected an error for comments outside the program")
+	}
+}
@@ -0,0 +1,104 @@
+package ast
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/j4nu5/monkey/token"
+)
+
+// A Comment is a single `//` comment, running to the end of its line.
+type Comment struct {
+	Token token.Token // token.COMMENT
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) Pos() token.Position  { return c.Token.Pos }
+func (c *Comment) End() token.Position  { return c.Token.End() }
+func (c *Comment) String() string       { return c.Token.Literal }
+
+// A CommentGroup is a run of comments on consecutive lines, with no other
+// tokens or blank lines between them.
+type CommentGroup struct {
+	List []*Comment // len(List) > 0
+}
+
+func (g *CommentGroup) TokenLiteral() string { return g.List[0].TokenLiteral() }
+func (g *CommentGroup) Pos() token.Position  { return g.List[0].Pos() }
+func (g *CommentGroup) End() token.Position  { return g.List[len(g.List)-1].End() }
+
+func (g *CommentGroup) String() string {
+	lines := []string{}
+	for _, c := range g.List {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Text returns the comment text with the `//` markers and surrounding
+// whitespace removed, one line per comment.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+
+	lines := []string{}
+	for _, c := range g.List {
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(c.Token.Literal, "//")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// A CommentMap maps nodes to the comment groups associated with them, in
+// source order. The parser associates a comment group with
+//
+//   - the outermost node starting at the next token, if the group precedes
+//     it, as with a comment on the line before a statement;
+//   - the statement ending on the same line, for a comment following it;
+//   - the enclosing *BlockStatement or *Program, for the groups after the
+//     last statement of a block or program.
+type CommentMap map[Node][]*CommentGroup
+
+// Comments returns all comment groups in the map, sorted by position.
+func (cmap CommentMap) Comments() []*CommentGroup {
+	groups := []*CommentGroup{}
+	for _, list := range cmap {
+		groups = append(groups, list...)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return before(groups[i].Pos(), groups[j].Pos())
+	})
+	return groups
+}
+
+// Filter returns a new comment map consisting of the entries of cmap for
+// node and the nodes within it.
+func (cmap CommentMap) Filter(node Node) CommentMap {
+	filtered := CommentMap{}
+	Inspect(node, func(n Node) bool {
+		if groups, ok := cmap[n]; ok {
+			filtered[n] = groups
+		}
+		return true
+	})
+	return filtered
+}
+
+// Update replaces old with new in the map: the comments associated with old
+// are associated with new instead. It returns new, so that it can wrap the
+// transformation of a node, e.g. `cmap.Update(n, rewrite(n))`.
+func (cmap CommentMap) Update(old, new Node) Node {
+	if groups, ok := cmap[old]; ok && old != new {
+		delete(cmap, old)
+		cmap[new] = append(cmap[new], groups...)
+	}
+	return new
+}
+
+// before reports whether a is before b in the same file.
+func before(a, b token.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
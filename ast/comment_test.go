@@ -0,0 +1,59 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+	"github.com/j4nu5/monkey/token"
+)
+
+func TestCommentMapUpdate(t *testing.T) {
+	p := parser.New(lexer.NewWithMode("// doc\nlet x = 1;\n// more\nlet y = 2;", lexer.ScanComments))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+
+	cmap := program.Comments
+	old := program.Statements[0]
+	replacement := &ast.ExpressionStatement{Token: token.Token{Type: token.IDENT, Literal: "x"}}
+
+	if got := cmap.Update(old, replacement); got != replacement {
+		t.Errorf("Update returned %v, expected the new node", got)
+	}
+	if _, ok := cmap[old]; ok {
+		t.Errorf("comments still associated with the old node")
+	}
+	if groups := cmap[replacement]; len(groups) != 1 || groups[0].Text() != "doc" {
+		t.Errorf("comments not moved to the new node. got=%v", groups)
+	}
+
+	cmap.Update(program.Statements[1], replacement)
+	if groups := cmap[replacement]; len(groups) != 2 || groups[1].Text() != "more" {
+		t.Errorf("comments not merged into the new node's. got=%v", groups)
+	}
+}
+
+func TestWalkCommentGroup(t *testing.T) {
+	group := &ast.CommentGroup{List: []*ast.Comment{
+		{Token: token.Token{Type: token.COMMENT, Literal: "// a"}},
+		{Token: token.Token{Type: token.COMMENT, Literal: "//b"}},
+	}}
+
+	var visited []string
+	ast.Inspect(group, func(n ast.Node) bool {
+		if n != nil {
+			visited = append(visited, nodeLabel(n))
+		}
+		return true
+	})
+
+	if len(visited) != 3 || visited[1] != "Comment" {
+		t.Errorf("visited wrong nodes. got=%q", visited)
+	}
+	if group.Text() != "a\nb" {
+		t.Errorf("group.Text() wrong. got=%q", group.Text())
+	}
+}
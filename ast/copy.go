@@ -0,0 +1,53 @@
+package ast
+
+import "reflect"
+
+// Copy returns a deep copy of n, sharing no nodes with it, so that the copy
+// can be modified, e.g. with Apply, without affecting n. Tokens and
+// positions are copied along. The Comments of a Program are not, as they
+// refer to the original nodes: a copied Program has none.
+func Copy(n Node) Node {
+	if n == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(n)).Interface().(Node)
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			c.Field(i).Set(copyValue(v.Field(i)))
+		}
+		return c
+	case reflect.Map:
+		// Only a Program's CommentMap, which is dropped.
+		return reflect.Zero(v.Type())
+	default:
+		return v
+	}
+}
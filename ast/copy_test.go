@@ -0,0 +1,60 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+func TestCopy(t *testing.T) {
+	input := `let f = fn(x, rest...) { if (x) { [x, {"k": rest}] } else { quote(unquote(x) + 1) } };
+let a, b = fn() { return 1, 2.5; }();
+for (v in [a]) { try { f(v...) } catch (e) { break; } }
+// trailing
+import "lib/strings";`
+
+	p := parser.New(lexer.NewWithMode(input, lexer.ScanComments))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+	original := program.String()
+
+	c := ast.Copy(program).(*ast.Program)
+	if !ast.Equal(program, c) || c.String() != original {
+		t.Fatalf("copy differs from the original:\n%s\n%s", original, c.String())
+	}
+	if c.Comments != nil {
+		t.Errorf("comments copied")
+	}
+
+	// No node is shared.
+	nodes := make(map[ast.Node]bool)
+	ast.Inspect(program, func(n ast.Node) bool {
+		nodes[n] = true
+		return true
+	})
+	ast.Inspect(c, func(n ast.Node) bool {
+		if n != nil && nodes[n] {
+			t.Errorf("node %T %s shared with the original", n, n)
+		}
+		return true
+	})
+
+	// Modifying the copy leaves the original alone.
+	ast.Apply(c, func(cur *ast.Cursor) bool {
+		if ident, ok := cur.Node().(*ast.Identifier); ok && ident.Value == "x" {
+			ident.Value = "y"
+		}
+		return true
+	}, nil)
+	if program.String() != original {
+		t.Errorf("original modified through the copy. got=%s", program.String())
+	}
+
+	if ast.Copy(nil) != nil {
+		t.Errorf("Copy(nil) not nil")
+	}
+}
@@ -0,0 +1,320 @@
+package ast
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// EditOp is the kind of an Edit.
+type EditOp int
+
+const (
+	Insert  EditOp = iota // New is added.
+	Delete                // Old is removed.
+	Replace               // Old is replaced by New.
+)
+
+var editOpNames = [...]string{"insert", "delete", "replace"}
+
+func (op EditOp) String() string { return editOpNames[op] }
+
+// An Edit is a change turning part of one tree into part of another.
+type Edit struct {
+	Op EditOp
+
+	// Path locates the edit in the old tree as a sequence of field names
+	// and list indices relative to its root, e.g. "Statements[1].Value".
+	// For an Insert into a list, the index is the position in the old list
+	// before which New goes; equal to the list's length, it appends.
+	Path string
+
+	Old Node // The node in the old tree; nil for an Insert.
+	New Node // The node in the new tree; nil for a Delete.
+}
+
+func (e Edit) String() string {
+	switch e.Op {
+	case Insert:
+		return "insert " + e.Path + ": " + e.New.String()
+	case Delete:
+		return "delete " + e.Path + ": " + e.Old.String()
+	}
+	return "replace " + e.Path + ": " + e.Old.String() + " -> " + e.New.String()
+}
+
+// Diff returns an edit script turning the tree a into the tree b, in source
+// order, or nil if they are Equal. Nodes of the same type and with the same
+// values and operators are compared child by child, while any other
+// differing nodes are replaced as a whole. Statements, arguments, elements
+// and parameters are matched up so that additions and removals in lists are
+// reported as such, rather than as changes to every following element.
+// Hash literals with differing numbers of pairs are replaced as a whole.
+func Diff(a, b Node) []Edit {
+	d := &differ{}
+	d.node("", a, b)
+	return d.edits
+}
+
+type differ struct {
+	edits []Edit
+}
+
+func (d *differ) add(op EditOp, path string, a, b Node) {
+	d.edits = append(d.edits, Edit{Op: op, Path: path, Old: a, New: b})
+}
+
+func (d *differ) node(path string, a, b Node) {
+	switch {
+	case isMissing(a) && isMissing(b):
+		return
+	case isMissing(a):
+		d.add(Insert, path, nil, b)
+		return
+	case isMissing(b):
+		d.add(Delete, path, a, nil)
+		return
+	case Equal(a, b):
+		return
+	case !sameShape(a, b):
+		d.add(Replace, path, a, b)
+		return
+	}
+
+	switch a := a.(type) {
+	case *Program:
+		diffList(d, field(path, "Statements"), a.Statements, b.(*Program).Statements)
+
+	case *LetStatement:
+		b := b.(*LetStatement)
+		if len(a.Names) > 0 {
+			diffList(d, field(path, "Names"), a.Names, b.Names)
+		} else {
+			d.node(field(path, "Name"), a.Name, b.Name)
+		}
+		d.node(field(path, "Value"), a.Value, b.Value)
+
+	case *ConstStatement:
+		b := b.(*ConstStatement)
+		d.node(field(path, "Name"), a.Name, b.Name)
+		d.node(field(path, "Value"), a.Value, b.Value)
+
+	case *ReturnStatement:
+		d.node(field(path, "ReturnValue"), a.ReturnValue, b.(*ReturnStatement).ReturnValue)
+
+	case *WhileStatement:
+		b := b.(*WhileStatement)
+		d.node(field(path, "Condition"), a.Condition, b.Condition)
+		d.node(field(path, "Body"), a.Body, b.Body)
+
+	case *ForStatement:
+		b := b.(*ForStatement)
+		d.node(field(path, "Variable"), a.Variable, b.Variable)
+		d.node(field(path, "Iterable"), a.Iterable, b.Iterable)
+		d.node(field(path, "Body"), a.Body, b.Body)
+
+	case *ImportStatement:
+		d.node(field(path, "Path"), a.Path, b.(*ImportStatement).Path)
+
+	case *ExpressionStatement:
+		d.node(field(path, "Expression"), a.Expression, b.(*ExpressionStatement).Expression)
+
+	case *BlockStatement:
+		diffList(d, field(path, "Statements"), a.Statements, b.(*BlockStatement).Statements)
+
+	case *BlockExpression:
+		d.node(field(path, "Block"), a.Block, b.(*BlockExpression).Block)
+
+	case *InterpolatedString:
+		diffList(d, field(path, "Exprs"), a.Exprs, b.(*InterpolatedString).Exprs)
+
+	case *PrefixExpression:
+		d.node(field(path, "Right"), a.Right, b.(*PrefixExpression).Right)
+
+	case *InfixExpression:
+		b := b.(*InfixExpression)
+		d.node(field(path, "Left"), a.Left, b.Left)
+		d.node(field(path, "Right"), a.Right, b.Right)
+
+	case *AssignExpression:
+		b := b.(*AssignExpression)
+		d.node(field(path, "Name"), a.Name, b.Name)
+		d.node(field(path, "Value"), a.Value, b.Value)
+
+	case *ParenExpression:
+		d.node(field(path, "Expression"), a.Expression, b.(*ParenExpression).Expression)
+
+	case *IfExpression:
+		b := b.(*IfExpression)
+		d.node(field(path, "Condition"), a.Condition, b.Condition)
+		d.node(field(path, "Consequence"), a.Consequence, b.Consequence)
+		d.node(field(path, "Alternative"), a.Alternative, b.Alternative)
+
+	case *TryExpression:
+		b := b.(*TryExpression)
+		d.node(field(path, "Body"), a.Body, b.Body)
+		d.node(field(path, "Param"), a.Param, b.Param)
+		d.node(field(path, "Handler"), a.Handler, b.Handler)
+
+	case *FunctionLiteral:
+		b := b.(*FunctionLiteral)
+		diffList(d, field(path, "Parameters"), a.Parameters, b.Parameters)
+		d.node(field(path, "Body"), a.Body, b.Body)
+
+	case *MacroLiteral:
+		b := b.(*MacroLiteral)
+		diffList(d, field(path, "Parameters"), a.Parameters, b.Parameters)
+		d.node(field(path, "Body"), a.Body, b.Body)
+
+	case *CallExpression:
+		b := b.(*CallExpression)
+		d.node(field(path, "Function"), a.Function, b.Function)
+		diffList(d, field(path, "Arguments"), a.Arguments, b.Arguments)
+
+	case *ArrayLiteral:
+		diffList(d, field(path, "Elements"), a.Elements, b.(*ArrayLiteral).Elements)
+
+	case *IndexExpression:
+		b := b.(*IndexExpression)
+		d.node(field(path, "Left"), a.Left, b.Left)
+		d.node(field(path, "Index"), a.Index, b.Index)
+
+	case *SliceExpression:
+		b := b.(*SliceExpression)
+		d.node(field(path, "Left"), a.Left, b.Left)
+		d.node(field(path, "Low"), a.Low, b.Low)
+		d.node(field(path, "High"), a.High, b.High)
+
+	case *HashLiteral:
+		for i, pair := range a.Pairs {
+			other := b.(*HashLiteral).Pairs[i]
+			pairPath := index(field(path, "Pairs"), i)
+			d.node(field(pairPath, "Key"), pair.Key, other.Key)
+			d.node(field(pairPath, "Value"), pair.Value, other.Value)
+		}
+
+	case *TupleLiteral:
+		diffList(d, field(path, "Elements"), a.Elements, b.(*TupleLiteral).Elements)
+
+	case *SpreadExpression:
+		d.node(field(path, "Value"), a.Value, b.(*SpreadExpression).Value)
+
+	case *QuoteExpression:
+		d.node(field(path, "Node"), a.Node, b.(*QuoteExpression).Node)
+
+	case *UnquoteExpression:
+		d.node(field(path, "Node"), a.Node, b.(*UnquoteExpression).Node)
+
+	case *CommentGroup:
+		diffList(d, field(path, "List"), a.List, b.(*CommentGroup).List)
+
+	default:
+		d.add(Replace, path, a, b)
+	}
+}
+
+// sameShape reports whether a and b can be diffed child by child: they have
+// the same type and equal values and operators.
+func sameShape(a, b Node) bool {
+	switch a := a.(type) {
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && (len(a.Names) > 0) == (len(b.Names) > 0)
+	case *InterpolatedString:
+		b, ok := b.(*InterpolatedString)
+		if !ok || len(a.Strings) != len(b.Strings) {
+			return false
+		}
+		for i := range a.Strings {
+			if a.Strings[i] != b.Strings[i] {
+				return false
+			}
+		}
+		return true
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && a.Operator == b.Operator
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && a.Operator == b.Operator
+	case *FunctionLiteral:
+		b, ok := b.(*FunctionLiteral)
+		return ok && a.Variadic == b.Variadic
+	case *HashLiteral:
+		b, ok := b.(*HashLiteral)
+		return ok && len(a.Pairs) == len(b.Pairs)
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean, *Comment:
+		// Leaves that aren't Equal differ in their values.
+		return false
+	}
+	return sameType(a, b)
+}
+
+// diffList diffs two lists by matching up their longest common subsequence
+// of Equal elements. Runs of unmatched elements are diffed pairwise, and
+// any left over are inserted or deleted.
+func diffList[T Node](d *differ, path string, a, b []T) {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case Equal(a[i], b[j]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		// Collect the unmatched runs up to the next matching pair.
+		i0, j0 := i, j
+		for i < len(a) && j < len(b) && !Equal(a[i], b[j]) {
+			if lcs[i+1][j] >= lcs[i][j+1] {
+				i++
+			} else {
+				j++
+			}
+		}
+		if i == len(a) || j == len(b) {
+			i, j = len(a), len(b)
+		}
+
+		k := 0
+		for ; i0+k < i && j0+k < j; k++ {
+			d.node(index(path, i0+k), a[i0+k], b[j0+k])
+		}
+		for ; i0+k < i; k++ {
+			d.add(Delete, index(path, i0+k), a[i0+k], nil)
+		}
+		for k2 := k; j0+k2 < j; k2++ {
+			d.add(Insert, index(path, i), nil, b[j0+k2])
+		}
+
+		if i < len(a) && j < len(b) {
+			i, j = i+1, j+1 // Matched.
+		}
+	}
+}
+
+func sameType(a, b Node) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b)
+}
+
+func field(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func index(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,91 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected []string
+	}{
+		{"let x = 1; f(x);", "let  x=1;\nf(x)", nil},
+		{"let x = 1;", "let x = 2;", []string{
+			"replace Statements[0].Value: 1 -> 2",
+		}},
+		{"a; b; c;", "a; c;", []string{
+			"delete Statements[1]: b",
+		}},
+		{"a; c;", "a; b; c; d;", []string{
+			"insert Statements[1]: b",
+			"insert Statements[2]: d",
+		}},
+		{"a; b; c;", "a; x; c;", []string{
+			"replace Statements[1].Expression: b -> x",
+		}},
+		{"f(1, 2)", "g(1, 3, 4)", []string{
+			"replace Statements[0].Expression.Function: f -> g",
+			"replace Statements[0].Expression.Arguments[1]: 2 -> 3",
+			"insert Statements[0].Expression.Arguments[2]: 4",
+		}},
+		{"a + b * c", "a - b * c", []string{
+			"replace Statements[0].Expression: (a + (b * c)) -> (a - (b * c))",
+		}},
+		{"a + b * c", "a + b * d", []string{
+			"replace Statements[0].Expression.Right.Right: c -> d",
+		}},
+		{"if (x) { 1 }", "if (x) { 1 } else { 2 }", []string{
+			"insert Statements[0].Expression.Alternative: { 2 }",
+		}},
+		{"fn(a, b) { a }", "fn(b) { b }", []string{
+			"delete Statements[0].Expression.Parameters[0]: a",
+			"replace Statements[0].Expression.Body.Statements[0].Expression: a -> b",
+		}},
+		{`{"a": 1, "b": 2}`, `{"a": 1, "b": 3}`, []string{
+			"replace Statements[0].Expression.Pairs[1].Value: 2 -> 3",
+		}},
+		{`{"a": 1}`, `{"a": 1, "b": 2}`, []string{
+			`replace Statements[0].Expression: {"a": 1} -> {"a": 1, "b": 2}`,
+		}},
+		{"(a)", "a", []string{
+			"replace Statements[0].Expression: a -> a",
+		}},
+		{"let a, b = f();", "let c = f();", []string{
+			"replace Statements[0]: let a, b = f(); -> let c = f();",
+		}},
+	}
+
+	for _, tt := range tests {
+		a, b := parse(t, tt.a), parse(t, tt.b)
+		edits := ast.Diff(a, b)
+
+		if len(edits) != len(tt.expected) {
+			t.Errorf("Diff(%q, %q) wrong number of edits. want=%q, got=%q", tt.a, tt.b, tt.expected, edits)
+			continue
+		}
+		for i, edit := range edits {
+			if edit.String() != tt.expected[i] {
+				t.Errorf("Diff(%q, %q) edit %d wrong. want=%q, got=%q", tt.a, tt.b, i, tt.expected[i], edit)
+			}
+		}
+	}
+}
+
+func TestDiffNodes(t *testing.T) {
+	a, b := parse(t, "x"), parse(t, "y")
+
+	edits := ast.Diff(a.Statements[0], b.Statements[0])
+	if len(edits) != 1 || edits[0].Path != "Expression" || edits[0].Op != ast.Replace {
+		t.Fatalf("wrong edits. got=%q", edits)
+	}
+	if edits[0].Old != a.Statements[0].(*ast.ExpressionStatement).Expression ||
+		edits[0].New != b.Statements[0].(*ast.ExpressionStatement).Expression {
+		t.Errorf("edit doesn't refer to the nodes in the trees")
+	}
+
+	if edits := ast.Diff(a, a); edits != nil {
+		t.Errorf("expected no edits. got=%q", edits)
+	}
+}
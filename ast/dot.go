@@ -0,0 +1,73 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Dot writes the tree rooted at node to w as a Graphviz DOT graph, e.g. for
+// rendering with `dot -Tsvg`. Each node is labeled with its type and, where
+// it has one, its name, value or operator; edges are labeled with the field
+// of the parent holding the child, e.g. "Arguments[1]".
+func Dot(node Node, w io.Writer) error {
+	var buf bytes.Buffer
+	ids := make(map[Node]int)
+
+	buf.WriteString("digraph ast {\n\tnode [shape=box];\n")
+	Apply(node, func(c *Cursor) bool {
+		n := c.Node()
+		id := len(ids)
+		ids[n] = id
+		fmt.Fprintf(&buf, "\tn%d [label=%s];\n", id, dotQuote(dotLabel(n)))
+
+		if parent, ok := ids[c.Parent()]; ok && c.Parent() != nil {
+			edge := c.Name()
+			if i := c.Index(); i >= 0 {
+				edge += "[" + strconv.Itoa(i) + "]"
+			}
+			fmt.Fprintf(&buf, "\tn%d -> n%d [label=%s];\n", parent, id, dotQuote(edge))
+		}
+		return true
+	}, nil)
+	buf.WriteString("}\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// dotLabel describes n by its type and, for leaves and operators, the
+// value that tells it apart from its siblings.
+func dotLabel(n Node) string {
+	label := kindName(n)
+	switch n := n.(type) {
+	case *Identifier:
+		label += "\n" + n.Value
+	case *IntegerLiteral:
+		label += "\n" + strconv.FormatInt(n.Value, 10)
+	case *FloatLiteral:
+		label += "\n" + strconv.FormatFloat(n.Value, 'g', -1, 64)
+	case *StringLiteral:
+		label += "\n" + strconv.Quote(n.Value)
+	case *Boolean:
+		label += "\n" + strconv.FormatBool(n.Value)
+	case *PrefixExpression:
+		label += "\n" + n.Operator
+	case *InfixExpression:
+		label += "\n" + n.Operator
+	case *FunctionLiteral:
+		if n.Variadic {
+			label += "\nvariadic"
+		}
+	}
+	return label
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,65 @@
+package ast_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+)
+
+func TestDot(t *testing.T) {
+	program := parse(t, `let s = f(-x, "a\b");`)
+
+	var buf bytes.Buffer
+	if err := ast.Dot(program, &buf); err != nil {
+		t.Fatalf("Dot: %v", err)
+	}
+
+	expected := `digraph ast {
+	node [shape=box];
+	n0 [label="Program"];
+	n1 [label="LetStatement"];
+	n0 -> n1 [label="Statements[0]"];
+	n2 [label="Identifier\ns"];
+	n1 -> n2 [label="Name"];
+	n3 [label="CallExpression"];
+	n1 -> n3 [label="Value"];
+	n4 [label="Identifier\nf"];
+	n3 -> n4 [label="Function"];
+	n5 [label="PrefixExpression\n-"];
+	n3 -> n5 [label="Arguments[0]"];
+	n6 [label="Identifier\nx"];
+	n5 -> n6 [label="Right"];
+	n7 [label="StringLiteral\n\"a\\\\b\""];
+	n3 -> n7 [label="Arguments[1]"];
+}
+`
+	if buf.String() != expected {
+		t.Errorf("wrong output.\nwant=%s\ngot=%s", expected, buf.String())
+	}
+}
+
+func TestDotSubtree(t *testing.T) {
+	program := parse(t, "fn(x, rest...) { x + 1 }")
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression
+
+	var buf bytes.Buffer
+	if err := ast.Dot(fn, &buf); err != nil {
+		t.Fatalf("Dot: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`n0 [label="FunctionLiteral\nvariadic"];`,
+		`n0 -> n1 [label="Parameters[0]"];`,
+		`[label="InfixExpression\n+"];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "->") != strings.Count(out, "[label=")/2 {
+		t.Errorf("expected one edge per node but the root:\n%s", out)
+	}
+}
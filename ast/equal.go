@@ -0,0 +1,258 @@
+package ast
+
+// Equal reports whether a and b are structurally equal: they have the same
+// node types, the same values and operators, and equal children. Tokens are
+// ignored, so layout and positions don't matter; parentheses do, as they are
+// ParenExpression nodes. Missing children only equal missing children.
+func Equal(a, b Node) bool {
+	return comparer{}.equal(a, b)
+}
+
+// Equivalent is like Equal, except that parentheses are ignored: a
+// ParenExpression is equivalent to any node equivalent to the expression it
+// holds. Trees that differ only in redundant parentheses are equivalent.
+func Equivalent(a, b Node) bool {
+	return comparer{unparen: true}.equal(a, b)
+}
+
+type comparer struct {
+	unparen bool // Look through ParenExpressions.
+}
+
+func (c comparer) equal(a, b Node) bool {
+	if c.unparen {
+		a, b = unparen(a), unparen(b)
+	}
+	if isMissing(a) || isMissing(b) {
+		return isMissing(a) && isMissing(b)
+	}
+
+	switch a := a.(type) {
+	case *Program:
+		b, ok := b.(*Program)
+		return ok && c.statements(a.Statements, b.Statements)
+
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && c.idents(a.Names, b.Names) && c.equal(a.Name, b.Name) &&
+			c.equal(a.Value, b.Value)
+
+	case *ConstStatement:
+		b, ok := b.(*ConstStatement)
+		return ok && c.equal(a.Name, b.Name) && c.equal(a.Value, b.Value)
+
+	case *ReturnStatement:
+		b, ok := b.(*ReturnStatement)
+		return ok && c.equal(a.ReturnValue, b.ReturnValue)
+
+	case *WhileStatement:
+		b, ok := b.(*WhileStatement)
+		return ok && c.equal(a.Condition, b.Condition) && c.equal(a.Body, b.Body)
+
+	case *ForStatement:
+		b, ok := b.(*ForStatement)
+		return ok && c.equal(a.Variable, b.Variable) && c.equal(a.Iterable, b.Iterable) &&
+			c.equal(a.Body, b.Body)
+
+	case *BreakStatement:
+		_, ok := b.(*BreakStatement)
+		return ok
+
+	case *ContinueStatement:
+		_, ok := b.(*ContinueStatement)
+		return ok
+
+	case *ImportStatement:
+		b, ok := b.(*ImportStatement)
+		return ok && c.equal(a.Path, b.Path)
+
+	case *ExpressionStatement:
+		b, ok := b.(*ExpressionStatement)
+		return ok && c.equal(a.Expression, b.Expression)
+
+	case *BlockStatement:
+		b, ok := b.(*BlockStatement)
+		return ok && c.statements(a.Statements, b.Statements)
+
+	case *BlockExpression:
+		b, ok := b.(*BlockExpression)
+		return ok && c.equal(a.Block, b.Block)
+
+	case *Identifier:
+		b, ok := b.(*Identifier)
+		return ok && a.Value == b.Value
+
+	case *IntegerLiteral:
+		b, ok := b.(*IntegerLiteral)
+		return ok && a.Value == b.Value
+
+	case *FloatLiteral:
+		b, ok := b.(*FloatLiteral)
+		return ok && a.Value == b.Value
+
+	case *StringLiteral:
+		b, ok := b.(*StringLiteral)
+		return ok && a.Value == b.Value
+
+	case *InterpolatedString:
+		b, ok := b.(*InterpolatedString)
+		if !ok || len(a.Strings) != len(b.Strings) {
+			return false
+		}
+		for i := range a.Strings {
+			if a.Strings[i] != b.Strings[i] {
+				return false
+			}
+		}
+		return c.exprs(a.Exprs, b.Exprs)
+
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && a.Operator == b.Operator && c.equal(a.Right, b.Right)
+
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && a.Operator == b.Operator && c.equal(a.Left, b.Left) &&
+			c.equal(a.Right, b.Right)
+
+	case *AssignExpression:
+		b, ok := b.(*AssignExpression)
+		return ok && c.equal(a.Name, b.Name) && c.equal(a.Value, b.Value)
+
+	case *ParenExpression:
+		b, ok := b.(*ParenExpression)
+		return ok && c.equal(a.Expression, b.Expression)
+
+	case *IfExpression:
+		b, ok := b.(*IfExpression)
+		return ok && c.equal(a.Condition, b.Condition) &&
+			c.equal(a.Consequence, b.Consequence) && c.equal(a.Alternative, b.Alternative)
+
+	case *TryExpression:
+		b, ok := b.(*TryExpression)
+		return ok && c.equal(a.Body, b.Body) && c.equal(a.Param, b.Param) &&
+			c.equal(a.Handler, b.Handler)
+
+	case *FunctionLiteral:
+		b, ok := b.(*FunctionLiteral)
+		return ok && a.Variadic == b.Variadic && c.idents(a.Parameters, b.Parameters) &&
+			c.equal(a.Body, b.Body)
+
+	case *MacroLiteral:
+		b, ok := b.(*MacroLiteral)
+		return ok && c.idents(a.Parameters, b.Parameters) && c.equal(a.Body, b.Body)
+
+	case *CallExpression:
+		b, ok := b.(*CallExpression)
+		return ok && c.equal(a.Function, b.Function) && c.exprs(a.Arguments, b.Arguments)
+
+	case *ArrayLiteral:
+		b, ok := b.(*ArrayLiteral)
+		return ok && c.exprs(a.Elements, b.Elements)
+
+	case *IndexExpression:
+		b, ok := b.(*IndexExpression)
+		return ok && c.equal(a.Left, b.Left) && c.equal(a.Index, b.Index)
+
+	case *SliceExpression:
+		b, ok := b.(*SliceExpression)
+		return ok && c.equal(a.Left, b.Left) && c.equal(a.Low, b.Low) && c.equal(a.High, b.High)
+
+	case *HashLiteral:
+		b, ok := b.(*HashLiteral)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for i := range a.Pairs {
+			if !c.equal(a.Pairs[i].Key, b.Pairs[i].Key) || !c.equal(a.Pairs[i].Value, b.Pairs[i].Value) {
+				return false
+			}
+		}
+		return true
+
+	case *TupleLiteral:
+		b, ok := b.(*TupleLiteral)
+		return ok && c.exprs(a.Elements, b.Elements)
+
+	case *SpreadExpression:
+		b, ok := b.(*SpreadExpression)
+		return ok && c.equal(a.Value, b.Value)
+
+	case *QuoteExpression:
+		b, ok := b.(*QuoteExpression)
+		return ok && c.equal(a.Node, b.Node)
+
+	case *UnquoteExpression:
+		b, ok := b.(*UnquoteExpression)
+		return ok && c.equal(a.Node, b.Node)
+
+	case *Comment:
+		b, ok := b.(*Comment)
+		return ok && a.Token.Literal == b.Token.Literal
+
+	case *CommentGroup:
+		b, ok := b.(*CommentGroup)
+		if !ok || len(a.List) != len(b.List) {
+			return false
+		}
+		for i := range a.List {
+			if !c.equal(a.List[i], b.List[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// unparen returns n with any enclosing parentheses removed.
+func unparen(n Node) Node {
+	for {
+		paren, ok := n.(*ParenExpression)
+		if !ok || paren == nil {
+			return n
+		}
+		n = paren.Expression
+	}
+}
+
+func (c comparer) statements(a, b []Statement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !c.equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c comparer) exprs(a, b []Expression) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !c.equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c comparer) idents(a, b []*Identifier) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !c.equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
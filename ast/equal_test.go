@@ -0,0 +1,59 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/token"
+)
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"let x = 1 + 2 * 3;", "let x=1+2*3", true},
+		{"let x = 1 + 2 * 3;", "let x = 1 + (2 * 3)", false},
+		{"let x = 1 + 2 * 3;", "let x = (1 + 2) * 3;", false},
+		{"if (a) { b } else { c }", "if (a) {\n\tb;\n} else {\n\tc;\n}", true},
+		{"if (a) { b }", "if (a) { b } else { }", false},
+		{"let a, b = f(xs...);", "let a,b=f(xs...)", true},
+		{"let a, b = f(xs...);", "let a, c = f(xs...);", false},
+		{"f(xs...)", "f(xs)", false},
+		{"fn(x, rest...) { x }", "fn(x, rest) { x }", false},
+		{`"a ${x} b"`, `"a ${x} b"`, true},
+		{`"a ${x} b"`, `"a ${x} c"`, false},
+		{`{"k": 1, "j": 2}`, `{"k": 1, "j": 2}`, true},
+		{`{"k": 1, "j": 2}`, `{"j": 2, "k": 1}`, false},
+		{"return 1, 2;", "return 1, 2", true},
+		{"return 1, 2;", "return [1, 2];", false},
+		{"-a", "!a", false},
+		{`"1"`, "1", false},
+		{"x; y", "x", false},
+	}
+
+	for _, tt := range tests {
+		a, b := parse(t, tt.a), parse(t, tt.b)
+		if got := ast.Equal(a, b); got != tt.equal {
+			t.Errorf("Equal(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.equal)
+		}
+		if got := ast.Equal(b, a); got != tt.equal {
+			t.Errorf("Equal(%q, %q) = %t, want %t", tt.b, tt.a, got, tt.equal)
+		}
+	}
+}
+
+func TestEqualNil(t *testing.T) {
+	ident := &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"}
+	var block *ast.BlockStatement
+
+	if !ast.Equal(nil, nil) {
+		t.Errorf("Equal(nil, nil) = false")
+	}
+	if !ast.Equal(nil, block) {
+		t.Errorf("Equal(nil, typed nil) = false")
+	}
+	if ast.Equal(ident, nil) || ast.Equal(nil, ident) {
+		t.Errorf("Equal of a node and nil = true")
+	}
+}
@@ -0,0 +1,125 @@
+package ast
+
+// FreeVariables returns the names fn refers to but doesn't bind, in the
+// order they are first referenced. Names are bound by fn's parameters and by
+// let, const and import statements anywhere in its body, from the statement
+// on: blocks other than the handlers of try expressions and the bodies of
+// for loops don't open scopes of their own, and a let's value already sees
+// the name being defined, so that local functions can be recursive. Free
+// variables of nested function literals are free in fn too unless fn binds
+// them before the literal. Inside quote, only unquoted expressions count.
+//
+// Builtin functions are not treated specially and show up as free
+// variables.
+func FreeVariables(fn *FunctionLiteral) []string {
+	return freeVariables(fn.Parameters, fn.Body)
+}
+
+func freeVariables(params []*Identifier, body *BlockStatement) []string {
+	f := &freeFinder{bound: make(map[string]bool), seen: make(map[string]bool)}
+	for _, param := range params {
+		f.bind(param)
+	}
+	f.find(body)
+	return f.free
+}
+
+type freeFinder struct {
+	bound map[string]bool
+	seen  map[string]bool // Names already in free.
+	free  []string
+}
+
+func (f *freeFinder) bind(ident *Identifier) {
+	if ident != nil {
+		f.bound[ident.Value] = true
+	}
+}
+
+func (f *freeFinder) ref(name string) {
+	if !f.bound[name] && !f.seen[name] {
+		f.seen[name] = true
+		f.free = append(f.free, name)
+	}
+}
+
+func (f *freeFinder) find(node Node) {
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *LetStatement:
+			if len(n.Names) > 0 {
+				for _, name := range n.Names {
+					f.bind(name)
+				}
+			} else {
+				f.bind(n.Name)
+			}
+			f.find(n.Value)
+			return false
+
+		case *ConstStatement:
+			f.bind(n.Name)
+			f.find(n.Value)
+			return false
+
+		case *ImportStatement:
+			f.bound[n.Name()] = true
+			return false
+
+		case *Identifier:
+			f.ref(n.Value)
+
+		case *TryExpression:
+			if n.Body != nil {
+				f.find(n.Body)
+			}
+			f.findInner(n.Param, n.Handler)
+			return false
+
+		case *ForStatement:
+			if n.Iterable != nil {
+				f.find(n.Iterable)
+			}
+			f.findInner(n.Variable, n.Body)
+			return false
+
+		case *FunctionLiteral:
+			for _, name := range freeVariables(n.Parameters, n.Body) {
+				f.ref(name)
+			}
+			return false
+
+		case *MacroLiteral:
+			for _, name := range freeVariables(n.Parameters, n.Body) {
+				f.ref(name)
+			}
+			return false
+
+		case *QuoteExpression:
+			Inspect(n.Node, func(n Node) bool {
+				if unquote, ok := n.(*UnquoteExpression); ok {
+					f.find(unquote.Node)
+					return false
+				}
+				return true
+			})
+			return false
+		}
+		return true
+	})
+}
+
+// findInner finds the free variables of block, which binds ident in a scope
+// of its own.
+func (f *freeFinder) findInner(ident *Identifier, block *BlockStatement) {
+	outer := f.bound
+	f.bound = make(map[string]bool, len(outer)+1)
+	for name := range outer {
+		f.bound[name] = true
+	}
+	f.bind(ident)
+	if block != nil {
+		f.find(block)
+	}
+	f.bound = outer
+}
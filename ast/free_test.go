@@ -0,0 +1,52 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+)
+
+func TestFreeVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn() { 1 }", nil},
+		{"fn(x) { x }", nil},
+		{"fn(x) { x + y }", []string{"y"}},
+		{"fn(x) { y + z + y + x }", []string{"y", "z"}},
+		{"fn() { let a = 1; a + b }", []string{"b"}},
+		{"fn() { a; let a = 1; a }", []string{"a"}},
+		{"fn() { const c = 1; c }", nil},
+		{"fn() { let a, b = f(); a + b }", []string{"f"}},
+		{"fn() { if (c) { let a = 1; } a }", []string{"c"}},
+		{"fn() { let f = fn() { f() }; f }", nil},
+		{"fn(x) { fn(y) { x + y + z } }", []string{"z"}},
+		{"fn() { let g = fn() { h() }; let h = fn() { 1 }; }", []string{"h"}},
+		{"fn(xs...) { len(xs) }", []string{"len"}},
+		{"fn(m) { {k: m[i]} }", []string{"k", "i"}},
+		{"fn() { macro(a) { a + b } }", []string{"b"}},
+		{"fn(x) { quote(a + unquote(x + b)) }", []string{"b"}},
+		{"fn() { let x = x; }", nil},
+		{"fn() { try { e } catch (e) { e + f } }", []string{"e", "f"}},
+		{"fn() { try { 1 } catch (e) { let g = 1; } e + g }", []string{"e", "g"}},
+		{"fn() { try { 1 } catch (e) { fn() { e + h } } }", []string{"h"}},
+		{"fn() { for (x in x) { x + y } }", []string{"x", "y"}},
+		{"fn() { n = n + 1 }", []string{"n"}},
+		{"fn() { let n = 0; fn() { n = n + 1 } }", nil},
+		{"fn(n) { while (n > 0) { let m = n; } m }", nil},
+		{"fn() { for (x in []) { let z = x; } x + z }", []string{"x", "z"}},
+		{`fn() { import "lib/strings"; strings["upper"](s) }`, []string{"s"}},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+		got := ast.FreeVariables(fn)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("FreeVariables(%q) wrong. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Package optimize implements transformations that simplify a tree without
+// changing what it computes, for use by both the evaluator and the compiler.
+package optimize
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/token"
+)
+
+// Fold performs constant folding on the tree rooted at node, in place, and
+// returns the resulting root:
+//
+//   - Arithmetic and comparisons on integer literals, comparisons of boolean
+//     literals, concatenation of string literals and negation of integer and
+//     boolean literals are replaced by their result: `2 * 3 + 4` becomes
+//     `10` and `!true` becomes `false`.
+//   - Parentheses around a literal are dropped.
+//   - An if expression whose condition is a boolean literal is replaced by
+//     the branch that would be taken, as a block expression.
+//
+// Folding is conservative: expressions that would fail at run time, such as
+// division by zero, integer overflow or adding a string to an integer, are
+// left alone so that they still report their error, and so are if
+// expressions that have no branch to take or whose branch binds names, which
+// a block expression would keep to itself.
+//
+// New nodes take the position of the nodes they replace.
+func Fold(node ast.Node) ast.Node {
+	return ast.Apply(node, nil, func(c *ast.Cursor) bool {
+		var folded ast.Node
+		switch n := c.Node().(type) {
+		case *ast.PrefixExpression:
+			folded = foldPrefix(n)
+		case *ast.InfixExpression:
+			folded = foldInfix(n)
+		case *ast.ParenExpression:
+			if isLiteral(n.Expression) {
+				folded = n.Expression
+			}
+		case *ast.IfExpression:
+			folded = foldIf(n)
+		}
+
+		if folded != nil {
+			c.Replace(folded)
+		}
+		return true
+	})
+}
+
+func foldPrefix(n *ast.PrefixExpression) ast.Expression {
+	switch right := unparen(n.Right).(type) {
+	case *ast.IntegerLiteral:
+		// Already folded: negative numbers are written this way.
+		return nil
+	case *ast.Boolean:
+		if n.Operator == "!" {
+			return boolean(n, !right.Value)
+		}
+		return nil
+	}
+
+	if v, ok := intValue(n.Right); ok && n.Operator == "-" {
+		return integer(n, -v)
+	}
+	return nil
+}
+
+func foldInfix(n *ast.InfixExpression) ast.Expression {
+	if a, ok := intValue(n.Left); ok {
+		b, ok := intValue(n.Right)
+		if !ok {
+			return nil
+		}
+		x, y := big.NewInt(a), big.NewInt(b)
+		switch n.Operator {
+		case "+":
+			return checkedInteger(n, x.Add(x, y))
+		case "-":
+			return checkedInteger(n, x.Sub(x, y))
+		case "*":
+			return checkedInteger(n, x.Mul(x, y))
+		case "/":
+			if b != 0 {
+				return checkedInteger(n, x.Quo(x, y))
+			}
+		case "<":
+			return boolean(n, a < b)
+		case ">":
+			return boolean(n, a > b)
+		case "==":
+			return boolean(n, a == b)
+		case "!=":
+			return boolean(n, a != b)
+		}
+		return nil
+	}
+
+	switch left := unparen(n.Left).(type) {
+	case *ast.Boolean:
+		right, ok := unparen(n.Right).(*ast.Boolean)
+		if !ok {
+			return nil
+		}
+		switch n.Operator {
+		case "==":
+			return boolean(n, left.Value == right.Value)
+		case "!=":
+			return boolean(n, left.Value != right.Value)
+		}
+
+	case *ast.StringLiteral:
+		right, ok := unparen(n.Right).(*ast.StringLiteral)
+		if !ok || n.Operator != "+" {
+			return nil
+		}
+		// Don't create a string that would read as an interpolation.
+		if s := left.Value + right.Value; !strings.Contains(s, "${") {
+			return &ast.StringLiteral{Token: tok(n, token.STRING, s), Value: s}
+		}
+	}
+	return nil
+}
+
+func foldIf(n *ast.IfExpression) ast.Expression {
+	cond, ok := unparen(n.Condition).(*ast.Boolean)
+	if !ok {
+		return nil
+	}
+
+	branch := n.Alternative
+	if cond.Value {
+		branch = n.Consequence
+	}
+	// An if without a branch to take evaluates to null, which has no
+	// literal, and an empty block expression is not allowed.
+	if branch == nil || len(branch.Statements) == 0 || binds(branch) {
+		return nil
+	}
+	return &ast.BlockExpression{Token: branch.Token, Block: branch}
+}
+
+// binds reports whether block binds names in the scope it runs in, which
+// those of the if expressions it is a branch of are part of.
+func binds(block *ast.BlockStatement) bool {
+	var found bool
+	ast.Inspect(block, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.LetStatement, *ast.ConstStatement, *ast.ImportStatement:
+			found = true
+		case *ast.FunctionLiteral, *ast.MacroLiteral, *ast.BlockExpression:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+// integer returns the expression for value: a literal or, as integer
+// literals can't be negative, the negation of one. It returns nil for the
+// one value that can't be written either way.
+func integer(at ast.Node, value int64) ast.Expression {
+	if value == math.MinInt64 {
+		return nil
+	}
+	if value >= 0 {
+		return &ast.IntegerLiteral{Token: tok(at, token.INT, strconv.FormatInt(value, 10)), Value: value}
+	}
+	return &ast.PrefixExpression{
+		Token:    tok(at, token.MINUS, "-"),
+		Operator: "-",
+		Right:    integer(at, -value),
+	}
+}
+
+// checkedInteger is like integer, but returns nil if value overflows an
+// int64.
+func checkedInteger(at ast.Node, value *big.Int) ast.Expression {
+	if !value.IsInt64() {
+		return nil
+	}
+	return integer(at, value.Int64())
+}
+
+// intValue returns the value of exp if it is an integer as returned by
+// integer, possibly parenthesized.
+func intValue(exp ast.Expression) (int64, bool) {
+	switch e := unparen(exp).(type) {
+	case *ast.IntegerLiteral:
+		return e.Value, true
+	case *ast.PrefixExpression:
+		if lit, ok := unparen(e.Right).(*ast.IntegerLiteral); ok && e.Operator == "-" {
+			return -lit.Value, true
+		}
+	}
+	return 0, false
+}
+
+func boolean(at ast.Node, value bool) *ast.Boolean {
+	typ := token.FALSE
+	if value {
+		typ = token.TRUE
+	}
+	return &ast.Boolean{Token: tok(at, typ, strconv.FormatBool(value)), Value: value}
+}
+
+func tok(at ast.Node, typ token.TokenType, literal string) token.Token {
+	return token.Token{Type: typ, Literal: literal, Pos: at.Pos()}
+}
+
+func isLiteral(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.Boolean, *ast.StringLiteral:
+		return true
+	}
+	return false
+}
+
+// unparen returns exp with any enclosing parentheses removed.
+func unparen(exp ast.Expression) ast.Expression {
+	for {
+		paren, ok := exp.(*ast.ParenExpression)
+		if !ok {
+			return exp
+		}
+		exp = paren.Expression
+	}
+}
@@ -0,0 +1,101 @@
+package optimize_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/ast/optimize"
+	"github.com/j4nu5/monkey/ast/printer"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+	return program
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 3 + 4", "10"},
+		{"2 * (3 + 4)", "14"},
+		{"10 / 3 - 1", "2"},
+		{"2 - 5", "(-3)"},
+		{"(2 - 5) * 2", "(-6)"},
+		{"-(-5)", "5"},
+		{"-5", "(-5)"},
+		{"-(5)", "(-5)"},
+		{"(5)", "5"},
+		{"!true", "false"},
+		{"!!false", "false"},
+		{"1 < 2", "true"},
+		{"1 + 1 == 2", "true"},
+		{"true != (1 > 2)", "true"},
+		{`"foo" + "bar"`, `"foobar"`},
+		{"x + 2 * 3", "(x + 6)"},
+		{"f(1 + 2, [3 * 3])", "f(3, [9])"},
+		{"fn(x) { x * (2 + 2) }", "fn(x) { (x * 4) }"},
+		{"if (1 < 2) { a } else { b }", "{ a }"},
+		{"if (!true) { a } else { b; c }", "{ b; c }"},
+		{"let v = if (true) { 1 + 1 };", "let v = { 2 };"},
+		{"if (true) { fn() { let a = 1; }; { let b = 2; b } }", "{ fn() { let a = 1; }; { let b = 2; b } }"},
+
+		// Left alone.
+		{"1 + 2 + x", "(3 + x)"},
+		{"x + 1 + 2", "((x + 1) + 2)"},
+		{"1 / 0", "(1 / 0)"},
+		{"1 + true", "(1 + true)"},
+		{`"a" + 1`, `("a" + 1)`},
+		{`"a" == "a"`, `("a" == "a")`},
+		{"true + false", "(true + false)"},
+		{"!5", "(!5)"},
+		{"-true", "(-true)"},
+		{`"$" + "{x}"`, `("$" + "{x}")`},
+		{"if (false) { a }", "if (false) { a }"},
+		{"if (true) {} else { a }", "if (true) {} else { a }"},
+		{"if (1) { a }", "if (1) { a }"},
+		{"if (true) { let a = 1; a }", "if (true) { let a = 1; a }"},
+		{"if (true) { if (c) { let a = 1; } a }", "if (true) { if (c) { let a = 1; }; a }"},
+		{"9223372036854775806 + 1", "9223372036854775807"},
+		{"9223372036854775807 + 1", "(9223372036854775807 + 1)"},
+		{"-9223372036854775807 - 2", "((-9223372036854775807) - 2)"},
+		{"3037000500 * 3037000500", "(3037000500 * 3037000500)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		result := optimize.Fold(program)
+		if result != program {
+			t.Fatalf("Fold(%q) returned a different root", tt.input)
+		}
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("Fold(%q) wrong. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if errs := ast.Check(program); len(errs) > 0 {
+			t.Errorf("Fold(%q) left a malformed tree: %v", tt.input, errs)
+		}
+		if err := printer.CheckRoundTrip(program); err != nil {
+			t.Errorf("Fold(%q) broke printing: %v", tt.input, err)
+		}
+	}
+}
+
+func TestFoldKeepsPositions(t *testing.T) {
+	program := parse(t, "let x = \n  2 * 3;")
+	optimize.Fold(program)
+
+	lit := program.Statements[0].(*ast.LetStatement).Value.(*ast.IntegerLiteral)
+	if lit.Value != 6 || lit.Pos().Line != 2 || lit.Pos().Column != 3 {
+		t.Errorf("wrong literal. got=%d at %s", lit.Value, lit.Pos())
+	}
+}
@@ -0,0 +1,104 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/token"
+)
+
+// sourceRange returns the text of input between two positions.
+func sourceRange(input string, from, to token.Position) string {
+	lines := strings.SplitAfter(input, "\n")
+	offset := func(p token.Position) int {
+		o := 0
+		for _, l := range lines[:p.Line-1] {
+			o += len(l)
+		}
+		return o + p.Column - 1
+	}
+	return input[offset(from):offset(to)]
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  return a + b;
+};
+let s = "x ${add(1, xs[0])} y";
+if (!ok) { [1, 2] } else { {"k": quote(v)} }
+"multi
+line"; f(args...); (x + 1) * 2`
+
+	program := parse(t, input)
+
+	var got []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			got = append(got, nodeLabel(n)+": "+sourceRange(input, n.Pos(), n.End()))
+		}
+		return true
+	})
+
+	expected := []string{
+		"Program: " + input,
+		"LetStatement: let add = fn(a, b) {\n  return a + b;\n}",
+		"Identifier add: add",
+		"FunctionLiteral: fn(a, b) {\n  return a + b;\n}",
+		"Identifier a: a",
+		"Identifier b: b",
+		"BlockStatement: {\n  return a + b;\n}",
+		"ReturnStatement: return a + b",
+		"InfixExpression: a + b",
+		"Identifier a: a",
+		"Identifier b: b",
+		`LetStatement: let s = "x ${add(1, xs[0])} y"`,
+		"Identifier s: s",
+		`InterpolatedString: "x ${add(1, xs[0])} y"`,
+		"CallExpression: add(1, xs[0])",
+		"Identifier add: add",
+		"IntegerLiteral 1: 1",
+		"IndexExpression: xs[0]",
+		"Identifier xs: xs",
+		"IntegerLiteral 0: 0",
+		`ExpressionStatement: if (!ok) { [1, 2] } else { {"k": quote(v)} }`,
+		`IfExpression: if (!ok) { [1, 2] } else { {"k": quote(v)} }`,
+		"PrefixExpression: !ok",
+		"Identifier ok: ok",
+		"BlockStatement: { [1, 2] }",
+		"ExpressionStatement: [1, 2]",
+		"ArrayLiteral: [1, 2]",
+		"IntegerLiteral 1: 1",
+		"IntegerLiteral 2: 2",
+		`BlockStatement: { {"k": quote(v)} }`,
+		`ExpressionStatement: {"k": quote(v)}`,
+		`HashLiteral: {"k": quote(v)}`,
+		`StringLiteral k: "k"`,
+		"QuoteExpression: quote(v)",
+		"Identifier v: v",
+		"ExpressionStatement: \"multi\nline\"",
+		"StringLiteral multi\nline: \"multi\nline\"",
+		"ExpressionStatement: f(args...)",
+		"CallExpression: f(args...)",
+		"Identifier f: f",
+		"SpreadExpression: args...",
+		"Identifier args: args",
+		"ExpressionStatement: (x + 1) * 2",
+		"InfixExpression: (x + 1) * 2",
+		"ParenExpression: (x + 1)",
+		"InfixExpression: x + 1",
+		"Identifier x: x",
+		"IntegerLiteral 1: 1",
+		"IntegerLiteral 2: 2",
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("wrong number of nodes. want=%d, got=%d:\n%s",
+			len(expected), len(got), strings.Join(got, "\n"))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("node %d wrong.\nwant=%q\ngot= %q", i, expected[i], got[i])
+		}
+	}
+}
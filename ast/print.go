@@ -0,0 +1,190 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/j4nu5/monkey/token"
+)
+
+// Fprint writes a structured dump of the tree rooted at node to w, in the
+// style of go/ast.Print: each line is numbered, struct fields are listed by
+// name and a node that was already printed, such as a LetStatement's Name
+// appearing in its Names too, is referred to by its line number as
+// "(obj @ 12)". Tokens are printed on one line as their type, literal and
+// position.
+//
+// Nodes nested more than depth levels below node are elided as "{...}"; a
+// depth of zero or less prints the whole tree.
+func Fprint(w io.Writer, node Node, depth int) error {
+	d := &dumper{maxDepth: depth, objs: make(map[uintptr]int)}
+	d.newline()
+	d.value(reflect.ValueOf(&node).Elem())
+	d.buf.WriteByte('\n')
+
+	_, err := w.Write(d.buf.Bytes())
+	return err
+}
+
+type dumper struct {
+	buf      bytes.Buffer
+	line     int
+	indent   int
+	depth    int // Number of enclosing nodes.
+	maxDepth int
+	objs     map[uintptr]int // Line numbers of the pointers printed so far.
+}
+
+func (d *dumper) printf(format string, a ...interface{}) {
+	fmt.Fprintf(&d.buf, format, a...)
+}
+
+// newline starts a new numbered line at the current indentation.
+func (d *dumper) newline() {
+	if d.line > 0 {
+		d.buf.WriteByte('\n')
+	}
+	d.line++
+	d.printf("%6d  ", d.line)
+	for i := 0; i < d.indent; i++ {
+		d.buf.WriteString(".  ")
+	}
+}
+
+var (
+	tokenType    = reflect.TypeOf(token.Token{})
+	positionType = reflect.TypeOf(token.Position{})
+)
+
+func (d *dumper) value(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			d.printf("nil")
+			return
+		}
+		d.value(v.Elem())
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			d.printf("nil")
+			return
+		}
+		if line, ok := d.objs[v.Pointer()]; ok {
+			d.printf("(obj @ %d)", line)
+			return
+		}
+		d.objs[v.Pointer()] = d.line
+		d.printf("*")
+		d.value(v.Elem())
+
+	case reflect.Slice:
+		if v.IsNil() {
+			d.printf("%s (nil)", v.Type())
+			return
+		}
+		d.printf("%s (len = %d) {", v.Type(), v.Len())
+		if d.enter(v.Len()) {
+			for i := 0; i < v.Len(); i++ {
+				d.newline()
+				d.printf("%d: ", i)
+				d.value(v.Index(i))
+			}
+			d.leave()
+		}
+		d.printf("}")
+
+	case reflect.Map:
+		if v.IsNil() {
+			d.printf("%s (nil)", v.Type())
+			return
+		}
+		d.printf("%s (len = %d) {", v.Type(), v.Len())
+		if d.enter(v.Len()) {
+			for _, key := range d.sortedKeys(v) {
+				d.newline()
+				d.value(key)
+				d.printf(": ")
+				d.value(v.MapIndex(key))
+			}
+			d.leave()
+		}
+		d.printf("}")
+
+	case reflect.Struct:
+		switch v.Type() {
+		case tokenType:
+			tok := v.Interface().(token.Token)
+			d.printf("%s %s %s", tok.Type, strconv.Quote(tok.Literal), tok.Pos)
+			return
+		case positionType:
+			d.printf("%s", v.Interface().(token.Position))
+			return
+		}
+
+		t := v.Type()
+		d.printf("%s {", t)
+		if d.enter(t.NumField()) {
+			for i := 0; i < t.NumField(); i++ {
+				if !t.Field(i).IsExported() {
+					continue
+				}
+				d.newline()
+				d.printf("%s: ", t.Field(i).Name)
+				d.value(v.Field(i))
+			}
+			d.leave()
+		}
+		d.printf("}")
+
+	case reflect.String:
+		d.printf("%s", strconv.Quote(v.String()))
+
+	default:
+		d.printf("%v", v)
+	}
+}
+
+// enter opens a level of nesting with n entries, returning false and
+// printing an ellipsis instead if it would be too deep.
+func (d *dumper) enter(n int) bool {
+	if n == 0 {
+		return false
+	}
+	if d.maxDepth > 0 && d.depth >= d.maxDepth {
+		d.printf("...")
+		return false
+	}
+	d.depth++
+	d.indent++
+	return true
+}
+
+func (d *dumper) leave() {
+	d.depth--
+	d.indent--
+	d.newline()
+}
+
+// sortedKeys returns the keys of the map v, ordered by the lines they were
+// printed at, keys printed earlier first.
+func (d *dumper) sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	line := func(k reflect.Value) int {
+		if k.Kind() == reflect.Interface {
+			k = k.Elem()
+		}
+		if k.Kind() == reflect.Pointer {
+			if line, ok := d.objs[k.Pointer()]; ok {
+				return line
+			}
+		}
+		return d.line + 1
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return line(keys[i]) < line(keys[j]) })
+	return keys
+}
@@ -0,0 +1,70 @@
+package ast_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+)
+
+func TestFprint(t *testing.T) {
+	program := parse(t, "let a, b = -x;")
+
+	var buf bytes.Buffer
+	if err := ast.Fprint(&buf, program, 0); err != nil {
+		t.Fatalf("Fprint: %v", err)
+	}
+
+	expected := `     1  *ast.Program {
+     2  .  Statements: []ast.Statement (len = 1) {
+     3  .  .  0: *ast.LetStatement {
+     4  .  .  .  Token: LET "let" 1:1
+     5  .  .  .  Name: *ast.Identifier {
+     6  .  .  .  .  Token: IDENT "a" 1:5
+     7  .  .  .  .  Value: "a"
+     8  .  .  .  }
+     9  .  .  .  Names: []*ast.Identifier (len = 2) {
+    10  .  .  .  .  0: (obj @ 5)
+    11  .  .  .  .  1: *ast.Identifier {
+    12  .  .  .  .  .  Token: IDENT "b" 1:8
+    13  .  .  .  .  .  Value: "b"
+    14  .  .  .  .  }
+    15  .  .  .  }
+    16  .  .  .  Value: *ast.PrefixExpression {
+    17  .  .  .  .  Token: - "-" 1:12
+    18  .  .  .  .  Operator: "-"
+    19  .  .  .  .  Right: *ast.Identifier {
+    20  .  .  .  .  .  Token: IDENT "x" 1:13
+    21  .  .  .  .  .  Value: "x"
+    22  .  .  .  .  }
+    23  .  .  .  }
+    24  .  .  }
+    25  .  }
+    26  .  Comments: ast.CommentMap (nil)
+    27  }
+`
+	if buf.String() != expected {
+		t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", expected, buf.String())
+	}
+}
+
+func TestFprintDepth(t *testing.T) {
+	program := parse(t, "if (x) { y }")
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+
+	var buf bytes.Buffer
+	if err := ast.Fprint(&buf, stmt.Expression, 1); err != nil {
+		t.Fatalf("Fprint: %v", err)
+	}
+
+	expected := `     1  *ast.IfExpression {
+     2  .  Token: IF "if" 1:1
+     3  .  Condition: *ast.Identifier {...}
+     4  .  Consequence: *ast.BlockStatement {...}
+     5  .  Alternative: nil
+     6  }
+`
+	if buf.String() != expected {
+		t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", expected, buf.String())
+	}
+}
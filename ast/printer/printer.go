@@ -0,0 +1,531 @@
+// Package printer implements printing of AST nodes as canonical Monkey
+// source.
+//
+// The output depends only on the structure of the tree: layout and the
+// spelling of literals in the original source are not preserved.
+// Parentheses written in the source are kept, as ParenExpression nodes, and
+// so are the comments recorded in Program.Comments.
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/token"
+)
+
+// Binding strength of operators, mirroring the parser's precedence table.
+const (
+	lowest = iota
+	assign
+	coalesce
+	or
+	and
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+)
+
+var precedences = map[string]int{
+	"??": coalesce,
+	"||": or,
+	"&&": and,
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"|":  sum,
+	"^":  sum,
+	"*":  product,
+	"/":  product,
+	"%":  product,
+	"&":  product,
+	"<<": product,
+	">>": product,
+}
+
+// Fprint writes the canonical source of node to w. Blocks are broken over
+// indented lines, every statement is terminated by a semicolon and operands
+// are parenthesized where the tree has a ParenExpression or precedence
+// requires it. When node is a
+// Program each statement ends with a newline.
+func Fprint(w io.Writer, node ast.Node) error {
+	p := &printer{}
+	if program, ok := node.(*ast.Program); ok {
+		p.comments = program.Comments
+	}
+
+	if err := p.node(node); err != nil {
+		return err
+	}
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// String returns the canonical source of node, as written by Fprint. It
+// panics if node is of a type the printer doesn't know.
+func String(node ast.Node) string {
+	var buf bytes.Buffer
+	if err := Fprint(&buf, node); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+type printer struct {
+	buf      bytes.Buffer
+	indent   int
+	comments ast.CommentMap
+}
+
+func (p *printer) print(args ...string) {
+	for _, s := range args {
+		p.buf.WriteString(s)
+	}
+}
+
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+	for i := 0; i < p.indent; i++ {
+		p.buf.WriteByte('\t')
+	}
+}
+
+func (p *printer) node(node ast.Node) error {
+	switch n := node.(type) {
+	case *ast.Program:
+		p.statements(n.Statements)
+		if dangling := p.comments[n]; len(dangling) > 0 {
+			if len(n.Statements) > 0 {
+				p.newline()
+			}
+			p.groups(dangling)
+		}
+		if p.buf.Len() > 0 {
+			p.print("\n")
+		}
+	case ast.Statement:
+		p.statement(n)
+	case ast.Expression:
+		p.expr(n)
+	default:
+		return fmt.Errorf("printer: unsupported node type %T", node)
+	}
+	return nil
+}
+
+// statements prints list one statement per line. The first statement
+// starts at the current position.
+func (p *printer) statements(list []ast.Statement) {
+	pending := -1 // Where a block-like statement may need its semicolon.
+	for i, stmt := range list {
+		if i > 0 {
+			p.newline()
+		}
+		start := p.statement(stmt)
+
+		// A block-like expression statement needs no semicolon, unless
+		// the statement after it would otherwise continue it, as in
+		// `if (a) { b }; -c`.
+		if pending >= 0 && start < p.buf.Len() && bytes.IndexByte([]byte("([-"), p.buf.Bytes()[start]) >= 0 {
+			rest := append([]byte(nil), p.buf.Bytes()[pending:]...)
+			p.buf.Truncate(pending)
+			p.buf.WriteByte(';')
+			p.buf.Write(rest)
+		}
+
+		pending = -1
+		switch stmt.(type) {
+		case *ast.WhileStatement, *ast.ForStatement:
+			// Nothing can continue a loop.
+		default:
+			if isBlockLike(stmt) {
+				pending = p.buf.Len()
+			} else {
+				p.print(";")
+			}
+		}
+		p.trailingComment(stmt)
+	}
+}
+
+// statement prints stmt and returns the offset at which its code, following
+// any comments, starts.
+func (p *printer) statement(stmt ast.Statement) int {
+	p.leadingComments(stmt)
+	start := p.buf.Len()
+
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		p.print("let ")
+		if len(s.Names) > 0 {
+			for i, name := range s.Names {
+				if i > 0 {
+					p.print(", ")
+				}
+				p.expr(name)
+			}
+		} else {
+			p.expr(s.Name)
+		}
+		p.print(" = ")
+		p.expr(s.Value)
+
+	case *ast.ConstStatement:
+		p.print("const ")
+		p.expr(s.Name)
+		p.print(" = ")
+		p.expr(s.Value)
+
+	case *ast.ReturnStatement:
+		p.print("return")
+		if s.ReturnValue != nil {
+			p.print(" ")
+			p.expr(s.ReturnValue)
+		}
+
+	case *ast.WhileStatement:
+		p.print("while (")
+		p.expr(s.Condition)
+		p.print(") ")
+		p.block(s.Body)
+
+	case *ast.ForStatement:
+		p.print("for (")
+		p.expr(s.Variable)
+		p.print(" in ")
+		p.expr(s.Iterable)
+		p.print(") ")
+		p.block(s.Body)
+
+	case *ast.BreakStatement:
+		p.print("break")
+
+	case *ast.ContinueStatement:
+		p.print("continue")
+
+	case *ast.ImportStatement:
+		p.print("import ")
+		p.expr(s.Path)
+
+	case *ast.ExpressionStatement:
+		p.expr(s.Expression)
+
+	case *ast.BlockStatement:
+		p.block(s)
+	}
+	return start
+}
+
+// leadingComments prints the comment groups preceding node, each comment
+// on a line of its own.
+func (p *printer) leadingComments(node ast.Node) {
+	var leading []*ast.CommentGroup
+	for _, g := range p.comments[node] {
+		if before(g.Pos(), node.Pos()) {
+			leading = append(leading, g)
+		}
+	}
+	if len(leading) > 0 {
+		p.groups(leading)
+		p.newline()
+	}
+}
+
+// trailingComment prints the comment following stmt on its line.
+func (p *printer) trailingComment(stmt ast.Statement) {
+	for _, g := range p.comments[stmt] {
+		if !before(g.Pos(), stmt.Pos()) {
+			for _, c := range g.List {
+				p.print(" ", c.String())
+			}
+		}
+	}
+}
+
+// groups prints comment groups one comment per line, separating the groups
+// by blank lines. The first comment starts at the current position.
+func (p *printer) groups(groups []*ast.CommentGroup) {
+	for i, g := range groups {
+		if i > 0 {
+			p.print("\n")
+			p.newline()
+		}
+		for j, c := range g.List {
+			if j > 0 {
+				p.newline()
+			}
+			p.print(c.String())
+		}
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	var dangling []*ast.CommentGroup
+	if block != nil {
+		dangling = p.comments[block]
+	}
+	if block == nil || len(block.Statements) == 0 && len(dangling) == 0 {
+		p.print("{}")
+		return
+	}
+
+	p.print("{")
+	p.indent++
+	p.newline()
+	p.statements(block.Statements)
+	if len(dangling) > 0 {
+		if len(block.Statements) > 0 {
+			p.newline()
+		}
+		p.groups(dangling)
+	}
+	p.indent--
+	p.newline()
+	p.print("}")
+}
+
+func (p *printer) expr(exp ast.Expression) {
+	// Nil expressions are left behind by a parser recovering from errors.
+	if isNil(exp) {
+		return
+	}
+	p.leadingComments(exp)
+
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		p.print(e.Value)
+
+	case *ast.IntegerLiteral:
+		p.print(strconv.FormatInt(e.Value, 10))
+
+	case *ast.FloatLiteral:
+		// Always with a decimal point, so as not to read as an integer.
+		s := strconv.FormatFloat(e.Value, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		p.print(s)
+
+	case *ast.StringLiteral:
+		p.print(`"`, e.Value, `"`)
+
+	case *ast.InterpolatedString:
+		p.print(`"`)
+		for i, s := range e.Strings {
+			if i > 0 {
+				p.print("${")
+				p.expr(e.Exprs[i-1])
+				p.print("}")
+			}
+			p.print(s)
+		}
+		p.print(`"`)
+
+	case *ast.Boolean:
+		p.print(strconv.FormatBool(e.Value))
+
+	case *ast.PrefixExpression:
+		p.print(e.Operator)
+		p.operand(e.Right, prefix, false)
+
+	case *ast.InfixExpression:
+		prec := precedences[e.Operator]
+		p.operand(e.Left, prec, false)
+		p.print(" ", e.Operator, " ")
+		p.operand(e.Right, prec, true)
+
+	case *ast.AssignExpression:
+		p.expr(e.Name)
+		p.print(" = ")
+		p.expr(e.Value)
+
+	case *ast.ParenExpression:
+		p.print("(")
+		p.expr(e.Expression)
+		p.print(")")
+
+	case *ast.IfExpression:
+		p.print("if (")
+		p.expr(e.Condition)
+		p.print(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.print(" else ")
+			p.block(e.Alternative)
+		}
+
+	case *ast.TryExpression:
+		p.print("try ")
+		p.block(e.Body)
+		p.print(" catch (")
+		p.expr(e.Param)
+		p.print(") ")
+		p.block(e.Handler)
+
+	case *ast.FunctionLiteral:
+		p.print("fn")
+		p.parameters(e.Parameters, e.Variadic)
+		p.print(" ")
+		p.block(e.Body)
+
+	case *ast.MacroLiteral:
+		p.print("macro")
+		p.parameters(e.Parameters, false)
+		p.print(" ")
+		p.block(e.Body)
+
+	case *ast.CallExpression:
+		p.operand(e.Function, call, false)
+		p.print("(")
+		p.exprList(e.Arguments)
+		p.print(")")
+
+	case *ast.ArrayLiteral:
+		p.print("[")
+		p.exprList(e.Elements)
+		p.print("]")
+
+	case *ast.IndexExpression:
+		p.operand(e.Left, call, false)
+		p.print("[")
+		p.expr(e.Index)
+		p.print("]")
+
+	case *ast.SliceExpression:
+		p.operand(e.Left, call, false)
+		p.print("[")
+		if e.Low != nil {
+			p.expr(e.Low)
+		}
+		p.print(":")
+		if e.High != nil {
+			p.expr(e.High)
+		}
+		p.print("]")
+
+	case *ast.HashLiteral:
+		p.print("{")
+		for i, pair := range e.Pairs {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.expr(pair.Key)
+			p.print(": ")
+			p.expr(pair.Value)
+		}
+		p.print("}")
+
+	case *ast.TupleLiteral:
+		p.exprList(e.Elements)
+
+	case *ast.SpreadExpression:
+		p.expr(e.Value)
+		p.print("...")
+
+	case *ast.BlockExpression:
+		p.block(e.Block)
+
+	case *ast.QuoteExpression:
+		p.print("quote(")
+		p.expr(e.Node)
+		p.print(")")
+
+	case *ast.UnquoteExpression:
+		p.print("unquote(")
+		p.expr(e.Node)
+		p.print(")")
+	}
+}
+
+// operand prints exp as an operand of an operator with precedence prec,
+// parenthesizing it if it would otherwise bind differently. Operators
+// associate to the left, so a right operand of equal precedence needs
+// parentheses too.
+func (p *printer) operand(exp ast.Expression, prec int, right bool) {
+	paren := false
+	switch e := exp.(type) {
+	case *ast.InfixExpression:
+		inner := precedences[e.Operator]
+		paren = inner < prec || inner == prec && right
+	case *ast.AssignExpression:
+		paren = prec > assign
+	case *ast.PrefixExpression:
+		paren = prec > prefix
+	}
+
+	if paren {
+		p.print("(")
+	}
+	p.expr(exp)
+	if paren {
+		p.print(")")
+	}
+}
+
+func (p *printer) exprList(list []ast.Expression) {
+	for i, exp := range list {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expr(exp)
+	}
+}
+
+func (p *printer) parameters(params []*ast.Identifier, variadic bool) {
+	p.print("(")
+	for i, param := range params {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expr(param)
+	}
+	if variadic {
+		p.print("...")
+	}
+	p.print(")")
+}
+
+// isBlockLike reports whether stmt is an expression statement ending in a
+// block, such as an if expression.
+func isBlockLike(stmt ast.Statement) bool {
+	s, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	switch s.Expression.(type) {
+	case *ast.IfExpression, *ast.TryExpression, *ast.BlockExpression:
+		return true
+	}
+	return false
+}
+
+// before reports whether a is before b in the same file.
+func before(a, b token.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// isNil reports whether exp is nil or a nil pointer.
+func isNil(exp ast.Expression) bool {
+	switch e := exp.(type) {
+	case nil:
+		return true
+	case *ast.Identifier:
+		return e == nil
+	case *ast.StringLiteral:
+		return e == nil
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package printer_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/ast/printer"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.NewWithMode(input, lexer.ScanComments))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %q", input, p.Errors())
+	}
+	if len(p.Warnings()) != 0 {
+		t.Fatalf("parser warnings for %q: %q", input, p.Warnings())
+	}
+	return program
+}
+
+func TestFprint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"let y = 2.50 * -1.0", "let y = 2.5 * -1.0;\n"},
+		{"let a,b = f(xs...)", "let a, b = f(xs...);\n"},
+		{"const c = true; return c", "const c = true;\nreturn c;\n"},
+		{`import "lib/math"`, "import \"lib/math\";\n"},
+		{"return a,b", "return a, b;\n"},
+		{"(1 + 2) * 3; 1 + (2 * 3); 1 - (2 - 3); (1 - 2) - 3",
+			"(1 + 2) * 3;\n1 + (2 * 3);\n1 - (2 - 3);\n(1 - 2) - 3;\n"},
+		{"-(a + b); -a * b; !-a; (-a)(b); (a + b)[0]",
+			"-(a + b);\n-a * b;\n!-a;\n(-a)(b);\n(a + b)[0];\n"},
+		{"(a < b) < c; a < b == c", "(a < b) < c;\na < b == c;\n"},
+		{"a | b & c; (a | b) & c; a << (b << c)", "a | b & c;\n(a | b) & c;\na << (b << c);\n"},
+		{"a || b && c == d; (a || b) && c", "a || b && c == d;\n(a || b) && c;\n"},
+		{"a ?? b || c; (a ?? b) || c", "a ?? b || c;\n(a ?? b) || c;\n"},
+		{`"a ${x + 1} b${"c"}"`, "\"a ${x + 1} b${\"c\"}\";\n"},
+		{`[1, [2], {"k": [], "j": {}}]`, "[1, [2], {\"k\": [], \"j\": {}}];\n"},
+		{"if (x) { a } else { if (y) { b; c } }",
+			"if (x) {\n\ta;\n} else {\n\tif (y) {\n\t\tb;\n\t\tc;\n\t}\n}\n"},
+		{"let f = fn(x, rest...) { fn() {} }",
+			"let f = fn(x, rest...) {\n\tfn() {};\n};\n"},
+		{"let m = macro(a) { quote(unquote(a) + 1) }",
+			"let m = macro(a) {\n\tquote(unquote(a) + 1);\n};\n"},
+		{"let x = { let y = 1; y }", "let x = {\n\tlet y = 1;\n\ty;\n};\n"},
+		{"try { f() } catch (e) { g(e) }; -1; try {} catch (e) {} x; let v = try {} catch (e) { 0 }",
+			"try {\n\tf();\n} catch (e) {\n\tg(e);\n};\n-1;\ntry {} catch (e) {}\nx;\nlet v = try {} catch (e) {\n\t0;\n};\n"},
+		{"a = b = c + 1; (a = b) + 1; f(x = 1)", "a = b = c + 1;\n(a = b) + 1;\nf(x = 1);\n"},
+		{"while (a) { b; break } -c; for (x in xs) { continue; }; (d)",
+			"while (a) {\n\tb;\n\tbreak;\n}\n-c;\nfor (x in xs) {\n\tcontinue;\n}\n(d);\n"},
+		{"if (a) { b } c; if (a) { b }; -c; if (a) { b }; (c); { d }; [e]",
+			"if (a) {\n\tb;\n}\nc;\nif (a) {\n\tb;\n};\n-c;\nif (a) {\n\tb;\n};\n(c);\n{\n\td;\n};\n[e];\n"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got := printer.String(parse(t, tt.input))
+		if got != tt.expected {
+			t.Errorf("printer.String(%q) wrong.\nexpected=%q\ngot=     %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFprintRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let x = 1 + 2 * 3 - -4 / (5 - 6);",
+		"let a, b = f(g(h)[1], [xs...], {1: 2});",
+		"if ((a == b) != (c < d)) { x } else { y }; -1",
+		"let add = fn(a, b) { a + b }; add(1, 2) * add(3, 4)",
+		"fn(x) { x }(5); (fn(x) { x })(5); {1: 2}[1]",
+		"let s = \"${a} and ${b + \"${c}\"}\"",
+		"{ let x = 1; { x } }",
+		"if (x) { 1 }; [1, 2]; { 2 }; (3)(4); if (y) { 5 } (6)",
+		"let m = macro(a, b) { quote(unquote(b) - unquote(a)) }; m(1, 2)",
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+		out := printer.String(program)
+
+		reparsed := parse(t, out)
+		if !ast.Equal(program, reparsed) {
+			t.Errorf("%q printed as %q, which parses differently", input, out)
+		}
+		if again := printer.String(reparsed); again != out {
+			t.Errorf("printing %q is not idempotent: %q, then %q", input, out, again)
+		}
+	}
+}
+
+func TestFprintComments(t *testing.T) {
+	input := `// Package doc.
+// Second line.
+
+// Another group.
+let x = 5; // Five.
+let f = fn() {
+  // Inside.
+  x   // Trailing.
+  // Dangling.
+};
+if (x) { 1 }; // After a block.
+-x;
+let g = fn() {
+	// Only a comment.
+};
+// The end.`
+	expected := `// Package doc.
+// Second line.
+
+// Another group.
+let x = 5; // Five.
+let f = fn() {
+	// Inside.
+	x; // Trailing.
+	// Dangling.
+};
+if (x) {
+	1;
+}; // After a block.
+-x;
+let g = fn() {
+	// Only a comment.
+};
+// The end.
+`
+
+	if got := printer.String(parse(t, input)); got != expected {
+		t.Errorf("printer.String wrong.\nexpected=%q\ngot=     %q", expected, got)
+	}
+	if got := printer.String(parse(t, "// Just a comment.")); got != "// Just a comment.\n" {
+		t.Errorf("printer.String wrong for a comment-only program. got=%q", got)
+	}
+}
+
+func TestFprintNode(t *testing.T) {
+	program := parse(t, "let f = fn(x) { x * (2 + 1) };")
+	let := program.Statements[0].(*ast.LetStatement)
+
+	if got := printer.String(let.Value); got != "fn(x) {\n\tx * (2 + 1);\n}" {
+		t.Errorf("printer.String(FunctionLiteral) wrong. got=%q", got)
+	}
+	if got := printer.String(let); got != "let f = fn(x) {\n\tx * (2 + 1);\n}" {
+		t.Errorf("printer.String(LetStatement) wrong. got=%q", got)
+	}
+}
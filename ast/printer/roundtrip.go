@@ -0,0 +1,35 @@
+package printer
+
+import (
+	"fmt"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+// CheckRoundTrip verifies the printer's round-trip invariant for program:
+// its printed source parses without errors into a tree that is
+// ast.Equivalent to program, and printing that tree reproduces the source.
+//
+// Every program that passes ast.Check satisfies the invariant. Programs
+// produced by the parser even parse back into an ast.Equal tree, as the
+// printer only adds the parentheses precedence requires, which such trees
+// already have.
+func CheckRoundTrip(program *ast.Program) error {
+	src := String(program)
+
+	p := parser.New(lexer.NewWithMode(src, lexer.ScanComments))
+	reparsed := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return fmt.Errorf("printed program does not parse: %v\n%s", parser.ErrorList(errs), src)
+	}
+
+	if !ast.Equivalent(program, reparsed) {
+		return fmt.Errorf("printed program parses into a different tree:\n%s", src)
+	}
+	if again := String(reparsed); again != src {
+		return fmt.Errorf("printing is not idempotent:\n%s\nthen:\n%s", src, again)
+	}
+	return nil
+}
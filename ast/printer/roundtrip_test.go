@@ -0,0 +1,249 @@
+package printer_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/ast/build"
+	"github.com/j4nu5/monkey/ast/printer"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+// generator produces random programs that pass ast.Check.
+type generator struct {
+	r *rand.Rand
+}
+
+var (
+	names           = []string{"a", "b", "foo", "Bar", "_x", "iff", "fnord", "index"}
+	texts           = []string{"", "a", "hello world", "$", "}", "{", "a\nb", "$ {", "x$"}
+	prefixOperators = []string{"!", "-"}
+	infixOperators  = []string{"+", "-", "*", "/", "%", "&", "|", "^", "<<", ">>", "<", ">", "==", "!=", "&&", "||", "??"}
+)
+
+func (g *generator) pick(list []string) string { return list[g.r.Intn(len(list))] }
+
+func (g *generator) names(n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = g.pick(names)
+	}
+	return list
+}
+
+func (g *generator) program() *ast.Program {
+	return build.Program(g.statements(4, 3)...)
+}
+
+// statements returns up to max statements.
+func (g *generator) statements(max, depth int) []ast.Statement {
+	stmts := make([]ast.Statement, g.r.Intn(max+1))
+	for i := range stmts {
+		stmts[i] = g.statement(depth)
+	}
+	return stmts
+}
+
+func (g *generator) statement(depth int) ast.Statement {
+	switch g.r.Intn(11) {
+	case 0:
+		return build.LetMulti(g.names(2+g.r.Intn(2)), g.expr(depth))
+	case 1:
+		return build.Const(g.pick(names), g.expr(depth))
+	case 2:
+		return build.Return(g.exprs(1+g.r.Intn(3), depth)...)
+	case 3:
+		return build.Import(g.pick(texts))
+	case 4, 5:
+		return build.Let(g.pick(names), g.expr(depth))
+	case 6:
+		if depth > 0 {
+			return build.While(g.expr(depth-1), g.statements(2, depth-1)...)
+		}
+	case 7:
+		if depth > 0 {
+			return build.For(g.pick(names), g.expr(depth-1), g.statements(2, depth-1)...)
+		}
+	case 8:
+		if g.r.Intn(2) == 0 {
+			return build.Break()
+		}
+		return build.Continue()
+	}
+	return build.Expr(g.expr(depth))
+}
+
+func (g *generator) exprs(n, depth int) []ast.Expression {
+	list := make([]ast.Expression, n)
+	for i := range list {
+		list[i] = g.expr(depth)
+	}
+	return list
+}
+
+// elements returns a list of expressions, some of them spread.
+func (g *generator) elements(depth int) []ast.Expression {
+	list := g.exprs(g.r.Intn(4), depth)
+	for i := range list {
+		if g.r.Intn(4) == 0 {
+			list[i] = build.Spread(list[i])
+		}
+	}
+	return list
+}
+
+func (g *generator) block(depth int) *ast.BlockStatement {
+	return build.Block(g.statements(3, depth)...)
+}
+
+func (g *generator) expr(depth int) ast.Expression {
+	if depth <= 0 {
+		return g.leaf()
+	}
+	depth--
+
+	switch g.r.Intn(18) {
+	case 0:
+		return build.Prefix(g.pick(prefixOperators), g.expr(depth))
+	case 1, 2:
+		return build.Infix(g.expr(depth), g.pick(infixOperators), g.expr(depth))
+	case 3:
+		return build.Paren(g.expr(depth))
+	case 4:
+		var alternative *ast.BlockStatement
+		if g.r.Intn(2) == 0 {
+			alternative = g.block(depth)
+		}
+		return build.If(g.expr(depth), g.block(depth), alternative)
+	case 5:
+		params := g.names(g.r.Intn(3))
+		body := g.statements(3, depth)
+		if len(params) > 0 && g.r.Intn(2) == 0 {
+			return build.VariadicFn(params, body...)
+		}
+		return build.Fn(params, body...)
+	case 6:
+		return build.Call(g.expr(depth), g.elements(depth)...)
+	case 7:
+		return build.Array(g.elements(depth)...)
+	case 8:
+		if g.r.Intn(2) == 0 {
+			return build.Index(g.expr(depth), g.expr(depth))
+		}
+		var low, high ast.Expression
+		if g.r.Intn(2) == 0 {
+			low = g.expr(depth)
+		}
+		if g.r.Intn(2) == 0 {
+			high = g.expr(depth)
+		}
+		return build.Slice(g.expr(depth), low, high)
+	case 9:
+		pairs := make([]*ast.HashPair, g.r.Intn(3))
+		for i := range pairs {
+			pairs[i] = build.Pair(g.expr(depth), g.expr(depth))
+		}
+		return build.Hash(pairs...)
+	case 10:
+		exprs := g.exprs(1+g.r.Intn(2), depth)
+		strs := make([]string, len(exprs)+1)
+		for i := range strs {
+			strs[i] = g.pick(texts)
+		}
+		return build.Interpolated(strs, exprs...)
+	case 11:
+		return build.BlockExpr(append(g.statements(2, depth), g.statement(depth))...)
+	case 12:
+		return build.Quote(g.expr(depth))
+	case 13:
+		return build.Unquote(g.expr(depth))
+	case 14:
+		return build.Macro(g.names(g.r.Intn(3)), g.statements(2, depth)...)
+	case 15:
+		return build.Try(g.block(depth), g.names(1)[0], g.block(depth))
+	case 16:
+		return build.Assign(g.pick(names), g.expr(depth))
+	}
+	return g.leaf()
+}
+
+func (g *generator) leaf() ast.Expression {
+	switch g.r.Intn(5) {
+	case 0:
+		return build.Ident(g.pick(names))
+	case 1:
+		return build.Int(g.r.Int63n(1000))
+	case 2:
+		return build.Str(g.pick(texts))
+	case 3:
+		return build.Float(float64(g.r.Int63n(100000)) / 100)
+	}
+	return build.Bool(g.r.Intn(2) == 0)
+}
+
+const roundTripRuns = 2000
+
+func TestCheckRoundTripProperty(t *testing.T) {
+	g := &generator{r: rand.New(rand.NewSource(1))}
+
+	for i := 0; i < roundTripRuns; i++ {
+		program := g.program()
+		if errs := ast.Check(program); errs != nil {
+			t.Fatalf("generated an invalid program %q: %v", program, errs)
+		}
+		if err := printer.CheckRoundTrip(program); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+}
+
+func TestStringRoundTripProperty(t *testing.T) {
+	g := &generator{r: rand.New(rand.NewSource(2))}
+
+	for i := 0; i < roundTripRuns; i++ {
+		program := g.program()
+		src := program.String()
+
+		p := parser.New(lexer.New(src))
+		reparsed := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("run %d: String() of a valid program does not parse: %q\n%s", i, p.Errors(), src)
+		}
+		if !ast.Equivalent(program, reparsed) {
+			t.Fatalf("run %d: String() parses into a different tree:\n%s\n%s", i, src, reparsed)
+		}
+	}
+}
+
+func TestCheckRoundTripParsed(t *testing.T) {
+	inputs := []string{
+		"let x = 1 + 2 * 3 - -4 / (5 - 6);",
+		"if (a < b < c) { (((x))) } else { -(-x) }",
+		"// Doc.\nlet f = fn(x, rest...) { x(rest...) }; // Trailing.\n// Dangling.",
+	}
+
+	for _, input := range inputs {
+		p := parser.New(lexer.NewWithMode(input, lexer.ScanComments))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %q", input, p.Errors())
+		}
+
+		if err := printer.CheckRoundTrip(program); err != nil {
+			t.Errorf("CheckRoundTrip(%q): %v", input, err)
+		}
+		reparsed := parser.New(lexer.New(printer.String(program))).ParseProgram()
+		if !ast.Equal(program, reparsed) {
+			t.Errorf("%q does not parse back into an equal tree", input)
+		}
+	}
+}
+
+func TestCheckRoundTripFailure(t *testing.T) {
+	program := build.Program(build.Let("if", build.Int(1)))
+	if err := printer.CheckRoundTrip(program); err == nil {
+		t.Errorf("CheckRoundTrip accepted a program that prints as %q", printer.String(program))
+	}
+}
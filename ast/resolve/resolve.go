@@ -0,0 +1,339 @@
+// Package resolve implements name resolution: it binds every identifier in
+// a program to the declaration it refers to and reports the names that are
+// used before their definition, redeclared or not defined at all.
+//
+// Scopes are those of the language: the program and every function and
+// macro literal has one, and so do every block expression, the handler of
+// every try expression, holding its catch parameter, and the body of every
+// for loop, holding its variable; other blocks don't. A let or const binds
+// its names from the statement on, including within its own value, so that
+// local functions can be recursive. The bodies of function literals are
+// resolved once the scopes enclosing them are complete, as they can only run
+// after their definition: functions may refer to names defined after them.
+package resolve
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/token"
+)
+
+// Kind describes what an Object is.
+type Kind int
+
+const (
+	Predeclared Kind = iota // A name such as a builtin, defined outside of the program.
+	Var                     // A name bound by a let statement, catch clause or for loop.
+	Const                   // A name bound by a const statement.
+	Param                   // A function or macro parameter.
+	Module                  // A name bound to a module by an import statement.
+)
+
+var kindNames = [...]string{"predeclared", "var", "const", "param", "module"}
+
+func (k Kind) String() string { return kindNames[k] }
+
+// An Object is a named entity: a variable, constant, parameter or
+// predeclared name.
+type Object struct {
+	Name string
+	Kind Kind
+
+	// Decl is the LetStatement, ConstStatement, FunctionLiteral,
+	// MacroLiteral, TryExpression, ForStatement or ImportStatement declaring
+	// the object, and Ident the identifier in it naming the object. Both are
+	// nil for predeclared objects, and Ident is nil for modules, whose names
+	// come from their import paths.
+	Decl  ast.Node
+	Ident *ast.Identifier
+}
+
+// Pos returns the position of the identifier declaring obj or, if it has
+// none, of its declaration.
+func (obj *Object) Pos() token.Position {
+	switch {
+	case obj.Ident != nil:
+		return obj.Ident.Pos()
+	case obj.Decl != nil:
+		return obj.Decl.Pos()
+	}
+	return token.Position{}
+}
+
+// A Scope maps names to the objects declared in it.
+type Scope struct {
+	Outer   *Scope
+	Node    ast.Node // The Program, FunctionLiteral, MacroLiteral, TryExpression or ForStatement; nil for the predeclared scope.
+	Objects map[string]*Object
+
+	// First direct use of each name in this scope that did not find a
+	// declaration in it, to detect later declarations.
+	used map[string]*ast.Identifier
+}
+
+func newScope(outer *Scope, node ast.Node) *Scope {
+	return &Scope{
+		Outer:   outer,
+		Node:    node,
+		Objects: make(map[string]*Object),
+		used:    make(map[string]*ast.Identifier),
+	}
+}
+
+// Lookup returns the object name refers to in s, looking in the enclosing
+// scopes if s doesn't declare it, or nil if there is none.
+func (s *Scope) Lookup(name string) *Object {
+	for ; s != nil; s = s.Outer {
+		if obj, ok := s.Objects[name]; ok {
+			return obj
+		}
+	}
+	return nil
+}
+
+// Info holds the result of resolving a program.
+type Info struct {
+	Defs   map[*ast.Identifier]*Object // Identifiers declaring objects.
+	Uses   map[*ast.Identifier]*Object // Identifiers referring to objects.
+	Scopes map[ast.Node]*Scope         // Scopes of the program, of function and macro literals, of block expressions, of try handlers and of for loops.
+}
+
+// An Error reports a problem with a name.
+type Error struct {
+	Pos   token.Position
+	Ident *ast.Identifier // Nil for errors about the name of a module.
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// Resolve resolves the names in program. Names in predeclared, such as
+// builtin functions, are defined in a scope enclosing the program's. The
+// errors returned are *Errors, sorted by position; identifiers they report
+// as undefined are missing from Info.Uses.
+func Resolve(program *ast.Program, predeclared []string) (*Info, []error) {
+	r := &resolver{
+		info: &Info{
+			Defs:   make(map[*ast.Identifier]*Object),
+			Uses:   make(map[*ast.Identifier]*Object),
+			Scopes: make(map[ast.Node]*Scope),
+		},
+	}
+
+	universe := newScope(nil, nil)
+	for _, name := range predeclared {
+		universe.Objects[name] = &Object{Name: name, Kind: Predeclared}
+	}
+
+	r.scope = newScope(universe, program)
+	r.info.Scopes[program] = r.scope
+	for _, stmt := range program.Statements {
+		r.resolve(stmt)
+	}
+	r.closeScope()
+
+	sort.SliceStable(r.errors, func(i, j int) bool {
+		a, b := r.errors[i].(*Error).Pos, r.errors[j].(*Error).Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return r.info, r.errors
+}
+
+// A pendingFunc is a function or macro literal whose body is yet to be
+// resolved, and the scope it appears in.
+type pendingFunc struct {
+	fn    ast.Node
+	scope *Scope
+}
+
+type resolver struct {
+	info   *Info
+	scope  *Scope
+	errors []error
+
+	// Function and macro literals in the current function's scope, to be
+	// resolved once it is complete.
+	pending []pendingFunc
+
+	// Identifiers in the current scope that found no declaration.
+	unresolved []*ast.Identifier
+}
+
+func (r *resolver) errorf(ident *ast.Identifier, format string, a ...interface{}) {
+	r.errors = append(r.errors, &Error{Pos: ident.Pos(), Ident: ident, Msg: fmt.Sprintf(format, a...)})
+}
+
+func (r *resolver) declare(ident *ast.Identifier, kind Kind, decl ast.Node) {
+	if ident == nil {
+		return
+	}
+	r.define(&Object{Name: ident.Value, Kind: kind, Decl: decl, Ident: ident})
+}
+
+// define adds obj to the current scope.
+func (r *resolver) define(obj *Object) {
+	name := obj.Name
+	if prev, ok := r.scope.Objects[name]; ok {
+		r.errors = append(r.errors, &Error{Pos: obj.Pos(), Ident: obj.Ident,
+			Msg: fmt.Sprintf("%s redeclared in this scope; previous declaration at %s", name, prev.Pos())})
+		if obj.Ident != nil {
+			r.info.Defs[obj.Ident] = prev
+		}
+		return
+	}
+	if use, ok := r.scope.used[name]; ok {
+		r.errorf(use, "%s used before its definition at %s", name, obj.Pos())
+		delete(r.scope.used, name)
+	}
+
+	r.scope.Objects[name] = obj
+	if obj.Ident != nil {
+		r.info.Defs[obj.Ident] = obj
+	}
+}
+
+func (r *resolver) use(ident *ast.Identifier) {
+	name := ident.Value
+	if _, ok := r.scope.Objects[name]; !ok {
+		if _, ok := r.scope.used[name]; !ok {
+			r.scope.used[name] = ident
+		}
+	}
+
+	if obj := r.scope.Lookup(name); obj != nil {
+		r.info.Uses[ident] = obj
+	} else {
+		r.unresolved = append(r.unresolved, ident)
+	}
+}
+
+// closeScope resolves the function literals of the current scope, now that
+// it is complete, and reports the names that remain undefined.
+func (r *resolver) closeScope() {
+	scope, pending, unresolved := r.scope, r.pending, r.unresolved
+	defer func() { r.scope = scope }()
+
+	for _, ident := range unresolved {
+		// Defined later in this scope: reported as used before definition.
+		if obj, ok := scope.Objects[ident.Value]; ok {
+			r.info.Uses[ident] = obj
+			continue
+		}
+		r.errorf(ident, "undefined: %s", ident.Value)
+	}
+
+	for _, p := range pending {
+		fn := p.fn
+		r.scope, r.pending, r.unresolved = newScope(p.scope, fn), nil, nil
+		r.info.Scopes[fn] = r.scope
+
+		var params []*ast.Identifier
+		var body *ast.BlockStatement
+		switch fn := fn.(type) {
+		case *ast.FunctionLiteral:
+			params, body = fn.Parameters, fn.Body
+		case *ast.MacroLiteral:
+			params, body = fn.Parameters, fn.Body
+		}
+		for _, param := range params {
+			r.declare(param, Param, fn)
+		}
+		r.resolve(body)
+		r.closeScope()
+	}
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			if len(n.Names) > 0 {
+				for _, name := range n.Names {
+					r.declare(name, Var, n)
+				}
+			} else {
+				r.declare(n.Name, Var, n)
+			}
+			r.resolve(n.Value)
+			return false
+
+		case *ast.ConstStatement:
+			r.declare(n.Name, Const, n)
+			r.resolve(n.Value)
+			return false
+
+		case *ast.ImportStatement:
+			r.define(&Object{Name: n.Name(), Kind: Module, Decl: n})
+			return false
+
+		case *ast.Identifier:
+			r.use(n)
+
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			r.pending = append(r.pending, pendingFunc{fn: n, scope: r.scope})
+			return false
+
+		case *ast.BlockExpression:
+			r.resolveInner(n, nil, n.Block)
+			return false
+
+		case *ast.TryExpression:
+			if n.Body != nil {
+				r.resolve(n.Body)
+			}
+			r.resolveInner(n, n.Param, n.Handler)
+			return false
+
+		case *ast.ForStatement:
+			if n.Iterable != nil {
+				r.resolve(n.Iterable)
+			}
+			r.resolveInner(n, n.Variable, n.Body)
+			return false
+
+		case *ast.QuoteExpression:
+			// Only unquoted expressions are evaluated.
+			ast.Inspect(n.Node, func(n ast.Node) bool {
+				if unquote, ok := n.(*ast.UnquoteExpression); ok {
+					r.resolve(unquote.Node)
+					return false
+				}
+				return true
+			})
+			return false
+		}
+		return true
+	})
+}
+
+// resolveInner resolves block, that of a block expression, the handler of
+// a try expression or the body of a for loop n, in a scope of its own
+// declaring ident, if any. The block runs in place, so names it uses but
+// doesn't declare count as uses in the enclosing scope.
+func (r *resolver) resolveInner(n ast.Node, ident *ast.Identifier, block *ast.BlockStatement) {
+	outer := r.scope
+	r.scope = newScope(outer, n)
+	r.info.Scopes[n] = r.scope
+
+	r.declare(ident, Var, n)
+	if block != nil {
+		r.resolve(block)
+	}
+
+	for name, ident := range r.scope.used {
+		if _, ok := outer.Objects[name]; ok {
+			continue
+		}
+		if _, ok := outer.used[name]; !ok {
+			outer.used[name] = ident
+		}
+	}
+	r.scope = outer
+}
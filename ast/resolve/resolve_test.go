@@ -0,0 +1,171 @@
+package resolve_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/ast/resolve"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+	return program
+}
+
+// identAt returns the identifier at line:col.
+func identAt(t *testing.T, program *ast.Program, line, col int) *ast.Identifier {
+	t.Helper()
+
+	var found *ast.Identifier
+	ast.Inspect(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok && ident.Pos().Line == line && ident.Pos().Column == col {
+			found = ident
+		}
+		return true
+	})
+	if found == nil {
+		t.Fatalf("no identifier at %d:%d", line, col)
+	}
+	return found
+}
+
+func TestResolve(t *testing.T) {
+	input := `let x = 1;
+const c = len(x);
+let f = fn(x, y) { let z = x + y + c; g(z) };
+let g = fn(n) { if (n > 0) { f(n, n) } else { x } };
+let a, b = f(x);`
+
+	program := parse(t, input)
+	info, errs := resolve.Resolve(program, []string{"len"})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	tests := []struct {
+		line, col int
+		decl      string // line:col of the declaring identifier, or "-" for predeclared ones.
+		kind      resolve.Kind
+	}{
+		{2, 11, "-", resolve.Predeclared}, // len
+		{2, 15, "1:5", resolve.Var},       // x
+		{3, 36, "2:7", resolve.Const},     // c
+		{3, 28, "3:12", resolve.Param},    // x, shadowing the global x
+		{3, 39, "4:5", resolve.Var},       // g, defined after f
+		{3, 41, "3:24", resolve.Var},      // z
+		{4, 30, "3:5", resolve.Var},       // f
+		{4, 47, "1:5", resolve.Var},       // x
+		{5, 12, "3:5", resolve.Var},       // f
+		{5, 14, "1:5", resolve.Var},       // x
+	}
+
+	for _, tt := range tests {
+		ident := identAt(t, program, tt.line, tt.col)
+		obj := info.Uses[ident]
+		if obj == nil {
+			t.Errorf("%s at %d:%d not resolved", ident.Value, tt.line, tt.col)
+			continue
+		}
+		if obj.Name != ident.Value || obj.Kind != tt.kind || obj.Pos().String() != tt.decl {
+			t.Errorf("%s at %d:%d resolved wrongly. want=%s %s, got=%s %s at %s",
+				ident.Value, tt.line, tt.col, tt.kind, tt.decl, obj.Kind, obj.Name, obj.Pos())
+		}
+	}
+
+	// Declaring identifiers are recorded as such.
+	a, b := identAt(t, program, 5, 5), identAt(t, program, 5, 8)
+	if info.Defs[a] == nil || info.Defs[b] == nil || info.Defs[a].Decl != program.Statements[4] {
+		t.Errorf("destructuring let not recorded in Defs")
+	}
+	if _, ok := info.Uses[a]; ok {
+		t.Errorf("declaring identifier recorded as a use")
+	}
+
+	fn := program.Statements[2].(*ast.LetStatement).Value
+	scope := info.Scopes[fn]
+	if scope == nil || scope.Outer != info.Scopes[program] {
+		t.Fatalf("wrong scope for function literal")
+	}
+	if scope.Lookup("z") == nil || scope.Lookup("len") == nil || info.Scopes[program].Lookup("z") != nil {
+		t.Errorf("wrong scope lookups")
+	}
+}
+
+func TestResolveImport(t *testing.T) {
+	program := parse(t, `import "lib/strings"; strings["upper"]("a")`)
+	info, errs := resolve.Resolve(program, nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	obj := info.Uses[identAt(t, program, 1, 23)]
+	if obj == nil || obj.Kind != resolve.Module || obj.Decl != program.Statements[0] || obj.Ident != nil {
+		t.Fatalf("module name resolved wrongly. got=%+v", obj)
+	}
+	if obj.Pos().String() != "1:1" {
+		t.Errorf("wrong position for module name. want=1:1, got=%s", obj.Pos())
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x + y", []string{"1:16: undefined: y"}},
+		{"x; let x = 1;", []string{"1:1: x used before its definition at 1:8"}},
+		{"let x = 1; fn() { x; let x = 2; }", []string{"1:19: x used before its definition at 1:26"}},
+		{"let x = 1; let x = 2;", []string{"1:16: x redeclared in this scope; previous declaration at 1:5"}},
+		{"let x, x = f();", []string{"1:8: x redeclared in this scope; previous declaration at 1:5", "1:12: undefined: f"}},
+		{"fn(a, a) { a }", []string{"1:7: a redeclared in this scope; previous declaration at 1:4"}},
+		{"fn(a) { const a = 1; }", []string{"1:15: a redeclared in this scope; previous declaration at 1:4"}},
+		{"fn() { fn() { q } }; let q = 1;", []string{}},
+		{"let f = fn() { u };", []string{"1:16: undefined: u"}},
+		{"let m = macro(a) { quote(a + unquote(a + b)) };", []string{"1:42: undefined: b"}},
+		{"let x = 1; fn(x) { let y = x; }", []string{}},
+		{"let f = fn() { f() };", []string{}},
+		{"if (true) { let v = 1; } v", []string{}},
+		{"let v = { let t = 1; t }; t", []string{"1:27: undefined: t"}},
+		{"let v = 1; { let v = 2; v }", []string{}},
+		{"{ v }; let v = 1;", []string{"1:3: v used before its definition at 1:12"}},
+		{"try { 1 } catch (e) { e }; try { 2 } catch (e) { e }", []string{}},
+		{"try { e } catch (e) { 1 }", []string{"1:7: undefined: e"}},
+		{"try { 1 } catch (e) { let v = e; } v", []string{"1:36: undefined: v"}},
+		{"try { 1 } catch (e) { x }; let x = 1;", []string{"1:23: x used before its definition at 1:32"}},
+		{"try { 1 } catch (e) { fn() { e + y } }; let y = 1;", []string{}},
+		{"let e = 1; try { 1 } catch (e) { e }", []string{}},
+		{"try { 1 } catch (e) { let e = 2; }", []string{"1:27: e redeclared in this scope; previous declaration at 1:18"}},
+		{"for (x in [1]) { x }; for (x in [2]) { x }", []string{}},
+		{"x = 1", []string{"1:1: undefined: x"}},
+		{"let n = 0; let inc = fn() { n = n + 1 }; for (x in [1]) { n = x }", []string{}},
+		{"for (x in x) { 1 }", []string{"1:11: undefined: x"}},
+		{"for (x in [1]) { let v = x; } v", []string{"1:31: undefined: v"}},
+		{"let n = 3; while (n > 0) { let m = n; } m", []string{}},
+		{"for (x in [1]) { let x = 2; }", []string{"1:22: x redeclared in this scope; previous declaration at 1:6"}},
+		{`import "lib/strings"; strings; fn() { strings }`, []string{}},
+		{`import "a/x"; let x = 1;`, []string{"1:19: x redeclared in this scope; previous declaration at 1:1"}},
+		{`let x = 1; import "x.monkey";`, []string{"1:12: x redeclared in this scope; previous declaration at 1:5"}},
+		{`strings; import "strings";`, []string{"1:1: strings used before its definition at 1:10"}},
+	}
+
+	for _, tt := range tests {
+		_, errs := resolve.Resolve(parse(t, tt.input), nil)
+		if len(errs) != len(tt.expected) {
+			t.Errorf("Resolve(%q) wrong number of errors. want=%q, got=%v", tt.input, tt.expected, errs)
+			continue
+		}
+		for i, err := range errs {
+			if err.Error() != tt.expected[i] {
+				t.Errorf("Resolve(%q) error %d wrong. want=%q, got=%q", tt.input, i, tt.expected[i], err)
+			}
+		}
+	}
+}
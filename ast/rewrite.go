@@ -0,0 +1,356 @@
+package ast
+
+import "fmt"
+
+// An ApplyFunc is invoked by Apply for each non-nil node n, before and/or
+// after the node's children, using a Cursor describing the current
+// node and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal. See
+// Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a syntax tree recursively, starting with root, and calling
+// pre and post for each node as described below. Apply returns the syntax
+// tree, possibly modified.
+//
+// If pre is not nil, it is called for each node before the node's children
+// are traversed (pre-order). If pre returns false, no children are traversed,
+// and post is not called for that node.
+//
+// If post is not nil, and a prior call of pre didn't return false, post is
+// called for each node after its children are traversed (post-order). If post
+// returns false, traversal is terminated and Apply returns immediately.
+//
+// Only fields that refer to AST nodes are considered children; i.e. the
+// Strings of an InterpolatedString are not. Nil children are skipped.
+//
+// Children are traversed in source order. Modifications to the current node
+// through the Cursor are reflected in what is traversed next: a node
+// replaced in pre has the children of its replacement traversed, while nodes
+// inserted before or after the current one are not visited.
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	parent := &struct{ Node }{root}
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = parent.Node
+	}()
+
+	a := &application{pre: pre, post: post}
+	applyField(a, parent, "Node", &parent.Node)
+	return
+}
+
+var abort = new(int) // Singleton, to signal termination of Apply.
+
+// A Cursor describes a node encountered during Apply. Information about the
+// node and its parent is available from the Node, Parent, Name, and Index
+// methods.
+//
+// The methods Replace, Delete, InsertBefore, and InsertAfter can be used to
+// change the AST without disrupting Apply. A Cursor is only valid during the
+// ApplyFunc call it was passed to.
+type Cursor struct {
+	parent Node
+	name   string
+	list   nodeList  // The slice containing the current node, if any.
+	iter   *iterator // Valid if list is not nil.
+	set    func(Node)
+	node   Node
+}
+
+// Node returns the current Node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current Node.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent Node field that contains the current
+// Node. If the parent is a *HashLiteral, the name is that of the HashPair
+// field, i.e. "Key" or "Value".
+func (c *Cursor) Name() string { return c.name }
+
+// Index reports the index of the current Node in the slice of Nodes that
+// contains it, or a value < 0 if the current Node is not part of a slice
+// that can be edited. The index of the current node changes if
+// InsertBefore is called while processing the current node.
+func (c *Cursor) Index() int {
+	if c.list != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// Replace replaces the current Node with n. The replacement node is not
+// walked by Apply. Replace panics if n cannot be stored where the current
+// Node is, e.g. if an expression would replace a statement. Outside of
+// slices n may be nil, which clears the field; use Delete to remove a node
+// from a slice.
+func (c *Cursor) Replace(n Node) {
+	if c.list != nil {
+		c.list.set(c.iter.index, n)
+	} else {
+		c.set(n)
+	}
+	c.node = n
+}
+
+// Delete deletes the current Node from its containing slice. If the current
+// Node is not part of a slice, Delete panics.
+func (c *Cursor) Delete() {
+	if c.list == nil {
+		panic(fmt.Sprintf("ast.Cursor.Delete: %s of %T is not a slice", c.name, c.parent))
+	}
+	c.list.delete(c.iter.index)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current Node in its containing slice. If
+// the current Node is not part of a slice, InsertAfter panics. Apply does
+// not walk n.
+func (c *Cursor) InsertAfter(n Node) {
+	if c.list == nil {
+		panic(fmt.Sprintf("ast.Cursor.InsertAfter: %s of %T is not a slice", c.name, c.parent))
+	}
+	c.list.insert(c.iter.index+1, n)
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current Node in its containing slice. If
+// the current Node is not part of a slice, InsertBefore panics. Apply does
+// not walk n.
+func (c *Cursor) InsertBefore(n Node) {
+	if c.list == nil {
+		panic(fmt.Sprintf("ast.Cursor.InsertBefore: %s of %T is not a slice", c.name, c.parent))
+	}
+	c.list.insert(c.iter.index, n)
+	c.iter.index++
+}
+
+// nodeList gives uniform access to the node slices that Cursors can edit.
+type nodeList interface {
+	len() int
+	at(i int) Node
+	set(i int, n Node)
+	insert(i int, n Node)
+	delete(i int)
+}
+
+type sliceList[T Node] struct{ s *[]T }
+
+func (l sliceList[T]) len() int          { return len(*l.s) }
+func (l sliceList[T]) at(i int) Node     { return (*l.s)[i] }
+func (l sliceList[T]) set(i int, n Node) { (*l.s)[i] = n.(T) }
+
+func (l sliceList[T]) insert(i int, n Node) {
+	var zero T
+	*l.s = append(*l.s, zero)
+	copy((*l.s)[i+1:], (*l.s)[i:])
+	(*l.s)[i] = n.(T)
+}
+
+func (l sliceList[T]) delete(i int) {
+	copy((*l.s)[i:], (*l.s)[i+1:])
+	var zero T
+	(*l.s)[len(*l.s)-1] = zero
+	*l.s = (*l.s)[:len(*l.s)-1]
+}
+
+type iterator struct {
+	index, step int
+}
+
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+}
+
+func (a *application) apply(parent Node, name string, set func(Node), n Node) {
+	saved := a.cursor
+	a.cursor = Cursor{parent: parent, name: name, set: set, node: n}
+	a.visit()
+	a.cursor = saved
+}
+
+func (a *application) applyList(parent Node, name string, list nodeList) {
+	saved := a.iter
+	a.iter.index = 0
+	for a.iter.index < list.len() {
+		a.iter.step = 1
+		if n := list.at(a.iter.index); n != nil {
+			savedCursor := a.cursor
+			a.cursor = Cursor{parent: parent, name: name, list: list, iter: &a.iter, node: n}
+			a.visit()
+			a.cursor = savedCursor
+		}
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
+
+// visit calls pre, traverses the children of the cursor's node and calls
+// post.
+func (a *application) visit() {
+	if a.pre != nil && !a.pre(&a.cursor) {
+		return
+	}
+
+	switch n := a.cursor.node.(type) {
+	case nil:
+		// Deleted or replaced with nothing by pre.
+
+	case *Program:
+		a.applyList(n, "Statements", sliceList[Statement]{&n.Statements})
+
+	case *LetStatement:
+		if len(n.Names) > 0 {
+			a.applyList(n, "Names", sliceList[*Identifier]{&n.Names})
+			if len(n.Names) > 0 {
+				n.Name = n.Names[0]
+			}
+		} else {
+			applyField(a, n, "Name", &n.Name)
+		}
+		applyField(a, n, "Value", &n.Value)
+
+	case *ConstStatement:
+		applyField(a, n, "Name", &n.Name)
+		applyField(a, n, "Value", &n.Value)
+
+	case *ReturnStatement:
+		applyField(a, n, "ReturnValue", &n.ReturnValue)
+
+	case *WhileStatement:
+		applyField(a, n, "Condition", &n.Condition)
+		applyField(a, n, "Body", &n.Body)
+
+	case *ForStatement:
+		applyField(a, n, "Variable", &n.Variable)
+		applyField(a, n, "Iterable", &n.Iterable)
+		applyField(a, n, "Body", &n.Body)
+
+	case *BreakStatement, *ContinueStatement:
+		// Leaves.
+
+	case *ImportStatement:
+		applyField(a, n, "Path", &n.Path)
+
+	case *ExpressionStatement:
+		applyField(a, n, "Expression", &n.Expression)
+
+	case *BlockStatement:
+		a.applyList(n, "Statements", sliceList[Statement]{&n.Statements})
+
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean, *Comment:
+		// Leaves.
+
+	case *InterpolatedString:
+		// The expressions can't be deleted or inserted independently of
+		// the surrounding strings, so they are visited as single fields.
+		for i := range n.Exprs {
+			applyField(a, n, "Exprs", &n.Exprs[i])
+		}
+
+	case *PrefixExpression:
+		applyField(a, n, "Right", &n.Right)
+
+	case *InfixExpression:
+		applyField(a, n, "Left", &n.Left)
+		applyField(a, n, "Right", &n.Right)
+
+	case *AssignExpression:
+		applyField(a, n, "Name", &n.Name)
+		applyField(a, n, "Value", &n.Value)
+
+	case *ParenExpression:
+		applyField(a, n, "Expression", &n.Expression)
+
+	case *IfExpression:
+		applyField(a, n, "Condition", &n.Condition)
+		applyField(a, n, "Consequence", &n.Consequence)
+		applyField(a, n, "Alternative", &n.Alternative)
+
+	case *TryExpression:
+		applyField(a, n, "Body", &n.Body)
+		applyField(a, n, "Param", &n.Param)
+		applyField(a, n, "Handler", &n.Handler)
+
+	case *FunctionLiteral:
+		a.applyList(n, "Parameters", sliceList[*Identifier]{&n.Parameters})
+		applyField(a, n, "Body", &n.Body)
+
+	case *MacroLiteral:
+		a.applyList(n, "Parameters", sliceList[*Identifier]{&n.Parameters})
+		applyField(a, n, "Body", &n.Body)
+
+	case *CallExpression:
+		applyField(a, n, "Function", &n.Function)
+		a.applyList(n, "Arguments", sliceList[Expression]{&n.Arguments})
+
+	case *ArrayLiteral:
+		a.applyList(n, "Elements", sliceList[Expression]{&n.Elements})
+
+	case *IndexExpression:
+		applyField(a, n, "Left", &n.Left)
+		applyField(a, n, "Index", &n.Index)
+
+	case *SliceExpression:
+		applyField(a, n, "Left", &n.Left)
+		applyField(a, n, "Low", &n.Low)
+		applyField(a, n, "High", &n.High)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			if pair == nil {
+				continue
+			}
+			applyField(a, n, "Key", &pair.Key)
+			applyField(a, n, "Value", &pair.Value)
+		}
+
+	case *TupleLiteral:
+		a.applyList(n, "Elements", sliceList[Expression]{&n.Elements})
+
+	case *SpreadExpression:
+		applyField(a, n, "Value", &n.Value)
+
+	case *BlockExpression:
+		applyField(a, n, "Block", &n.Block)
+
+	case *QuoteExpression:
+		applyField(a, n, "Node", &n.Node)
+
+	case *UnquoteExpression:
+		applyField(a, n, "Node", &n.Node)
+
+	case *CommentGroup:
+		a.applyList(n, "List", sliceList[*Comment]{&n.List})
+
+	default:
+		panic(fmt.Sprintf("ast.Apply: unexpected node type %T", n))
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+}
+
+// applyField visits the node stored in a single field of parent, unless the
+// field is nil.
+func applyField[T Node](a *application, parent Node, name string, field *T) {
+	var zero T
+	if any(*field) == any(zero) {
+		return
+	}
+
+	a.apply(parent, name, func(x Node) {
+		if x == nil {
+			*field = zero
+		} else {
+			*field = x.(T)
+		}
+	}, *field)
+}
@@ -0,0 +1,158 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/token"
+)
+
+func TestApplyReplace(t *testing.T) {
+	program := parse(t, "let x = a + b; f(a, [a]);")
+
+	// Rename every `a` to `z`.
+	result := ast.Apply(program, nil, func(c *ast.Cursor) bool {
+		if ident, ok := c.Node().(*ast.Identifier); ok && ident.Value == "a" {
+			c.Replace(&ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: "z"}, Value: "z"})
+		}
+		return true
+	})
+
+	if result != program {
+		t.Fatalf("Apply returned a different root")
+	}
+	if program.String() != "let x = (z + b); f(z, [z])" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestApplyReplaceRoot(t *testing.T) {
+	program := parse(t, "1")
+	replacement := parse(t, "2")
+
+	result := ast.Apply(program, func(c *ast.Cursor) bool {
+		if c.Node() == program {
+			c.Replace(replacement)
+			return false
+		}
+		return true
+	}, nil)
+
+	if result != replacement {
+		t.Errorf("root was not replaced. got=%q", result)
+	}
+}
+
+func TestApplyDeleteAndInsert(t *testing.T) {
+	program := parse(t, "a; debug(1); b; c;")
+
+	var visited []string
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		stmt, ok := c.Node().(*ast.ExpressionStatement)
+		if !ok {
+			return true
+		}
+
+		visited = append(visited, stmt.String())
+		switch stmt.String() {
+		case "debug(1)":
+			c.Delete()
+		case "b":
+			c.InsertBefore(parse(t, "before;").Statements[0])
+			c.InsertAfter(parse(t, "after;").Statements[0])
+		}
+		return false
+	}, nil)
+
+	if program.String() != "a; before; b; after; c" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	expected := "a,debug(1),b,c,"
+	got := ""
+	for _, v := range visited {
+		got += v + ","
+	}
+	if got != expected {
+		t.Errorf("wrong visit order. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestApplyCursorInfo(t *testing.T) {
+	program := parse(t, `fn(x, y) { {"k": x} }`)
+
+	type info struct {
+		name  string
+		index int
+	}
+	var got []info
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		if _, ok := c.Node().(*ast.Identifier); ok {
+			got = append(got, info{c.Name(), c.Index()})
+		}
+		if _, ok := c.Node().(*ast.StringLiteral); ok {
+			if _, ok := c.Parent().(*ast.HashLiteral); !ok {
+				t.Errorf("parent of hash key is %T", c.Parent())
+			}
+			got = append(got, info{c.Name(), c.Index()})
+		}
+		return true
+	}, nil)
+
+	expected := []info{{"Parameters", 0}, {"Parameters", 1}, {"Key", -1}, {"Value", -1}}
+	if len(got) != len(expected) {
+		t.Fatalf("wrong number of cursors. want=%d, got=%d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("cursor %d wrong. want=%+v, got=%+v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestApplyAbort(t *testing.T) {
+	program := parse(t, "a; b; c;")
+
+	var visited []string
+	ast.Apply(program, nil, func(c *ast.Cursor) bool {
+		if ident, ok := c.Node().(*ast.Identifier); ok {
+			visited = append(visited, ident.Value)
+			return ident.Value != "b"
+		}
+		return true
+	})
+
+	if len(visited) != 2 {
+		t.Errorf("traversal not aborted. visited=%v", visited)
+	}
+}
+
+func TestApplyClearOptionalField(t *testing.T) {
+	program := parse(t, "if (x) { 1 } else { 2 }")
+
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		if c.Name() == "Alternative" {
+			c.Replace(nil)
+		}
+		return true
+	}, nil)
+
+	if program.String() != "if (x) { 1 }" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestApplyDeleteOutsideSlicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic")
+		}
+	}()
+
+	ast.Apply(parse(t, "-x"), func(c *ast.Cursor) bool {
+		if _, ok := c.Node().(*ast.Identifier); ok {
+			c.Delete()
+		}
+		return true
+	}, nil)
+}
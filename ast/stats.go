@@ -0,0 +1,48 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Metrics summarize the size and shape of a tree, e.g. to enforce complexity
+// limits on untrusted scripts or to implement linter rules.
+type Metrics struct {
+	Nodes     int            // Total number of nodes.
+	Kinds     map[string]int // Number of nodes per type name, e.g. "Identifier".
+	MaxDepth  int            // Depth of the deepest node; the root is at depth 1.
+	Functions int            // Number of function literals.
+}
+
+// Stats returns the Metrics of the tree rooted at node, counting the nodes
+// visited by Inspect.
+func Stats(node Node) Metrics {
+	stats := Metrics{Kinds: make(map[string]int)}
+	depth := 0
+
+	Inspect(node, func(n Node) bool {
+		if n == nil {
+			depth--
+			return true
+		}
+
+		depth++
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+		stats.Nodes++
+		stats.Kinds[kindName(n)]++
+		if _, ok := n.(*FunctionLiteral); ok {
+			stats.Functions++
+		}
+		return true
+	})
+
+	return stats
+}
+
+// kindName returns the name of the type of n without its package, e.g.
+// "Identifier" for an *Identifier.
+func kindName(n Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+}
@@ -0,0 +1,47 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+)
+
+func TestStats(t *testing.T) {
+	program := parse(t, `let add = fn(a, b) { a + b };
+		let twice = fn(f) { fn(x) { f(f(x)) } };`)
+
+	stats := ast.Stats(program)
+
+	expectedKinds := map[string]int{
+		"Program":             1,
+		"LetStatement":        2,
+		"ExpressionStatement": 3,
+		"BlockStatement":      3,
+		"FunctionLiteral":     3,
+		"Identifier":          11,
+		"InfixExpression":     1,
+		"CallExpression":      2,
+	}
+	if !reflect.DeepEqual(stats.Kinds, expectedKinds) {
+		t.Errorf("stats.Kinds wrong.\nwant=%v\ngot= %v", expectedKinds, stats.Kinds)
+	}
+	if stats.Nodes != 26 {
+		t.Errorf("stats.Nodes wrong. want=26, got=%d", stats.Nodes)
+	}
+	if stats.Functions != 3 {
+		t.Errorf("stats.Functions wrong. want=3, got=%d", stats.Functions)
+	}
+	// Program, let, fn, block, expression statement, fn, block, expression
+	// statement, call f(...), call f(x), x.
+	if stats.MaxDepth != 11 {
+		t.Errorf("stats.MaxDepth wrong. want=11, got=%d", stats.MaxDepth)
+	}
+}
+
+func TestStatsLeaf(t *testing.T) {
+	stats := ast.Stats(&ast.IntegerLiteral{Value: 1})
+	if stats.Nodes != 1 || stats.MaxDepth != 1 || stats.Kinds["IntegerLiteral"] != 1 {
+		t.Errorf("stats of a leaf wrong. got=%+v", stats)
+	}
+}
@@ -0,0 +1,205 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk. If
+// the result visitor w is not nil, Walk visits each of the children of node
+// with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first, source order. It starts by calling
+// v.Visit(node); node must not be nil. Nil children, as left behind by a
+// parser recovering from errors, are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		if len(n.Names) > 0 {
+			for _, name := range n.Names {
+				walkIdent(v, name)
+			}
+		} else {
+			walkIdent(v, n.Name)
+		}
+		walkExpr(v, n.Value)
+
+	case *ConstStatement:
+		walkIdent(v, n.Name)
+		walkExpr(v, n.Value)
+
+	case *ReturnStatement:
+		walkExpr(v, n.ReturnValue)
+
+	case *WhileStatement:
+		walkExpr(v, n.Condition)
+		walkBlock(v, n.Body)
+
+	case *ForStatement:
+		walkIdent(v, n.Variable)
+		walkExpr(v, n.Iterable)
+		walkBlock(v, n.Body)
+
+	case *BreakStatement, *ContinueStatement:
+		// Leaves.
+
+	case *ImportStatement:
+		if n.Path != nil {
+			Walk(v, n.Path)
+		}
+
+	case *ExpressionStatement:
+		walkExpr(v, n.Expression)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean, *Comment:
+		// Leaves.
+
+	case *InterpolatedString:
+		walkExprs(v, n.Exprs)
+
+	case *PrefixExpression:
+		walkExpr(v, n.Right)
+
+	case *InfixExpression:
+		walkExpr(v, n.Left)
+		walkExpr(v, n.Right)
+
+	case *AssignExpression:
+		walkIdent(v, n.Name)
+		walkExpr(v, n.Value)
+
+	case *ParenExpression:
+		walkExpr(v, n.Expression)
+
+	case *IfExpression:
+		walkExpr(v, n.Condition)
+		walkBlock(v, n.Consequence)
+		walkBlock(v, n.Alternative)
+
+	case *TryExpression:
+		walkBlock(v, n.Body)
+		walkIdent(v, n.Param)
+		walkBlock(v, n.Handler)
+
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			walkIdent(v, param)
+		}
+		walkBlock(v, n.Body)
+
+	case *MacroLiteral:
+		for _, param := range n.Parameters {
+			walkIdent(v, param)
+		}
+		walkBlock(v, n.Body)
+
+	case *CallExpression:
+		walkExpr(v, n.Function)
+		walkExprs(v, n.Arguments)
+
+	case *ArrayLiteral:
+		walkExprs(v, n.Elements)
+
+	case *IndexExpression:
+		walkExpr(v, n.Left)
+		walkExpr(v, n.Index)
+
+	case *SliceExpression:
+		walkExpr(v, n.Left)
+		walkExpr(v, n.Low)
+		walkExpr(v, n.High)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			if pair == nil {
+				continue
+			}
+			walkExpr(v, pair.Key)
+			walkExpr(v, pair.Value)
+		}
+
+	case *TupleLiteral:
+		walkExprs(v, n.Elements)
+
+	case *SpreadExpression:
+		walkExpr(v, n.Value)
+
+	case *BlockExpression:
+		walkBlock(v, n.Block)
+
+	case *QuoteExpression:
+		walkExpr(v, n.Node)
+
+	case *UnquoteExpression:
+		walkExpr(v, n.Node)
+
+	case *CommentGroup:
+		for _, c := range n.List {
+			Walk(v, c)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, stmt := range list {
+		if stmt != nil {
+			Walk(v, stmt)
+		}
+	}
+}
+
+func walkExprs(v Visitor, list []Expression) {
+	for _, exp := range list {
+		walkExpr(v, exp)
+	}
+}
+
+func walkExpr(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+func walkIdent(v Visitor, ident *Identifier) {
+	if ident != nil {
+		Walk(v, ident)
+	}
+}
+
+func walkBlock(v Visitor, block *BlockStatement) {
+	if block != nil {
+		Walk(v, block)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first, source order. It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a call
+// of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,155 @@
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+	return program
+}
+
+// nodeLabel describes a node by its type and, for leaves, its literal.
+func nodeLabel(n ast.Node) string {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+	switch n := n.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return name + " " + n.TokenLiteral()
+	}
+	return name
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, `let a, b = f(1, xs...);
+		if (a < b) { return [a, {"k": b}][0]; } else { -b }
+		const c = fn(x, rest...) { "${x}" };`)
+
+	var visited []string
+	depth := 0
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		visited = append(visited, strings.Repeat(".", depth)+nodeLabel(n))
+		depth++
+		return true
+	})
+
+	expected := []string{
+		"Program",
+		".LetStatement",
+		"..Identifier a",
+		"..Identifier b",
+		"..CallExpression",
+		"...Identifier f",
+		"...IntegerLiteral 1",
+		"...SpreadExpression",
+		"....Identifier xs",
+		".ExpressionStatement",
+		"..IfExpression",
+		"...InfixExpression",
+		"....Identifier a",
+		"....Identifier b",
+		"...BlockStatement",
+		"....ReturnStatement",
+		".....IndexExpression",
+		"......ArrayLiteral",
+		".......Identifier a",
+		".......HashLiteral",
+		"........StringLiteral k",
+		"........Identifier b",
+		"......IntegerLiteral 0",
+		"...BlockStatement",
+		"....ExpressionStatement",
+		".....PrefixExpression",
+		"......Identifier b",
+		".ConstStatement",
+		"..Identifier c",
+		"..FunctionLiteral",
+		"...Identifier x",
+		"...Identifier rest",
+		"...BlockStatement",
+		"....ExpressionStatement",
+		".....InterpolatedString",
+		"......Identifier x",
+	}
+
+	if strings.Join(visited, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong traversal.\nwant:\n%s\ngot:\n%s",
+			strings.Join(expected, "\n"), strings.Join(visited, "\n"))
+	}
+	if depth != 0 {
+		t.Errorf("unbalanced nil visits. depth=%d", depth)
+	}
+}
+
+func TestInspectPrune(t *testing.T) {
+	program := parse(t, `let f = fn(x) { y + x }; g(z);`)
+
+	var idents []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		if ident, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		return true
+	})
+
+	if strings.Join(idents, ",") != "f,g,z" {
+		t.Errorf("wrong identifiers. got=%v", idents)
+	}
+}
+
+func TestWalkPartialTree(t *testing.T) {
+	p := parser.New(lexer.New("if (x) { 1 } else"))
+	program := p.ParseProgram()
+
+	count := 0
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			count++
+		}
+		return true
+	})
+	if count == 0 {
+		t.Errorf("nothing visited")
+	}
+}
+
+type countingVisitor map[string]int
+
+func (c countingVisitor) Visit(n ast.Node) ast.Visitor {
+	if n != nil {
+		c[nodeLabel(n)]++
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	counts := countingVisitor{}
+	ast.Walk(counts, parse(t, "x + x * 2; quote(unquote(x)); macro(a) { a }"))
+
+	if counts["Identifier x"] != 3 {
+		t.Errorf("wrong count for x. got=%d", counts["Identifier x"])
+	}
+	for _, label := range []string{"QuoteExpression", "UnquoteExpression", "MacroLiteral"} {
+		if counts[label] != 1 {
+			t.Errorf("wrong count for %s. got=%d", label, counts[label])
+		}
+	}
+}
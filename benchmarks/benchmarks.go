@@ -0,0 +1,97 @@
+// Package benchmarks holds Monkey programs for comparing the performance of
+// the evaluator and the VM. The benchmarks of its tests run each program on
+// both engines, as Programs/<name>/evaluator and Programs/<name>/vm, so that
+// the output of
+//
+//	go test -run '^$' -bench . -count 10 ./benchmarks
+//
+// before and after a change can be compared with benchstat, and the two
+// engines with each other. With -register, the programs also run on the
+// experimental register machine of the register package, as
+// Programs/<name>/register, which the tests check the programs against
+// either way.
+//
+// The programs only use what both engines support, which rules out loops
+// and assignment: they iterate by recursion, kept shallow enough for the
+// VM's frames.
+package benchmarks
+
+// Program is a benchmark program.
+type Program struct {
+	Name   string
+	Source string
+
+	// Want is the Inspect of the value the program evaluates to.
+	Want string
+}
+
+// Programs are the benchmark programs.
+var Programs = []Program{
+	{
+		Name: "fib",
+		Source: `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(20)`,
+		Want: "6765",
+	},
+	{
+		Name: "strings",
+		Source: `
+let build = fn(n, s) {
+  if (n == 0) { return s; }
+  build(n - 1, s + str(n % 10) + ",")
+};
+len(build(400, ""))`,
+		Want: "800",
+	},
+	{
+		Name: "sort",
+		Source: lists + `
+let merge = fn(a, b, out) {
+  if (len(a) == 0) { return reduce(b, push, out); }
+  if (len(b) == 0) { return reduce(a, push, out); }
+  if (first(a) < first(b)) {
+    merge(rest(a), b, push(out, first(a)))
+  } else {
+    merge(a, rest(b), push(out, first(b)))
+  }
+};
+let mergeSort = fn(xs) {
+  if (len(xs) < 2) { return xs; }
+  let half = len(xs) / 2;
+  merge(mergeSort(take(xs, half, [])), mergeSort(drop(xs, half)), [])
+};
+let xs = numbers(200, 1, []);
+mergeSort(xs) == sort(xs, fn(a, b) { a < b })`,
+		Want: "true",
+	},
+	{
+		Name: "closures",
+		Source: lists + `
+let adder = fn(x) { fn(y) { x + y } };
+let compose = fn(f, g) { fn(x) { g(f(x)) } };
+let chain = fn(n, f) { if (n == 0) { f } else { chain(n - 1, compose(f, adder(n))) } };
+let addAll = chain(100, fn(x) { x });
+reduce(map(numbers(50, 7, []), addAll), fn(sum, x) { sum + x - 5050 }, 0)`,
+		Want: "26001",
+	},
+}
+
+// lists defines the functions on arrays that the programs share: numbers
+// returns n pseudo-random integers below 1000 appended to out, take the
+// first n elements of xs appended to out, and drop the others.
+const lists = `
+let numbers = fn(n, seed, out) {
+  if (n == 0) { return out; }
+  let next = (seed * 1103515245 + 12345) % 2147483648;
+  numbers(n - 1, next, push(out, next % 1000))
+};
+let take = fn(xs, n, out) {
+  if (len(out) == n) { return out; }
+  take(xs, n, push(out, xs[len(out)]))
+};
+let drop = fn(xs, n) {
+  if (n == 0) { return xs; }
+  drop(rest(xs), n - 1)
+};
+`
@@ -0,0 +1,117 @@
+package benchmarks
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/compiler"
+	"github.com/j4nu5/monkey/evaluator"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/parser"
+	"github.com/j4nu5/monkey/register"
+	"github.com/j4nu5/monkey/vm"
+)
+
+var registerFlag = flag.Bool("register", false, "also benchmark the experimental register machine")
+
+func TestPrograms(t *testing.T) {
+	for _, p := range Programs {
+		program := parse(t, p)
+
+		if got := evaluator.Eval(program, object.NewEnvironment()); got.Inspect() != p.Want {
+			t.Errorf("%s: evaluator gave %s, want %s", p.Name, got.Inspect(), p.Want)
+		}
+
+		machine := vm.New(compile(t, p, program))
+		if err := machine.Run(); err != nil {
+			t.Errorf("%s: vm error: %s", p.Name, err)
+		} else if got := machine.LastPoppedStackElem(); got.Inspect() != p.Want {
+			t.Errorf("%s: vm gave %s, want %s", p.Name, got.Inspect(), p.Want)
+		}
+
+		regMachine := register.New(compileRegister(t, p, program))
+		if err := regMachine.Run(); err != nil {
+			t.Errorf("%s: register machine error: %s", p.Name, err)
+		} else if got := regMachine.Result(); got.Inspect() != p.Want {
+			t.Errorf("%s: register machine gave %s, want %s", p.Name, got.Inspect(), p.Want)
+		}
+	}
+}
+
+// BenchmarkPrograms runs the programs on both engines, and with -register
+// on the register machine too. Parsing and compiling are left out.
+func BenchmarkPrograms(b *testing.B) {
+	for _, p := range Programs {
+		program := parse(b, p)
+		bytecode := compile(b, p, program)
+
+		b.Run(p.Name+"/evaluator", func(b *testing.B) {
+			in := evaluator.New()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if result := in.Eval(program, object.NewEnvironment()); result.Type() == object.ERROR_OBJ {
+					b.Fatalf("evaluator error: %s", result.Inspect())
+				}
+			}
+		})
+
+		b.Run(p.Name+"/vm", func(b *testing.B) {
+			machine := vm.New(bytecode)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				machine.Reset(bytecode)
+				if err := machine.Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+
+		if !*registerFlag {
+			continue
+		}
+		regProgram := compileRegister(b, p, program)
+		b.Run(p.Name+"/register", func(b *testing.B) {
+			machine := register.New(regProgram)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				machine.Reset(regProgram)
+				if err := machine.Run(); err != nil {
+					b.Fatalf("register machine error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func parse(tb testing.TB, p Program) *ast.Program {
+	tb.Helper()
+
+	par := parser.New(lexer.New(p.Source))
+	program := par.ParseProgram()
+	if errs := par.Errors(); len(errs) > 0 {
+		tb.Fatalf("%s: parser errors: %v", p.Name, errs)
+	}
+	return program
+}
+
+func compile(tb testing.TB, p Program, program *ast.Program) *compiler.Bytecode {
+	tb.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		tb.Fatalf("%s: compiler error: %s", p.Name, err)
+	}
+	return comp.Bytecode()
+}
+
+func compileRegister(tb testing.TB, p Program, program *ast.Program) *register.Program {
+	tb.Helper()
+
+	comp := register.NewCompiler()
+	if err := comp.Compile(program); err != nil {
+		tb.Fatalf("%s: register compiler error: %s", p.Name, err)
+	}
+	return comp.Program()
+}
@@ -0,0 +1,327 @@
+// Package code defines the bytecode the compiler emits: instructions are an
+// opcode byte followed by its operands, each a big-endian unsigned integer
+// of the width the opcode's Definition gives.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/j4nu5/monkey/token"
+)
+
+// Instructions is a sequence of encoded instructions.
+type Instructions []byte
+
+// String disassembles ins, one instruction per line, each prefixed by its
+// offset: "0000 OpConstant 1". Undefined opcodes and truncated
+// instructions are reported as "ERROR: ..." lines.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+
+		if i+1+def.width() > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: %s truncated\n", i, def.Name)
+			break
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+// Instruction disassembles the instruction at offset pos of ins, which must
+// be well formed, as String does but without the offset: "OpConstant 1".
+func (ins Instructions) Instruction(pos int) string {
+	def, err := Lookup(ins[pos])
+	if err != nil {
+		return fmt.Sprintf("ERROR: %s", err)
+	}
+	operands, _ := ReadOperands(def, ins[pos+1:])
+	return ins.fmtInstruction(def, operands)
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s", def.Name)
+}
+
+type Opcode byte
+
+const (
+	// OpConstant pushes the constant at the index given by its operand.
+	OpConstant Opcode = iota
+	// OpPop discards the top of the stack.
+	OpPop
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	// Binary operators pop the right operand, then the left one, and push
+	// the result.
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	// Unary operators replace the top of the stack with the result.
+	OpMinus
+	OpBang
+
+	// OpJump continues at the offset given by its operand, and
+	// OpJumpNotTruthy pops the top of the stack and does so if it isn't
+	// truthy.
+	OpJump
+	OpJumpNotTruthy
+	// OpAnd, OpOr and OpCoalesce implement the short-circuiting operators.
+	// If the top of the stack decides the result, respectively by being
+	// falsy, truthy or not null, they jump to their operand leaving it in
+	// place; otherwise they pop it.
+	OpAnd
+	OpOr
+	OpCoalesce
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+
+	// OpArray pops the number of elements given by its operand and pushes
+	// an array of them; OpHash does the same with keys and values,
+	// alternating.
+	OpArray
+	OpHash
+	// OpIndex pops an index and the value it applies to and pushes the
+	// result.
+	OpIndex
+
+	// OpCall calls the function below the number of arguments given by its
+	// operand. OpReturnValue returns the top of the stack from the current
+	// function, and OpReturn returns null.
+	OpCall
+	OpReturnValue
+	OpReturn
+
+	// OpClosure pushes a closure of the compiled function at the constant
+	// index given by its first operand, capturing the number of values given
+	// by its second operand, which it pops. OpGetFree pushes the captured
+	// value at the index given by its operand, and OpCurrentClosure the
+	// closure being executed.
+	OpClosure
+	OpGetFree
+	OpCurrentClosure
+
+	// OpGetBuiltin pushes the builtin at the index given by its operand in
+	// evaluator.BuiltinNames.
+	OpGetBuiltin
+
+	// OpTailCall is OpCall for a call whose value the calling function
+	// returns. A closure called with it replaces the calling function's
+	// frame rather than getting a new one; the OpReturnValue that follows
+	// returns the value of other functions.
+	OpTailCall
+
+	// OpIndexConstant pops a value and pushes its element at the constant
+	// given by its operand, as OpConstant followed by OpIndex would.
+	OpIndexConstant
+
+	// OpDup pushes the top of the stack again. The compiler doesn't emit
+	// it, but Optimize does.
+	OpDup
+)
+
+// Definition describes an opcode for humans and the encoder.
+type Definition struct {
+	Name          string
+	OperandWidths []int // In bytes.
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpMod:         {"OpMod", []int{}},
+	OpBitAnd:      {"OpBitAnd", []int{}},
+	OpBitOr:       {"OpBitOr", []int{}},
+	OpBitXor:      {"OpBitXor", []int{}},
+	OpShiftLeft:   {"OpShiftLeft", []int{}},
+	OpShiftRight:  {"OpShiftRight", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpAnd:           {"OpAnd", []int{2}},
+	OpOr:            {"OpOr", []int{2}},
+	OpCoalesce:      {"OpCoalesce", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	OpGetLocal:  {"OpGetLocal", []int{1}},
+	OpSetLocal:  {"OpSetLocal", []int{1}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+	OpTailCall:   {"OpTailCall", []int{1}},
+
+	OpIndexConstant: {"OpIndexConstant", []int{2}},
+
+	OpDup: {"OpDup", []int{}},
+}
+
+// width returns the number of bytes taken up by the operands of def.
+func (def *Definition) width() int {
+	n := 0
+	for _, w := range def.OperandWidths {
+		n += w
+	}
+	return n
+}
+
+// Lookup returns the definition of op.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes the instruction op with the given operands. It returns an
+// empty instruction if op is undefined.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instruction := make([]byte, 1+def.width())
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction defined by def from
+// ins, which starts right after the opcode. It returns them along with the
+// number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two-byte operand.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one-byte operand.
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
+
+// SourceMap maps instructions to the positions in the source of the nodes
+// they were compiled from. Each entry gives the position of the
+// instructions from its offset up to that of the next entry; entries are
+// ordered by offset.
+type SourceMap []SourceMapEntry
+
+type SourceMapEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Pos returns the position of the instruction at offset, or the zero
+// Position if m doesn't cover it.
+func (m SourceMap) Pos(offset int) token.Position {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return m[i-1].Pos
+}
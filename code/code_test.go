@@ -0,0 +1,177 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/token"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpCall, []int{3}, []byte{byte(OpCall), 3}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{Opcode(255), []int{}, []byte{}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d",
+				len(tt.expected), len(instruction))
+			continue
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d",
+					i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	for op := Opcode(0); op <= OpDup; op++ {
+		def, err := Lookup(byte(op))
+		if err != nil {
+			t.Errorf("opcode %d has no definition", op)
+			continue
+		}
+		if def.Name == "" {
+			t.Errorf("opcode %d has no name", op)
+		}
+	}
+
+	if _, err := Lookup(255); err == nil || err.Error() != "opcode 255 undefined" {
+		t.Errorf("wrong error for an undefined opcode. got=%v", err)
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpCall, 3),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpCall 3
+0011 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, concatted.String())
+	}
+}
+
+func TestInstructionsStringErrors(t *testing.T) {
+	ins := Instructions{byte(OpPop), 255, byte(OpConstant), 1}
+
+	expected := `0000 OpPop
+0001 ERROR: opcode 255 undefined
+0002 ERROR: OpConstant truncated
+`
+	if ins.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, ins.String())
+	}
+}
+
+func TestInstruction(t *testing.T) {
+	ins := Instructions{}
+	ins = append(ins, Make(OpPop)...)
+	ins = append(ins, Make(OpConstant, 65535)...)
+	ins = append(ins, Make(OpClosure, 2, 1)...)
+
+	tests := []struct {
+		pos      int
+		expected string
+	}{
+		{0, "OpPop"},
+		{1, "OpConstant 65535"},
+		{4, "OpClosure 2 1"},
+	}
+
+	for _, tt := range tests {
+		if got := ins.Instruction(tt.pos); got != tt.expected {
+			t.Errorf("instruction at %d wrongly formatted. want=%q, got=%q", tt.pos, tt.expected, got)
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+		{OpPop, []int{}, 0},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestSourceMapPos(t *testing.T) {
+	m := SourceMap{
+		{Offset: 2, Pos: token.Position{Line: 1, Column: 5}},
+		{Offset: 6, Pos: token.Position{Line: 2, Column: 1}},
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{0, token.Position{}},
+		{2, token.Position{Line: 1, Column: 5}},
+		{5, token.Position{Line: 1, Column: 5}},
+		{6, token.Position{Line: 2, Column: 1}},
+		{100, token.Position{Line: 2, Column: 1}},
+	}
+
+	for _, tt := range tests {
+		if got := m.Pos(tt.offset); got != tt.expected {
+			t.Errorf("position of %d wrong. want=%v, got=%v", tt.offset, tt.expected, got)
+		}
+	}
+}
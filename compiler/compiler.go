@@ -0,0 +1,743 @@
+// Package compiler compiles Monkey programs to bytecode, as defined by the
+// code package: a sequence of instructions for a stack machine together
+// with the pool of constants they refer to.
+//
+// The compiler handles integer, float, string and boolean literals,
+// arrays, hashes and indexing, the prefix and infix operators, if
+// expressions, let, const and return statements, and functions and calls.
+// Other constructs are compile errors for now.
+//
+// Top-level bindings are globals; the parameters and lets of a function are
+// locals of its frame. Functions are compiled to closures: the locals of
+// enclosing functions that a function refers to are copied into the
+// closure when it is created. Since compiled code cannot assign to a
+// binding, this only differs from the evaluator's capturing of scopes when
+// a let rebinds a captured name after the closure was created. A function
+// literal bound by let or const refers to itself by that name, so it may
+// be recursive even inside a function. The builtin functions and constants
+// are those of the evaluator, which the VM calls, and bindings shadow them
+// as they do there.
+//
+// Code that can't be reached isn't compiled: the statements of a block
+// after a return statement, and the branch of an if expression that its
+// literal condition doesn't select. As in the evaluator, such code can't
+// fail, even by referring to undefined variables.
+//
+// Calls whose value a function returns are tail calls, which reuse the
+// frame of the calling function, so that recursion in tail position
+// doesn't overflow the VM's stack of frames.
+//
+// The program and each function come with a source map, which maps their
+// instructions to the positions of the nodes they were compiled from, so
+// that the VM can report where in the source an instruction failed.
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/evaluator"
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/token"
+)
+
+// Limits imposed by the widths of the operands.
+const (
+	maxConstants = math.MaxUint16 + 1
+	maxGlobals   = math.MaxUint16 + 1
+	maxLocals    = math.MaxUint8 + 1
+	maxArguments = math.MaxUint8
+	maxFree      = math.MaxUint8
+	maxElements  = math.MaxUint16
+)
+
+// Bytecode is the result of a compilation.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+
+	// SourceMap maps Instructions to the source. The functions among the
+	// Constants have source maps of their own.
+	SourceMap code.SourceMap
+
+	// NumGlobals is the number of globals the instructions use, indexed
+	// from 0, including those of the compilations continued by
+	// NewWithState.
+	NumGlobals int
+
+	// GlobalNames are the names of the globals, by index, for debuggers.
+	// They may be empty.
+	GlobalNames []string
+}
+
+// EmittedInstruction records an instruction the compiler emitted, so that
+// it can be inspected or removed again.
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the program or a function
+// being compiled.
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	sourceMap           code.SourceMap
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos is the position of the innermost node being compiled that has
+	// one, which the instructions emitted now are mapped to.
+	pos token.Position
+}
+
+// New returns a compiler for a program of its own.
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState returns a compiler that continues from the globals of
+// symbolTable and the constants of a previous compilation, as a REPL
+// compiling one line at a time does. It defines the builtins of
+// evaluator.BuiltinNames in symbolTable, except those it binds already.
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	for i, name := range evaluator.BuiltinNames {
+		if _, ok := symbolTable.store[name]; !ok {
+			symbolTable.DefineBuiltin(i, name)
+		}
+	}
+
+	return &Compiler{
+		constants:   constants,
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// Bytecode returns the instructions and constants compiled so far.
+func (c *Compiler) Bytecode() *Bytecode {
+	globals := c.symbolTable
+	for globals.Outer != nil {
+		globals = globals.Outer
+	}
+
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		NumGlobals:   globals.numDefinitions,
+		GlobalNames:  globals.Names(),
+	}
+}
+
+// An Error reports why a node couldn't be compiled.
+type Error struct {
+	Pos  token.Position // Position of Node, if it has one.
+	Node ast.Node
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// Compile appends the code for node to the program being compiled, mapping
+// each instruction to the position of the innermost node it was compiled
+// from. Errors are *Errors reporting the innermost node that failed to
+// compile.
+func (c *Compiler) Compile(node ast.Node) error {
+	saved := c.pos
+	if pos := node.Pos(); pos.IsValid() {
+		c.setPos(pos)
+	}
+	err := c.compile(node)
+	c.setPos(saved)
+
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{Pos: node.Pos(), Node: node, Msg: err.Error()}
+}
+
+// errorAt returns an error reporting node, for failures that concern one of
+// the children of the node being compiled rather than the node itself.
+func errorAt(node ast.Node, format string, a ...interface{}) *Error {
+	return &Error{Pos: node.Pos(), Node: node, Msg: fmt.Sprintf(format, a...)}
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		_, err := c.compileStatements(node.Statements)
+		return err
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.LetStatement:
+		if len(node.Names) > 0 {
+			return fmt.Errorf("cannot compile destructuring let")
+		}
+		return c.compileBinding(node.Name, node.Value)
+
+	case *ast.ConstStatement:
+		return c.compileBinding(node.Name, node.Value)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.BlockExpression:
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		_, err := c.compileBlock(node.Block)
+		c.symbolTable = c.symbolTable.Outer
+		return err
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+		return c.loadSymbol(symbol)
+
+	case *ast.IntegerLiteral:
+		return c.emitConstant(&object.Integer{Value: node.Value})
+
+	case *ast.FloatLiteral:
+		return c.emitConstant(&object.Float{Value: node.Value})
+
+	case *ast.StringLiteral:
+		return c.emitConstant(&object.String{Value: node.Value})
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		return c.compileInfix(node)
+
+	case *ast.ParenExpression:
+		return c.Compile(node.Expression)
+
+	case *ast.IfExpression:
+		return c.compileIf(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		if len(node.Arguments) > maxArguments {
+			return fmt.Errorf("too many arguments")
+		}
+		if err := c.compileElements(node.Arguments); err != nil {
+			return err
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.ArrayLiteral:
+		return c.compileArray(node.Elements)
+
+	case *ast.TupleLiteral:
+		return c.compileArray(node.Elements)
+
+	case *ast.HashLiteral:
+		if len(node.Pairs) > maxElements/2 {
+			return fmt.Errorf("too many hash pairs")
+		}
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, 2*len(node.Pairs))
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		// Constant string keys, such as those of hashes of settings, get an
+		// instruction of their own, which the VM caches the hash key of.
+		if key, ok := node.Index.(*ast.StringLiteral); ok {
+			index, err := c.addConstant(&object.String{Value: key.Value})
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpIndexConstant, index)
+			return nil
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	default:
+		return fmt.Errorf("cannot compile %s", strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+	}
+
+	return nil
+}
+
+// compileBinding compiles binding name to the value of value in the current
+// scope.
+func (c *Compiler) compileBinding(name *ast.Identifier, value ast.Expression) error {
+	var err error
+	if fn, ok := value.(*ast.FunctionLiteral); ok {
+		err = c.compileFunction(fn, name.Value)
+	} else {
+		err = c.Compile(value)
+	}
+	if err != nil {
+		return err
+	}
+
+	symbol := c.symbolTable.Define(name.Value)
+	if symbol.Scope == GlobalScope {
+		if symbol.Index >= maxGlobals {
+			return errorAt(name, "too many globals: cannot define %s, the limit is %d", name.Value, maxGlobals)
+		}
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		if symbol.Index >= maxLocals {
+			return errorAt(name, "too many locals")
+		}
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	default:
+		return fmt.Errorf("cannot compile %s variable %s", strings.ToLower(string(s.Scope)), s.Name)
+	}
+	return nil
+}
+
+// infixOpcodes are the opcodes of the infix operators that evaluate both
+// operands.
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+}
+
+// shortCircuitOpcodes are the opcodes of the infix operators that only
+// evaluate their right operand if the left one doesn't decide the result.
+var shortCircuitOpcodes = map[string]code.Opcode{
+	"&&": code.OpAnd,
+	"||": code.OpOr,
+	"??": code.OpCoalesce,
+}
+
+func (c *Compiler) compileInfix(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	if op, ok := shortCircuitOpcodes[node.Operator]; ok {
+		jumpPos := c.emit(op, 9999)
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	op, ok := infixOpcodes[node.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(op)
+	return nil
+}
+
+// compileIf compiles an if expression. If the condition is a literal, only
+// the branch it selects is compiled, since the other can't be reached.
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if truthy, ok := literalTruthiness(node.Condition); ok {
+		var err error
+		switch {
+		case truthy:
+			_, err = c.compileBlock(node.Consequence)
+		case node.Alternative != nil:
+			_, err = c.compileBlock(node.Alternative)
+		default:
+			c.emit(code.OpNull)
+		}
+		return err
+	}
+
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// Emit with bogus offsets, patched once the targets are known.
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	returns, err := c.compileBlock(node.Consequence)
+	if err != nil {
+		return err
+	}
+
+	// No jump is needed over the alternative if the consequence returns.
+	jumpPos := -1
+	if !returns {
+		jumpPos = c.emit(code.OpJump, 9999)
+	}
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if _, err := c.compileBlock(node.Alternative); err != nil {
+		return err
+	}
+	if jumpPos >= 0 {
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+// literalTruthiness reports whether e is a literal, and if so, whether it
+// is truthy.
+func literalTruthiness(e ast.Expression) (truthy bool, ok bool) {
+	switch e := e.(type) {
+	case *ast.ParenExpression:
+		return literalTruthiness(e.Expression)
+	case *ast.Boolean:
+		return e.Value, true
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+// compileBlock compiles block to leave its value on the stack: that of its
+// last statement if it is an expression statement, or else null. It
+// reports whether the block ends by returning, in which case it leaves
+// nothing.
+func (c *Compiler) compileBlock(block *ast.BlockStatement) (bool, error) {
+	start := len(c.currentInstructions())
+	returns, err := c.compileStatements(block.Statements)
+	if err != nil || returns {
+		return returns, err
+	}
+
+	if c.lastInstructionIs(code.OpPop) && c.scopes[c.scopeIndex].lastInstruction.Position >= start {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return false, nil
+}
+
+// compileStatements compiles statements up to the first return statement
+// among them, since those after it can't be reached. It reports whether
+// there was one.
+func (c *Compiler) compileStatements(statements []ast.Statement) (bool, error) {
+	for _, s := range statements {
+		if err := c.Compile(s); err != nil {
+			return false, err
+		}
+		if _, ok := s.(*ast.ReturnStatement); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// compileFunction compiles node to a closure. If name isn't empty, it is
+// the name the function is bound to, by which its body may refer to it.
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) error {
+	if node.Variadic {
+		return fmt.Errorf("cannot compile variadic functions")
+	}
+
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	for _, p := range node.Parameters {
+		if c.symbolTable.Define(p.Value).Index >= maxLocals {
+			return errorAt(p, "too many locals")
+		}
+	}
+
+	if _, err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+
+	// The value of the last expression statement is returned implicitly.
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	localNames := c.symbolTable.Names()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+	markTailCalls(instructions)
+
+	if len(freeSymbols) > maxFree {
+		return fmt.Errorf("too many free variables")
+	}
+	var freeNames []string
+	for _, s := range freeSymbols {
+		if err := c.loadSymbol(s); err != nil {
+			return err
+		}
+		freeNames = append(freeNames, s.Name)
+	}
+
+	fnIndex, err := c.addConstant(&object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          name,
+		SourceMap:     sourceMap,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+	})
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	return nil
+}
+
+// markTailCalls turns the calls of the function body ins whose value it
+// returns into tail calls: those followed by OpReturnValue, directly or
+// through unconditional jumps, as the branches of an if expression are.
+func markTailCalls(ins code.Instructions) {
+	for pos := 0; pos < len(ins); {
+		def, _ := code.Lookup(ins[pos])
+		_, read := code.ReadOperands(def, ins[pos+1:])
+		next := pos + 1 + read
+
+		if code.Opcode(ins[pos]) == code.OpCall {
+			// Jumps only go forward, but following at most len(ins) of
+			// them guards against cycles anyway.
+			target := next
+			for n := 0; n < len(ins) && target < len(ins) && code.Opcode(ins[target]) == code.OpJump; n++ {
+				target = int(code.ReadUint16(ins[target+1:]))
+			}
+			if target < len(ins) && code.Opcode(ins[target]) == code.OpReturnValue {
+				ins[pos] = byte(code.OpTailCall)
+			}
+		}
+
+		pos = next
+	}
+}
+
+func (c *Compiler) compileArray(elements []ast.Expression) error {
+	if len(elements) > maxElements {
+		return fmt.Errorf("too many array elements")
+	}
+	if err := c.compileElements(elements); err != nil {
+		return err
+	}
+	c.emit(code.OpArray, len(elements))
+	return nil
+}
+
+// compileElements compiles the elements of an array or the arguments of a
+// call, which may not be spread.
+func (c *Compiler) compileElements(elements []ast.Expression) error {
+	for _, e := range elements {
+		if _, ok := e.(*ast.SpreadExpression); ok {
+			return errorAt(e, "cannot compile spread")
+		}
+		if err := c.Compile(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitConstant adds obj to the constant pool and emits the instruction that
+// pushes it.
+func (c *Compiler) emitConstant(obj object.Object) error {
+	index, err := c.addConstant(obj)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpConstant, index)
+	return nil
+}
+
+// addConstant adds obj to the constant pool and returns its index.
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+	if len(c.constants) >= maxConstants {
+		return 0, fmt.Errorf("too many constants")
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1, nil
+}
+
+// emit appends an instruction to the current scope and returns its
+// position.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.instructions = scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction = scope.previousInstruction
+
+	m := scope.sourceMap
+	for len(m) > 0 && m[len(m)-1].Offset > len(scope.instructions) {
+		m = m[:len(m)-1]
+	}
+	scope.sourceMap = m
+	c.setPos(c.pos)
+}
+
+// setPos maps the instructions emitted from now on in the current scope to
+// pos.
+func (c *Compiler) setPos(pos token.Position) {
+	c.pos = pos
+	scope := &c.scopes[c.scopeIndex]
+	offset := len(scope.instructions)
+
+	m := scope.sourceMap
+	if n := len(m); n > 0 && m[n-1].Offset == offset {
+		m = m[:n-1]
+	}
+	if n := len(m); n > 0 && m[n-1].Pos == pos {
+		scope.sourceMap = m
+		return
+	}
+	scope.sourceMap = append(m, code.SourceMapEntry{Offset: offset, Pos: pos})
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	copy(ins[pos:], newInstruction)
+}
+
+// changeOperand replaces the operand of the instruction at opPos.
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.replaceInstruction(opPos, code.Make(op, operand))
+}
+
+// enterScope starts compiling a function, with a symbol table enclosed by
+// the current one.
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope finishes compiling a function and returns its instructions.
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
@@ -0,0 +1,402 @@
+package compiler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/evaluator"
+	"github.com/j4nu5/monkey/object"
+)
+
+// FormatVersion is the version of the bytecode format written by WriteTo,
+// that of .monkeyc files. It changes whenever the format does, including
+// when opcodes are added or renumbered and when builtins are, since
+// OpGetBuiltin refers to them by index.
+const FormatVersion = 8
+
+// ErrVersion is wrapped by the errors ReadFrom returns for bytecode written
+// with a different FormatVersion.
+var ErrVersion = errors.New("compiler: unsupported bytecode version")
+
+// formatMagic starts every bytecode file.
+const formatMagic = "MKBC"
+
+// maxFormatLen bounds the lengths of strings, instructions and the constant
+// pool read by ReadFrom, so that corrupt data can't make it allocate
+// arbitrary amounts of memory.
+const maxFormatLen = 1 << 24
+
+// Constant tags. They are part of the format: append new ones and bump
+// FormatVersion rather than renumbering.
+const (
+	constInteger = iota + 1
+	constFloat
+	constString
+	constFunction
+)
+
+// WriteTo writes bytecode to w in the .monkeyc format, from which ReadFrom
+// reads it back, so that a program can be compiled once and run many times.
+// The constants must be of the types the compiler produces.
+func WriteTo(w io.Writer, bytecode *Bytecode) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(formatMagic)
+	writeUint(bw, FormatVersion)
+	writeUint(bw, uint64(bytecode.NumGlobals))
+	writeBytes(bw, bytecode.Instructions)
+	writeSourceMap(bw, bytecode.SourceMap)
+	writeNames(bw, bytecode.GlobalNames)
+
+	writeUint(bw, uint64(len(bytecode.Constants)))
+	for _, c := range bytecode.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			bw.WriteByte(constInteger)
+			// Zig-zag encoding, as in encoding/binary.
+			writeUint(bw, uint64(c.Value<<1)^uint64(c.Value>>63))
+		case *object.Float:
+			bw.WriteByte(constFloat)
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], math.Float64bits(c.Value))
+			bw.Write(buf[:])
+		case *object.String:
+			bw.WriteByte(constString)
+			writeBytes(bw, []byte(c.Value))
+		case *object.CompiledFunction:
+			bw.WriteByte(constFunction)
+			writeUint(bw, uint64(c.NumLocals))
+			writeUint(bw, uint64(c.NumParameters))
+			writeBytes(bw, []byte(c.Name))
+			writeBytes(bw, c.Instructions)
+			writeSourceMap(bw, c.SourceMap)
+			writeNames(bw, c.LocalNames)
+			writeNames(bw, c.FreeNames)
+		default:
+			return fmt.Errorf("compiler: cannot write constant of type %s", c.Type())
+		}
+	}
+
+	return bw.Flush()
+}
+
+func writeUint(w *bufio.Writer, x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], x)])
+}
+
+func writeBytes(w *bufio.Writer, b []byte) {
+	writeUint(w, uint64(len(b)))
+	w.Write(b)
+}
+
+func writeNames(w *bufio.Writer, names []string) {
+	writeUint(w, uint64(len(names)))
+	for _, name := range names {
+		writeBytes(w, []byte(name))
+	}
+}
+
+// writeSourceMap writes the entries of m, with their offsets as deltas from
+// the previous ones.
+func writeSourceMap(w *bufio.Writer, m code.SourceMap) {
+	writeUint(w, uint64(len(m)))
+	offset := 0
+	for _, e := range m {
+		writeUint(w, uint64(e.Offset-offset))
+		offset = e.Offset
+		writeBytes(w, []byte(e.Pos.Filename))
+		writeUint(w, uint64(e.Pos.Line))
+		writeUint(w, uint64(e.Pos.Column))
+	}
+}
+
+// ReadFrom reads bytecode written by WriteTo. It checks that the
+// instructions are well formed and only refer to constants in the pool, but
+// not that they make sense otherwise.
+func ReadFrom(r io.Reader) (*Bytecode, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(formatMagic))
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if string(header) != formatMagic {
+		return nil, errors.New("compiler: not a bytecode file")
+	}
+	v, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if v != FormatVersion {
+		return nil, fmt.Errorf("%w %d, want %d", ErrVersion, v, FormatVersion)
+	}
+
+	numGlobals, err := readLen(br)
+	if err != nil {
+		return nil, err
+	}
+	if numGlobals > maxGlobals {
+		return nil, fmt.Errorf("compiler: %d globals, the limit is %d", numGlobals, maxGlobals)
+	}
+	instructions, err := readBytes(br)
+	if err != nil {
+		return nil, err
+	}
+	sourceMap, err := readSourceMap(br)
+	if err != nil {
+		return nil, err
+	}
+	globalNames, err := readNames(br, numGlobals)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := readLen(br)
+	if err != nil {
+		return nil, err
+	}
+	constants := make([]object.Object, n)
+	for i := range constants {
+		if constants[i], err = readConstant(br); err != nil {
+			return nil, err
+		}
+	}
+
+	bytecode := &Bytecode{
+		Instructions: instructions,
+		Constants:    constants,
+		SourceMap:    sourceMap,
+		NumGlobals:   numGlobals,
+		GlobalNames:  globalNames,
+	}
+	if err := verify(instructions, bytecode); err != nil {
+		return nil, err
+	}
+	for _, c := range constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			if err := verify(fn.Instructions, bytecode); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return bytecode, nil
+}
+
+func readConstant(r *bufio.Reader) (object.Object, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	switch tag {
+	case constInteger:
+		u, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return &object.Integer{Value: int64(u>>1) ^ -int64(u&1)}, nil
+
+	case constFloat:
+		var buf [8]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return &object.Float{Value: math.Float64frombits(binary.BigEndian.Uint64(buf[:]))}, nil
+
+	case constString:
+		b, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: string(b)}, nil
+
+	case constFunction:
+		numLocals, err := readLen(r)
+		if err != nil {
+			return nil, err
+		}
+		numParameters, err := readLen(r)
+		if err != nil {
+			return nil, err
+		}
+		if numLocals > maxLocals || numParameters > numLocals {
+			return nil, fmt.Errorf("compiler: function with %d locals and %d parameters", numLocals, numParameters)
+		}
+		name, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		sourceMap, err := readSourceMap(r)
+		if err != nil {
+			return nil, err
+		}
+		localNames, err := readNames(r, numLocals)
+		if err != nil {
+			return nil, err
+		}
+		freeNames, err := readNames(r, maxFree)
+		if err != nil {
+			return nil, err
+		}
+		return &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: numParameters,
+			Name:          string(name),
+			SourceMap:     sourceMap,
+			LocalNames:    localNames,
+			FreeNames:     freeNames,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("compiler: unknown constant tag %d", tag)
+	}
+}
+
+// readLen reads a length that is bounded by maxFormatLen.
+func readLen(r *bufio.Reader) (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	if n > maxFormatLen {
+		return 0, fmt.Errorf("compiler: length %d out of range", n)
+	}
+	return int(n), nil
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := readLen(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// readNames reads at most max names written by writeNames. None read back
+// as nil.
+func readNames(r *bufio.Reader, max int) ([]string, error) {
+	n, err := readLen(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > max {
+		return nil, fmt.Errorf("compiler: %d names, want at most %d", n, max)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	names := make([]string, n)
+	for i := range names {
+		b, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = string(b)
+	}
+	return names, nil
+}
+
+// readSourceMap reads a source map written by writeSourceMap. An empty one
+// is read as nil.
+func readSourceMap(r *bufio.Reader) (code.SourceMap, error) {
+	n, err := readLen(r)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	var m code.SourceMap
+	offset := 0
+	for i := 0; i < n; i++ {
+		var e code.SourceMapEntry
+		delta, err := readLen(r)
+		if err != nil {
+			return nil, err
+		}
+		offset += delta
+		if offset > maxFormatLen {
+			return nil, fmt.Errorf("compiler: source map offset %d out of range", offset)
+		}
+		e.Offset = offset
+		filename, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		e.Pos.Filename = string(filename)
+		if e.Pos.Line, err = readLen(r); err != nil {
+			return nil, err
+		}
+		if e.Pos.Column, err = readLen(r); err != nil {
+			return nil, err
+		}
+		m = append(m, e)
+	}
+	return m, nil
+}
+
+// unexpectedEOF reports running out of data in the middle of bytecode as
+// io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// verify checks that ins consists of complete, defined instructions whose
+// constant, global and builtin operands are in range.
+func verify(ins code.Instructions, bytecode *Bytecode) error {
+	constants := bytecode.Constants
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return fmt.Errorf("compiler: %s at %d", err, i)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return fmt.Errorf("compiler: %s truncated at %d", def.Name, i)
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		switch op := code.Opcode(ins[i]); op {
+		case code.OpConstant, code.OpClosure, code.OpIndexConstant:
+			index := operands[0]
+			if index >= len(constants) {
+				return fmt.Errorf("compiler: constant %d out of range at %d", index, i)
+			}
+			if _, ok := constants[index].(*object.CompiledFunction); op == code.OpClosure && !ok {
+				return fmt.Errorf("compiler: closure of %s at %d", constants[index].Type(), i)
+			}
+			if _, ok := constants[index].(object.Hashable); op == code.OpIndexConstant && !ok {
+				return fmt.Errorf("compiler: index of %s at %d", constants[index].Type(), i)
+			}
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if operands[0] >= bytecode.NumGlobals {
+				return fmt.Errorf("compiler: global %d out of range at %d", operands[0], i)
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(evaluator.BuiltinNames) {
+				return fmt.Errorf("compiler: builtin %d out of range at %d", operands[0], i)
+			}
+		}
+
+		i += 1 + read
+	}
+	return nil
+}
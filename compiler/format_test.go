@@ -0,0 +1,156 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/object"
+)
+
+const formatSource = `
+let big = 9223372036854775807;
+let small = -4;
+let ratio = 0.25;
+let name = "monkey";
+let adder = fn(a) { fn(b) { a + b + big + small } };
+let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+[adder(1)(2), ratio, {name: fact(5)}]
+`
+
+func writeBytecode(t *testing.T, bytecode *Bytecode) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteTo(&buf, bytecode); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func compile(t *testing.T, input string) *Bytecode {
+	t.Helper()
+	c := New()
+	if err := c.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return c.Bytecode()
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	for _, input := range []string{"", formatSource} {
+		bytecode := compile(t, input)
+
+		read, err := ReadFrom(bytes.NewReader(writeBytecode(t, bytecode)))
+		if err != nil {
+			t.Fatalf("ReadFrom: %v", err)
+		}
+		if !bytes.Equal(read.Instructions, bytecode.Instructions) {
+			t.Errorf("wrong instructions.\nwant=%s\ngot=%s", bytecode.Instructions, read.Instructions)
+		}
+		if !reflect.DeepEqual(read.SourceMap, bytecode.SourceMap) {
+			t.Errorf("wrong source map.\nwant=%v\ngot=%v", bytecode.SourceMap, read.SourceMap)
+		}
+		if !reflect.DeepEqual(read.GlobalNames, bytecode.GlobalNames) {
+			t.Errorf("wrong global names. want=%q, got=%q", bytecode.GlobalNames, read.GlobalNames)
+		}
+		if read.NumGlobals != bytecode.NumGlobals {
+			t.Errorf("wrong NumGlobals. want=%d, got=%d", bytecode.NumGlobals, read.NumGlobals)
+		}
+		if !reflect.DeepEqual(read.Constants, bytecode.Constants) {
+			t.Errorf("wrong constants.\nwant=%+v\ngot=%+v", bytecode.Constants, read.Constants)
+		}
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	data := writeBytecode(t, compile(t, "1"))
+	data[4] = FormatVersion + 1 // The version follows the 4-byte magic.
+
+	_, err := ReadFrom(bytes.NewReader(data))
+	if !errors.Is(err, ErrVersion) {
+		t.Errorf("expected ErrVersion. got=%v", err)
+	}
+}
+
+func TestFormatInvalid(t *testing.T) {
+	data := writeBytecode(t, compile(t, formatSource))
+
+	invalid := []struct {
+		name     string
+		bytecode *Bytecode
+	}{
+		{"undefined opcode", &Bytecode{Instructions: code.Instructions{255}}},
+		{"truncated instruction", &Bytecode{Instructions: code.Make(code.OpConstant, 0)[:2]}},
+		{"constant out of range", &Bytecode{Instructions: code.Make(code.OpConstant, 0)}},
+		{"closure of a non-function", &Bytecode{
+			Instructions: code.Make(code.OpClosure, 0, 0),
+			Constants:    []object.Object{&object.Integer{Value: 1}},
+		}},
+		{"index with a function", &Bytecode{
+			Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpIndexConstant, 0),
+			}),
+			Constants: []object.Object{&object.CompiledFunction{}},
+		}},
+		{"global out of range", &Bytecode{
+			Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpSetGlobal, 1),
+			}),
+			NumGlobals: 1,
+		}},
+		{"too many globals", &Bytecode{NumGlobals: maxGlobals + 1}},
+		{"invalid function", &Bytecode{
+			Constants: []object.Object{&object.CompiledFunction{
+				Instructions: code.Make(code.OpConstant, 1),
+			}},
+		}},
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("JUNK"), data[4:]...)},
+		{"truncated", data[:len(data)/2]},
+	}
+	for _, tt := range invalid {
+		tests = append(tests, struct {
+			name string
+			data []byte
+		}{tt.name, writeBytecode(t, tt.bytecode)})
+	}
+
+	for _, tt := range tests {
+		_, err := ReadFrom(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+		if errors.Is(err, ErrVersion) {
+			t.Errorf("%s: unexpected ErrVersion", tt.name)
+		}
+	}
+
+	// Every prefix of valid data is rejected rather than misread.
+	for i := 0; i < len(data); i++ {
+		_, err := ReadFrom(bytes.NewReader(data[:i]))
+		if err == nil {
+			t.Fatalf("prefix of length %d read without error", i)
+		}
+		if i > 4 && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("prefix of length %d: expected io.ErrUnexpectedEOF. got=%v", i, err)
+		}
+	}
+}
+
+func TestWriteToUnsupported(t *testing.T) {
+	bytecode := &Bytecode{Constants: []object.Object{object.TRUE}}
+	if err := WriteTo(io.Discard, bytecode); err == nil {
+		t.Errorf("expected an error for a boolean constant")
+	}
+}
@@ -0,0 +1,321 @@
+package compiler
+
+import (
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/token"
+)
+
+// Optimize returns bytecode with the instructions of the program and of its
+// functions rewritten by a peephole optimizer, which:
+//
+//   - removes values that are pushed only to be popped, such as those of
+//     expression statements made of a literal;
+//   - makes jumps to unconditional jumps go straight to their targets, and
+//     removes unconditional jumps to the next instruction;
+//   - replaces loads of a variable right after a store to it, as compiled
+//     from `let x = 5; x`, with an OpDup before the store, or removes them
+//     along with the store's value if that is popped right away.
+//
+// Other loads of variables are kept, since they fail if the let defining
+// the variable didn't run.
+//
+// The value of a final expression statement of the program is kept, since
+// the VM reports it as the result. Constants that are no longer used are
+// then removed from the pool, renumbering the others, so the result can't
+// be continued by a compiler created with NewWithState. Source maps are
+// rewritten along with the instructions. bytecode itself isn't modified.
+func Optimize(bytecode *Bytecode) *Bytecode {
+	constants := make([]object.Object, len(bytecode.Constants))
+	for i, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			optimized := *fn
+			optimized.Instructions, optimized.SourceMap = optimizeInstructions(fn.Instructions, fn.SourceMap, false)
+			c = &optimized
+		}
+		constants[i] = c
+	}
+
+	instructions, sourceMap := optimizeInstructions(bytecode.Instructions, bytecode.SourceMap, true)
+	return stripConstants(&Bytecode{
+		Instructions: instructions,
+		Constants:    constants,
+		SourceMap:    sourceMap,
+		NumGlobals:   bytecode.NumGlobals,
+		GlobalNames:  bytecode.GlobalNames,
+	})
+}
+
+// stripConstants removes the constants that bytecode doesn't use from its
+// pool, including functions, and those only they use. The functions kept
+// are modified in place. Renumbering constants doesn't move instructions,
+// so source maps stay valid.
+func stripConstants(bytecode *Bytecode) *Bytecode {
+	used := make([]bool, len(bytecode.Constants))
+	pending := []code.Instructions{bytecode.Instructions}
+	for len(pending) > 0 {
+		ins := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for _, in := range decodeInstructions(ins, nil) {
+			if !constantOpcodes[in.op] {
+				continue
+			}
+			index := in.operands[0]
+			if used[index] {
+				continue
+			}
+			used[index] = true
+			if fn, ok := bytecode.Constants[index].(*object.CompiledFunction); ok {
+				pending = append(pending, fn.Instructions)
+			}
+		}
+	}
+
+	newIndex := make([]int, len(bytecode.Constants))
+	constants := []object.Object{}
+	for i, c := range bytecode.Constants {
+		if used[i] {
+			newIndex[i] = len(constants)
+			constants = append(constants, c)
+		}
+	}
+
+	renumber := func(ins code.Instructions) code.Instructions {
+		list := decodeInstructions(ins, nil)
+		for _, in := range list {
+			if constantOpcodes[in.op] {
+				in.operands[0] = newIndex[in.operands[0]]
+			}
+		}
+		renumbered, _ := encodeInstructions(list)
+		return renumbered
+	}
+	for _, c := range constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			fn.Instructions = renumber(fn.Instructions)
+		}
+	}
+
+	return &Bytecode{
+		Instructions: renumber(bytecode.Instructions),
+		Constants:    constants,
+		SourceMap:    bytecode.SourceMap,
+		NumGlobals:   bytecode.NumGlobals,
+		GlobalNames:  bytecode.GlobalNames,
+	}
+}
+
+// constantOpcodes are the opcodes whose first operand is the index of a
+// constant.
+var constantOpcodes = map[code.Opcode]bool{
+	code.OpConstant:      true,
+	code.OpClosure:       true,
+	code.OpIndexConstant: true,
+}
+
+// instruction is a decoded instruction. The operand of a jump is the index
+// of its target in the sequence of instructions rather than an offset.
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	pos      token.Position // From the source map.
+}
+
+// jumpOpcodes are the opcodes whose operand is the offset of the
+// instruction they may continue at.
+var jumpOpcodes = map[code.Opcode]bool{
+	code.OpJump:          true,
+	code.OpJumpNotTruthy: true,
+	code.OpAnd:           true,
+	code.OpOr:            true,
+	code.OpCoalesce:      true,
+}
+
+// pureLoad reports whether ins only pushes a value, without popping any or
+// having an effect that could fail.
+func pureLoad(ins instruction) bool {
+	switch ins.op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpGetBuiltin:
+		return true
+	case code.OpClosure:
+		return ins.operands[1] == 0
+	}
+	return false
+}
+
+// redundantPair reports whether the instructions in and next, executed one
+// after the other, have no effect.
+func redundantPair(in, next instruction) bool {
+	return pureLoad(in) && next.op == code.OpPop
+}
+
+// loadOf are the opcodes loading the variables that the opcodes they are
+// keyed by store to.
+var loadOf = map[code.Opcode]code.Opcode{
+	code.OpSetGlobal: code.OpGetGlobal,
+	code.OpSetLocal:  code.OpGetLocal,
+}
+
+// reload reports whether next loads the variable that in stores to, which
+// is then known to be set.
+func reload(in, next instruction) bool {
+	load, ok := loadOf[in.op]
+	return ok && next.op == load && next.operands[0] == in.operands[0]
+}
+
+// optimizeInstructions applies the peephole optimizations to ins, whose
+// source map is m, until none applies anymore, and returns the result with
+// its source map. If keepLastPop is set, a final OpPop is kept along with
+// the value it pops.
+func optimizeInstructions(ins code.Instructions, m code.SourceMap, keepLastPop bool) (code.Instructions, code.SourceMap) {
+	list := decodeInstructions(ins, m)
+
+	for {
+		threadJumps(list)
+
+		targets := make(map[int]bool)
+		for _, in := range list {
+			if jumpOpcodes[in.op] {
+				targets[in.operands[0]] = true
+			}
+		}
+
+		removed := make([]bool, len(list))
+		changed := false
+		for i := 0; i < len(list); i++ {
+			if list[i].op == code.OpJump && list[i].operands[0] == i+1 {
+				removed[i], changed = true, true
+				continue
+			}
+			if i+1 >= len(list) || targets[i+1] {
+				continue
+			}
+			if keepLastPop && i+1 == len(list)-1 && list[i+1].op == code.OpPop {
+				continue
+			}
+			if redundantPair(list[i], list[i+1]) {
+				removed[i], removed[i+1], changed = true, true, true
+				i++
+				continue
+			}
+			if reload(list[i], list[i+1]) {
+				changed = true
+				if popped(list, i+2, targets, keepLastPop) {
+					removed[i+1], removed[i+2] = true, true
+					i += 2
+					continue
+				}
+				list[i], list[i+1] = instruction{op: code.OpDup, pos: list[i].pos}, list[i]
+				i++
+			}
+		}
+
+		if !changed {
+			break
+		}
+		list = removeInstructions(list, removed)
+	}
+
+	return encodeInstructions(list)
+}
+
+// popped reports whether the instruction at i of list is an OpPop that can
+// be removed along with the value it pops.
+func popped(list []instruction, i int, targets map[int]bool, keepLastPop bool) bool {
+	if i >= len(list) || list[i].op != code.OpPop || targets[i] {
+		return false
+	}
+	return !keepLastPop || i != len(list)-1
+}
+
+// threadJumps makes the jumps of list that go to an unconditional jump go to
+// its target instead.
+func threadJumps(list []instruction) {
+	for i := range list {
+		if !jumpOpcodes[list[i].op] {
+			continue
+		}
+		// Following at most len(list) jumps guards against cycles.
+		target := list[i].operands[0]
+		for n := 0; n < len(list) && target < len(list) && list[target].op == code.OpJump; n++ {
+			target = list[target].operands[0]
+		}
+		list[i].operands[0] = target
+	}
+}
+
+// removeInstructions returns list without the instructions marked as
+// removed. Jumps to a removed instruction go to the next one kept.
+func removeInstructions(list []instruction, removed []bool) []instruction {
+	newIndex := make([]int, len(list)+1)
+	kept := 0
+	for i := range list {
+		newIndex[i] = kept
+		if !removed[i] {
+			kept++
+		}
+	}
+	newIndex[len(list)] = kept
+
+	result := make([]instruction, 0, kept)
+	for i, in := range list {
+		if removed[i] {
+			continue
+		}
+		if jumpOpcodes[in.op] {
+			in.operands[0] = newIndex[in.operands[0]]
+		}
+		result = append(result, in)
+	}
+	return result
+}
+
+// decodeInstructions decodes ins, which must be well formed, turning jump
+// offsets into indexes, and looks their positions up in m.
+func decodeInstructions(ins code.Instructions, m code.SourceMap) []instruction {
+	var list []instruction
+	index := make(map[int]int) // Of the instruction at each offset.
+
+	for pos := 0; pos < len(ins); {
+		def, _ := code.Lookup(ins[pos])
+		operands, read := code.ReadOperands(def, ins[pos+1:])
+		index[pos] = len(list)
+		list = append(list, instruction{op: code.Opcode(ins[pos]), operands: operands, pos: m.Pos(pos)})
+		pos += 1 + read
+	}
+	index[len(ins)] = len(list)
+
+	for _, in := range list {
+		if jumpOpcodes[in.op] {
+			in.operands[0] = index[in.operands[0]]
+		}
+	}
+	return list
+}
+
+// encodeInstructions encodes list, turning jump indexes back into offsets,
+// and returns the source map of the positions of its instructions.
+func encodeInstructions(list []instruction) (code.Instructions, code.SourceMap) {
+	offsets := make([]int, len(list)+1)
+	for i, in := range list {
+		offsets[i+1] = offsets[i] + len(code.Make(in.op, in.operands...))
+	}
+
+	ins := code.Instructions{}
+	var m code.SourceMap
+	var pos token.Position
+	for i, in := range list {
+		operands := in.operands
+		if jumpOpcodes[in.op] {
+			operands = []int{offsets[operands[0]]}
+		}
+		ins = append(ins, code.Make(in.op, operands...)...)
+
+		if in.pos != pos {
+			m = append(m, code.SourceMapEntry{Offset: offsets[i], Pos: in.pos})
+			pos = in.pos
+		}
+	}
+	return ins, m
+}
@@ -0,0 +1,269 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/object"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name   string
+		before []code.Instructions
+		after  string
+	}{
+		{
+			name: "push and pop",
+			before: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+			// The last value is the result of the program.
+			after: "0000 OpTrue\n0001 OpPop\n",
+		},
+		{
+			name: "pushes with effects",
+			before: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpClosure, 1, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+			},
+			after: "0000 OpGetLocal 0\n0002 OpClosure 0 1\n0006 OpPop\n0007 OpCall 0\n0009 OpPop\n0010 OpNull\n",
+		},
+		{
+			// Loads of variables fail if they are unset.
+			name: "variable loads",
+			before: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetFree, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 2),
+				code.Make(code.OpSetLocal, 2),
+				code.Make(code.OpNull),
+			},
+			after: "0000 OpGetGlobal 0\n0003 OpPop\n0004 OpGetLocal 1\n0006 OpPop\n0007 OpGetFree 2\n0009 OpPop\n0010 OpGetLocal 2\n0012 OpSetLocal 2\n0014 OpNull\n",
+		},
+		{
+			name: "pairs uncovered by removals",
+			before: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+			},
+			after: "0000 OpNull\n",
+		},
+		{
+			name: "store and load",
+			before: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+			// Only loads of the variable just stored to go.
+			after: "0000 OpConstant 0\n0003 OpDup\n0004 OpSetGlobal 0\n0007 OpDup\n0008 OpSetLocal 1\n0010 OpSetGlobal 2\n0013 OpGetGlobal 1\n0016 OpPop\n",
+		},
+		{
+			name: "store and load popped",
+			before: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+			// The last value is the result of the program.
+			after: "0000 OpConstant 0\n0003 OpSetGlobal 0\n0006 OpConstant 0\n0009 OpDup\n0010 OpSetGlobal 1\n0013 OpPop\n",
+		},
+		{
+			name: "jumps to a load",
+			before: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpNull),             // 0004
+				code.Make(code.OpSetGlobal, 0),     // 0005
+				code.Make(code.OpGetGlobal, 0),     // 0008
+				code.Make(code.OpNull),             // 0011
+			},
+			after: "0000 OpTrue\n0001 OpJumpNotTruthy 8\n0004 OpNull\n0005 OpSetGlobal 0\n0008 OpGetGlobal 0\n0011 OpNull\n",
+		},
+		{
+			name: "jump chains",
+			before: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 7), // 0001
+				code.Make(code.OpJump, 10),         // 0004
+				code.Make(code.OpJump, 13),         // 0007
+				code.Make(code.OpJump, 7),          // 0010
+				code.Make(code.OpNull),             // 0013
+			},
+			// Once they go straight to the end, the jumps go to the next
+			// instruction, one after the other.
+			after: "0000 OpTrue\n0001 OpJumpNotTruthy 4\n0004 OpNull\n",
+		},
+		{
+			name: "jump cycles",
+			before: []code.Instructions{
+				code.Make(code.OpJump, 3), // 0000
+				code.Make(code.OpJump, 0), // 0003
+			},
+			after: "0000 OpJump 0\n",
+		},
+		{
+			name: "jumps to the next instruction",
+			before: []code.Instructions{
+				code.Make(code.OpFalse),   // 0000
+				code.Make(code.OpOr, 7),   // 0001
+				code.Make(code.OpJump, 7), // 0004
+				code.Make(code.OpNull),    // 0007
+			},
+			after: "0000 OpFalse\n0001 OpOr 4\n0004 OpNull\n",
+		},
+		{
+			name: "jumps into a removed pair",
+			before: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 7), // 0001
+				code.Make(code.OpNull),             // 0004
+				code.Make(code.OpPop),              // 0005
+				code.Make(code.OpNull),             // 0006
+				code.Make(code.OpTrue),             // 0007
+				code.Make(code.OpPop),              // 0008
+				code.Make(code.OpFalse),            // 0009
+			},
+			after: "0000 OpTrue\n0001 OpJumpNotTruthy 5\n0004 OpNull\n0005 OpFalse\n",
+		},
+		{
+			name: "jumps to a pop",
+			before: []code.Instructions{
+				code.Make(code.OpTrue),   // 0000
+				code.Make(code.OpAnd, 5), // 0001
+				code.Make(code.OpNull),   // 0004
+				code.Make(code.OpPop),    // 0005
+				code.Make(code.OpNull),   // 0006
+			},
+			after: "0000 OpTrue\n0001 OpAnd 5\n0004 OpNull\n0005 OpPop\n0006 OpNull\n",
+		},
+	}
+
+	for _, tt := range tests {
+		before := concatInstructions(tt.before)
+		optimized := Optimize(&Bytecode{Instructions: before, Constants: []object.Object{
+			&object.Integer{Value: 1},
+			&object.CompiledFunction{Instructions: code.Make(code.OpReturn)},
+		}})
+
+		if got := optimized.Instructions.String(); got != tt.after {
+			t.Errorf("%s: wrong instructions.\nbefore:\n%s\nwant:\n%s\ngot:\n%s",
+				tt.name, before, tt.after, got)
+		}
+	}
+}
+
+func TestOptimizeFunctions(t *testing.T) {
+	input := "let f = fn(a) { 1; true; 2 }; f(1); 3"
+	bytecode := compile(t, input)
+	before := bytecode.Constants[2].(*object.CompiledFunction).Instructions.String()
+
+	optimized := Optimize(bytecode)
+
+	// The first constant, 1, was only used by the statement removed from
+	// f, so the others move down.
+	if err := testConstants([]interface{}{
+		2,
+		[]code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpReturnValue),
+		},
+		1,
+		3,
+	}, optimized.Constants); err != nil {
+		t.Errorf("wrong constants: %s\nbefore:\n%s", err, before)
+	}
+	if fn := optimized.Constants[1].(*object.CompiledFunction); fn.NumLocals != 1 || fn.NumParameters != 1 {
+		t.Errorf("wrong function. got=%+v", fn)
+	}
+
+	want := "0000 OpClosure 1 0\n0004 OpDup\n0005 OpSetGlobal 0\n0008 OpConstant 2\n0011 OpCall 1\n0013 OpPop\n0014 OpConstant 3\n0017 OpPop\n"
+	if got := optimized.Instructions.String(); got != want {
+		t.Errorf("wrong program instructions.\nbefore:\n%s\nwant:\n%s\ngot:\n%s", bytecode.Instructions, want, got)
+	}
+
+	// The original is left alone.
+	if got := bytecode.Constants[2].(*object.CompiledFunction).Instructions.String(); got != before {
+		t.Errorf("Optimize modified its argument:\n%s", got)
+	}
+	if len(bytecode.Constants) != 5 {
+		t.Errorf("Optimize modified the constants of its argument: %d", len(bytecode.Constants))
+	}
+}
+
+func TestStripConstants(t *testing.T) {
+	// The code after the return and the branch not taken aren't compiled at
+	// all. The optimizer removes the other statements but the last, so the
+	// function they created goes along with its constants.
+	input := `
+	let f = fn() { return 2; fn() { 3 } };
+	if (false) { fn() { 4 } } else { 5 };
+	fn() { 6 };
+	f`
+	bytecode := compile(t, input)
+	if len(bytecode.Constants) != 5 {
+		t.Fatalf("wrong number of compiled constants. got=%d, want=5", len(bytecode.Constants))
+	}
+
+	optimized := Optimize(bytecode)
+	if err := testConstants([]interface{}{
+		2,
+		[]code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpReturnValue),
+		},
+	}, optimized.Constants); err != nil {
+		t.Errorf("wrong constants: %s", err)
+	}
+	want := "0000 OpClosure 1 0\n0004 OpDup\n0005 OpSetGlobal 0\n0008 OpPop\n"
+	if got := optimized.Instructions.String(); got != want {
+		t.Errorf("wrong instructions.\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	// Keys of OpIndexConstant are renumbered too.
+	optimized = Optimize(compile(t, `fn() { 1 }; let h = {}; h["a"]`))
+	if err := testConstants([]interface{}{"a"}, optimized.Constants); err != nil {
+		t.Errorf("wrong constants: %s", err)
+	}
+	want = "0000 OpHash 0\n0003 OpDup\n0004 OpSetGlobal 0\n0007 OpIndexConstant 0\n0010 OpPop\n"
+	if got := optimized.Instructions.String(); got != want {
+		t.Errorf("wrong instructions.\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	optimized = Optimize(&Bytecode{
+		Instructions: code.Make(code.OpTrue),
+		Constants:    []object.Object{&object.Integer{Value: 1}},
+	})
+	if len(optimized.Constants) != 0 {
+		t.Errorf("unused constants kept: %+v", optimized.Constants)
+	}
+}
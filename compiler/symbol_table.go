@@ -0,0 +1,154 @@
+package compiler
+
+// SymbolScope tells where the value of a symbol is stored.
+type SymbolScope string
+
+const (
+	// GlobalScope symbols are bound by top-level statements and stored in
+	// the VM's globals.
+	GlobalScope SymbolScope = "GLOBAL"
+	// LocalScope symbols are the parameters and lets of a function, stored
+	// in its frame.
+	LocalScope SymbolScope = "LOCAL"
+	// FreeScope symbols are the locals of enclosing functions that a
+	// function refers to, stored in its closure. The index is that of the
+	// table's FreeSymbols.
+	FreeScope SymbolScope = "FREE"
+	// FunctionScope is the scope of the name a function is bound to, which
+	// refers to the function itself from within its body.
+	FunctionScope SymbolScope = "FUNCTION"
+	// BuiltinScope symbols are the builtin functions, by their index in the
+	// table of builtins.
+	BuiltinScope SymbolScope = "BUILTIN"
+)
+
+// Symbol is a name resolved to the slot holding its value.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable maps the names bound in a scope to symbols. The table of a
+// function or block expression is enclosed by the table of the scope it is
+// in.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// FreeSymbols are the symbols of the enclosing scopes that the
+	// FreeScope symbols of the table stand for, in order of their indexes.
+	FreeSymbols []Symbol
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// names are the names of the slots of the scope, by index.
+	names []string
+
+	// block is set for the table of a block expression, whose symbols take
+	// slots of the function or program the block is in.
+	block bool
+}
+
+// NewSymbolTable returns a table for the global scope.
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+// NewEnclosedSymbolTable returns a table for the locals of a function
+// defined in the scope of outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable returns a table for the lets of a block expression in
+// the scope of outer. They shadow the bindings of outer within the block
+// only, but are stored in the slots of the enclosing function or program.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// Define binds name in s, giving it the next free slot of the scope. A name
+// s already binds as a global or local keeps its slot, since the new
+// binding replaces the old one.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	slots := s
+	for slots.block {
+		slots = slots.Outer
+	}
+	symbol := Symbol{Name: name, Index: slots.numDefinitions, Scope: GlobalScope}
+	if slots.Outer != nil {
+		symbol.Scope = LocalScope
+	}
+	s.store[name] = symbol
+	slots.names = append(slots.names, name)
+	slots.numDefinitions++
+	return symbol
+}
+
+// Names returns the names of the globals or locals s defines, indexed by
+// slot, or nil if there are none. The lets of block expressions have slots
+// of their own, so a name may have several.
+func (s *SymbolTable) Names() []string {
+	if s.numDefinitions == 0 {
+		return nil
+	}
+	return append([]string(nil), s.names...)
+}
+
+// DefineBuiltin binds name to the builtin function at index in the table
+// of builtins. Builtins are usually defined in the global table, where
+// the bindings of a program may shadow them.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName binds name to the function whose locals s holds, for
+// the body of a function literal bound to name. Its parameters and lets
+// shadow it.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// defineFree binds original's name in s to a new free symbol standing for
+// original, a symbol of an enclosing table.
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Resolve returns the symbol name refers to in s: its own binding of name
+// or, failing that, that of the tables enclosing it. A local of an
+// enclosing function, free or not, is captured: it is bound in s, and the
+// tables in between, to a free symbol. The tables of block expressions
+// capture nothing, since their blocks run in the function enclosing them.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || s.block {
+		return symbol, ok
+	}
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+	return s.defineFree(symbol), true
+}
@@ -0,0 +1,277 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+		"e": {Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	global := NewSymbolTable()
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+	if b := global.Define("b"); b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("redefined a=%+v, want %+v", a, expected["a"])
+	}
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	if c := firstLocal.Define("c"); c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+	if d := firstLocal.Define("d"); d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	if e := secondLocal.Define("e"); e != expected["e"] {
+		t.Errorf("expected e=%+v, got=%+v", expected["e"], e)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+	local.Define("c")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: LocalScope, Index: 0},
+		{Name: "c", Scope: LocalScope, Index: 1},
+	}
+
+	for _, sym := range expected {
+		result, ok := local.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if _, ok := local.Resolve("d"); ok {
+		t.Errorf("undefined name d resolved")
+	}
+	if b, _ := global.Resolve("b"); b.Scope != GlobalScope {
+		t.Errorf("global b resolved to %+v", b)
+	}
+}
+
+func TestBlockSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+
+	block := NewBlockSymbolTable(local)
+	expected := map[string]Symbol{
+		"b": {Name: "b", Scope: LocalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 2},
+	}
+	for _, name := range []string{"b", "c"} {
+		if sym := block.Define(name); sym != expected[name] {
+			t.Errorf("expected %s=%+v, got=%+v", name, expected[name], sym)
+		}
+	}
+
+	// The block shadows b, and captures nothing.
+	for _, sym := range []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		expected["b"],
+		expected["c"],
+	} {
+		if result, ok := block.Resolve(sym.Name); !ok || result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+	if b, _ := local.Resolve("b"); b.Index != 0 {
+		t.Errorf("block binding of b visible outside it: %+v", b)
+	}
+	if _, ok := local.Resolve("c"); ok {
+		t.Errorf("block binding of c visible outside it")
+	}
+
+	if names := local.Names(); len(names) != 3 || names[0] != "b" || names[1] != "b" || names[2] != "c" {
+		t.Errorf("wrong names %q", names)
+	}
+
+	inner := NewEnclosedSymbolTable(block)
+	if c, _ := inner.Resolve("c"); c != (Symbol{Name: "c", Scope: FreeScope, Index: 0}) {
+		t.Errorf("c resolved to %+v in a function in the block", c)
+	}
+	if len(block.FreeSymbols) != 0 {
+		t.Errorf("block captured %+v", block.FreeSymbols)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("c")
+
+	tests := []struct {
+		table               *SymbolTable
+		expectedSymbols     []Symbol
+		expectedFreeSymbols []Symbol
+	}{
+		{
+			firstLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "b", Scope: LocalScope, Index: 0},
+			},
+			[]Symbol{},
+		},
+		{
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "b", Scope: FreeScope, Index: 0},
+				{Name: "c", Scope: LocalScope, Index: 0},
+			},
+			[]Symbol{
+				{Name: "b", Scope: LocalScope, Index: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expectedSymbols {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+
+		if len(tt.table.FreeSymbols) != len(tt.expectedFreeSymbols) {
+			t.Errorf("wrong number of free symbols. got=%d, want=%d",
+				len(tt.table.FreeSymbols), len(tt.expectedFreeSymbols))
+			continue
+		}
+		for i, sym := range tt.expectedFreeSymbols {
+			if result := tt.table.FreeSymbols[i]; result != sym {
+				t.Errorf("wrong free symbol. got=%+v, want=%+v", result, sym)
+			}
+		}
+	}
+
+	// A second reference reuses the free symbol.
+	if b, _ := secondLocal.Resolve("b"); b.Index != 0 || len(secondLocal.FreeSymbols) != 1 {
+		t.Errorf("b captured again: %+v, free symbols %+v", b, secondLocal.FreeSymbols)
+	}
+}
+
+func TestResolveNestedFree(t *testing.T) {
+	global := NewSymbolTable()
+	first := NewEnclosedSymbolTable(global)
+	first.Define("a")
+	second := NewEnclosedSymbolTable(first)
+	third := NewEnclosedSymbolTable(second)
+
+	a, ok := third.Resolve("a")
+	if !ok || a != (Symbol{Name: "a", Scope: FreeScope, Index: 0}) {
+		t.Fatalf("a resolved to %+v in the innermost table", a)
+	}
+	want := Symbol{Name: "a", Scope: FreeScope, Index: 0}
+	if len(third.FreeSymbols) != 1 || third.FreeSymbols[0] != want {
+		t.Errorf("innermost free symbols %+v, want [%+v]", third.FreeSymbols, want)
+	}
+	want = Symbol{Name: "a", Scope: LocalScope, Index: 0}
+	if len(second.FreeSymbols) != 1 || second.FreeSymbols[0] != want {
+		t.Errorf("intermediate free symbols %+v, want [%+v]", second.FreeSymbols, want)
+	}
+}
+
+func TestResolveUnresolvableFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	for _, name := range []string{"b", "d"} {
+		if _, ok := secondLocal.Resolve(name); ok {
+			t.Errorf("name %s resolved, but was expected not to", name)
+		}
+	}
+	if len(secondLocal.FreeSymbols) != 0 {
+		t.Errorf("unresolvable names captured: %+v", secondLocal.FreeSymbols)
+	}
+}
+
+func TestDefineResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+	firstLocal := NewEnclosedSymbolTable(global)
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+
+	expected := []Symbol{
+		{Name: "a", Scope: BuiltinScope, Index: 0},
+		{Name: "c", Scope: BuiltinScope, Index: 1},
+		{Name: "e", Scope: BuiltinScope, Index: 2},
+	}
+	for i, v := range expected {
+		global.DefineBuiltin(i, v.Name)
+	}
+
+	for _, table := range []*SymbolTable{global, firstLocal, secondLocal} {
+		for _, sym := range expected {
+			result, ok := table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	// Program bindings shadow builtins.
+	if a := global.Define("a"); a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("a defined as %+v over the builtin", a)
+	}
+}
+
+func TestDefineFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("a")
+
+	expected := Symbol{Name: "a", Scope: FunctionScope, Index: 0}
+	if result, ok := local.Resolve("a"); !ok || result != expected {
+		t.Errorf("expected a to resolve to %+v, got=%+v", expected, result)
+	}
+
+	// A parameter or let of the same name shadows the function.
+	if a := local.Define("a"); a != (Symbol{Name: "a", Scope: LocalScope, Index: 0}) {
+		t.Errorf("a defined as %+v over the function name", a)
+	}
+	if result, _ := local.Resolve("a"); result.Scope != LocalScope {
+		t.Errorf("a resolved to %+v after shadowing", result)
+	}
+}
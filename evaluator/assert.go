@@ -0,0 +1,52 @@
+package evaluator
+
+import (
+	"github.com/j4nu5/monkey/object"
+)
+
+// assert implements `assert(cond, msg)`, which fails unless cond is truthy.
+// The error's message is "assertion failed", followed by msg if given; like
+// any error returned by a builtin, its Stack starts with the position of the
+// call.
+func (in *Interpreter) assert(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+	message := "assertion failed"
+	if len(args) == 2 {
+		msg, ok := args[1].(*object.String)
+		if !ok {
+			return newError("argument to `assert` must be STRING, got %s",
+				args[1].Type())
+		}
+		message += ": " + msg.Value
+	}
+
+	ok, err := in.isTruthy(args[0])
+	if err != nil {
+		return err
+	}
+	if ok {
+		return NULL
+	}
+	return newError("%s", message)
+}
+
+// assertEqual implements `assertEqual(actual, expected)`, which fails unless
+// the values are equal, as by `==`. The
+// error's Details hold both values, as "actual" and "expected".
+func assertEqual(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	actual, expected := args[0], args[1]
+	if valuesEqual(actual, expected) {
+		return NULL
+	}
+
+	err := newError("assertion failed: got %s, want %s", actual.Inspect(), expected.Inspect())
+	err.Details = map[string]object.Object{"actual": actual, "expected": expected}
+	return err
+}
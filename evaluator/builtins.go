@@ -0,0 +1,657 @@
+package evaluator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// interpreterBuiltins are the builtins that need the interpreter running
+// them, to call the functions passed to them. Each Interpreter binds them to
+// itself.
+var interpreterBuiltins = map[string]func(in *Interpreter, args ...object.Object) object.Object{
+	"puts":      (*Interpreter).puts,
+	"print":     (*Interpreter).print,
+	"readLine":  (*Interpreter).readLine,
+	"input":     (*Interpreter).inputLine,
+	"memo":      (*Interpreter).memo,
+	"map":       (*Interpreter).mapArray,
+	"filter":    (*Interpreter).filter,
+	"reduce":    (*Interpreter).reduce,
+	"sort":      (*Interpreter).sort,
+	"random":    (*Interpreter).random,
+	"reMatch":   (*Interpreter).reMatch,
+	"reFind":    (*Interpreter).reFind,
+	"reReplace": (*Interpreter).reReplace,
+	"reSplit":   (*Interpreter).reSplit,
+	"now":       (*Interpreter).now,
+	"sleep":     (*Interpreter).sleep,
+	"assert":    (*Interpreter).assert,
+	"iter":      (*Interpreter).iter,
+	"take":      (*Interpreter).take,
+	"collect":   (*Interpreter).collect,
+}
+
+// builtins are the functions predefined in every program. Bindings in the
+// environment take precedence over them.
+var builtins = map[string]*object.Builtin{
+	"len": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				return object.NewInteger(int64(len(arg.Elements)))
+			case *object.String:
+				return object.NewInteger(int64(len(arg.Value)))
+			default:
+				return newError("argument to `len` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	},
+	"format": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want at least 1")
+			}
+			f, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `format` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			s, err := format(f.Value, args[1:])
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: s}
+		},
+	},
+	"error": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			msg, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `error` must be STRING, got %s",
+					args[0].Type())
+			}
+			return newError("%s", msg.Value)
+		},
+	},
+	"type": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			return &object.String{Value: string(args[0].Type())}
+		},
+	},
+	"int": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			return toInteger(args[0])
+		},
+	},
+	"str": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if s, ok := args[0].(*object.String); ok {
+				return s
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+	"assertEqual": {Fn: assertEqual},
+	"next":        {Fn: next},
+	"formatTime":  {Fn: formatTime},
+	"parseTime":   {Fn: parseTime},
+	"jsonEncode":  {Fn: jsonEncode},
+	"jsonDecode":  {Fn: jsonDecode},
+	"same":        {Fn: same},
+	"abs": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			return abs(args[0])
+		},
+	},
+	"min": {
+		Fn: func(args ...object.Object) object.Object {
+			return extremum("min", false, args)
+		},
+	},
+	"max": {
+		Fn: func(args ...object.Object) object.Object {
+			return extremum("max", true, args)
+		},
+	},
+	"pow": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			return pow(args[0], args[1])
+		},
+	},
+	"sqrt": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			return sqrt(args[0])
+		},
+	},
+	"floor": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			return round("floor", math.Floor, args[0])
+		},
+	},
+	"ceil": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			return round("ceil", math.Ceil, args[0])
+		},
+	},
+	"bool": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			return nativeBoolToBooleanObject(args[0] != NULL && args[0] != FALSE)
+		},
+	},
+	"first": {
+		Fn: func(args ...object.Object) object.Object {
+			arr, err := arrayArgument("first", args)
+			if err != nil {
+				return err
+			}
+
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+
+			return NULL
+		},
+	},
+	"last": {
+		Fn: func(args ...object.Object) object.Object {
+			arr, err := arrayArgument("last", args)
+			if err != nil {
+				return err
+			}
+
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+
+			return NULL
+		},
+	},
+	"rest": {
+		Fn: func(args ...object.Object) object.Object {
+			arr, err := arrayArgument("rest", args)
+			if err != nil {
+				return err
+			}
+
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]object.Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &object.Array{Elements: newElements}
+			}
+
+			return NULL
+		},
+	},
+	"push": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			if args[0].Type() != object.ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+
+			newElements := make([]object.Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+
+			return &object.Array{Elements: newElements}
+		},
+	},
+	"keys": {
+		Fn: func(args ...object.Object) object.Object {
+			hash, err := hashArgument("keys", args)
+			if err != nil {
+				return err
+			}
+			keys := []object.Object{}
+			for _, pair := range hash.Ordered() {
+				keys = append(keys, pair.Key)
+			}
+			return &object.Array{Elements: keys}
+		},
+	},
+	"values": {
+		Fn: func(args ...object.Object) object.Object {
+			hash, err := hashArgument("values", args)
+			if err != nil {
+				return err
+			}
+			values := []object.Object{}
+			for _, pair := range hash.Ordered() {
+				values = append(values, pair.Value)
+			}
+			return &object.Array{Elements: values}
+		},
+	},
+}
+
+// BuiltinNames are the names of the builtin functions and constants every
+// Interpreter has, sorted; those of capabilities are not included. The
+// compiler and VM packages number builtins by their position in it, so
+// that compiled code can use those of the evaluator. It must not be
+// modified.
+var BuiltinNames = builtinNames()
+
+func builtinNames() []string {
+	var names []string
+	for name := range interpreterBuiltins {
+		names = append(names, name)
+	}
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range constants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// toInteger implements `int(x)`. Integers are returned as they are, floats
+// are truncated toward zero and strings are parsed as decimal integers,
+// with an optional sign. Strings that aren't integers, numbers out of range
+// and values of other types are errors.
+func toInteger(arg object.Object) object.Object {
+	switch arg := arg.(type) {
+	case *object.Integer:
+		return arg
+	case *object.Float:
+		f := math.Trunc(arg.Value)
+		if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return newError("int: %s out of range", arg.Inspect())
+		}
+		return object.NewInteger(int64(f))
+	case *object.String:
+		i, err := strconv.ParseInt(arg.Value, 10, 64)
+		if err != nil {
+			if err.(*strconv.NumError).Err == strconv.ErrRange {
+				return newError("int: %q out of range", arg.Value)
+			}
+			return newError("int: cannot parse %q as INTEGER", arg.Value)
+		}
+		return object.NewInteger(i)
+	default:
+		return newError("argument to `int` not supported, got %s", arg.Type())
+	}
+}
+
+// stringArguments checks that args, the arguments to the builtin called
+// name, are n strings, and returns them.
+func stringArguments(name string, n int, args []object.Object) ([]string, *object.Error) {
+	if len(args) != n {
+		return nil, newError("wrong number of arguments. got=%d, want=%d",
+			len(args), n)
+	}
+	strs := make([]string, n)
+	for i, arg := range args {
+		s, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError("argument to `%s` must be STRING, got %s",
+				name, arg.Type())
+		}
+		strs[i] = s.Value
+	}
+	return strs, nil
+}
+
+// arrayArgument checks that args consists of a single array and returns it.
+func arrayArgument(name string, args []object.Object) (*object.Array, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s",
+			name, args[0].Type())
+	}
+	return arr, nil
+}
+
+// hashArgument checks that args consists of a single hash and returns it.
+func hashArgument(name string, args []object.Object) (*object.Hash, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s",
+			name, args[0].Type())
+	}
+	return hash, nil
+}
+
+// puts implements `puts(values...)`, which writes the values to the
+// interpreter's Output on one line, separated by spaces.
+func (in *Interpreter) puts(args ...object.Object) object.Object {
+	fmt.Fprintln(in.opts.Output, joinValues(args))
+	return NULL
+}
+
+// print implements `print(values...)`, which is like puts but doesn't end
+// the line.
+func (in *Interpreter) print(args ...object.Object) object.Object {
+	fmt.Fprint(in.opts.Output, joinValues(args))
+	return NULL
+}
+
+// readLine implements `readLine()`, which returns the next line of the
+// interpreter's Input without its line ending, or null at the end of the
+// input.
+func (in *Interpreter) readLine(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0",
+			len(args))
+	}
+	return in.nextLine("readLine")
+}
+
+// inputLine implements `input(prompt)`, which writes prompt, if given, to
+// the interpreter's Output and then reads a line like readLine.
+func (in *Interpreter) inputLine(args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1",
+			len(args))
+	}
+	if len(args) == 1 {
+		prompt, ok := args[0].(*object.String)
+		if !ok {
+			return newError("argument to `input` must be STRING, got %s",
+				args[0].Type())
+		}
+		fmt.Fprint(in.opts.Output, prompt.Value)
+	}
+	return in.nextLine("input")
+}
+
+// nextLine reads a line for the builtin called name.
+func (in *Interpreter) nextLine(name string) object.Object {
+	if in.input == nil {
+		in.input = bufio.NewReader(in.opts.Input)
+	}
+
+	line, err := in.input.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return NULL
+	}
+	if err != nil && err != io.EOF {
+		return newError("%s: %s", name, err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &object.String{Value: line}
+}
+
+// joinValues returns the values as displayed by Inspect, separated by
+// spaces.
+func joinValues(values []object.Object) string {
+	s := make([]string, len(values))
+	for i, value := range values {
+		s[i] = value.Inspect()
+	}
+	return strings.Join(s, " ")
+}
+
+// memo implements `memo(fn)`, which returns a function computing the same
+// results as fn but remembering them by argument, so that fn is called at
+// most once per list of arguments. The arguments must be usable as hash
+// keys. Errors are not remembered. fn should be pure: its side effects only
+// happen on the first call with each list of arguments.
+func (in *Interpreter) memo(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	fn := args[0]
+	if !isCallable(fn) {
+		return newError("argument to `memo` must be FUNCTION, got %s",
+			fn.Type())
+	}
+
+	cache := make(map[string]object.Object)
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		var key strings.Builder
+		for _, arg := range args {
+			hashable, ok := arg.(object.Hashable)
+			if !ok {
+				return newError("unusable as memo key: %s", arg.Type())
+			}
+			hk := hashable.HashKey()
+			fmt.Fprintf(&key, "%s:%d,", hk.Type, hk.Value)
+		}
+
+		if result, ok := cache[key.String()]; ok {
+			return result
+		}
+		result := in.applyFunction(fn, args)
+		if !isError(result) {
+			cache[key.String()] = result
+		}
+		return result
+	}}
+}
+
+// callbackArguments checks that args consist of an array, a function and,
+// if extra, one more value, and returns the array and the function.
+func callbackArguments(name string, args []object.Object, extra bool) (*object.Array, object.Object, *object.Error) {
+	if len(args) != 2 && !(extra && len(args) == 3) {
+		want := "2"
+		if extra {
+			want = "2 or 3"
+		}
+		return nil, nil, newError("wrong number of arguments. got=%d, want=%s",
+			len(args), want)
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, nil, newError("argument to `%s` must be ARRAY, got %s",
+			name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return nil, nil, newError("argument to `%s` must be FUNCTION, got %s",
+			name, args[1].Type())
+	}
+	return arr, args[1], nil
+}
+
+// mapArray implements `map(arr, fn)`, which returns the array of the results
+// of fn for each element of arr.
+func (in *Interpreter) mapArray(args ...object.Object) object.Object {
+	arr, fn, err := callbackArguments("map", args, false)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]object.Object, len(arr.Elements))
+	for i, elem := range arr.Elements {
+		result := in.applyFunction(fn, []object.Object{elem})
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+	return &object.Array{Elements: elements}
+}
+
+// filter implements `filter(arr, fn)`, which returns the array of the
+// elements of arr for which fn returns a truthy value.
+func (in *Interpreter) filter(args ...object.Object) object.Object {
+	arr, fn, err := callbackArguments("filter", args, false)
+	if err != nil {
+		return err
+	}
+
+	elements := []object.Object{}
+	for _, elem := range arr.Elements {
+		result := in.applyFunction(fn, []object.Object{elem})
+		if isError(result) {
+			return result
+		}
+		keep, err := in.isTruthy(result)
+		if err != nil {
+			return err
+		}
+		if keep {
+			elements = append(elements, elem)
+		}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// reduce implements `reduce(arr, fn, initial)`, which combines the elements
+// of arr from left to right, starting from initial, as
+// fn(...fn(fn(initial, arr[0]), arr[1])..., arr[n-1]). Without initial, it
+// starts from the first element, and arr must not be empty.
+func (in *Interpreter) reduce(args ...object.Object) object.Object {
+	arr, fn, err := callbackArguments("reduce", args, true)
+	if err != nil {
+		return err
+	}
+
+	elements := arr.Elements
+	var acc object.Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else {
+		if len(elements) == 0 {
+			return newError("reduce of empty array with no initial value")
+		}
+		acc, elements = elements[0], elements[1:]
+	}
+
+	for _, elem := range elements {
+		acc = in.applyFunction(fn, []object.Object{acc, elem})
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+// sort implements `sort(arr)` and `sort(arr, less)`, which return the
+// elements of arr in increasing order, keeping equal elements in their
+// original order. By default, strings are compared byte by byte and other
+// elements with `<`; less, if given, must return whether its first argument
+// goes before its second.
+func (in *Interpreter) sort(args ...object.Object) object.Object {
+	var arr *object.Array
+	var less object.Object
+	var err *object.Error
+	switch len(args) {
+	case 1:
+		arr, err = arrayArgument("sort", args)
+	case 2:
+		arr, less, err = callbackArguments("sort", args, false)
+	default:
+		err = newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+	if err != nil {
+		return err
+	}
+
+	elements := make([]object.Object, len(arr.Elements))
+	copy(elements, arr.Elements)
+
+	// Once a comparison fails, the order doesn't matter any more: less
+	// isn't called again and the error is returned.
+	var failure object.Object
+	sort.SliceStable(elements, func(i, j int) bool {
+		if failure != nil {
+			return false
+		}
+		var result object.Object
+		if less == nil {
+			result = defaultLess(elements[i], elements[j])
+		} else {
+			result = in.applyFunction(less, []object.Object{elements[i], elements[j]})
+		}
+		if isError(result) {
+			failure = result
+			return false
+		}
+		before, err := in.isTruthy(result)
+		if err != nil {
+			failure = err
+			return false
+		}
+		return before
+	})
+	if failure != nil {
+		return failure
+	}
+	return &object.Array{Elements: elements}
+}
+
+// defaultLess reports whether a goes before b in the default order of sort.
+func defaultLess(a, b object.Object) object.Object {
+	if a, ok := a.(*object.String); ok {
+		if b, ok := b.(*object.String); ok {
+			return nativeBoolToBooleanObject(a.Value < b.Value)
+		}
+	}
+	return evalInfixExpression(nil, "<", a, b)
+}
@@ -0,0 +1,60 @@
+package evaluator
+
+import (
+	"github.com/j4nu5/monkey/object"
+)
+
+// valuesEqual implements `==`: numbers and strings are compared by value,
+// arrays and hashes by their elements and other values by identity. Values
+// can't refer to themselves, so the recursion always ends.
+func valuesEqual(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer, *object.Float:
+		if !isNumber(b) {
+			return false
+		}
+		return evalInfixExpression(nil, "==", a, b) == TRUE
+	case *object.String:
+		b, ok := b.(*object.String)
+		return ok && a.Value == b.Value
+	case *object.Array:
+		b, ok := b.(*object.Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !valuesEqual(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		b, ok := b.(*object.Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !valuesEqual(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// same implements `same(a, b)`, which reports whether a and b are the same
+// array or hash rather than merely equal ones. Other values have no
+// identity to speak of and are compared as by `==`.
+func same(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	switch args[0].(type) {
+	case *object.Array, *object.Hash:
+		return nativeBoolToBooleanObject(args[0] == args[1])
+	}
+	return nativeBoolToBooleanObject(valuesEqual(args[0], args[1]))
+}
@@ -0,0 +1,1423 @@
+// Package evaluator implements a tree-walking interpreter for Monkey.
+//
+// Arithmetic on two integers yields an integer; `/` truncates toward zero,
+// so 7 / 2 is 3. If either operand is a float, the other is converted and
+// the result is a float: 7 / 2.0 is 3.5. Comparisons mix integers and
+// floats the same way, so 1 == 1.0. Dividing by zero is an error for both.
+//
+// Integers are 64 bits wide and integer arithmetic is checked: a result
+// that doesn't fit is an "integer overflow" error rather than wrapping
+// around. The remainder `%` takes the sign of its left operand, like
+// Go's. The bitwise operators `&`, `|`, `^`, `<<` and `>>` only accept
+// integers; shifts discard the bits shifted out, `>>` keeps the sign, and a
+// negative shift count is an error.
+//
+// let declares a name in the current scope, shadowing any binding of it in
+// the enclosing ones, while `x = value` assigns to the binding of x in the
+// nearest scope that has one and evaluates to value; assigning to a name
+// that isn't bound is an error, and so is assigning to a name bound by
+// const, even from a closure, or declaring it again in the scope of the
+// const. Functions capture the scopes they are defined in rather than
+// copies of them, so a closure sees assignments made after it was created,
+// and its own assignments to captured names are seen by everyone sharing
+// them.
+//
+// Hashes keep their keys in the order they were first added, which is the
+// order for loops, keys(), values(), jsonEncode and printing go by.
+//
+// `==` and `!=` compare arrays and hashes by their contents, element by
+// element and pair by pair, so [1, [2]] == [1, [2.0]]; values of
+// different types are unequal rather than an error, and functions and
+// builtins are equal only to themselves. The builtin same(a, b) tells
+// whether two arrays or hashes are one and the same.
+//
+// The logical operators `&&` and `||` short-circuit: the right operand is
+// only evaluated if the left one doesn't decide the result. Like `if`, they
+// go by truthiness, and they yield the operand that decided the result
+// rather than a boolean, so `name || "anonymous"` picks a default. `a ?? b`
+// is a short-circuiting default too, but it only falls back to b when a
+// is null, so a false or zero a is kept.
+//
+// A while loop runs its body for as long as its condition is truthy, and a
+// for loop runs it once per element of an array, key of a hash or value of
+// an iterator. Like the handler of a try expression, the body of a for loop
+// has a scope of its own, binding the loop variable afresh for every
+// iteration. break and continue apply to the innermost loop; used outside
+// of a loop, including in a function called from one, they are errors.
+//
+// `import "lib/strings";` evaluates the file lib/strings.monkey, found
+// relative to the importing file or else in one of the directories of
+// Options.ModulePath, and binds strings to a hash of the module's exports:
+// the names bound by its top-level let and const statements, except those
+// starting with an underscore. Each module is evaluated once per
+// Interpreter, in an environment of its own, and later imports share its
+// exports. A module importing itself, directly or not, is an error. Import
+// paths starting with "std/" refer to the modules of the standard library,
+// which Interpreter.LoadPrelude makes available without importing them.
+//
+// `quote(expr)` evaluates to the code expr rather than its value, as an
+// *object.Quote, after replacing each `unquote(e)` in it with the code for
+// the value of e. Macros are expanded before evaluation: DefineMacros
+// collects the macros bound by top-level let statements, and ExpandMacros
+// replaces each call to one with the quote it returns when given its
+// arguments as quotes.
+package evaluator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/ast/printer"
+	"github.com/j4nu5/monkey/object"
+)
+
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
+)
+
+// Options configures optional evaluator behaviour. The zero value gives the
+// behaviour of Eval.
+type Options struct {
+	// StrictBooleans makes conditions and the operands of !, && and || accept
+	// only booleans; anything else is an error. By default, any value may be
+	// used, with null and false counting as false and everything else as
+	// true.
+	StrictBooleans bool
+
+	// StepBudget, if positive, is the number of nodes the Interpreter may
+	// evaluate, counted over all its calls. Once it is used up, evaluation
+	// stops with a "step budget exceeded" error, which try expressions
+	// don't catch. Unlike a timeout, the budget stops a given program at
+	// the same point every time.
+	StepBudget int
+
+	// MemoryLimit, if positive, is the approximate number of bytes of
+	// strings, arrays and hashes the Interpreter may create, counted over
+	// all its calls. Values count when they are created, and values returned
+	// by builtins count as created by them; nothing is uncounted when it
+	// becomes garbage, so the limit bounds the total allocated rather than
+	// what is in use. Exceeding it stops evaluation with a "memory limit
+	// exceeded" error, which try expressions don't catch.
+	MemoryLimit int
+
+	// Hooks observe evaluation.
+	Hooks Hooks
+
+	// Output is where puts and print write. If nil, they write to
+	// os.Stdout.
+	Output io.Writer
+
+	// Input is where readLine and input read from. If nil, they read from
+	// os.Stdin. The Interpreter buffers it, so it may read ahead of the
+	// lines returned.
+	Input io.Reader
+
+	// Rand is the source of the numbers random returns. If nil, the
+	// Interpreter uses a source seeded with the time it was created.
+	Rand *rand.Rand
+
+	// Clock is what now and sleep tell the time by. If nil, they follow
+	// the real time.
+	Clock Clock
+
+	// Capabilities name the groups of builtins, beyond the default ones,
+	// that let programs reach outside the Interpreter. Without any, a
+	// program can only read Input and write Output. The only capability is
+	// "fs", for the readFile, writeFile and listDir builtins, which work
+	// on the file system of the process with its permissions.
+	Capabilities []string
+
+	// ModulePath lists the directories that imports are looked up in when
+	// the module isn't found relative to the importing file.
+	ModulePath []string
+
+	// Call, if set, is how builtins such as map and memo call the
+	// functions compiled code passes them, such as *object.Closure values,
+	// which the Interpreter can't run itself: the values of type FUNCTION
+	// other than *object.Function. The vm package sets it to run them on
+	// the VM calling the builtins.
+	Call func(fn object.Object, args []object.Object) object.Object
+}
+
+// Hooks are functions the Interpreter calls as it evaluates, so that tools
+// such as debuggers, profilers and coverage reports can follow execution.
+// Any of them may be nil. The hooks run synchronously and must not evaluate
+// code with the Interpreter calling them. Without hooks, evaluation only
+// pays for checking that they are nil; each hook set costs a function call
+// per event, which for the node hooks is several per operation.
+type Hooks struct {
+	// OnEnterNode is called before node is evaluated in env.
+	OnEnterNode func(node ast.Node, env *object.Environment)
+
+	// OnExitNode is called after node was evaluated, with its value, which
+	// is nil for statements that don't have one and an *object.Error if
+	// evaluation failed.
+	OnExitNode func(node ast.Node, result object.Object)
+
+	// OnCall is called when the call expression call is about to call fn
+	// with args, after both were evaluated. Calls that builtins make, such
+	// as those of memoized functions, are not reported.
+	OnCall func(call *ast.CallExpression, fn object.Object, args []object.Object)
+}
+
+// An Interpreter evaluates Monkey code according to its Options. It must
+// not be used by several goroutines at once.
+type Interpreter struct {
+	opts Options
+
+	// Context of the running EvalContext call, or nil.
+	ctx context.Context
+
+	steps     int // Nodes evaluated, if there is a StepBudget.
+	allocated int // Bytes allocated, if there is a MemoryLimit.
+
+	input *bufio.Reader // Buffers opts.Input once it is read from.
+
+	regexps map[string]*regexp.Regexp // Compiled patterns, by source.
+
+	// Exports of the modules imported so far, by absolute file name; nil
+	// for those still being evaluated, whose files are in importing.
+	modules   map[string]*object.Hash
+	importing []string
+
+	// Builtins of this interpreter only: those calling back into it, bound
+	// to it, and those registered with RegisterBuiltin.
+	builtins map[string]*object.Builtin
+}
+
+// New returns an Interpreter with the default Options.
+func New() *Interpreter {
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions returns an Interpreter configured by opts. It panics if
+// opts names an unknown capability.
+func NewWithOptions(opts Options) *Interpreter {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	if opts.Input == nil {
+		opts.Input = os.Stdin
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	in := &Interpreter{opts: opts, builtins: make(map[string]*object.Builtin)}
+	for name, fn := range interpreterBuiltins {
+		fn := fn
+		in.builtins[name] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			return fn(in, args...)
+		}}
+	}
+	for _, capability := range opts.Capabilities {
+		fns, ok := capabilities[capability]
+		if !ok {
+			panic(fmt.Sprintf("evaluator: unknown capability %q", capability))
+		}
+		for name, fn := range fns {
+			in.builtins[name] = &object.Builtin{Fn: fn}
+		}
+	}
+	return in
+}
+
+// RegisterBuiltin makes fn available as a builtin function called name to
+// the code in evaluates, and only to it. It replaces any builtin of the same
+// name; like other builtins, it is shadowed by bindings of name in the
+// environment. fn reports failures by returning an *object.Error, and may
+// return nil for null.
+func (in *Interpreter) RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	in.builtins[name] = &object.Builtin{Fn: fn}
+}
+
+// Eval evaluates node in env and returns its value, with the default
+// Options. Runtime errors, such as operations on values of the wrong types,
+// are returned as *object.Error values, which record the function calls
+// they unwound in their Stack; evaluation stops at the first one that no
+// try expression catches.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// EvalContext is like Eval, but stops evaluation once ctx is done. The
+// context is checked before every statement and loop iteration, and a done
+// context makes evaluation return an "evaluation cancelled" or, if its
+// deadline passed, "evaluation timed out" error, which try expressions don't
+// catch. Calls to builtins are not interrupted.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return New().EvalContext(ctx, node, env)
+}
+
+// EvalContext evaluates node in env like the function EvalContext.
+func (in *Interpreter) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	saved := in.ctx
+	in.ctx = ctx
+	defer func() { in.ctx = saved }()
+
+	return in.Eval(node, env)
+}
+
+// interrupted returns the error to stop evaluation with if it must not go
+// on, or nil.
+func (in *Interpreter) interrupted() *object.Error {
+	if in.opts.StepBudget > 0 && in.steps == in.opts.StepBudget {
+		return budgetExceeded()
+	}
+	if in.opts.MemoryLimit > 0 && in.allocated > in.opts.MemoryLimit {
+		return memoryExceeded()
+	}
+	if in.ctx == nil {
+		return nil
+	}
+	select {
+	case <-in.ctx.Done():
+		if in.ctx.Err() == context.DeadlineExceeded {
+			return newError("evaluation timed out")
+		}
+		return newError("evaluation cancelled")
+	default:
+		return nil
+	}
+}
+
+// Eval evaluates node in env and returns its value, like the function Eval.
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+	if in.opts.StepBudget > 0 {
+		if in.steps == in.opts.StepBudget {
+			return budgetExceeded()
+		}
+		in.steps++
+	}
+
+	hooks := &in.opts.Hooks
+	if hooks.OnEnterNode == nil && hooks.OnExitNode == nil {
+		return in.eval(node, env)
+	}
+	if hooks.OnEnterNode != nil {
+		hooks.OnEnterNode(node, env)
+	}
+	result := in.eval(node, env)
+	if hooks.OnExitNode != nil {
+		hooks.OnExitNode(node, result)
+	}
+	return result
+}
+
+// eval evaluates node in env, without counting the step or calling hooks.
+func (in *Interpreter) eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		return in.evalProgram(node, env)
+
+	case *ast.ExpressionStatement:
+		return in.Eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return in.evalBlockStatement(node, env)
+
+	case *ast.ReturnStatement:
+		val := in.Eval(node.ReturnValue, env)
+		if isUnwinding(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.LetStatement:
+		val := in.Eval(node.Value, env)
+		if isUnwinding(val) {
+			return val
+		}
+		if len(node.Names) > 0 {
+			return destructure(node.Names, val, env)
+		}
+		if err := redeclaredConst(node.Name, env); err != nil {
+			return err
+		}
+		env.Set(node.Name.Value, val)
+
+	case *ast.ConstStatement:
+		val := in.Eval(node.Value, env)
+		if isUnwinding(val) {
+			return val
+		}
+		if err := redeclaredConst(node.Name, env); err != nil {
+			return err
+		}
+		env.SetConst(node.Name.Value, val)
+
+	case *ast.ImportStatement:
+		return in.evalImportStatement(node, env)
+
+	case *ast.QuoteExpression:
+		return in.quote(node.Node, env)
+
+	case *ast.UnquoteExpression:
+		return newError("unquote outside of quote")
+
+	case *ast.MacroLiteral:
+		return newError("macros can only be defined by top-level let statements")
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return object.NewInteger(node.Value)
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.StringLiteral:
+		return in.allocate(&object.String{Value: node.Value})
+
+	case *ast.InterpolatedString:
+		return in.evalInterpolatedString(node, env)
+
+	case *ast.PrefixExpression:
+		right := in.Eval(node.Right, env)
+		if isUnwinding(right) {
+			return right
+		}
+		if node.Operator == "!" && in.opts.StrictBooleans && right.Type() != object.BOOLEAN_OBJ {
+			return newError("unknown operator: !%s", right.Type())
+		}
+		return evalPrefixExpression(nil, node.Operator, right)
+
+	case *ast.InfixExpression:
+		left := in.Eval(node.Left, env)
+		if isUnwinding(left) {
+			return left
+		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return in.evalLogicalExpression(node, left, env)
+		}
+		if node.Operator == "??" {
+			if left != NULL {
+				return left
+			}
+			return in.Eval(node.Right, env)
+		}
+
+		right := in.Eval(node.Right, env)
+		if isUnwinding(right) {
+			return right
+		}
+
+		return in.allocate(evalInfixExpression(nil, node.Operator, left, right))
+
+	case *ast.ParenExpression:
+		return in.Eval(node.Expression, env)
+
+	case *ast.BlockExpression:
+		return in.Eval(node.Block, object.NewEnclosedEnvironment(env))
+
+	case *ast.IfExpression:
+		return in.evalIfExpression(node, env)
+
+	case *ast.TryExpression:
+		return in.evalTryExpression(node, env)
+
+	case *ast.AssignExpression:
+		val := in.Eval(node.Value, env)
+		if isUnwinding(val) {
+			return val
+		}
+		if !env.Assign(node.Name.Value, val) {
+			if env.IsConst(node.Name.Value) {
+				return newError("assignment to constant: %s", node.Name.Value)
+			}
+			return newError("assignment to undeclared identifier: %s", node.Name.Value)
+		}
+		return val
+
+	case *ast.WhileStatement:
+		return in.evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return in.evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
+	case *ast.Identifier:
+		return in.evalIdentifier(node, env)
+
+	case *ast.FunctionLiteral:
+		params := node.Parameters
+		body := node.Body
+		return &object.Function{Parameters: params, Env: env, Body: body, Variadic: node.Variadic}
+
+	case *ast.CallExpression:
+		function := in.Eval(node.Function, env)
+		if isUnwinding(function) {
+			return function
+		}
+
+		args := in.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isUnwinding(args[0]) {
+			return args[0]
+		}
+
+		if in.opts.Hooks.OnCall != nil {
+			in.opts.Hooks.OnCall(node, function, args)
+		}
+		result := in.applyFunction(function, args)
+		if err, ok := result.(*object.Error); ok && isCallable(function) {
+			err.Stack = append(err.Stack, object.Frame{Function: calleeName(node.Function), Pos: node.Pos()})
+		}
+		return result
+
+	case *ast.ArrayLiteral:
+		elements := in.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isUnwinding(elements[0]) {
+			return elements[0]
+		}
+		return in.allocate(&object.Array{Elements: elements})
+
+	case *ast.TupleLiteral:
+		elements := in.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isUnwinding(elements[0]) {
+			return elements[0]
+		}
+		return in.allocate(&object.Array{Elements: elements})
+
+	case *ast.IndexExpression:
+		left := in.Eval(node.Left, env)
+		if isUnwinding(left) {
+			return left
+		}
+		index := in.Eval(node.Index, env)
+		if isUnwinding(index) {
+			return index
+		}
+		return in.evalIndexExpression(left, index)
+
+	case *ast.SliceExpression:
+		return in.evalSliceExpression(node, env)
+
+	case *ast.HashLiteral:
+		return in.evalHashLiteral(node, env)
+
+	case *ast.SpreadExpression:
+		return newError("spread outside of call arguments or array elements")
+
+	case ast.Expression:
+		return newError("unsupported expression: %s", kindName(node))
+
+	case ast.Statement:
+		return newError("unsupported statement: %s", kindName(node))
+	}
+
+	return nil
+}
+
+func budgetExceeded() *object.Error {
+	return newError("step budget exceeded")
+}
+
+// allocate counts obj, a value just created, against the MemoryLimit. It
+// returns obj, or an error if the limit is exceeded.
+func (in *Interpreter) allocate(obj object.Object) object.Object {
+	if in.opts.MemoryLimit <= 0 {
+		return obj
+	}
+	in.allocated += sizeOf(obj)
+	if in.allocated > in.opts.MemoryLimit {
+		return memoryExceeded()
+	}
+	return obj
+}
+
+// sizeOf returns the approximate number of bytes a string, array or hash
+// takes up, not counting the values it contains; other values count as
+// nothing.
+func sizeOf(obj object.Object) int {
+	switch obj := obj.(type) {
+	case *object.String:
+		return 16 + len(obj.Value)
+	case *object.Array:
+		return 24 + 16*len(obj.Elements)
+	case *object.Hash:
+		return 48 + 64*len(obj.Pairs)
+	}
+	return 0
+}
+
+func memoryExceeded() *object.Error {
+	return newError("memory limit exceeded")
+}
+
+// evalProgram evaluates the statements of program in order and returns the
+// value of the last one, or the value of the first return statement
+// executed or the first error.
+func (in *Interpreter) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		if err := in.interrupted(); err != nil {
+			return err
+		}
+		result = in.Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		case *object.Break, *object.Continue:
+			return strayLoopControl(result)
+		}
+	}
+
+	return result
+}
+
+// strayLoopControl returns the error for a break or continue that reached
+// the end of a program or function body without meeting a loop.
+func strayLoopControl(obj object.Object) *object.Error {
+	return newError("%s outside of a loop", obj.Inspect())
+}
+
+// evalBlockStatement is like evalProgram, except that a return value, break
+// or continue is passed on still wrapped, so that it ends the enclosing
+// blocks too, up to the function being called or the loop, and that a block
+// whose last statement has no value, such as an empty one, evaluates to
+// NULL.
+func (in *Interpreter) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		if err := in.interrupted(); err != nil {
+			return err
+		}
+		result = in.Eval(statement, env)
+		if isUnwinding(result) {
+			return result
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func evalPrefixExpression(pool *object.IntegerPool, operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(pool, right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalBangOperatorExpression(right object.Object) object.Object {
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+func evalMinusPrefixOperatorExpression(pool *object.IntegerPool, right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return newError("integer overflow: -(%d)", right.Value)
+		}
+		return pool.New(-right.Value)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+// integerOperators are the infix operators defined only on integers.
+var integerOperators = map[string]bool{
+	"%": true, "&": true, "|": true, "^": true, "<<": true, ">>": true,
+}
+
+func evalInfixExpression(pool *object.IntegerPool, operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(pool, operator, left, right)
+	case integerOperators[operator]:
+		return newError("type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case operator == "==":
+		return nativeBoolToBooleanObject(valuesEqual(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!valuesEqual(left, right))
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(pool *object.IntegerPool, operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch operator {
+	case "+", "-", "*":
+		var result int64
+		var ok bool
+		switch operator {
+		case "+":
+			result, ok = addInt(leftVal, rightVal)
+		case "-":
+			result, ok = subInt(leftVal, rightVal)
+		case "*":
+			result, ok = mulInt(leftVal, rightVal)
+		}
+		if !ok {
+			return newError("integer overflow: %d %s %d", leftVal, operator, rightVal)
+		}
+		return pool.New(result)
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return newError("integer overflow: %d / %d", leftVal, rightVal)
+		}
+		return pool.New(leftVal / rightVal)
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return pool.New(leftVal % rightVal)
+	case "&":
+		return pool.New(leftVal & rightVal)
+	case "|":
+		return pool.New(leftVal | rightVal)
+	case "^":
+		return pool.New(leftVal ^ rightVal)
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if operator == "<<" {
+			return pool.New(leftVal << rightVal)
+		}
+		return pool.New(leftVal >> rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// addInt returns a + b and whether the sum didn't overflow.
+func addInt(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+// subInt returns a - b and whether the difference didn't overflow.
+func subInt(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+// mulInt returns a * b and whether the product didn't overflow.
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return c, false
+	}
+	return c, c/b == a
+}
+
+// evalFloatInfixExpression evaluates operator on two numbers, at least one
+// of which is a float.
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.Float:
+		return true
+	}
+	return false
+}
+
+// toFloat returns the value of the number obj as a float.
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalInterpolatedString evaluates the embedded expressions of is and
+// splices them into its text: strings as they are, other values as
+// displayed by Inspect.
+func (in *Interpreter) evalInterpolatedString(is *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for i, text := range is.Strings {
+		if i > 0 {
+			val := in.Eval(is.Exprs[i-1], env)
+			if isUnwinding(val) {
+				return val
+			}
+			out.WriteString(val.Inspect())
+		}
+		out.WriteString(text)
+	}
+
+	return in.allocate(&object.String{Value: out.String()})
+}
+
+func (in *Interpreter) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := in.Eval(ie.Condition, env)
+	if isUnwinding(condition) {
+		return condition
+	}
+
+	truthy, err := in.isTruthy(condition)
+	if err != nil {
+		return err
+	}
+	if truthy {
+		return in.Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return in.Eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+// evalTryExpression evaluates the body of te and, if that fails, its handler
+// in a new environment binding the catch parameter to a hash describing the
+// error: its "message", its "stack", an array of strings such as "f (1:5)",
+// and its Details.
+func (in *Interpreter) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := in.Eval(te.Body, env)
+	err, ok := result.(*object.Error)
+	if !ok {
+		return result
+	}
+	if abort := in.interrupted(); abort != nil {
+		return abort
+	}
+
+	handlerEnv := object.NewEnclosedEnvironment(env)
+	handlerEnv.Set(te.Param.Value, errorValue(err))
+	return in.Eval(te.Handler, handlerEnv)
+}
+
+// evalWhileStatement runs the body of ws for as long as its condition holds.
+// The loop evaluates to null, unless its body returns or fails.
+func (in *Interpreter) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		if err := in.interrupted(); err != nil {
+			return err
+		}
+		condition := in.Eval(ws.Condition, env)
+		if isUnwinding(condition) {
+			return condition
+		}
+		truthy, err := in.isTruthy(condition)
+		if err != nil {
+			return err
+		}
+		if !truthy {
+			return nil
+		}
+
+		if result, done := loopBody(in.Eval(ws.Body, env)); done {
+			return result
+		}
+	}
+}
+
+// evalForStatement runs the body of fs once per element of its iterable: the
+// elements of an array, the keys of a hash or the values of an iterator.
+func (in *Interpreter) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := in.Eval(fs.Iterable, env)
+	if isUnwinding(iterable) {
+		return iterable
+	}
+
+	var it *object.Iterator
+	switch iterable.(type) {
+	case *object.Array, *object.Hash, *object.Iterator:
+		it, _ = in.iterate("for", iterable)
+	default:
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	for {
+		if err := in.interrupted(); err != nil {
+			return err
+		}
+		element, ok := it.Next()
+		if !ok {
+			return nil
+		}
+		if isError(element) {
+			return element
+		}
+		bodyEnv := object.NewEnclosedEnvironment(env)
+		bodyEnv.Set(fs.Variable.Value, element)
+		if result, done := loopBody(in.Eval(fs.Body, bodyEnv)); done {
+			return result
+		}
+	}
+}
+
+// loopBody interprets the result of one run of a loop body. It reports
+// whether the loop is done and, if so, what the loop evaluates to: nothing
+// after a break, or the return value or error that ends the loop.
+func loopBody(result object.Object) (object.Object, bool) {
+	switch result.(type) {
+	case *object.Break:
+		return nil, true
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	}
+	return nil, false
+}
+
+// errorValue returns the hash a catch parameter is bound to for err.
+func errorValue(err *object.Error) *object.Hash {
+	stack := &object.Array{Elements: []object.Object{}}
+	for _, f := range err.Stack {
+		stack.Elements = append(stack.Elements, &object.String{Value: fmt.Sprintf("%s (%s)", f.Function, f.Pos)})
+	}
+
+	hash := object.NewHash()
+	hash.Set(&object.String{Value: "message"}, &object.String{Value: err.Message})
+	hash.Set(&object.String{Value: "stack"}, stack)
+
+	names := make([]string, 0, len(err.Details))
+	for name := range err.Details {
+		if name != "message" && name != "stack" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hash.Set(&object.String{Value: name}, err.Details[name])
+	}
+	return hash
+}
+
+// evalLogicalExpression evaluates the && or || expression node, whose left
+// operand evaluated to left. The right operand is only evaluated if left
+// doesn't decide the result.
+func (in *Interpreter) evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	truthy, err := in.isTruthy(left)
+	if err != nil {
+		return err
+	}
+	if truthy == (node.Operator == "||") {
+		return left
+	}
+
+	right := in.Eval(node.Right, env)
+	if isUnwinding(right) {
+		return right
+	}
+	if _, err := in.isTruthy(right); err != nil {
+		return err
+	}
+	return right
+}
+
+// isTruthy reports whether obj counts as true in a condition: anything but
+// null and false does. With Options.StrictBooleans, obj must be a boolean.
+func (in *Interpreter) isTruthy(obj object.Object) (bool, *object.Error) {
+	if in.opts.StrictBooleans && obj.Type() != object.BOOLEAN_OBJ {
+		return false, newError("non-boolean condition: %s", obj.Type())
+	}
+	switch obj {
+	case NULL, FALSE:
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+func (in *Interpreter) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	if val, ok := in.Builtin(node.Value); ok {
+		return val
+	}
+	return newError("identifier not found: " + node.Value)
+}
+
+// Builtin returns the value of the builtin function or constant called
+// name, as the Interpreter resolves it when no binding shadows it.
+func (in *Interpreter) Builtin(name string) (object.Object, bool) {
+	if builtin, ok := in.builtins[name]; ok {
+		return builtin, true
+	}
+	if builtin, ok := builtins[name]; ok {
+		return builtin, true
+	}
+	if val, ok := constants[name]; ok {
+		return val, true
+	}
+	return nil, false
+}
+
+// evalExpressions evaluates exps in order, expanding the elements of arrays
+// that are spread. On error, or a return, break or continue, it returns just
+// that.
+func (in *Interpreter) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	result := []object.Object{}
+
+	for _, e := range exps {
+		spread, isSpread := e.(*ast.SpreadExpression)
+		if isSpread {
+			e = spread.Value
+		}
+
+		evaluated := in.Eval(e, env)
+		if isUnwinding(evaluated) {
+			return []object.Object{evaluated}
+		}
+
+		if isSpread {
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				return []object.Object{newError("cannot spread %s", evaluated.Type())}
+			}
+			result = append(result, arr.Elements...)
+			continue
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func (in *Interpreter) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := in.Eval(pair.Key, env)
+		if isUnwinding(key) {
+			return key
+		}
+
+		if _, ok := key.(object.Hashable); !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := in.Eval(pair.Value, env)
+		if isUnwinding(value) {
+			return value
+		}
+
+		hash.Set(key, value)
+	}
+
+	return in.allocate(hash)
+}
+
+// evalHashIndexExpression returns the value for index in hash, or null if
+// there is none.
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+// destructure binds names to the elements of val, which must be an array
+// of as many elements, as returned by `return a, b`.
+func destructure(names []*ast.Identifier, val object.Object, env *object.Environment) object.Object {
+	arr, ok := val.(*object.Array)
+	if !ok {
+		return newError("cannot destructure %s", val.Type())
+	}
+	if len(arr.Elements) != len(names) {
+		return newError("wrong number of values to destructure. got=%d, want=%d",
+			len(arr.Elements), len(names))
+	}
+
+	for _, name := range names {
+		if err := redeclaredConst(name, env); err != nil {
+			return err
+		}
+	}
+	for i, name := range names {
+		env.Set(name.Value, arr.Elements[i])
+	}
+	return nil
+}
+
+// redeclaredConst returns the error for binding name anew in env if env
+// itself binds it constantly, or nil: constants can't be redeclared in
+// their own scope any more than they can be assigned to.
+func redeclaredConst(name *ast.Identifier, env *object.Environment) *object.Error {
+	if env.IsOwnConst(name.Value) {
+		return newError("redeclaration of constant: %s", name.Value)
+	}
+	return nil
+}
+
+func (in *Interpreter) evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return in.evalStringIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// elementIndex returns the position of index in a sequence of length n,
+// counting negative indexes back from the end, and whether it is in range.
+func elementIndex(index int64, n int) (int, bool) {
+	if index < 0 {
+		index += int64(n)
+	}
+	if index < 0 || index >= int64(n) {
+		return 0, false
+	}
+	return int(index), true
+}
+
+// evalArrayIndexExpression returns the element of array at index, or null
+// if the index is out of range. A negative index counts from the end, so
+// -1 is the last element.
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+
+	i, ok := elementIndex(index.(*object.Integer).Value, len(arrayObject.Elements))
+	if !ok {
+		return NULL
+	}
+
+	return arrayObject.Elements[i]
+}
+
+// evalStringIndexExpression returns the byte of str at index as a string
+// of length one, or null if the index is out of range. Negative indexes
+// count from the end, as for arrays.
+func (in *Interpreter) evalStringIndexExpression(str, index object.Object) object.Object {
+	value := str.(*object.String).Value
+
+	i, ok := elementIndex(index.(*object.Integer).Value, len(value))
+	if !ok {
+		return NULL
+	}
+
+	return in.allocate(&object.String{Value: value[i : i+1]})
+}
+
+// evalSliceExpression evaluates `left[low:high]` on a string or array. An
+// omitted low bound is 0 and an omitted high bound is the length; negative
+// bounds count from the end. Bounds are clamped to the sequence, and a low
+// bound past the high one gives an empty result rather than an error.
+func (in *Interpreter) evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := in.Eval(node.Left, env)
+	if isUnwinding(left) {
+		return left
+	}
+
+	var n int
+	switch left := left.(type) {
+	case *object.String:
+		n = len(left.Value)
+	case *object.Array:
+		n = len(left.Elements)
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	low, err := in.sliceBound(node.Low, env, 0, n)
+	if err != nil {
+		return err
+	}
+	high, err := in.sliceBound(node.High, env, n, n)
+	if err != nil {
+		return err
+	}
+	if low > high {
+		low = high
+	}
+
+	if str, ok := left.(*object.String); ok {
+		return in.allocate(&object.String{Value: str.Value[low:high]})
+	}
+	elements := make([]object.Object, high-low)
+	copy(elements, left.(*object.Array).Elements[low:high])
+	return in.allocate(&object.Array{Elements: elements})
+}
+
+// sliceBound evaluates a bound of a slice of a sequence of length n,
+// returning def if it is omitted and clamping it to [0, n].
+func (in *Interpreter) sliceBound(bound ast.Expression, env *object.Environment, def, n int) (int, object.Object) {
+	if bound == nil {
+		return def, nil
+	}
+
+	val := in.Eval(bound, env)
+	if isUnwinding(val) {
+		return 0, val
+	}
+	integer, ok := val.(*object.Integer)
+	if !ok {
+		return 0, newError("slice bound must be INTEGER, got %s", val.Type())
+	}
+
+	i := integer.Value
+	if i < 0 {
+		i += int64(n)
+	}
+	switch {
+	case i < 0:
+		return 0, nil
+	case i > int64(n):
+		return n, nil
+	}
+	return int(i), nil
+}
+
+func (in *Interpreter) applyFunction(fn object.Object, args []object.Object) object.Object {
+	switch fn := fn.(type) {
+
+	case *object.Function:
+		extendedEnv := extendFunctionEnv(fn, args)
+		evaluated := in.Eval(fn.Body, extendedEnv)
+		switch evaluated.(type) {
+		case *object.Break, *object.Continue:
+			return strayLoopControl(evaluated)
+		}
+		return unwrapReturnValue(evaluated)
+
+	case *object.Builtin:
+		if result := fn.Fn(args...); result != nil {
+			return in.allocate(result)
+		}
+		return NULL
+
+	default:
+		// Functions of compiled code, such as *object.Closure.
+		if fn.Type() != object.FUNCTION_OBJ || in.opts.Call == nil {
+			return newError("not a function: %s", fn.Type())
+		}
+		return in.opts.Call(fn, args)
+	}
+}
+
+// extendFunctionEnv binds the parameters of fn to args in a new environment
+// enclosed by the one fn was defined in. Parameters without an argument are
+// bound to null. The last parameter of a variadic function is bound to an
+// array of the remaining arguments.
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	params := fn.Parameters
+	if fn.Variadic && len(params) > 0 {
+		rest := &object.Array{Elements: []object.Object{}}
+		if fixed := len(params) - 1; len(args) > fixed {
+			rest.Elements = append(rest.Elements, args[fixed:]...)
+		}
+		params = params[:len(params)-1]
+		env.Set(fn.Parameters[len(params)].Value, rest)
+	}
+
+	for paramIdx, param := range params {
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+		} else {
+			env.Set(param.Value, NULL)
+		}
+	}
+
+	return env
+}
+
+// unwrapReturnValue returns the value a function call evaluates to, given
+// the result of its body: returns end at function boundaries.
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	if obj == nil {
+		return NULL
+	}
+	return obj
+}
+
+// isCallable reports whether obj can be called, i.e. whether a call of it
+// can fail with a stack frame of its own.
+func isCallable(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.FUNCTION_OBJ || t == object.BUILTIN_OBJ
+}
+
+// maxCalleeName is the length, in characters, past which calleeName cuts
+// the source of callees short.
+const maxCalleeName = 40
+
+// calleeName describes the function a call expression calls in stack
+// frames: its source on one line, cut short if long, except that function
+// literals are cut short after their parameters.
+func calleeName(callee ast.Expression) string {
+	fn, ok := callee.(*ast.FunctionLiteral)
+	if !ok {
+		name := []rune(strings.Join(strings.Fields(printer.String(callee)), " "))
+		if len(name) > maxCalleeName {
+			return string(name[:maxCalleeName]) + "..."
+		}
+		return string(name)
+	}
+
+	params := []string{}
+	for _, p := range fn.Parameters {
+		params = append(params, p.Value)
+	}
+	if fn.Variadic && len(params) > 0 {
+		params[len(params)-1] += "..."
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
+
+// isUnwinding reports whether obj ends the evaluation of the expressions
+// enclosing the one it is the result of: an error, or a return, break or
+// continue on its way to the function or loop it ends.
+func isUnwinding(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+		return true
+	}
+	return false
+}
+
+// kindName returns the name of the type of node without its package, e.g.
+// "StringLiteral".
+func kindName(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
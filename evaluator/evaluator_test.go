@@ -0,0 +1,2823 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/parser"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"1 + 10 % 4 * 2", 5},
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"1 | 2 & 3", 3},
+		{"1 << 4", 16},
+		{"1 << 2 + 1", 5},
+		{"-16 >> 2", -4},
+		{"1 >> 64", 0},
+		{"1 << 64", 0},
+		{"-1 << 63", -9223372036854775807 - 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775806 + 1", int64(9223372036854775807)},
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 1", int64(-9223372036854775807 - 1)},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"1 - -9223372036854775807", "integer overflow: 1 - -9223372036854775807"},
+		{"3037000499 * 3037000499", int64(9223372030926249001)},
+		{"3037000500 * 3037000500", "integer overflow: 3037000500 * 3037000500"},
+		{"-1 * (-9223372036854775807 - 1)", "integer overflow: -1 * -9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: -(-9223372036854775808)"},
+		{"(-9223372036854775807 - 1) / 1", int64(-9223372036854775807 - 1)},
+		{"9223372036854775807 + 1.0", 9223372036854775808.0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"2.5", 2.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"3 * 0.5", 1.5},
+		{"1 - 1.5", -0.5},
+		{"7 / 2", 3},
+		{"-7 / 2", -3},
+		{"7 / 2.0", 3.5},
+		{"7.0 / 2", 3.5},
+		{"0.1 + 0.2 > 0.3", true},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"2 < 2.5", true},
+		{"2.5 > 3", false},
+		{"[1.5][0]", 1.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestIntegerOperatorErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 % 0", "division by zero"},
+		{"1 << -1", "negative shift count: -1"},
+		{"5.5 % 2", "type mismatch: FLOAT % INTEGER"},
+		{"5 & 2.0", "type mismatch: INTEGER & FLOAT"},
+		{"true | false", "type mismatch: BOOLEAN | BOOLEAN"},
+		{`"a" ^ "b"`, "type mismatch: STRING ^ STRING"},
+		{"1 >> true", "type mismatch: INTEGER >> BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestFloatErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1.5 / 0", "division by zero"},
+		{"1 / 0.0", "division by zero"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+		{`"a" + 1.5`, "type mismatch: STRING + FLOAT"},
+		{"{1.5: 1}", "unusable as hash key: FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestDeepEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[] == []", true},
+		{`[1, [2, "three"]] == [1, [2, "three"]]`, true},
+		{"[1, [2]] == [1, [2.0]]", true},
+		{`{"a": [1], 2: true} == {2: true, "a": [1]}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{"{} == []", false},
+		{`[1] == "[1]"`, false},
+		{"[[][0]] == [[][0]]", true},
+		{"let f = fn() { 1 }; [f] == [f]", true},
+		{"[fn() { 1 }] == [fn() { 1 }]", false},
+		{"[len] == [len]", true},
+		{"let a = [1]; same(a, a)", true},
+		{"same([1], [1])", false},
+		{`let h = {"k": 1}; same(h, h)`, true},
+		{`same({}, {})`, false},
+		{"same(1, 1)", true},
+		{"same(1, 1.0)", true},
+		{`same("a", "a")`, true},
+		{"same(true, false)", false},
+		{"same([][0], [][0])", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("wrong result for %q", tt.input)
+		}
+	}
+
+	errorObj, ok := testEval(t, "same(1)").(*object.Error)
+	if !ok || errorObj.Message != "wrong number of arguments. got=1, want=2" {
+		t.Errorf("wrong error for same(1). got=%v", errorObj)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		{"1 && 2", 2},
+		{"[][0] && 2", nil},
+		{"1 || 2", 1},
+		{"[][0] || 2", 2},
+		{"false || [][0]", nil},
+		{"1 < 2 && 2 < 3", true},
+		{"false && true || true", true},
+		{"let x = 0; x || 5", 0},
+		// The right operand isn't evaluated if the left decides.
+		{"false && missing", false},
+		{"true || missing", true},
+		{"false && (1 / 0)", false},
+		{"let f = fn() { if (true) { return 1 && 2; } 3 }; f()", 2},
+		{"[][0] ?? 5", 5},
+		{"1 ?? 5", 1},
+		{"let x = 0; x ?? 5", 0},
+		{"false ?? true", false},
+		{"[][0] ?? [][0]", nil},
+		{"[][0] ?? [][0] ?? 3", 3},
+		{`let h = {"a": 1}; h["b"] ?? 2`, 2},
+		{"1 ?? missing", 1},
+		{"let f = fn() { if (true) { return [][0] ?? 4; } 3 }; f()", 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStrictBooleans(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 1 } else { 2 }", 1},
+		{"if (1 > 2) { 1 } else { 2 }", 2},
+		{"if (1) { 1 }", "non-boolean condition: INTEGER"},
+		{"if ([][0]) { 1 }", "non-boolean condition: NULL"},
+		{"!true", false},
+		{"!0", "unknown operator: !INTEGER"},
+		{"true && false", false},
+		{"false || true", true},
+		{"false && 1", false},
+		{"true && 1", "non-boolean condition: INTEGER"},
+		{`"" || true`, "non-boolean condition: STRING"},
+		{"let f = fn(x) { if (x) { 1 } }; f(5)", "non-boolean condition: INTEGER"},
+	}
+
+	in := NewWithOptions(Options{StrictBooleans: true})
+	for _, tt := range tests {
+		evaluated := in.Eval(testParse(t, tt.input), object.NewEnvironment())
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		// Blocks without a value evaluate to null, even in value positions.
+		{"if (true) { } else { 2 }", nil},
+		{"if (true) { let y = 1; }", nil},
+		{"let x = if (true) { } else { 2 }; x", nil},
+		{"let x = if (true) { let y = 1; }; [x][0]", nil},
+		{"let x = { let y = 1; }; [x][0]", nil},
+		{"let x = if (true) { } else { 2 }; if (x == [][0]) { 1 } else { 2 }", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBlockExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"{ 1; 2 }", 2},
+		{"let y = { let t = 5; t * t }; y", 25},
+		{"let x = 10; { x + 1 }", 11},
+		// The lets of a block are its own.
+		{"let x = 10; { let x = 1; x }; x", 10},
+		{"let x = 10; let y = { let x = x + 1; x * 2 }; x + y", 32},
+		{"let f = fn() { let x = 10; { let x = 1; x }; x }; f()", 10},
+		{"let y = { let t = 5; t * t }; t", "identifier not found: t"},
+		{"let f = { let t = 5; fn() { t } }; f()", 5},
+		// Assignments rebind the variables of the enclosing scopes.
+		{"let x = 10; { x = 1; }; x", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { return 10; }", 10},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`,
+			10,
+		},
+		{
+			`
+let f = fn(x) {
+  return x;
+  x + 10;
+};
+f(10);`,
+			10,
+		},
+		{
+			`
+let f = fn(x) {
+   let result = x + 10;
+   return result;
+   return 10;
+};
+f(10);`,
+			20,
+		},
+		{
+			`
+let f = fn(x) {
+  if (x > 1) {
+    if (x > 2) { return 3; }
+    return 2;
+  }
+  { return 1; }
+  0
+};
+f(1) * 100 + f(2) * 10 + f(3);`,
+			123,
+		},
+		// A return inside a function doesn't end its caller.
+		{
+			`
+let inner = fn() { return 1; 2 };
+let outer = fn() { let x = inner(); x + 10 };
+outer();`,
+			11,
+		},
+		{"let f = fn() { return 5; }; f(); 7", 7},
+		{"let f = fn() { if (true) { return 5; } }; if (f() == 5) { 8 } else { 9 }", 8},
+		// A return in an expression ends the function, whatever position
+		// the expression is in.
+		{"let f = fn() { let x = if (true) { return 3; }; 5 }; f()", 3},
+		{"let f = fn() { const x = if (true) { return 3; }; 5 }; f()", 3},
+		{"let f = fn() { let x = 0; x = if (true) { return 3; }; 5 }; f()", 3},
+		{"let f = fn() { let x = try { return 3; } catch (e) { 1 }; 5 }; f()", 3},
+		{"let f = fn() { let x = { return 3; }; 5 }; f()", 3},
+		{"let f = fn() { 1 + if (true) { return 3; } else { 1 } }; f()", 3},
+		{"let f = fn() { if (true) { return 3; } + 1 }; f()", 3},
+		{"let f = fn() { -if (true) { return 3; } }; f()", 3},
+		{"let f = fn() { !if (true) { return 3; } }; f()", 3},
+		{"let f = fn() { true && if (true) { return 3; } }; f()", 3},
+		{"let f = fn() { [if (true) { return 3; }]; 5 }; f()", 3},
+		{"let f = fn() { {if (true) { return 3; }: 1}; 5 }; f()", 3},
+		{"let f = fn() { {1: if (true) { return 3; }}; 5 }; f()", 3},
+		{"let g = fn(x) { 5 }; let f = fn() { g(if (true) { return 3; }) }; f()", 3},
+		{"let f = fn() { if (true) { return 3; }(1) }; f()", 3},
+		{"let f = fn() { [1][if (true) { return 3; }] }; f()", 3},
+		{"let f = fn() { [1][0:if (true) { return 3; }]; 5 }; f()", 3},
+		{`let f = fn() { "${if (true) { return 3; }}"; 5 }; f()`, 3},
+		{"let f = fn() { if (if (true) { return 3; }) { 4 } else { 5 } }; f()", 3},
+		{"let f = fn() { return if (true) { return 3; } else { 4 }; }; f()", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"const a = 5; a * 2;", 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"5 + true;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"5 + true; 5;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"-true",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			"true + false;",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"5; true + false; 5",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"if (10 > 1) { true + false; }",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`,
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"foobar",
+			"identifier not found: foobar",
+		},
+		{
+			"let x = foobar; x",
+			"identifier not found: foobar",
+		},
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"5(1)",
+			"not a function: INTEGER",
+		},
+		{
+			"let f = fn(x) { x }; f(1, -true, undefined)",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			"let f = fn() { g(); 1 }; let g = fn() { 1 > true }; f()",
+			"type mismatch: INTEGER > BOOLEAN",
+		},
+		{
+			"if (missing) { 1 } else { 2 }",
+			"identifier not found: missing",
+		},
+		{
+			"true && missing",
+			"identifier not found: missing",
+		},
+		{
+			"missing || true",
+			"identifier not found: missing",
+		},
+		{
+			"macro(x) { x }",
+			"macros can only be defined by top-level let statements",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestErrorStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "ERROR: division by zero"},
+		{"5(1)", "ERROR: not a function: INTEGER"},
+		{
+			"let inner = fn(x) { x / 0 };\nlet outer = fn() { 1 + inner(2) };\nouter()",
+			"ERROR: division by zero\n\tat inner (2:24)\n\tat outer (3:1)",
+		},
+		{
+			"let fs = [fn() { len(1) }];\nlet f = fn() { fs[0]() };\nf()",
+			"ERROR: argument to `len` not supported, got INTEGER\n\tat len (1:18)\n\tat fs[0] (2:16)\n\tat f (3:1)",
+		},
+		{
+			"fn(x) { x + true }(1)",
+			"ERROR: type mismatch: INTEGER + BOOLEAN\n\tat fn(x) (1:1)",
+		},
+		{
+			// Other callees are shown on one line, and cut short if long.
+			"let memo = fn(f) { fn(xs) { f(xs[0] + true) } };\nmemo(fn(x){x})([1])",
+			"ERROR: type mismatch: INTEGER + BOOLEAN\n\tat memo(fn(x) { x; }) (2:1)",
+		},
+		{
+			"let memo = fn(f) { fn(xs) { xs + true } };\nmemo(fn(first, second) { first + second })([1])",
+			"ERROR: type mismatch: ARRAY + BOOLEAN\n\tat memo(fn(first, second) { first + second;... (2:1)",
+		},
+		{
+			// Errors evaluating the arguments belong to the caller.
+			"let f = fn(x) { x }; f(-true)",
+			"ERROR: unknown operator: -BOOLEAN",
+		},
+		{
+			"let countdown = fn(n) { if (n == 0) { missing } else { countdown(n - 1) } }; countdown(2)",
+			"ERROR: identifier not found: missing\n\tat countdown (1:56)\n\tat countdown (1:56)\n\tat countdown (1:78)",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if got := errObj.Inspect(); got != tt.expected {
+			t.Errorf("wrong stack trace for %q.\nexpected=%q\ngot=     %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { 1 / 0 } catch (e) { 2 }", 2},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+		{`try { error("boom") } catch (e) { e["message"] }`, "boom"},
+		{`let f = fn() { 1 + true }; try { f() } catch (e) { e["stack"] }`, []string{"f (1:34)"}},
+		{`let f = fn(x) { try { x / 0 } catch (e) { -1 } }; f(5)`, -1},
+		{`let f = fn(x) { try { return x } catch (e) { 0 }; 99 }; f(5)`, 5},
+		{`let f = fn() { try { 1 / 0 } catch (e) { return 7 }; 99 }; f()`, 7},
+		{`try { try { 1 / 0 } catch (e) { error("again: " + e["message"]) } } catch (e) { e["message"] }`, "again: division by zero"},
+		{`let e = 1; try { 1 / 0 } catch (e) { 2 }; e`, 1},
+		{`try { let v = 5; v / 0 } catch (e) { 0 }; v`, 5},
+		{"try { 1 / 0 } catch (e) { 1 + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"try { 1 / 0 } catch (e) { e } + 1", "type mismatch: HASH + INTEGER"},
+		{`error(1)`, "argument to `error` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []string:
+			arr, ok := evaluated.(*object.Array)
+			if !ok || len(arr.Elements) != len(expected) {
+				t.Errorf("wrong stack for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			for i, want := range expected {
+				if got := arr.Elements[i].Inspect(); got != want {
+					t.Errorf("wrong frame %d for %q. want=%q, got=%q", i, tt.input, want, got)
+				}
+			}
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("wrong string for %q. want=%q, got=%q", tt.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("unexpected result for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; a = a + 1", 2},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n", 2},
+		{"let n = 0; let f = fn() { let n = 5; n = n + 1; n }; f() * 10 + n", 60},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1 } }; let one = counter(); let two = counter(); one(); one(); two(); one()", 3},
+		{"let a = 1; let get = fn() { a }; a = 7; get()", 7},
+		{"let f = fn(x) { x = x * 2; x }; let y = 4; f(y) + y", 12},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x; } sum", 6},
+		{"let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }); } fs[0]() * 10 + fs[1]()", 12},
+		{"let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x = x * 3; x }); } fs[0](); fs[0]() * 10 + fs[1]()", 96},
+		{"let n = 0; while (n < 5) { n = n + 1; } n", 5},
+		{"let e = 0; try { 1 / 0 } catch (err) { e = 1 }; e", 1},
+		{"let a = 1; if (true) { let a = 2; } a", 2},
+		{"x = 1", "assignment to undeclared identifier: x"},
+		{"let f = fn() { y = 1 }; f()", "assignment to undeclared identifier: y"},
+		{"len = 1", "assignment to undeclared identifier: len"},
+		{"let a = 1; a = 1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"for (x in [1]) { let v = x; } v = 2", "assignment to undeclared identifier: v"},
+		{"const c = 1; c = 2", "assignment to constant: c"},
+		{"const c = 1; let f = fn() { c = 2 }; f()", "assignment to constant: c"},
+		{"let f = fn() { const c = 1; fn() { c = c + 1 } }; f()()", "assignment to constant: c"},
+		{"const c = 1; let a = 2; a = c = 3", "assignment to constant: c"},
+		{"const c = 1; let f = fn() { c = 2 }; try { f() } catch (e) { 0 }; c", 1},
+		{"const c = 1; let f = fn() { let c = 2; c = 3; c }; f() * 10 + c", 31},
+		{"const c = 1; let f = fn(c) { c = 4; c }; f(0) + c", 5},
+		{"const c = 1; let c = 2; c = 3; c", "redeclaration of constant: c"},
+		{"const c = 1; const c = 2; c", "redeclaration of constant: c"},
+		{"const c = 1; let a, c = fn() { return 2, 3; }(); c", "redeclaration of constant: c"},
+		{"const c = 1; let f = fn() { let c = 2; c }; f() + c", 3},
+		{"const c = 1; { let c = 2; c } + c", 3},
+		{"let c = 1; const c = 2; c", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; let n = 0; while (n < 5) { let n = n + 1; let i = i + n; } i", 15},
+		{"let n = 0; while (true) { let n = n + 1; if (n == 3) { break; } } n", 3},
+		{"let n = 0; let odd = 0; while (n < 6) { let n = n + 1; if (n % 2 == 0) { continue; } let odd = odd + 1; } odd", 3},
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x; } } -1 }; f([1, 2, 3, 4])", 3},
+		{"let f = fn(xs) { for (x in xs) { if (x == 1) { continue; } if (x == 4) { break; } return x; } 0 }; f([1, 2])", 2},
+		{"let f = fn(xs) { for (x in xs) { if (x == 1) { continue; } if (x == 4) { break; } return x; } 0 }; f([1, 4, 2])", 0},
+		{`let f = fn(h) { for (k in h) { if (k == 2) { return h[k]; } } }; f({1: 10, 2: 20})`, 20},
+		{"let x = 5; for (x in [1, 2]) { x } x", 5},
+		{"let v = 0; for (x in [1]) { let v = x; } v", 0},
+		{"let n = 0; let m = 0; while (n < 2) { let n = n + 1; for (y in [1, 2, 3]) { if (y == 2) { break; } let m = m + 1; } } n", 2},
+		{"let f = fn() { while (true) { return 9; } }; f()", 9},
+		{"let fs = fn(xs) { for (x in xs) { return fn() { x }; } }; fs([7, 8])()", 7},
+		{"let n = 0; while (n < 3) { let n = n + 1; try { 1 / 0 } catch (e) { continue; } let n = 100; } n", 3},
+		{"let f = fn() { while (true) { 1 } }; for (x in []) { f() } 1", 1},
+		{"for (x in [1]) { x } ", nil},
+		{"while (1 + true) { 1 }", "type mismatch: INTEGER + BOOLEAN"},
+		{"for (x in [1, 2]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"break", "break outside of a loop"},
+		{"if (true) { continue; }", "continue outside of a loop"},
+		{"let f = fn() { break; }; while (true) { f() }", "break outside of a loop"},
+		{"let n = 0; while (n < 2) { let n = n + 1; try { continue; } catch (e) { 0 } } n", 2},
+		// A break or continue in an expression ends the loop body, whatever
+		// position the expression is in.
+		{"let i = 0; while (i < 3) { let x = { break; 1 }; i = i + 1 } i", 0},
+		{"let i = 0; while (i < 3) { i = i + 1; [if (i > 1) { break; }] } i", 2},
+		{"let i = 0; let n = 0; while (i < 3) { i = i + 1; n = n + if (i == 2) { continue; } else { 1 } } n", 2},
+		{"let n = 0; for (x in [1, 2, 3]) { n = n + x * try { if (x == 2) { continue; } 1 } catch (e) { 0 } } n", 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		case nil:
+			if evaluated != nil {
+				t.Errorf("loop evaluated to %T (%+v), want nothing", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestMemo(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let fib = memo(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }); fib(80)", 23416728348467685},
+		{"let calls = 0; let f = memo(fn(x) { calls = calls + 1; x * 2 }); f(1); f(1); f(2); f(1); calls", 2},
+		{"let add = memo(fn(a, b) { a - b }); add(2, 1) * 10 + add(1, 2)", 9},
+		{`let id = memo(fn(x) { x }); id(1); id("1")`, "1"},
+		{`memo(len)("abc")`, 3},
+		{"let calls = 0; let f = memo(fn(x) { calls = calls + 1; x / 0 }); try { f(1) } catch (e) { 0 }; try { f(1) } catch (e) { 0 }; calls", 2},
+		{"memo(fn(x) { x })([1])", "unusable as memo key: ARRAY"},
+		{"memo(1)", "argument to `memo` must be FUNCTION, got INTEGER"},
+		{"memo()", "wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("wrong string for %q. want=%q, got=%q", tt.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("unexpected result for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		ctx      context.Context
+		input    string
+		expected string // Error message, or "" for the result 3.
+	}{
+		{context.Background(), "let f = fn(n) { while (n > 0) { n = n - 1 } 3 }; f(1000)", ""},
+		{cancelled, "1 + 2", "evaluation cancelled"},
+		{nil, "while (true) {}", "evaluation timed out"},
+		{nil, "for (x in [1, 2, 3]) { while (true) { 1 } }", "evaluation timed out"},
+		{nil, "let g = fn(n) { if (n > 0) { g(n - 1) } else { while (true) {} } }; g(3)", "evaluation timed out"},
+		{nil, "while (true) { try { while (true) {} } catch (e) { 0 } }", "evaluation timed out"},
+	}
+
+	for _, tt := range tests {
+		ctx := tt.ctx
+		if ctx == nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+		}
+
+		in := New()
+		evaluated := in.EvalContext(ctx, testParse(t, tt.input), object.NewEnvironment())
+		if tt.expected == "" {
+			testIntegerObject(t, evaluated, 3)
+		} else if err, ok := evaluated.(*object.Error); !ok || err.Message != tt.expected {
+			t.Errorf("EvalContext(%q) = %T (%+v), want error %q", tt.input, evaluated, evaluated, tt.expected)
+		}
+
+		// The context only applies to the EvalContext call.
+		testIntegerObject(t, in.Eval(testParse(t, "1 + 2"), object.NewEnvironment()), 3)
+	}
+}
+
+func TestStepBudget(t *testing.T) {
+	tests := []struct {
+		budget   int
+		input    string
+		expected interface{}
+	}{
+		// Program, ExpressionStatement, InfixExpression and two literals.
+		{5, "1 + 2", 3},
+		{4, "1 + 2", "step budget exceeded"},
+		{0, "let n = 0; while (n < 1000) { n = n + 1 } n", 1000},
+		{1000, "while (true) {}", "step budget exceeded"},
+		{1000, "let f = fn(n) { f(n + 1) }; f(0)", "step budget exceeded"},
+		{1000, "while (true) { try { while (true) {} } catch (e) { 0 } }", "step budget exceeded"},
+	}
+
+	for _, tt := range tests {
+		in := NewWithOptions(Options{StepBudget: tt.budget})
+		evaluated := in.Eval(testParse(t, tt.input), object.NewEnvironment())
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if err, ok := evaluated.(*object.Error); !ok || err.Message != expected {
+				t.Errorf("Eval(%q) with budget %d = %T (%+v), want error %q",
+					tt.input, tt.budget, evaluated, evaluated, expected)
+			}
+		}
+	}
+
+	// The budget covers all calls of Eval.
+	in := NewWithOptions(Options{StepBudget: 9})
+	testIntegerObject(t, in.Eval(testParse(t, "1 + 2"), object.NewEnvironment()), 3)
+	if _, ok := in.Eval(testParse(t, "1 + 2"), object.NewEnvironment()).(*object.Error); !ok {
+		t.Errorf("second Eval did not exceed the budget")
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		limit    int
+		input    string
+		expected interface{}
+	}{
+		{18, `"ab"`, "ab"},
+		{17, `"ab"`, "memory limit exceeded"},
+		{1000, "len(push([1, 2], 3))", 3},
+		{0, "let a = []; for (x in [1, 2, 3]) { a = push(a, x) } len(a)", 3},
+		{1 << 20, "let a = []; while (true) { a = push(a, 1) }", "memory limit exceeded"},
+		{1 << 20, `let s = "x"; while (true) { s = s + s }`, "memory limit exceeded"},
+		{1 << 20, `let s = "x"; while (true) { s = "${s}${s}" }`, "memory limit exceeded"},
+		{1 << 20, "let h = {}; while (true) { h = {1: h, 2: [h, h]} }", "memory limit exceeded"},
+		{1 << 20, "while (true) { try { let a = []; while (true) { a = push(a, 1) } } catch (e) { 0 } }", "memory limit exceeded"},
+	}
+
+	for _, tt := range tests {
+		in := NewWithOptions(Options{MemoryLimit: tt.limit})
+		evaluated := in.Eval(testParse(t, tt.input), object.NewEnvironment())
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("wrong string for %q. want=%q, got=%q", tt.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("unexpected result for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var events []string
+	kind := func(node ast.Node) string { return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.") }
+	in := NewWithOptions(Options{Hooks: Hooks{
+		OnEnterNode: func(node ast.Node, env *object.Environment) {
+			events = append(events, "enter "+kind(node))
+		},
+		OnExitNode: func(node ast.Node, result object.Object) {
+			if result == nil {
+				events = append(events, "exit "+kind(node))
+				return
+			}
+			events = append(events, "exit "+kind(node)+" "+result.Inspect())
+		},
+	}})
+
+	in.Eval(testParse(t, "let x = 1 + 2;"), object.NewEnvironment())
+	expected := []string{
+		"enter Program",
+		"enter LetStatement",
+		"enter InfixExpression",
+		"enter IntegerLiteral",
+		"exit IntegerLiteral 1",
+		"enter IntegerLiteral",
+		"exit IntegerLiteral 2",
+		"exit InfixExpression 3",
+		"exit LetStatement",
+		"exit Program",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("wrong node events.\nwant=%q\ngot= %q", expected, events)
+	}
+
+	var calls []string
+	in = NewWithOptions(Options{Hooks: Hooks{
+		OnCall: func(call *ast.CallExpression, fn object.Object, args []object.Object) {
+			values := make([]string, len(args))
+			for i, arg := range args {
+				values[i] = arg.Inspect()
+			}
+			calls = append(calls, fmt.Sprintf("%s %s %s", call, fn.Type(), strings.Join(values, ",")))
+		},
+	}})
+	in.Eval(testParse(t, `let f = fn(x, y) { len(x) + y }; f([1, 2], 3); memo(f)("ab", 5)`), object.NewEnvironment())
+	expected = []string{
+		"f([1, 2], 3) FUNCTION [1, 2],3",
+		"len(x) BUILTIN [1, 2]",
+		"memo(f) BUILTIN fn(x, y) { (len(x) + y) }",
+		`memo(f)("ab", 5) BUILTIN ab,5`,
+		"len(x) BUILTIN ab",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("wrong calls.\nwant=%q\ngot= %q", expected, calls)
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	users := map[string]string{"1": "ada", "2": "grace"}
+
+	in := New()
+	in.RegisterBuiltin("lookup", func(args ...object.Object) object.Object {
+		id, ok := args[0].(*object.String)
+		if !ok {
+			return &object.Error{Message: "lookup: id must be STRING"}
+		}
+		if name, ok := users[id.Value]; ok {
+			return &object.String{Value: name}
+		}
+		return nil
+	})
+	in.RegisterBuiltin("len", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: -1}
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`lookup("2")`, "grace"},
+		{`lookup("3")`, "null"},
+		{`len("abc")`, "-1"},
+		{`let lookup = fn(id) { "shadowed" }; lookup("1")`, "shadowed"},
+		{`let f = fn() { lookup(1) }; f()`, "ERROR: lookup: id must be STRING\n\tat lookup (1:16)\n\tat f (1:29)"},
+	}
+
+	for _, tt := range tests {
+		evaluated := in.Eval(testParse(t, tt.input), object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// Registered builtins belong to their interpreter.
+	other := New()
+	evaluated := other.Eval(testParse(t, `lookup("1")`), object.NewEnvironment())
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "identifier not found: lookup" {
+		t.Errorf("lookup leaked into another interpreter: %s", evaluated.Inspect())
+	}
+	testIntegerObject(t, other.Eval(testParse(t, `len("abc")`), object.NewEnvironment()), 3)
+}
+
+func TestBuiltinNames(t *testing.T) {
+	if !sort.StringsAreSorted(BuiltinNames) {
+		t.Errorf("BuiltinNames not sorted: %v", BuiltinNames)
+	}
+
+	in := NewWithOptions(Options{Capabilities: []string{"fs"}})
+	for _, name := range BuiltinNames {
+		if _, ok := in.Builtin(name); !ok {
+			t.Errorf("builtin %s not found", name)
+		}
+	}
+	isBuiltin := func(name string) bool {
+		i := sort.SearchStrings(BuiltinNames, name)
+		return i < len(BuiltinNames) && BuiltinNames[i] == name
+	}
+	for _, name := range []string{"len", "map", "pi"} {
+		if !isBuiltin(name) {
+			t.Errorf("%s missing from BuiltinNames", name)
+		}
+	}
+	for name := range capabilities["fs"] {
+		if isBuiltin(name) {
+			t.Errorf("capability builtin %s in BuiltinNames", name)
+		}
+	}
+}
+
+func TestCallOption(t *testing.T) {
+	closure := &object.Closure{Fn: &object.CompiledFunction{}}
+	env := object.NewEnvironment()
+	env.Set("f", closure)
+
+	evaluated := New().Eval(testParse(t, "map([1, 2], f)"), env)
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "not a function: FUNCTION" {
+		t.Errorf("closure called without Call: %s", evaluated.Inspect())
+	}
+
+	in := NewWithOptions(Options{Call: func(fn object.Object, args []object.Object) object.Object {
+		if fn != closure {
+			t.Errorf("Call got %s", fn.Inspect())
+		}
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 10}
+	}})
+	evaluated = in.Eval(testParse(t, "map([1, 2], f)"), env)
+	if evaluated.Inspect() != "[10, 20]" {
+		t.Errorf("wrong result. want=%q, got=%q", "[10, 20]", evaluated.Inspect())
+	}
+}
+
+func TestArrayCallbackBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{"map([], fn(x) { x })", "[]"},
+		{"map([1, 2], len)", "argument to `len` not supported, got INTEGER"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{"filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })", "[2, 4]"},
+		{"filter([1, [][0], 0, false, true], fn(x) { x })", "[1, 0, true]"},
+		{"reduce([1, 2, 3, 4], fn(acc, x) { acc + x }, 0)", 10},
+		{"reduce([1, 2, 3, 4], fn(acc, x) { acc * x })", 24},
+		{`reduce(["a", "b"], fn(acc, x) { acc + x }, ">")`, ">ab"},
+		{"reduce([], fn(acc, x) { acc + x }, 5)", 5},
+		{"reduce([], fn(acc, x) { acc + x })", "reduce of empty array with no initial value"},
+		{"sort([3, 1, 2])", "[1, 2, 3]"},
+		{"sort([2.5, 1, 2])", "[1, 2, 2.5]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{"sort([3, 1, 2], fn(a, b) { a > b })", "[3, 2, 1]"},
+		{`sort([[2, "x"], [1, "y"], [2, "z"], [1, "w"]], fn(a, b) { a[0] < b[0] })`, "[[1, y], [1, w], [2, x], [2, z]]"},
+		{"let xs = [2, 1]; sort(xs); xs", "[2, 1]"},
+		{`sort([1, "a"])`, "type mismatch: STRING < INTEGER"},
+		{"sort([1, 2], fn(a, b) { a + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{"let n = 0; map([1, 2, 3], fn(x) { n = n + x }); n", 6},
+		{"map([1], fn(x) { x }, 2)", "wrong number of arguments. got=3, want=2"},
+		{"reduce([1])", "wrong number of arguments. got=1, want=2 or 3"},
+		{"sort()", "wrong number of arguments. got=0, want=1 or 2"},
+		{"filter(1, fn(x) { x })", "argument to `filter` must be ARRAY, got INTEGER"},
+		{"map([1], 1)", "argument to `map` must be FUNCTION, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			got := evaluated.Inspect()
+			if err, ok := evaluated.(*object.Error); ok {
+				got = err.Message
+			}
+			if got != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, expected, got)
+			}
+		}
+	}
+
+	in := NewWithOptions(Options{StrictBooleans: true})
+	evaluated := in.Eval(testParse(t, "filter([1, 2], fn(x) { x })"), object.NewEnvironment())
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "non-boolean condition: INTEGER" {
+		t.Errorf("filter accepted a non-boolean in strict mode: %s", evaluated.Inspect())
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"type(1)", "INTEGER"},
+		{"type(1.5)", "FLOAT"},
+		{`type("a")`, "STRING"},
+		{"type([1])", "ARRAY"},
+		{"type({})", "HASH"},
+		{"type(true)", "BOOLEAN"},
+		{"type([][0])", "NULL"},
+		{"type(fn() {})", "FUNCTION"},
+		{"type(len)", "BUILTIN"},
+		{`int("42")`, 42},
+		{`int("-7")`, -7},
+		{`int("+7")`, 7},
+		{"int(3)", 3},
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{`int("4x")`, `int: cannot parse "4x" as INTEGER`},
+		{`int(" 4")`, `int: cannot parse " 4" as INTEGER`},
+		{`int("")`, `int: cannot parse "" as INTEGER`},
+		{`int("9223372036854775808")`, `int: "9223372036854775808" out of range`},
+		{"int(10000000000000000000.0)", "int: 1e+19 out of range"},
+		{"int(true)", "argument to `int` not supported, got BOOLEAN"},
+		{"int()", "wrong number of arguments. got=0, want=1"},
+		{"str(7)", "7"},
+		{`str("a")`, "a"},
+		{"str([1, true])", "[1, true]"},
+		{"str(2.5)", "2.5"},
+		{`str(7) + "!"`, "7!"},
+		{"str(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"bool(0)", true},
+		{`bool("")`, true},
+		{"bool([][0])", false},
+		{"bool(false)", false},
+		{"bool(true)", true},
+		{`int(str(12)) + 1`, 13},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("wrong string for %q. want=%q, got=%q", tt.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("unexpected result for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+
+	// bool converts by truthiness even in strict mode.
+	in := NewWithOptions(Options{StrictBooleans: true})
+	testBooleanObject(t, in.Eval(testParse(t, "bool(1)"), object.NewEnvironment()), true)
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"abs(-3)", 3},
+		{"abs(3)", 3},
+		{"abs(-2.5)", 2.5},
+		{"abs(-9223372036854775807 - 1)", "integer overflow: abs(-9223372036854775808)"},
+		{`abs("a")`, "argument to `abs` must be INTEGER or FLOAT, got STRING"},
+		{"min(3, 1, 2)", 1},
+		{"max(3, 1, 2)", 3},
+		{"min(2, 1.5)", 1.5},
+		{"max(2, 1.5)", 2},
+		{"max([4, 9, 2])", 9},
+		{"min(7)", 7},
+		{"min()", "wrong number of arguments. got=0, want at least 1"},
+		{"max([])", "`max` of empty array"},
+		{`min(1, "a")`, "argument to `min` must be INTEGER or FLOAT, got STRING"},
+		{"pow(2, 10)", 1024},
+		{"pow(-3, 3)", -27},
+		{"pow(5, 0)", 1},
+		{"pow(2, -1)", 0.5},
+		{"pow(4, 0.5)", 2.0},
+		{"pow(2, 63)", "integer overflow: pow(2, 63)"},
+		{"pow(2, 62)", 4611686018427387904},
+		{"sqrt(16)", 4.0},
+		{"sqrt(2.25)", 1.5},
+		{"sqrt(-1)", "sqrt of negative number: -1"},
+		{"floor(2.7)", 2},
+		{"floor(-2.2)", -3},
+		{"ceil(2.2)", 3},
+		{"ceil(-2.7)", -2},
+		{"floor(5)", 5},
+		{"ceil(10000000000000000000.0)", "ceil: 1e+19 out of range"},
+		{"floor(true)", "argument to `floor` must be INTEGER or FLOAT, got BOOLEAN"},
+		{"pi", 3.141592653589793},
+		{"e", 2.718281828459045},
+		{"let pi = 3; pi", 3},
+		{"[1, 2, 3][floor(pi / 2)]", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: true, false: [][0]}`, `{b: 1, a: 2, 3: true, false: null}`},
+		{`{"a": 1, "b": 2, "a": 3}`, `{a: 3, b: 2}`},
+		{`keys({"b": 1, "a": 2, 3: true})`, `[b, a, 3]`},
+		{`values({"b": 1, "a": 2, 3: true})`, `[1, 2, true]`},
+		{`keys({})`, `[]`},
+		{`let s = ""; for (k in {"z": 1, "y": 2, "x": 3}) { s = s + k; } s`, `zyx`},
+		{`collect(iter({"z": 1, "y": 2}))`, `[z, y]`},
+		{`try { assertEqual(1, 2) } catch (e) { keys(e) }`, `[message, stack, actual, expected]`},
+		{`keys([1])`, "argument to `keys` must be HASH, got ARRAY"},
+		{`values()`, "wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`jsonEncode({"b": [1, 2.5, 3.0], "a": [][0], "c": {"d": true}})`, `{"b":[1,2.5,3.0],"a":null,"c":{"d":true}}`},
+		{`jsonEncode("<a & b>")`, `"<a & b>"`},
+		{`jsonEncode(jsonEncode("q"))`, `"\"q\""`},
+		{`jsonEncode([])`, `[]`},
+		{`jsonEncode({"a": [1, 2]}, "  ")`, "{\n  \"a\": [\n    1,\n    2\n  ]\n}"},
+		{`jsonEncode({1: 2})`, "jsonEncode: hash keys must be STRING, got INTEGER"},
+		{`jsonEncode([len])`, "jsonEncode: cannot encode BUILTIN"},
+		{`jsonEncode(1, 2)`, "argument to `jsonEncode` must be STRING, got INTEGER"},
+		{`jsonDecode(jsonEncode({"a": [1, 2.5, "x", true, [][0], {}]}))`, `{a: [1, 2.5, x, true, null, {}]}`},
+		{`jsonDecode(jsonEncode([1, 2.0]))[1]`, "2.0"},
+		{`jsonDecode(jsonEncode("q"))`, "q"},
+		{`jsonEncode(jsonDecode(jsonEncode({"z": 1, "a": {"y": [2], "b": 3}})))`, `{"z":1,"a":{"y":[2],"b":3}}`},
+		{`jsonDecode(" 42 ")`, "42"},
+		{`jsonDecode("1e2")`, "100.0"},
+		{`jsonDecode("9223372036854775808")`, "9.223372036854776e+18"},
+		{`jsonDecode("[1,")`, "jsonDecode: unexpected end of JSON input"},
+		{`jsonDecode("")`, "jsonDecode: unexpected end of JSON input"},
+		{`jsonDecode("{} {}")`, "jsonDecode: invalid data after top-level value"},
+		{`jsonDecode("nul")`, "jsonDecode: unexpected EOF"},
+		{`jsonDecode("[1 2]")`, "jsonDecode: invalid character '2' after array element"},
+		{`jsonDecode("1e400")`, "jsonDecode: number 1e400 out of range"},
+		{`jsonDecode(1)`, "argument to `jsonDecode` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		var got string
+		switch result := evaluated.(type) {
+		case *object.String:
+			got = result.Value
+		case *object.Error:
+			got = result.Message
+		default:
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRegexpBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`reMatch("^a+b$", "aaab")`, "true"},
+		{`reMatch("^a+b$", "aaabc")`, "false"},
+		{`reMatch("[0-9]", "x1")`, "true"},
+		{`reFind("(\w+)@(\w+)", "mail bob@example now")`, "[bob@example, bob, example]"},
+		{`reFind("a(x)?b", "ab")`, "[ab, null]"},
+		{`reFind("z", "abc")`, "null"},
+		{`reReplace("(\w+)@(\w+)", "bob@example", "$2 at $1")`, "example at bob"},
+		{`reReplace("o", "foo", "0")`, "f00"},
+		{`reSplit(",\s*", "a, b,c")`, "[a, b, c]"},
+		{`reSplit(",", "")`, "[]"},
+		{`reMatch("(", "x")`, "reMatch: error parsing regexp: missing closing ): `(`"},
+		{`reSplit(1, "x")`, "argument to `reSplit` must be STRING, got INTEGER"},
+		{`reReplace("a", "b")`, "wrong number of arguments. got=2, want=3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		var got string
+		switch result := evaluated.(type) {
+		case *object.String:
+			got = result.Value
+		case *object.Error:
+			got = result.Message
+		default:
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// Patterns are compiled once per interpreter, and a full cache starts
+	// over rather than growing.
+	in := New()
+	for i := 0; i < maxRegexps+1; i++ {
+		in.Eval(testParse(t, fmt.Sprintf(`reMatch("x{%d}", "x")`, i)), object.NewEnvironment())
+		if _, ok := in.regexps[fmt.Sprintf("x{%d}", i)]; !ok {
+			t.Fatalf("pattern %d not cached", i)
+		}
+	}
+	if len(in.regexps) != 1 {
+		t.Errorf("cache not reset. got %d patterns", len(in.regexps))
+	}
+}
+
+func TestFSCapability(t *testing.T) {
+	dir := t.TempDir()
+	env := object.NewEnvironment()
+	env.Set("dir", &object.String{Value: dir})
+
+	evaluated := New().Eval(testParse(t, `readFile(dir + "/a.txt")`), env)
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "identifier not found: readFile" {
+		t.Fatalf("readFile available without the fs capability. got=%s", evaluated.Inspect())
+	}
+
+	in := NewWithOptions(Options{Capabilities: []string{"fs"}})
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`writeFile(dir + "/b.txt", "bee")`, "null"},
+		{`writeFile(dir + "/a.txt", "ay")`, "null"},
+		{`readFile(dir + "/a.txt") + readFile(dir + "/b.txt")`, "aybee"},
+		{`listDir(dir)`, "[a.txt, b.txt]"},
+		{`readFile(dir + "/c.txt")`, "readFile: open " + dir + "/c.txt: no such file or directory"},
+		{`writeFile(dir + "/no/d.txt", "")`, "writeFile: open " + dir + "/no/d.txt: no such file or directory"},
+		{`listDir(dir + "/no")`, "listDir: open " + dir + "/no: no such file or directory"},
+		{`readFile(1)`, "argument to `readFile` must be STRING, got INTEGER"},
+		{`writeFile("x")`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range tests {
+		var got string
+		switch result := in.Eval(testParse(t, tt.input), env).(type) {
+		case *object.String:
+			got = result.Value
+		case *object.Error:
+			got = result.Message
+		default:
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != "evaluator: unknown capability \"net\"" {
+			t.Errorf("wrong panic for an unknown capability: %v", r)
+		}
+	}()
+	NewWithOptions(Options{Capabilities: []string{"net"}})
+}
+
+// fakeClock is a Clock whose time only moves when it is slept on.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestTimeBuiltins(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)}
+	in := NewWithOptions(Options{Clock: clock})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`now()`, "1709208000000"},
+		{`let start = now(); sleep(1500); now() - start`, "1500"},
+		{`formatTime(now())`, "2024-02-29T12:00:01Z"},
+		{`formatTime(0, "2006-01-02 15:04:05.000")`, "1970-01-01 00:00:00.000"},
+		{`parseTime("2024-02-29T12:00:01.5Z") == now()`, "true"},
+		{`parseTime("2024-02-29T13:00:00+01:00")`, "1709208000000"},
+		{`parseTime("1970-01-02", "2006-01-02")`, "86400000"},
+		{`parseTime("yesterday")`, `parseTime: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`},
+		{`formatTime("0")`, "argument to `formatTime` must be INTEGER, got STRING"},
+		{`parseTime("0", 1)`, "argument to `parseTime` must be STRING, got INTEGER"},
+		{`sleep(-1)`, "sleep: -1 out of range"},
+		{`sleep(1.5)`, "argument to `sleep` must be INTEGER, got FLOAT"},
+	}
+	for _, tt := range tests {
+		var got string
+		switch result := in.Eval(testParse(t, tt.input), object.NewEnvironment()).(type) {
+		case *object.String:
+			got = result.Value
+		case *object.Error:
+			got = result.Message
+		default:
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// A real sleep stops when the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	evaluated := New().EvalContext(ctx, testParse(t, `try { sleep(60000) } catch (e) { "caught" }`), object.NewEnvironment())
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "evaluation timed out" {
+		t.Errorf("sleep not interrupted. got=%s", evaluated.Inspect())
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("sleep took %s after the context was done", elapsed)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/strings.monkey": `puts("loading"); import "helper"; let shout = fn(s) { s + "!" }; let _secret = 1; const answer = 42; let twice = helper["twice"];`,
+		"lib/helper.monkey":  `let twice = fn(x) { x * 2 };`,
+		"path/extra.monkey":  `let value = "extra";`,
+		"a.monkey":           `import "b";`,
+		"b.monkey":           `import "a";`,
+		"broken.monkey":      `let = 1;`,
+		"failing.monkey":     `let x = 1 + true;`,
+	}
+	for name, src := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(src), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	in := NewWithOptions(Options{Output: &out, ModulePath: []string{filepath.Join(dir, "path")}})
+	eval := func(input string) object.Object {
+		program, err := parser.ParseFile(filepath.Join(dir, "main.monkey"), strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("parser errors for %q: %v", input, err)
+		}
+		return in.Eval(program, object.NewEnvironment())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/strings"; strings["shout"]("hi")`, "hi!"},
+		{`import "lib/strings.monkey"; [strings["answer"], strings["twice"](4), strings["_secret"], strings["helper"]]`, "[42, 8, null, null]"},
+		{`import "extra"; extra["value"]`, "extra"},
+		{`let f = fn() { import "extra"; extra }; f()["value"]`, "extra"},
+		{`import "a"`, `import "a": import cycle: a.monkey -> b.monkey -> a.monkey`},
+		{`import "nope"`, `import "nope": module not found`},
+		{`import "my-mod"`, `import "my-mod": module name "my-mod" is not an identifier`},
+		{`import "broken"`, `import "broken": ` + filepath.Join(dir, "broken.monkey") + `:1:5: expected next token to be IDENT, got = instead (and 1 more errors)`},
+		{`import "failing"`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		var got string
+		switch result := eval(tt.input).(type) {
+		case *object.String:
+			got = result.Value
+		case *object.Error:
+			got = result.Message
+		default:
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// Modules are evaluated once per interpreter.
+	if out.String() != "loading\n" {
+		t.Errorf("module evaluated more than once. output=%q", out.String())
+	}
+}
+
+func TestStdlib(t *testing.T) {
+	in := New()
+	env := object.NewEnvironment()
+	if err := in.LoadPrelude(env); err != nil {
+		t.Fatalf("LoadPrelude failed: %s", err.Inspect())
+	}
+	env.Set("text", &object.String{Value: "a\r\nb\n\nc\n"})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`range(4)`, "[0, 1, 2, 3]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(3, 1)`, "[]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`sum([1, 2, 3.5])`, "6.5"},
+		{`sum([])`, "0"},
+		{`[indexOf([5, 6, 7], 7), indexOf([5], 1)]`, "[2, -1]"},
+		{`[contains(["a", "b"], "b"), contains([], 1)]`, "[true, false]"},
+		{`find([1, 4, 9], fn(x) { x > 3 })`, "4"},
+		{`find([1], fn(x) { x > 3 })`, "null"},
+		{`[any([1, 2], fn(x) { x > 1 }), any([], fn(x) { true })]`, "[true, false]"},
+		{`[all([1, 2], fn(x) { x > 1 }), all([], fn(x) { false })]`, "[false, true]"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`flatten([[1, 2], 3, [], [[4]]])`, "[1, 2, 3, [4]]"},
+		{`uniq([3, 1, 3, 2, 1])`, "[3, 1, 2]"},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`join([], "-")`, ""},
+		{`repeat("ab", 3)`, "ababab"},
+		{`trim("  hi there ")`, "hi there"},
+		{`words(" one  two three ")`, "[one, two, three]"},
+		{`words("  ")`, "[]"},
+		{`lines(text)`, "[a, b, , c]"},
+		{`padLeft("7", 3, "0") + padRight("x", 3, ".") + padLeft("long", 2, " ")`, "007x..long"},
+		{`padLeft("7", 3, "")`, "7"},
+		{`assertFails(fn() { 1 / 0 })`, "null"},
+		{`assertFails(fn() { 1 / 0 }, "division by zero")`, "null"},
+		{`assertFails(fn() { 1 / 0 }, "other")`, `assertion failed: got error "division by zero", want "other"`},
+		{`assertFails(fn() { 1 })`, "assertion failed: no error"},
+	}
+	for _, tt := range tests {
+		var got string
+		switch result := in.Eval(testParse(t, tt.input), env).(type) {
+		case *object.String:
+			got = result.Value
+		case *object.Error:
+			got = result.Message
+		default:
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// The modules can be imported too, and are shared with the prelude.
+	evaluated := in.Eval(testParse(t, `import "std/lists"; lists["range"] == range`), env)
+	testBooleanObject(t, evaluated, true)
+	evaluated = in.Eval(testParse(t, `import "std/nope"`), env)
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != `import "std/nope": module not found` {
+		t.Errorf("wrong result importing a missing module. got=%s", evaluated.Inspect())
+	}
+
+	// Only the environments it is loaded into have the prelude.
+	evaluated = in.Eval(testParse(t, "range(2)"), object.NewEnvironment())
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "identifier not found: range" {
+		t.Errorf("prelude leaked into another environment. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`quote(unquote(4))`, `4`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(2.5) + unquote("s"))`, `(2.5 + "s")`},
+		{`quote(f(unquote([1, -2])))`, `f([1, -2])`},
+		{`let q = quote(a + b); quote(unquote(q) * unquote(q))`, `((a + b) * (a + b))`},
+		{`let f = fn(x) { quote(unquote(x) + 1) }; f(1); f(2)`, `(2 + 1)`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Errorf("%s: expected *object.Quote. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("%s: wrong quoted code. want=%q, got=%q", tt.input, tt.expected, quote.Node.String())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(fn() {}))`, "cannot unquote FUNCTION"},
+		{`quote(unquote(missing))`, "identifier not found: missing"},
+		{`unquote(1)`, "unquote outside of quote"},
+	}
+	for _, tt := range errTests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Message != tt.expected {
+			t.Errorf("%s: want error %q, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	program := testParse(t, `let number = 1;
+let function = fn(x, y) { x + y };
+let mymacro = macro(x, y) { x + y; };`)
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Errorf("number should not be defined")
+	}
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+	if len(macro.Parameters) != 2 || macro.Body.String() != "{ (x + y) }" || macro.Env != env {
+		t.Errorf("wrong macro. got=%s", macro.Inspect())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); }; infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); }; reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`let unless = macro(cond, consequence, alternative) {
+				quote(if (!(unquote(cond))) { unquote(consequence); } else { unquote(alternative); });
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`let twice = macro(x) { quote(unquote(x) * 2) }; let inc = macro(x) { quote(unquote(x) + 1) }; twice(inc(3));`,
+			`(3 + 1) * 2`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParse(t, tt.expected)
+		program := testParse(t, tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if !ast.Equivalent(expanded, expected) {
+			t.Errorf("%s: not equal. want=%q, got=%q", tt.input, expected.String(), expanded.String())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro() { 1 }; 1 + m();`, "1:28: macro m returned INTEGER, not a quote"},
+		{`let m = macro(x) { error("bad") }; m(1);`, "1:36: bad"},
+	}
+	for _, tt := range errTests {
+		program := testParse(t, tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: want error %q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	// Expanded programs evaluate as usual.
+	program := testParse(t, `let unless = macro(cond, then) { quote(if (!unquote(cond)) { unquote(then) }) }; unless(1 > 2, "ran")`)
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	if _, err := ExpandMacros(program, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if evaluated := Eval(program, env); evaluated.Inspect() != "ran" {
+		t.Errorf("wrong result of the expanded program. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestAssertBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`assert(1 < 2, "maths")`, "null"},
+		{`assert(1 > 2, "maths")`, "assertion failed: maths"},
+		{`assert([][0])`, "assertion failed"},
+		{`assert(true, 1)`, "argument to `assert` must be STRING, got INTEGER"},
+		{`assertEqual(1 + 1, 2)`, "null"},
+		{`assertEqual(1, 1.0)`, "null"},
+		{`assertEqual([1, {"a": [2]}], [1, {"a": [2]}])`, "null"},
+		{`assertEqual({"a": 1}, {"a": 2})`, "assertion failed: got {a: 1}, want {a: 2}"},
+		{`assertEqual([1, 2], [1])`, "assertion failed: got [1, 2], want [1]"},
+		{`assertEqual("1", 1)`, "assertion failed: got 1, want 1"},
+		{`assertEqual(len, len)`, "null"},
+		{`try { assertEqual(1 + 1, 3) } catch (e) { [e["actual"], e["expected"], e["message"]] }`, "[2, 3, assertion failed: got 2, want 3]"},
+		{`let check = fn(x) { assert(x > 0, "positive") }; try { check(-1) } catch (e) { e["stack"] }`, "[assert (1:21), check (1:56)]"},
+	}
+	for _, tt := range tests {
+		var got string
+		switch result := testEval(t, tt.input).(type) {
+		case *object.String:
+			got = result.Value
+		case *object.Error:
+			got = result.Message
+		default:
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// Embedders find the position of the failed assertion in the stack,
+	// and the values compared in the details.
+	evaluated := testEval(t, "let x = 1;\nassertEqual(x, 2);")
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error returned. got=%s", evaluated.Inspect())
+	}
+	if len(err.Stack) != 1 || err.Stack[0].Pos.String() != "2:1" {
+		t.Errorf("wrong stack. got=%v", err.Stack)
+	}
+	if testIntegerObject(t, err.Details["actual"], 1) {
+		testIntegerObject(t, err.Details["expected"], 2)
+	}
+
+	// assert goes by the truthiness of the interpreter.
+	in := NewWithOptions(Options{StrictBooleans: true})
+	evaluated = in.Eval(testParse(t, "assert(1)"), object.NewEnvironment())
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "non-boolean condition: INTEGER" {
+		t.Errorf("assert accepted a non-boolean in strict mode. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestIterators(t *testing.T) {
+	naturals := `let n = 0; let naturals = fn() { n = n + 1; return n, false; };`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`collect(iter([1, 2, 3]))`, "[1, 2, 3]"},
+		{`collect([1, 2])`, "[1, 2]"},
+		{`collect({"k": 1})`, "[k]"},
+		{`let it = iter([7]); [next(it), next(it), next(it)]`, "[[7, false], [null, true], [null, true]]"},
+		{`let it = iter(["a", "b"]); let v, done = next(it); v`, "a"},
+		{`let it = iter([1, 2, 3]); next(it); collect(it)`, "[2, 3]"},
+		{naturals + `collect(take(naturals, 5))`, "[1, 2, 3, 4, 5]"},
+		{naturals + `let it = iter(naturals); collect(take(it, 2)); collect(take(it, 2))`, "[3, 4]"},
+		{naturals + `take(naturals, 3); n`, "0"},
+		{naturals + `collect(take(naturals, 0))`, "[]"},
+		{`collect(take([1, 2], 5))`, "[1, 2]"},
+		{`let i = 0; let gen = fn() { i = i + 1; if (i > 3) { return 0, true; } return i * 10, false; }; collect(gen)`, "[10, 20, 30]"},
+		{naturals + `let total = 0; for (x in iter(naturals)) { if (x > 4) { break; } total = total + x; } total`, "10"},
+		{`let seen = []; for (x in take([5, 6, 7], 2)) { seen = push(seen, x); } seen`, "[5, 6]"},
+		{`collect(fn() { 1 })`, "generator must return a value and a boolean, got 1"},
+		{`collect(fn() { return 1, 2; })`, "generator must return a value and a boolean, got [1, 2]"},
+		{`collect(fn() { 1 / 0 })`, "division by zero"},
+		{`for (x in iter(fn() { missing })) { x }`, "identifier not found: missing"},
+		{`iter(1)`, "argument to `iter` must be ARRAY, HASH, ITERATOR or FUNCTION, got INTEGER"},
+		{`next([1])`, "argument to `next` must be ITERATOR, got ARRAY"},
+		{`take([1], -1)`, "argument to `take` must not be negative, got -1"},
+		{`type(iter([]))`, "ITERATOR"},
+	}
+	for _, tt := range tests {
+		var got string
+		switch result := testEval(t, tt.input).(type) {
+		case *object.String:
+			got = result.Value
+		case *object.Error:
+			got = result.Message
+		default:
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// Collecting an endless iterator is stopped like any endless loop.
+	in := NewWithOptions(Options{StepBudget: 10000})
+	evaluated := in.Eval(testParse(t, `collect(fn() { return 1, false; })`), object.NewEnvironment())
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "step budget exceeded" {
+		t.Errorf("endless collect not stopped. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestRandom(t *testing.T) {
+	newInterpreter := func() *Interpreter {
+		return NewWithOptions(Options{Rand: rand.New(rand.NewSource(1))})
+	}
+	program := testParse(t, "[random(), random(6), random(1000000)]")
+
+	first := newInterpreter().Eval(program, object.NewEnvironment())
+	second := newInterpreter().Eval(program, object.NewEnvironment())
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("same seed gave different numbers: %s and %s", first.Inspect(), second.Inspect())
+	}
+
+	in := newInterpreter()
+	for i := 0; i < 100; i++ {
+		f, ok := in.Eval(testParse(t, "random()"), object.NewEnvironment()).(*object.Float)
+		if !ok || f.Value < 0 || f.Value >= 1 {
+			t.Fatalf("random() not a float in [0, 1). got=%v", f)
+		}
+		n, ok := in.Eval(testParse(t, "random(6)"), object.NewEnvironment()).(*object.Integer)
+		if !ok || n.Value < 0 || n.Value >= 6 {
+			t.Fatalf("random(6) not an integer in [0, 6). got=%v", n)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"random(0)", "argument to `random` must be positive, got 0"},
+		{"random(1.5)", "argument to `random` must be INTEGER, got FLOAT"},
+		{"random(1, 2)", "wrong number of arguments. got=2, want=0 or 1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var out, other bytes.Buffer
+	in := NewWithOptions(Options{Output: &out})
+	evaluated := in.Eval(testParse(t, `puts(1, "a", [2]); print("x"); print("y", 3); puts(); puts()`), object.NewEnvironment())
+	if evaluated != NULL {
+		t.Errorf("puts returned %s, want null", evaluated.Inspect())
+	}
+	NewWithOptions(Options{Output: &other}).Eval(testParse(t, `puts("other")`), object.NewEnvironment())
+
+	if expected := "1 a [2]\nxy 3\n\n"; out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+	if expected := "other\n"; other.String() != expected {
+		t.Errorf("wrong output of the other interpreter. want=%q, got=%q", expected, other.String())
+	}
+}
+
+func TestInput(t *testing.T) {
+	var out bytes.Buffer
+	in := NewWithOptions(Options{
+		Input:  strings.NewReader("Ada\r\nfirst\n\nlast"),
+		Output: &out,
+	})
+	evaluated := in.Eval(testParse(t, `[input("name? "), readLine(), readLine(), input(), readLine(), input("more? ")]`), object.NewEnvironment())
+	if expected := "[Ada, first, , last, null, null]"; evaluated.Inspect() != expected {
+		t.Errorf("wrong lines. want=%s, got=%s", expected, evaluated.Inspect())
+	}
+	if expected := "name? more? "; out.String() != expected {
+		t.Errorf("wrong prompts. want=%q, got=%q", expected, out.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`readLine(1)`, "wrong number of arguments. got=1, want=0"},
+		{`input("a", "b")`, "wrong number of arguments. got=2, want=0 or 1"},
+		{`input(1)`, "argument to `input` must be STRING, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := NewWithOptions(Options{Input: strings.NewReader("")}).Eval(testParse(t, tt.input), object.NewEnvironment())
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(t, input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "{ (x + 2) }"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let g = 3; let f = fn(x) { x + g }; f(1)", 4},
+		{"let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(4)", 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestFunctionScope(t *testing.T) {
+	input := `
+let x = 1;
+let f = fn(x) { let y = x; y };
+f(2);
+x`
+
+	testIntegerObject(t, testEval(t, input), 1)
+
+	evaluated := testEval(t, "let f = fn() { let y = 1; }; f(); y")
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "identifier not found: y" {
+		t.Errorf("local binding leaked out of function. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`, 4},
+		{`
+let newAdder = fn(x) { fn(y) { x + y } };
+let addOne = newAdder(1);
+let addTen = newAdder(10);
+addOne(1) + addTen(1);`, 13},
+		{`
+let compose = fn(f, g) { fn(x) { g(f(x)) } };
+let inc = fn(x) { x + 1 };
+let double = fn(x) { x * 2 };
+compose(inc, double)(5);`, 12},
+		// The closure sees bindings made after its creation in the
+		// environment it captured.
+		{`
+let make = fn() { let f = fn() { later }; let later = 7; f };
+make()();`, 7},
+		// Parameters shadow captured bindings.
+		{`
+let x = 1;
+let f = fn(x) { fn() { x } };
+f(5)();`, 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{`let greet = fn(name) { "Hello, " + name }; greet("Monkey")`, "Hello, Monkey"},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`let x = "s"; x == "s"`, true},
+		{`"${1 + 2} apples"`, "3 apples"},
+		{`let n = "Monkey"; "Hello, ${n}! ${n == "Monkey"}"`, "Hello, Monkey! true"},
+		{`len("${"ab"}c")`, 3},
+		{`len("")`, 0},
+		{`if ("") { 1 } else { 2 }`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"a" < "b"`, "unknown operator: STRING < STRING"},
+		{`"a" + 1`, "type mismatch: STRING + INTEGER"},
+		{`"${missing}"`, "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d",
+			len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			"[1, 2, 3][0]",
+			1,
+		},
+		{
+			"[1, 2, 3][1]",
+			2,
+		},
+		{
+			"[1, 2, 3][2]",
+			3,
+		},
+		{
+			"let i = 0; [1][i];",
+			1,
+		},
+		{
+			"[1, 2, 3][1 + 1];",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[2];",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+			6,
+		},
+		{
+			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+			2,
+		},
+		{
+			"[1, 2, 3][3]",
+			nil,
+		},
+		{
+			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
+			nil,
+		},
+		{
+			"[][0]",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStringIndexAndSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[4]`, "o"},
+		{`"hello"[-1]`, "o"},
+		{`"hello"[-5]`, "h"},
+		{`"hello"[5]`, nil},
+		{`"hello"[-6]`, nil},
+		{`""[0]`, nil},
+		{`"hello"[1:4]`, "ell"},
+		{`"hello"[:2]`, "he"},
+		{`"hello"[3:]`, "lo"},
+		{`"hello"[:]`, "hello"},
+		{`"hello"[-3:-1]`, "ll"},
+		{`"hello"[-100:2]`, "he"},
+		{`"hello"[3:100]`, "lo"},
+		{`len("hello"[4:2])`, 0},
+		{`[1, 2, 3, 4][1:3]`, "[2, 3]"},
+		{`[1, 2, 3, 4][:-1]`, "[1, 2, 3]"},
+		{`[1, 2, 3, 4][-2:]`, "[3, 4]"},
+		{`[1, 2, 3][5:]`, "[]"},
+		{`[1, 2, 3][2:1]`, "[]"},
+		{`let a = [1, 2, 3]; let b = a[:]; push(b, 4); len(a)`, 3},
+		{`let i = 1; "hello"[i:i + 2]`, "el"},
+		{`"hello"["a"]`, "index operator not supported: STRING"},
+		{`1[0:1]`, "slice operator not supported: INTEGER"},
+		{`"hello"[true:]`, "slice bound must be INTEGER, got BOOLEAN"},
+		{`[1][:x]`, "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			got := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				got = errObj.Message
+			}
+			if got != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, expected, got)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestArrayExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let xs = [1, 2]; [0, xs..., 3]`, "[0, 1, 2, 3]"},
+		{`let add = fn(a, b) { a + b }; add([1, 2]...)`, 3},
+		{`let f = fn(xs...) { xs }; f()`, "[]"},
+		{`let f = fn(xs...) { xs }; f(1, 2, 3)`, "[1, 2, 3]"},
+		{`let f = fn(a, b, rest...) { [a, b, rest] }; f(1)`, "[1, null, []]"},
+		{`let f = fn(a, rest...) { a + len(rest) }; f(10, [1, 2]..., 3)`, 13},
+		{`let f = fn() { return 1, "two"; }; f()`, "[1, two]"},
+		{`let f = fn() { return 1, 2; }; let a, b = f(); a * 10 + b`, 12},
+		{`let a, b = [3, 4]; b`, 4},
+		{`let map = fn(arr, f) {
+  let iter = fn(arr, acc) {
+    if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }
+  };
+  iter(arr, []);
+};
+map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`[1, 5 + true, 3]`, "type mismatch: INTEGER + BOOLEAN"},
+		{`[1, 2][true]`, "index operator not supported: ARRAY"},
+		{`1[0]`, "index operator not supported: INTEGER"},
+		{`f(1...)`, "identifier not found: f"},
+		{`len(1...)`, "cannot spread INTEGER"},
+		{`let a, b = 1;`, "cannot destructure INTEGER"},
+		{`let a, b = [1, 2, 3];`, "wrong number of values to destructure. got=3, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			got := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				got = errObj.Message
+			}
+			if got != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, expected, got)
+			}
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`{"foo": 5}["foo"]`,
+			5,
+		},
+		{
+			`{"foo": 5}["bar"]`,
+			nil,
+		},
+		{
+			`let key = "foo"; {"foo": 5}[key]`,
+			5,
+		},
+		{
+			`{}["foo"]`,
+			nil,
+		},
+		{
+			`{5: 5}[5]`,
+			5,
+		},
+		{
+			`{true: 5}[true]`,
+			5,
+		},
+		{
+			`{false: 5}[false]`,
+			5,
+		},
+		{
+			`{"a": 1, "a": 2}["a"]`,
+			2,
+		},
+		{
+			`{1: 5}["1"]`,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`{"a": 1}[{}]`, "unusable as hash key: HASH"},
+		{`{"a": missing}`, "identifier not found: missing"},
+		{`{1 + true: 1}`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	arr := func(values ...int64) *object.Array {
+		a := &object.Array{Elements: []object.Object{}}
+		for _, v := range values {
+			a.Elements = append(a.Elements, &object.Integer{Value: v})
+		}
+		return a
+	}
+
+	env := object.NewEnvironment()
+	env.Set("empty", arr())
+	env.Set("xs", arr(1, 2, 3))
+	env.Set("s", &object.String{Value: "four"})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len(s)`, 4},
+		{`len(empty)`, 0},
+		{`len(xs)`, 3},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len(s, s)`, "wrong number of arguments. got=2, want=1"},
+		{`first(xs)`, 1},
+		{`first(empty)`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last(xs)`, 3},
+		{`last(empty)`, nil},
+		{`last(s)`, "argument to `last` must be ARRAY, got STRING"},
+		{`rest(xs)`, []int64{2, 3}},
+		{`rest(rest(rest(xs)))`, []int64{}},
+		{`rest(empty)`, nil},
+		{`push(empty, 1)`, []int64{1}},
+		{`push(xs, 4)`, []int64{1, 2, 3, 4}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`let f = len; f(xs)`, 3},
+		{`let len = fn(x) { 42 }; len(xs)`, 42}, // Last: shadows len in env.
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalIn(t, tt.input, env)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		case []int64:
+			result, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(result.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(result.Elements))
+				continue
+			}
+			for i, expectedElem := range expected {
+				testIntegerObject(t, result.Elements[i], expectedElem)
+			}
+		}
+	}
+
+	// The builtins don't modify their arguments.
+	if got, _ := env.Get("xs"); got.Inspect() != "[1, 2, 3]" {
+		t.Errorf("xs modified: %s", got.Inspect())
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		isError  bool
+	}{
+		{`format("x = %d, name = %s", 5, "monkey")`, "x = 5, name = monkey", false},
+		{`format("no verbs")`, "no verbs", false},
+		{`format("100%%")`, "100%", false},
+		{`format("%5d|%-5d|%05d", 42, 42, 42)`, "   42|42   |00042", false},
+		{`format("%.2f %f %g", 3.14159, 2, 0.5)`, "3.14 2.000000 0.5", false},
+		{`format("%e", 1500.0)`, "1.500000e+03", false},
+		{`format("%t %t", true, 1 > 2)`, "true false", false},
+		{`format("%x %X %x", 255, 255, "hi")`, "ff FF 6869", false},
+		{`format("%q", "quoted")`, "\"quoted\"", false},
+		{`format("%s %v %s", [1, "a"], {"k": true}, fn(x) { x })`, "[1, a] {k: true} fn(x) { x }", false},
+		{`format("%4s|", "ab")`, "  ab|", false},
+		{`format("%d", "five")`, "format: %d needs INTEGER, got STRING", true},
+		{`format("%f", true)`, "format: %f needs INTEGER or FLOAT, got BOOLEAN", true},
+		{`format("%t", 1)`, "format: %t needs BOOLEAN, got INTEGER", true},
+		{`format("%d %d", 1)`, "format: missing argument for %d", true},
+		{`format("%d", 1, 2, 3)`, "format: 2 unused arguments", true},
+		{`format("%z", 1)`, "format: unknown verb %z", true},
+		{`format("50%")`, "format: missing verb at end of \"%\"", true},
+		{`format("%5")`, "format: missing verb at end of \"%5\"", true},
+		{`format()`, "wrong number of arguments. got=0, want at least 1", true},
+		{`format(1)`, "argument to `format` must be STRING, got INTEGER", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		if tt.isError {
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+			continue
+		}
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("format wrong for %q. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	return testEvalIn(t, input, object.NewEnvironment())
+}
+
+func testEvalIn(t *testing.T, input string, env *object.Environment) object.Object {
+	t.Helper()
+	return Eval(testParse(t, input), env)
+}
+
+func testParse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %q", input, p.Errors())
+	}
+
+	return program
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	t.Helper()
+
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	t.Helper()
+
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%v, want=%v",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	t.Helper()
+
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	t.Helper()
+
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+const benchmarkInput = `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(15)`
+
+func BenchmarkEval(b *testing.B) {
+	program := parser.New(lexer.New(benchmarkInput)).ParseProgram()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
+	}
+}
+
+func BenchmarkEvalHooks(b *testing.B) {
+	program := parser.New(lexer.New(benchmarkInput)).ParseProgram()
+	in := NewWithOptions(Options{Hooks: Hooks{
+		OnEnterNode: func(ast.Node, *object.Environment) {},
+		OnExitNode:  func(ast.Node, object.Object) {},
+		OnCall:      func(*ast.CallExpression, object.Object, []object.Object) {},
+	}})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in.Eval(program, object.NewEnvironment())
+	}
+}
@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// format formats args according to the printf-style format string f. Verbs
+// may carry the flags, width and precision Go's fmt accepts, and are
+// matched to the Monkey values they take:
+//
+//	%d     integers
+//	%f %e %g  integers and floats
+//	%t     booleans
+//	%x %X  integers and strings
+//	%q     strings, quoted
+//	%s %v  any value, as displayed by puts
+//	%%     a literal percent sign
+//
+// Unknown verbs, arguments of the wrong type and arguments left over or
+// missing are errors.
+func format(f string, args []object.Object) (string, *object.Error) {
+	var out strings.Builder
+	argNum := 0
+
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			out.WriteByte(f[i])
+			continue
+		}
+
+		start := i
+		i++
+		for i < len(f) && strings.IndexByte("+-# 0123456789.", f[i]) >= 0 {
+			i++
+		}
+		if i == len(f) {
+			return "", newError("format: missing verb at end of %q", f[start:])
+		}
+		spec, verb := f[start:i+1], f[i]
+
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if argNum == len(args) {
+			return "", newError("format: missing argument for %s", spec)
+		}
+		arg := args[argNum]
+		argNum++
+
+		value, err := formatValue(spec, verb, arg)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, spec, value)
+	}
+
+	if argNum < len(args) {
+		return "", newError("format: %d unused arguments", len(args)-argNum)
+	}
+	return out.String(), nil
+}
+
+// formatValue returns the Go value that the verb of spec formats arg as.
+func formatValue(spec string, verb byte, arg object.Object) (interface{}, *object.Error) {
+	var want string
+	switch verb {
+	case 'd':
+		if arg, ok := arg.(*object.Integer); ok {
+			return arg.Value, nil
+		}
+		want = "INTEGER"
+	case 'f', 'e', 'g':
+		if isNumber(arg) {
+			return toFloat(arg), nil
+		}
+		want = "INTEGER or FLOAT"
+	case 't':
+		if arg, ok := arg.(*object.Boolean); ok {
+			return arg.Value, nil
+		}
+		want = "BOOLEAN"
+	case 'x', 'X':
+		switch arg := arg.(type) {
+		case *object.Integer:
+			return arg.Value, nil
+		case *object.String:
+			return arg.Value, nil
+		}
+		want = "INTEGER or STRING"
+	case 'q':
+		if arg, ok := arg.(*object.String); ok {
+			return arg.Value, nil
+		}
+		want = "STRING"
+	case 's', 'v':
+		return arg.Inspect(), nil
+	default:
+		return nil, newError("format: unknown verb %s", spec)
+	}
+	return nil, newError("format: %s needs %s, got %s", spec, want, arg.Type())
+}
@@ -0,0 +1,70 @@
+package evaluator
+
+import (
+	"os"
+	"sort"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// capabilities are the builtins that give access to the world outside the
+// Interpreter, by the name of the capability that enables them. An
+// Interpreter only has those enabled in its Options.
+var capabilities = map[string]map[string]object.BuiltinFunction{
+	"fs": {
+		"readFile":  readFile,
+		"writeFile": writeFile,
+		"listDir":   listDir,
+	},
+}
+
+// readFile implements `readFile(path)`, which returns the contents of the
+// file.
+func readFile(args ...object.Object) object.Object {
+	strs, err := stringArguments("readFile", 1, args)
+	if err != nil {
+		return err
+	}
+	data, rerr := os.ReadFile(strs[0])
+	if rerr != nil {
+		return newError("readFile: %s", rerr)
+	}
+	return &object.String{Value: string(data)}
+}
+
+// writeFile implements `writeFile(path, contents)`, which creates or
+// truncates the file and writes contents to it.
+func writeFile(args ...object.Object) object.Object {
+	strs, err := stringArguments("writeFile", 2, args)
+	if err != nil {
+		return err
+	}
+	if werr := os.WriteFile(strs[0], []byte(strs[1]), 0o666); werr != nil {
+		return newError("writeFile: %s", werr)
+	}
+	return NULL
+}
+
+// listDir implements `listDir(path)`, which returns the names of the
+// entries of the directory, sorted.
+func listDir(args ...object.Object) object.Object {
+	strs, err := stringArguments("listDir", 1, args)
+	if err != nil {
+		return err
+	}
+	entries, rerr := os.ReadDir(strs[0])
+	if rerr != nil {
+		return newError("listDir: %s", rerr)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	sort.Strings(names)
+
+	elements := make([]object.Object, len(names))
+	for i, name := range names {
+		elements[i] = &object.String{Value: name}
+	}
+	return &object.Array{Elements: elements}
+}
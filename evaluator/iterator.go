@@ -0,0 +1,156 @@
+package evaluator
+
+import (
+	"github.com/j4nu5/monkey/object"
+)
+
+// iterate returns an iterator over the elements of an array, the keys of a
+// hash or the values of an iterator, which is returned as it is. A function
+// is a generator: the iterator calls it without arguments for each value,
+// and it returns the value and whether it is done, as in `return x, false`.
+func (in *Interpreter) iterate(name string, obj object.Object) (*object.Iterator, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Iterator:
+		return obj, nil
+	case *object.Array:
+		return sliceIterator(obj.Elements), nil
+	case *object.Hash:
+		keys := make([]object.Object, 0, len(obj.Pairs))
+		for _, pair := range obj.Ordered() {
+			keys = append(keys, pair.Key)
+		}
+		return sliceIterator(keys), nil
+	}
+	if !isCallable(obj) {
+		return nil, newError("argument to `%s` must be ARRAY, HASH, ITERATOR or FUNCTION, got %s",
+			name, obj.Type())
+	}
+
+	done := false
+	return &object.Iterator{Next: func() (object.Object, bool) {
+		if done {
+			return nil, false
+		}
+		result := in.applyFunction(obj, nil)
+		if isError(result) {
+			return result, true
+		}
+		pair, ok := result.(*object.Array)
+		if !ok || len(pair.Elements) != 2 || pair.Elements[1].Type() != object.BOOLEAN_OBJ {
+			done = true
+			return newError("generator must return a value and a boolean, got %s", result.Inspect()), true
+		}
+		if pair.Elements[1] == TRUE {
+			done = true
+			return nil, false
+		}
+		return pair.Elements[0], true
+	}}, nil
+}
+
+// sliceIterator returns an iterator over elems.
+func sliceIterator(elems []object.Object) *object.Iterator {
+	i := 0
+	return &object.Iterator{Next: func() (object.Object, bool) {
+		if i == len(elems) {
+			return nil, false
+		}
+		i++
+		return elems[i-1], true
+	}}
+}
+
+// iter implements `iter(x)`, which returns an iterator over x as described
+// by iterate.
+func (in *Interpreter) iter(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	it, err := in.iterate("iter", args[0])
+	if err != nil {
+		return err
+	}
+	return it
+}
+
+// next implements `next(it)`, which advances the iterator it and returns
+// the next value and false, or null and true if there are no more, so that
+// `let value, done = next(it);` takes a value.
+func next(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	it, ok := args[0].(*object.Iterator)
+	if !ok {
+		return newError("argument to `next` must be ITERATOR, got %s",
+			args[0].Type())
+	}
+	val, ok := it.Next()
+	if !ok {
+		return &object.Array{Elements: []object.Object{NULL, TRUE}}
+	}
+	if isError(val) {
+		return val
+	}
+	return &object.Array{Elements: []object.Object{val, FALSE}}
+}
+
+// take implements `take(x, n)`, which returns an iterator over the first n
+// values of x, at most, taking them from x only as they are needed.
+func (in *Interpreter) take(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	it, err := in.iterate("take", args[0])
+	if err != nil {
+		return err
+	}
+	n, ok := args[1].(*object.Integer)
+	if !ok {
+		return newError("argument to `take` must be INTEGER, got %s",
+			args[1].Type())
+	}
+	if n.Value < 0 {
+		return newError("argument to `take` must not be negative, got %d", n.Value)
+	}
+
+	left := n.Value
+	return &object.Iterator{Next: func() (object.Object, bool) {
+		if left == 0 {
+			return nil, false
+		}
+		left--
+		return it.Next()
+	}}
+}
+
+// collect implements `collect(x)`, which returns an array of the values of
+// x, running an iterator to its end.
+func (in *Interpreter) collect(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	it, err := in.iterate("collect", args[0])
+	if err != nil {
+		return err
+	}
+
+	elements := []object.Object{}
+	for {
+		if err := in.interrupted(); err != nil {
+			return err
+		}
+		val, ok := it.Next()
+		if !ok {
+			return &object.Array{Elements: elements}
+		}
+		if isError(val) {
+			return val
+		}
+		elements = append(elements, val)
+	}
+}
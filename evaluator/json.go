@@ -0,0 +1,207 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// jsonEncode implements `jsonEncode(value, indent)`, which returns value as
+// JSON text. Only null, booleans, numbers, strings, arrays and hashes with
+// string keys can be encoded; the keys of a hash are written in its
+// order. If indent is given, each element begins on a new line, indented
+// by it once per level of nesting.
+func jsonEncode(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, args[0]); err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return &object.String{Value: buf.String()}
+	}
+
+	indent, ok := args[1].(*object.String)
+	if !ok {
+		return newError("argument to `jsonEncode` must be STRING, got %s",
+			args[1].Type())
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", indent.Value); err != nil {
+		return newError("jsonEncode: %s", err)
+	}
+	return &object.String{Value: out.String()}
+}
+
+func encodeJSON(buf *bytes.Buffer, obj object.Object) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Null:
+		buf.WriteString("null")
+	case *object.Boolean:
+		buf.WriteString(strconv.FormatBool(obj.Value))
+	case *object.Integer:
+		buf.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *object.Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return newError("jsonEncode: cannot encode %s", obj.Inspect())
+		}
+		// Inspect keeps a decimal point, so that the number decodes as
+		// a float again.
+		buf.WriteString(obj.Inspect())
+	case *object.String:
+		encodeJSONString(buf, obj.Value)
+	case *object.Array:
+		buf.WriteByte('[')
+		for i, elem := range obj.Elements {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSON(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case *object.Hash:
+		pairs := obj.Ordered()
+		for _, pair := range pairs {
+			if _, ok := pair.Key.(*object.String); !ok {
+				return newError("jsonEncode: hash keys must be STRING, got %s",
+					pair.Key.Type())
+			}
+		}
+
+		buf.WriteByte('{')
+		for i, pair := range pairs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			encodeJSONString(buf, pair.Key.(*object.String).Value)
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, pair.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return newError("jsonEncode: cannot encode %s", obj.Type())
+	}
+	return nil
+}
+
+// encodeJSONString writes s as a JSON string. Unlike json.Marshal, it
+// leaves <, > and & alone, since the text isn't meant for HTML.
+func encodeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // Encode ends the value with a newline.
+}
+
+// jsonDecode implements `jsonDecode(text)`, which returns the value of the
+// JSON text: objects become hashes and numbers become integers, unless they
+// have a fraction or exponent or don't fit in one, in which case they
+// become floats.
+func jsonDecode(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	text, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `jsonDecode` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	dec := json.NewDecoder(strings.NewReader(text.Value))
+	dec.UseNumber()
+	value := decodeJSON(dec)
+	if isError(value) {
+		return value
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return newError("jsonDecode: invalid data after top-level value")
+	}
+	return value
+}
+
+// decodeJSON returns the value of the next JSON value read from dec, which
+// yields numbers as json.Number. Objects become hashes with their keys in
+// the order of the text, and numbers too large for a float are errors.
+func decodeJSON(dec *json.Decoder) object.Object {
+	tok, err := dec.Token()
+	if err != nil {
+		return jsonDecodeError(err)
+	}
+
+	switch tok := tok.(type) {
+	case nil:
+		return NULL
+	case bool:
+		return nativeBoolToBooleanObject(tok)
+	case json.Number:
+		if !strings.ContainsAny(string(tok), ".eE") {
+			if i, err := tok.Int64(); err == nil {
+				return object.NewInteger(i)
+			}
+		}
+		f, err := tok.Float64()
+		if err != nil {
+			return newError("jsonDecode: number %s out of range", tok)
+		}
+		return &object.Float{Value: f}
+	case string:
+		return &object.String{Value: tok}
+	case json.Delim:
+		var result object.Object
+		if tok == '[' {
+			elements := []object.Object{}
+			for dec.More() {
+				elem := decodeJSON(dec)
+				if isError(elem) {
+					return elem
+				}
+				elements = append(elements, elem)
+			}
+			result = &object.Array{Elements: elements}
+		} else {
+			hash := object.NewHash()
+			for dec.More() {
+				key := decodeJSON(dec) // Always a string: Token checks the syntax.
+				if isError(key) {
+					return key
+				}
+				value := decodeJSON(dec)
+				if isError(value) {
+					return value
+				}
+				hash.Set(key, value)
+			}
+			result = hash
+		}
+		// The closing delimiter.
+		if _, err := dec.Token(); err != nil {
+			return jsonDecodeError(err)
+		}
+		return result
+	}
+	panic(fmt.Sprintf("jsonDecode: unexpected %T", tok))
+}
+
+// jsonDecodeError returns the error jsonDecode reports for err, returned by
+// the decoder.
+func jsonDecodeError(err error) *object.Error {
+	if err == io.EOF {
+		return newError("jsonDecode: unexpected end of JSON input")
+	}
+	return newError("jsonDecode: %s", err)
+}
@@ -0,0 +1,162 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/ast/build"
+	"github.com/j4nu5/monkey/object"
+)
+
+// quote evaluates `quote(node)`: it returns a copy of node in which every
+// unquote has been replaced by the code for the value of its expression.
+func (in *Interpreter) quote(node ast.Node, env *object.Environment) object.Object {
+	var err object.Object
+	node = ast.Apply(ast.Copy(node), func(c *ast.Cursor) bool {
+		unquote, ok := c.Node().(*ast.UnquoteExpression)
+		if !ok || err != nil {
+			return err == nil
+		}
+
+		val := in.Eval(unquote.Node, env)
+		if isError(val) {
+			err = val
+			return false
+		}
+		expr, ok := valueToExpression(val)
+		if !ok {
+			err = newError("cannot unquote %s", val.Type())
+			return false
+		}
+		c.Replace(expr)
+		return false
+	}, nil)
+
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// valueToExpression returns the code for val, and whether there is any.
+// Quotes stand for the code they hold.
+func valueToExpression(val object.Object) (ast.Expression, bool) {
+	switch val := val.(type) {
+	case *object.Integer:
+		return build.Int(val.Value), true
+	case *object.Float:
+		return build.Float(val.Value), true
+	case *object.String:
+		return build.Str(val.Value), true
+	case *object.Boolean:
+		return build.Bool(val.Value), true
+	case *object.Array:
+		elems := make([]ast.Expression, len(val.Elements))
+		for i, elem := range val.Elements {
+			expr, ok := valueToExpression(elem)
+			if !ok {
+				return nil, false
+			}
+			elems[i] = expr
+		}
+		return build.Array(elems...), true
+	case *object.Quote:
+		// The same quote may be unquoted more than once.
+		expr, ok := ast.Copy(val.Node).(ast.Expression)
+		return expr, ok
+	}
+	return nil, false
+}
+
+// DefineMacros removes the top-level let statements binding macro literals
+// from program and binds the macros in env instead, for ExpandMacros to
+// expand calls to them. Macro literals anywhere else are errors when
+// evaluated.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	stmts := program.Statements[:0]
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			stmts = append(stmts, stmt)
+			continue
+		}
+		macro, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			stmts = append(stmts, stmt)
+			continue
+		}
+		env.Set(let.Name.Value, &object.Macro{
+			Parameters: macro.Parameters,
+			Body:       macro.Body,
+			Env:        env,
+		})
+	}
+	program.Statements = stmts
+}
+
+// ExpandMacros expands the calls in program to the macros bound in env
+// with a new Interpreter. See Interpreter.ExpandMacros.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	return New().ExpandMacros(program, env)
+}
+
+// ExpandMacros replaces every call in program to a macro bound in env,
+// typically by DefineMacros, with the code the macro returns: its body is
+// evaluated with its parameters bound to its arguments as quotes, and must
+// return a quote. Calls to macros in the code returned are expanded in
+// turn. ExpandMacros modifies program in place and returns it. It stops at
+// the first macro that fails, returning an error giving the position of
+// the call.
+func (in *Interpreter) ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+	expanded := ast.Apply(program, func(c *ast.Cursor) bool {
+		call, ok := c.Node().(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+		macro, ok := macroOf(call, env)
+		if !ok {
+			return true
+		}
+
+		macroEnv := object.NewEnclosedEnvironment(macro.Env)
+		for i, param := range macro.Parameters {
+			var arg object.Object = NULL
+			if i < len(call.Arguments) {
+				arg = &object.Quote{Node: call.Arguments[i]}
+			}
+			macroEnv.Set(param.Value, arg)
+		}
+
+		result := unwrapReturnValue(in.Eval(macro.Body, macroEnv))
+		if errObj, ok := result.(*object.Error); ok {
+			err = fmt.Errorf("%s: %s", call.Pos(), errObj.Message)
+			return false
+		}
+		quote, ok := result.(*object.Quote)
+		if !ok {
+			err = fmt.Errorf("%s: macro %s returned %s, not a quote", call.Pos(), call.Function, result.Type())
+			return false
+		}
+		c.Replace(quote.Node)
+		return true
+	}, func(*ast.Cursor) bool {
+		return err == nil
+	})
+	return expanded, err
+}
+
+// macroOf returns the macro call calls, if its function is the name of one
+// bound in env.
+func macroOf(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
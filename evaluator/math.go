@@ -0,0 +1,164 @@
+package evaluator
+
+import (
+	"math"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// constants are the values predefined in every program. Like builtins,
+// they are shadowed by bindings in the environment.
+var constants = map[string]object.Object{
+	"pi": &object.Float{Value: math.Pi},
+	"e":  &object.Float{Value: math.E},
+}
+
+// numberArgument checks that arg, the argument to the builtin called name,
+// is an integer or a float.
+func numberArgument(name string, arg object.Object) *object.Error {
+	if !isNumber(arg) {
+		return newError("argument to `%s` must be INTEGER or FLOAT, got %s",
+			name, arg.Type())
+	}
+	return nil
+}
+
+// abs implements `abs(x)`, which keeps the type of x.
+func abs(arg object.Object) object.Object {
+	switch arg := arg.(type) {
+	case *object.Integer:
+		if arg.Value == math.MinInt64 {
+			return newError("integer overflow: abs(%d)", arg.Value)
+		}
+		if arg.Value < 0 {
+			return object.NewInteger(-arg.Value)
+		}
+		return arg
+	case *object.Float:
+		return &object.Float{Value: math.Abs(arg.Value)}
+	default:
+		return numberArgument("abs", arg)
+	}
+}
+
+// extremum implements `min(values...)` and `max(values...)`, which also
+// accept a single array of the values. It returns the least value if max is
+// false and the greatest otherwise; of equal values, the first one.
+func extremum(name string, max bool, args []object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want at least 1")
+	}
+	if arr, ok := args[0].(*object.Array); ok && len(args) == 1 {
+		if len(arr.Elements) == 0 {
+			return newError("`%s` of empty array", name)
+		}
+		args = arr.Elements
+	}
+
+	result := args[0]
+	for _, arg := range args {
+		if err := numberArgument(name, arg); err != nil {
+			return err
+		}
+		if (!max && less(arg, result)) || (max && less(result, arg)) {
+			result = arg
+		}
+	}
+	return result
+}
+
+// less reports whether the number a is less than the number b, comparing
+// integers exactly.
+func less(a, b object.Object) bool {
+	if a, ok := a.(*object.Integer); ok {
+		if b, ok := b.(*object.Integer); ok {
+			return a.Value < b.Value
+		}
+	}
+	return toFloat(a) < toFloat(b)
+}
+
+// pow implements `pow(x, y)`. An integer raised to a non-negative integer
+// is an integer, checked for overflow; otherwise the result is a float.
+func pow(x, y object.Object) object.Object {
+	if err := numberArgument("pow", x); err != nil {
+		return err
+	}
+	if err := numberArgument("pow", y); err != nil {
+		return err
+	}
+
+	base, ok1 := x.(*object.Integer)
+	exp, ok2 := y.(*object.Integer)
+	if !ok1 || !ok2 || exp.Value < 0 {
+		return &object.Float{Value: math.Pow(toFloat(x), toFloat(y))}
+	}
+
+	result, b := int64(1), base.Value
+	for e := exp.Value; e > 0; e >>= 1 {
+		var ok bool
+		if e&1 == 1 {
+			if result, ok = mulInt(result, b); !ok {
+				return newError("integer overflow: pow(%d, %d)", base.Value, exp.Value)
+			}
+		}
+		if e > 1 {
+			if b, ok = mulInt(b, b); !ok {
+				return newError("integer overflow: pow(%d, %d)", base.Value, exp.Value)
+			}
+		}
+	}
+	return object.NewInteger(result)
+}
+
+// sqrt implements `sqrt(x)`, which is a float. Negative numbers are errors
+// rather than NaN.
+func sqrt(arg object.Object) object.Object {
+	if err := numberArgument("sqrt", arg); err != nil {
+		return err
+	}
+	x := toFloat(arg)
+	if x < 0 {
+		return newError("sqrt of negative number: %s", arg.Inspect())
+	}
+	return &object.Float{Value: math.Sqrt(x)}
+}
+
+// round implements `floor(x)` and `ceil(x)`, which round x with f and
+// yield an integer, so that the result can be used as an index.
+func round(name string, f func(float64) float64, arg object.Object) object.Object {
+	switch arg := arg.(type) {
+	case *object.Integer:
+		return arg
+	case *object.Float:
+		r := f(arg.Value)
+		if math.IsNaN(r) || r < math.MinInt64 || r >= math.MaxInt64 {
+			return newError("%s: %s out of range", name, arg.Inspect())
+		}
+		return object.NewInteger(int64(r))
+	default:
+		return numberArgument(name, arg)
+	}
+}
+
+// random implements `random()`, which returns a float in [0, 1), and
+// `random(n)`, which returns an integer in [0, n).
+func (in *Interpreter) random(args ...object.Object) object.Object {
+	switch len(args) {
+	case 0:
+		return &object.Float{Value: in.opts.Rand.Float64()}
+	case 1:
+		n, ok := args[0].(*object.Integer)
+		if !ok {
+			return newError("argument to `random` must be INTEGER, got %s",
+				args[0].Type())
+		}
+		if n.Value <= 0 {
+			return newError("argument to `random` must be positive, got %d", n.Value)
+		}
+		return object.NewInteger(in.opts.Rand.Int63n(n.Value))
+	default:
+		return newError("wrong number of arguments. got=%d, want=0 or 1",
+			len(args))
+	}
+}
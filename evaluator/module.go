@@ -0,0 +1,177 @@
+package evaluator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/parser"
+	"github.com/j4nu5/monkey/token"
+)
+
+// moduleExt is the extension of module files, which import paths may leave
+// out.
+const moduleExt = ".monkey"
+
+// evalImportStatement binds the name of the module node imports to its
+// exports.
+func (in *Interpreter) evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	name := node.Name()
+	if !isIdentifier(name) {
+		return newError("import %q: module name %q is not an identifier", node.Path.Value, name)
+	}
+
+	exports := in.importModule(node.Path.Value, node.Pos().Filename)
+	if isError(exports) {
+		return exports
+	}
+	env.Set(name, exports)
+	return nil
+}
+
+// importModule returns the exports of the module at path, imported by the
+// file importer, evaluating the module if this is its first import.
+func (in *Interpreter) importModule(path, importer string) object.Object {
+	file, err := in.findModule(path, importer)
+	if err != nil {
+		return newError("import %q: %s", path, err)
+	}
+
+	if exports, ok := in.modules[file]; ok {
+		if exports == nil {
+			return newError("import %q: import cycle: %s", path, in.importCycle(file))
+		}
+		return exports
+	}
+
+	f, err := openModule(file)
+	if err != nil {
+		return newError("import %q: %s", path, err)
+	}
+	program, err := parser.ParseFile(file, f)
+	f.Close()
+	if err != nil {
+		return newError("import %q: %s", path, err)
+	}
+
+	if in.modules == nil {
+		in.modules = make(map[string]*object.Hash)
+	}
+	in.modules[file] = nil
+	in.importing = append(in.importing, file)
+	defer func() { in.importing = in.importing[:len(in.importing)-1] }()
+
+	env := object.NewEnvironment()
+	if result := in.Eval(program, env); isError(result) {
+		// Forget the failed evaluation, so that the next import tries
+		// again.
+		delete(in.modules, file)
+		return result
+	}
+
+	exports := object.NewHash()
+	for _, name := range exportedNames(program) {
+		val, ok := env.Get(name)
+		if !ok {
+			continue
+		}
+		exports.Set(&object.String{Value: name}, val)
+	}
+	in.modules[file] = exports
+	return exports
+}
+
+// findModule returns the absolute name of the file path refers to when
+// imported by the file importer. A relative path is looked up in the
+// directory of importer, or the current directory if importer is unnamed,
+// and then in each directory of the ModulePath. Paths starting with
+// stdPrefix refer to the standard library instead, and findModule returns
+// the path of the module with its extension.
+func (in *Interpreter) findModule(path, importer string) (string, error) {
+	if strings.HasPrefix(path, stdPrefix) {
+		if file, ok := findStdModule(path); ok {
+			return file, nil
+		}
+		return "", fmt.Errorf("module not found")
+	}
+
+	file := filepath.FromSlash(path)
+	if filepath.Ext(file) != moduleExt {
+		file += moduleExt
+	}
+
+	candidates := []string{file}
+	if !filepath.IsAbs(file) {
+		candidates[0] = filepath.Join(filepath.Dir(importer), file)
+		for _, dir := range in.opts.ModulePath {
+			candidates = append(candidates, filepath.Join(dir, file))
+		}
+	}
+
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		return filepath.Abs(candidate)
+	}
+	return "", fmt.Errorf("module not found")
+}
+
+// importCycle describes the chain of imports from file back to itself.
+func (in *Interpreter) importCycle(file string) string {
+	var chain []string
+	for i := len(in.importing) - 1; i >= 0; i-- {
+		chain = append([]string{filepath.Base(in.importing[i])}, chain...)
+		if in.importing[i] == file {
+			break
+		}
+	}
+	chain = append(chain, filepath.Base(file))
+	return strings.Join(chain, " -> ")
+}
+
+// exportedNames returns the names a module exports: those bound by its
+// top-level let and const statements, except for names starting with an
+// underscore, which are private to the module.
+func exportedNames(program *ast.Program) []string {
+	var names []string
+	for _, stmt := range program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			if len(stmt.Names) > 0 {
+				for _, name := range stmt.Names {
+					names = append(names, name.Value)
+				}
+			} else {
+				names = append(names, stmt.Name.Value)
+			}
+		case *ast.ConstStatement:
+			names = append(names, stmt.Name.Value)
+		}
+	}
+
+	exported := names[:0]
+	for _, name := range names {
+		if !strings.HasPrefix(name, "_") {
+			exported = append(exported, name)
+		}
+	}
+	return exported
+}
+
+// isIdentifier reports whether name could be written as an identifier.
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+	for _, ch := range name {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
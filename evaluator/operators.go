@@ -0,0 +1,35 @@
+package evaluator
+
+import "github.com/j4nu5/monkey/object"
+
+// The functions below apply operators to values as Eval does, so that
+// other engines, such as the vm package, share the evaluator's semantics.
+// They report failures by returning an *object.Error.
+
+// Infix returns the value of `left operator right` for the infix operators
+// that evaluate both operands, i.e. all but &&, || and ??.
+func Infix(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(nil, operator, left, right)
+}
+
+// InfixWithPool is like Infix, except that the integers it computes come
+// from pool.
+func InfixWithPool(pool *object.IntegerPool, operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(pool, operator, left, right)
+}
+
+// Prefix returns the value of `operator right`.
+func Prefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(nil, operator, right)
+}
+
+// PrefixWithPool is like Prefix, except that the integers it computes come
+// from pool.
+func PrefixWithPool(pool *object.IntegerPool, operator string, right object.Object) object.Object {
+	return evalPrefixExpression(pool, operator, right)
+}
+
+// Index returns the value of `left[index]`.
+func Index(left, index object.Object) object.Object {
+	return (&Interpreter{}).evalIndexExpression(left, index)
+}
@@ -0,0 +1,95 @@
+package evaluator
+
+import (
+	"regexp"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// maxRegexps is the number of compiled patterns an Interpreter keeps. When
+// a new pattern would exceed it, the cache starts over.
+const maxRegexps = 64
+
+// regexpArguments checks that args, the arguments to the builtin called
+// name, are n strings, the first of which is a pattern. It returns the
+// compiled pattern and the remaining strings.
+func (in *Interpreter) regexpArguments(name string, n int, args []object.Object) (*regexp.Regexp, []string, *object.Error) {
+	strs, err := stringArguments(name, n, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	re, ok := in.regexps[strs[0]]
+	if !ok {
+		var cerr error
+		re, cerr = regexp.Compile(strs[0])
+		if cerr != nil {
+			return nil, nil, newError("%s: %s", name, cerr)
+		}
+		if in.regexps == nil || len(in.regexps) >= maxRegexps {
+			in.regexps = make(map[string]*regexp.Regexp)
+		}
+		in.regexps[strs[0]] = re
+	}
+	return re, strs[1:], nil
+}
+
+// reMatch implements `reMatch(pattern, s)`, which reports whether s
+// contains a match of pattern.
+func (in *Interpreter) reMatch(args ...object.Object) object.Object {
+	re, strs, err := in.regexpArguments("reMatch", 2, args)
+	if err != nil {
+		return err
+	}
+	return nativeBoolToBooleanObject(re.MatchString(strs[0]))
+}
+
+// reFind implements `reFind(pattern, s)`, which returns the leftmost match
+// of pattern in s followed by the text of its groups, null for those that
+// didn't take part in the match. If there is no match, it returns null.
+func (in *Interpreter) reFind(args ...object.Object) object.Object {
+	re, strs, err := in.regexpArguments("reFind", 2, args)
+	if err != nil {
+		return err
+	}
+	loc := re.FindStringSubmatchIndex(strs[0])
+	if loc == nil {
+		return NULL
+	}
+
+	elements := make([]object.Object, len(loc)/2)
+	for i := range elements {
+		if loc[2*i] < 0 {
+			elements[i] = NULL
+			continue
+		}
+		elements[i] = &object.String{Value: strs[0][loc[2*i]:loc[2*i+1]]}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// reReplace implements `reReplace(pattern, s, replacement)`, which replaces
+// every match of pattern in s. In replacement, $1 or $name stands for the
+// text of a group; "${...}" would be interpolated by the string literal.
+func (in *Interpreter) reReplace(args ...object.Object) object.Object {
+	re, strs, err := in.regexpArguments("reReplace", 3, args)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: re.ReplaceAllString(strs[0], strs[1])}
+}
+
+// reSplit implements `reSplit(pattern, s)`, which returns the pieces of s
+// between the matches of pattern.
+func (in *Interpreter) reSplit(args ...object.Object) object.Object {
+	re, strs, err := in.regexpArguments("reSplit", 2, args)
+	if err != nil {
+		return err
+	}
+	pieces := re.Split(strs[0], -1)
+	elements := make([]object.Object, len(pieces))
+	for i, piece := range pieces {
+		elements[i] = &object.String{Value: piece}
+	}
+	return &object.Array{Elements: elements}
+}
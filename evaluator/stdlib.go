@@ -0,0 +1,61 @@
+package evaluator
+
+import (
+	"embed"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// stdPrefix starts the import paths of the modules of the standard library,
+// which is written in Monkey and embedded in the evaluator rather than read
+// from files: `import "std/lists";` imports stdlib/lists.monkey.
+const stdPrefix = "std/"
+
+//go:embed stdlib/*.monkey
+var stdlib embed.FS
+
+// LoadPrelude binds the exports of every module of the standard library in
+// env, so that programs evaluated in it can use them without importing
+// them. As with imports, each module is only evaluated once per
+// Interpreter. LoadPrelude returns an *object.Error if evaluating a module
+// failed, such as when the StepBudget ran out, and nil otherwise.
+func (in *Interpreter) LoadPrelude(env *object.Environment) object.Object {
+	files, _ := fs.Glob(stdlib, "stdlib/*"+moduleExt)
+	for _, file := range files {
+		exports := in.importModule(stdPrefix+path.Base(file), "")
+		if isError(exports) {
+			return exports
+		}
+		for _, pair := range exports.(*object.Hash).Pairs {
+			env.Set(pair.Key.(*object.String).Value, pair.Value)
+		}
+	}
+	return nil
+}
+
+// findStdModule returns the name of the module of the standard library at
+// the import path p, which starts with stdPrefix, and whether it exists.
+func findStdModule(p string) (string, bool) {
+	name := strings.TrimPrefix(p, stdPrefix)
+	if path.Ext(name) != moduleExt {
+		name += moduleExt
+	}
+	info, err := fs.Stat(stdlib, "stdlib/"+name)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	return stdPrefix + name, true
+}
+
+// openModule opens the module file found by findModule.
+func openModule(file string) (io.ReadCloser, error) {
+	if strings.HasPrefix(file, stdPrefix) {
+		return stdlib.Open("stdlib/" + strings.TrimPrefix(file, stdPrefix))
+	}
+	return os.Open(file)
+}
@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"math"
+	"time"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// A Clock tells the time for the now and sleep builtins. Tests can use one
+// that doesn't follow the real time, so that programs using them behave the
+// same on every run.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock following the real time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// now implements `now()`, which returns the current time in milliseconds
+// since the Unix epoch.
+func (in *Interpreter) now(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0",
+			len(args))
+	}
+	return object.NewInteger(in.opts.Clock.Now().UnixMilli())
+}
+
+// sleep implements `sleep(ms)`, which waits for ms milliseconds. If the
+// context of EvalContext is done before then, it stops evaluation like
+// the context being done does anywhere else.
+func (in *Interpreter) sleep(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	ms, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("argument to `sleep` must be INTEGER, got %s",
+			args[0].Type())
+	}
+	if ms.Value < 0 || ms.Value > math.MaxInt64/int64(time.Millisecond) {
+		return newError("sleep: %d out of range", ms.Value)
+	}
+
+	var done <-chan struct{}
+	if in.ctx != nil {
+		done = in.ctx.Done()
+	}
+	select {
+	case <-in.opts.Clock.After(time.Duration(ms.Value) * time.Millisecond):
+		return NULL
+	case <-done:
+		return in.interrupted()
+	}
+}
+
+// timeLayout returns the layout argument of formatTime or parseTime, which
+// is the optional argument after the first. Layouts are those of Go's time
+// package, and default to RFC 3339.
+func timeLayout(name string, args []object.Object) (string, *object.Error) {
+	if len(args) != 1 && len(args) != 2 {
+		return "", newError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+	if len(args) == 1 {
+		return time.RFC3339, nil
+	}
+	layout, ok := args[1].(*object.String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s",
+			name, args[1].Type())
+	}
+	return layout.Value, nil
+}
+
+// formatTime implements `formatTime(ms, layout)`, which formats the time
+// ms milliseconds after the Unix epoch, in UTC.
+func formatTime(args ...object.Object) object.Object {
+	layout, err := timeLayout("formatTime", args)
+	if err != nil {
+		return err
+	}
+	ms, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("argument to `formatTime` must be INTEGER, got %s",
+			args[0].Type())
+	}
+	return &object.String{Value: time.UnixMilli(ms.Value).UTC().Format(layout)}
+}
+
+// parseTime implements `parseTime(s, layout)`, which returns the time s
+// represents in milliseconds since the Unix epoch. Times without a zone are
+// taken to be in UTC.
+func parseTime(args ...object.Object) object.Object {
+	layout, err := timeLayout("parseTime", args)
+	if err != nil {
+		return err
+	}
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `parseTime` must be STRING, got %s",
+			args[0].Type())
+	}
+	t, perr := time.Parse(layout, s.Value)
+	if perr != nil {
+		return newError("parseTime: %s", perr)
+	}
+	return object.NewInteger(t.UnixMilli())
+}
@@ -2,8 +2,23 @@ package lexer
 
 import "github.com/j4nu5/monkey/token"
 
+// Mode controls optional lexer behaviour.
+type Mode uint
+
+const (
+	// ScanComments makes the lexer return `//` comments as token.COMMENT
+	// instead of skipping them like whitespace.
+	ScanComments Mode = 1 << iota
+)
+
 type Lexer struct {
-	input string
+	input    string
+	filename string
+	mode     Mode
+
+	// Line of `ch` and the offset at which that line starts.
+	line      int
+	lineStart int
 
 	// Current position in the input. Points to current character `ch`.
 	position int
@@ -13,10 +28,23 @@ type Lexer struct {
 
 	// Current character under examination. Corresponds to `position`.
 	ch byte
+
+	// One entry per `${` interpolation we are inside of, counting the braces
+	// opened within it so we know which `}` resumes the string.
+	interpolations []int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithMode(input, 0)
+}
+
+func NewWithMode(input string, mode Mode) *Lexer {
+	return NewFile("", input, mode)
+}
+
+// NewFile returns a lexer whose token positions carry filename.
+func NewFile(filename, input string, mode Mode) *Lexer {
+	l := &Lexer{input: input, filename: filename, mode: mode, line: 1}
 	l.readChar()
 	return l
 }
@@ -25,10 +53,21 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	pos := l.pos()
 
 	switch l.ch {
 	case '=':
-		tok = newToken(token.ASSIGN, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.EQ)
+		} else {
+			tok = newToken(token.ASSIGN, l.ch)
+		}
+	case '!':
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.NOT_EQ)
+		} else {
+			tok = newToken(token.BANG, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case '(':
@@ -37,23 +76,104 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
+	case '-':
+		tok = newToken(token.MINUS, l.ch)
+	case '*':
+		tok = newToken(token.ASTERISK, l.ch)
+	case '/':
+		if l.peekChar() == '/' {
+			comment := l.readComment()
+			if l.mode&ScanComments == 0 {
+				return l.NextToken()
+			}
+			return token.Token{Type: token.COMMENT, Literal: comment, Pos: pos}
+		}
+		tok = newToken(token.SLASH, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.newTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.newTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
+	case '?':
+		if l.peekChar() == '?' {
+			tok = l.newTwoCharToken(token.COALESCE)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '<':
+		if l.peekChar() == '<' {
+			tok = l.newTwoCharToken(token.LSHIFT)
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
+	case '>':
+		if l.peekChar() == '>' {
+			tok = l.newTwoCharToken(token.RSHIFT)
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1] == 0 {
+			tok = l.readInterpolationRest()
+			break
+		}
+		if n > 0 {
+			l.interpolations[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(2) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '"':
+		text, interpolated := l.readStringPart()
+		if interpolated {
+			l.interpolations = append(l.interpolations, 0)
+			tok = token.Token{Type: token.INTERP_START, Literal: text}
+		} else {
+			tok = token.Token{Type: token.STRING, Literal: text}
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
 		if isNumber(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -61,9 +181,19 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
+// pos returns the position of the current character.
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Line:     l.line,
+		Column:   l.position - l.lineStart + 1,
+	}
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
@@ -74,6 +204,14 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// newTwoCharToken consumes the current character and builds a token from it
+// and the one following it.
+func (l *Lexer) newTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
@@ -90,21 +228,91 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[start:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer, or a float if the digits are followed by a
+// dot and more digits. A dot not followed by a digit is left alone, so that
+// `1...` is an integer and an ellipsis.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	start := l.position
+	typ := token.INT
 	for isNumber(l.ch) {
 		l.readChar()
 	}
+	if l.ch == '.' && isNumber(l.peekChar()) {
+		typ = token.FLOAT
+		l.readChar()
+		for isNumber(l.ch) {
+			l.readChar()
+		}
+	}
+	return l.input[start:l.position], typ
+}
+
+// readComment reads a `//` comment up to, but not including, the end of the
+// line.
+func (l *Lexer) readComment() string {
+	start := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
 	return l.input[start:l.position]
 }
 
+// readStringPart reads string contents following the current character up
+// to either the closing quote or the start of an interpolation. It reports
+// which one it hit and leaves `ch` on the quote or on the `{` of `${`. An
+// unterminated string runs to the end of the input.
+func (l *Lexer) readStringPart() (string, bool) {
+	start := l.position + 1
+	for {
+		l.readChar()
+		if l.ch == '"' || l.ch == 0 {
+			return l.input[start:l.position], false
+		}
+		if l.ch == '$' && l.peekChar() == '{' {
+			text := l.input[start:l.position]
+			l.readChar()
+			return text, true
+		}
+	}
+}
+
+// readInterpolationRest continues an interpolated string after the `}`
+// closing one of its expressions.
+func (l *Lexer) readInterpolationRest() token.Token {
+	text, interpolated := l.readStringPart()
+	if interpolated {
+		return token.Token{Type: token.INTERP_MID, Literal: text}
+	}
+
+	l.interpolations = l.interpolations[:len(l.interpolations)-1]
+	return token.Token{Type: token.INTERP_END, Literal: text}
+}
+
+func (l *Lexer) peekChar() byte {
+	return l.peekCharAt(1)
+}
+
+// peekCharAt returns the character n positions after `ch` without consuming
+// anything.
+func (l *Lexer) peekCharAt(n int) byte {
+	if l.position+n >= len(l.input) {
+		return 0
+	}
+	return l.input[l.position+n]
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
-		return
+	} else {
+		l.ch = l.input[l.readPosition]
 	}
 
-	l.ch = l.input[l.readPosition]
 	l.position = l.readPosition
 	l.readPosition += 1
 }
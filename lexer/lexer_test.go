@@ -41,6 +41,44 @@ func TestNextTokenBasic(t *testing.T) {
 	}
 }
 
+func TestNumbers(t *testing.T) {
+	input := `5 3.14 0.5 10.0 1... 2.x 7.`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "10.0"},
+		{token.INT, "1"},
+		{token.ELLIPSIS, "..."},
+		{token.INT, "2"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type incorrect. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal incorrect. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
 func TestNextToken(t *testing.T) {
 	input := `let five = 5;
 		let ten = 10;
@@ -111,3 +149,298 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestNextTokenOperatorsAndKeywords(t *testing.T) {
+	input := `!-/*5;
+		5 < 10 > 5;
+
+		if (5 < 10) {
+			return true;
+		} else {
+			return false;
+		}
+
+		10 == 10;
+		10 != 9;
+		"foobar"
+		"foo bar"
+		[1, 2];
+		{"foo": "bar"}
+		f(args...)
+		while for in break continue index
+		end`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.BANG, "!"},
+		{token.MINUS, "-"},
+		{token.SLASH, "/"},
+		{token.ASTERISK, "*"},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "5"},
+		{token.LT, "<"},
+		{token.INT, "10"},
+		{token.GT, ">"},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IF, "if"},
+		{token.LPAREN, "("},
+		{token.INT, "5"},
+		{token.LT, "<"},
+		{token.INT, "10"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RETURN, "return"},
+		{token.TRUE, "true"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.ELSE, "else"},
+		{token.LBRACE, "{"},
+		{token.RETURN, "return"},
+		{token.FALSE, "false"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.INT, "10"},
+		{token.EQ, "=="},
+		{token.INT, "10"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "10"},
+		{token.NOT_EQ, "!="},
+		{token.INT, "9"},
+		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.IDENT, "args"},
+		{token.ELLIPSIS, "..."},
+		{token.RPAREN, ")"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.IDENT, "index"},
+		{token.IDENT, "end"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type incorrect. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal incorrect. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := `a % b & c | d ^ e << f >> g < h > i && j || k &&& l ?? m ? n`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "c"},
+		{token.PIPE, "|"},
+		{token.IDENT, "d"},
+		{token.CARET, "^"},
+		{token.IDENT, "e"},
+		{token.LSHIFT, "<<"},
+		{token.IDENT, "f"},
+		{token.RSHIFT, ">>"},
+		{token.IDENT, "g"},
+		{token.LT, "<"},
+		{token.IDENT, "h"},
+		{token.GT, ">"},
+		{token.IDENT, "i"},
+		{token.AND, "&&"},
+		{token.IDENT, "j"},
+		{token.OR, "||"},
+		{token.IDENT, "k"},
+		{token.AND, "&&"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "l"},
+		{token.COALESCE, "??"},
+		{token.IDENT, "m"},
+		{token.ILLEGAL, "?"},
+		{token.IDENT, "n"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type incorrect. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal incorrect. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 10 / 2; // trailing
+// last`
+
+	tests := []struct {
+		mode     Mode
+		expected []token.Token
+	}{
+		{0, []token.Token{
+			{Type: token.LET, Literal: "let"},
+			{Type: token.IDENT, Literal: "x"},
+			{Type: token.ASSIGN, Literal: "="},
+			{Type: token.INT, Literal: "10"},
+			{Type: token.SLASH, Literal: "/"},
+			{Type: token.INT, Literal: "2"},
+			{Type: token.SEMICOLON, Literal: ";"},
+			{Type: token.EOF, Literal: ""},
+		}},
+		{ScanComments, []token.Token{
+			{Type: token.COMMENT, Literal: "// leading"},
+			{Type: token.LET, Literal: "let"},
+			{Type: token.IDENT, Literal: "x"},
+			{Type: token.ASSIGN, Literal: "="},
+			{Type: token.INT, Literal: "10"},
+			{Type: token.SLASH, Literal: "/"},
+			{Type: token.INT, Literal: "2"},
+			{Type: token.SEMICOLON, Literal: ";"},
+			{Type: token.COMMENT, Literal: "// trailing"},
+			{Type: token.COMMENT, Literal: "// last"},
+			{Type: token.EOF, Literal: ""},
+		}},
+	}
+
+	for _, tt := range tests {
+		l := NewWithMode(input, tt.mode)
+
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("mode %d, tests[%d] - wrong token. expected=%+v, got=%+v",
+					tt.mode, i, expected, tok)
+			}
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x == \"a\"\n\n// note\n\tfoo"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"==", 2, 5},
+		{"a", 2, 8},
+		{"// note", 4, 1},
+		{"foo", 5, 2},
+		{"", 5, 5},
+	}
+
+	l := NewFile("script.monkey", input, ScanComments)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal incorrect. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		expected := token.Position{
+			Filename: "script.monkey",
+			Line:     tt.expectedLine,
+			Column:   tt.expectedColumn,
+		}
+		if tok.Pos != expected {
+			t.Errorf("tests[%d] - position of %q incorrect. expected=%s, got=%s",
+				i, tok.Literal, expected, tok.Pos)
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `"a ${x + 1} b ${ {"k": "${y}"}["k"] } c" "plain $ {}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERP_START, "a "},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.INTERP_MID, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.INTERP_START, ""},
+		{token.IDENT, "y"},
+		{token.INTERP_END, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.INTERP_END, " c"},
+		{token.STRING, "plain $ {}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type incorrect. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal incorrect. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var objectType = reflect.TypeOf((*Object)(nil)).Elem()
+
+// FromGo returns the Monkey value corresponding to the Go value v:
+//
+//   - nil and nil pointers, interfaces, slices and maps become null;
+//   - bools, integers, floats and strings become booleans, integers, floats
+//     and strings;
+//   - slices and arrays become arrays, and maps hashes, with their keys
+//     in sorted order;
+//   - structs become hashes from field names to field values, in the
+//     order of the fields, as for ToGo;
+//   - pointers and interfaces become the value they point to;
+//   - Objects are returned as they are.
+//
+// Anything else, including unsigned integers too large for an integer,
+// map keys that can't be hash keys and cyclic data, is an error.
+// Conversion copies: changes to the result don't affect v.
+func FromGo(v any) (Object, error) {
+	if v == nil {
+		return NULL, nil
+	}
+	return fromGo(reflect.ValueOf(v), 0)
+}
+
+// maxDepth bounds the nesting FromGo follows, to fail on cyclic data.
+const maxDepth = 1000
+
+func fromGo(v reflect.Value, depth int) (Object, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("object: cannot convert %s: nested too deeply", v.Type())
+	}
+	if v.Type().Implements(objectType) && v.Kind() != reflect.Interface {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if int64(u) < 0 {
+			return nil, fmt.Errorf("object: cannot convert %s %d: overflows INTEGER", v.Type(), u)
+		}
+		return NewInteger(int64(u)), nil
+
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			elem, err := fromGo(v.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return &Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		hash := &Hash{Pairs: make(map[HashKey]HashPair, v.Len())}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromGo(iter.Key(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value, err := fromGo(iter.Value(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if err := hash.Set(key, value); err != nil {
+				return nil, fmt.Errorf("object: %w", err)
+			}
+		}
+		hash.sort()
+		return hash, nil
+
+	case reflect.Struct:
+		hash := &Hash{Pairs: make(map[HashKey]HashPair)}
+		for _, f := range structFields(v.Type()) {
+			value, err := fromGo(v.Field(f.index), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&String{Value: f.name}, value)
+		}
+		return hash, nil
+
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromGo(v.Elem(), depth+1)
+	}
+
+	return nil, fmt.Errorf("object: cannot convert %s to a Monkey value", v.Type())
+}
+
+// ToGo stores the Go value corresponding to the Monkey value o in the value
+// target points to. Conversions are the reverse of FromGo's, checked
+// against the type of the target:
+//
+//   - booleans, integers, floats and strings convert to Go values of the
+//     same kind, integers also to floats; integers that don't fit are an
+//     error;
+//   - arrays convert to slices, and to Go arrays of the same length;
+//   - hashes convert to maps, and to structs, setting the fields whose
+//     names are keys of the hash;
+//   - null converts to the zero value of pointers, interfaces, slices and
+//     maps;
+//   - any value converts to an Object, unchanged, and to an empty
+//     interface, as int64, float64, bool, string, nil, []any or
+//     map[string]any, which requires string keys.
+//
+// A struct field's name is its Go name unless it has a tag such as
+// `monkey:"name"`; fields tagged `monkey:"-"` and unexported fields are
+// skipped.
+func ToGo(o Object, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("object: ToGo target must be a non-nil pointer, got %T", target)
+	}
+	return toGo(o, v.Elem())
+}
+
+func toGo(o Object, v reflect.Value) error {
+	t := v.Type()
+	if t == objectType {
+		v.Set(reflect.ValueOf(o))
+		return nil
+	}
+
+	if o == nil || o.Type() == NULL_OBJ {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		return convertError(o, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			break
+		}
+		value, err := natural(o)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(&value).Elem())
+		return nil
+
+	case reflect.Pointer:
+		elem := reflect.New(t.Elem())
+		if err := toGo(o, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+
+	case reflect.Bool:
+		if b, ok := o.(*Boolean); ok {
+			v.SetBool(b.Value)
+			return nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := o.(*Integer); ok {
+			if v.OverflowInt(i.Value) {
+				return fmt.Errorf("object: cannot convert %d to %s: out of range", i.Value, t)
+			}
+			v.SetInt(i.Value)
+			return nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := o.(*Integer); ok {
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return fmt.Errorf("object: cannot convert %d to %s: out of range", i.Value, t)
+			}
+			v.SetUint(uint64(i.Value))
+			return nil
+		}
+
+	case reflect.Float32, reflect.Float64:
+		switch n := o.(type) {
+		case *Integer:
+			v.SetFloat(float64(n.Value))
+			return nil
+		case *Float:
+			v.SetFloat(n.Value)
+			return nil
+		}
+
+	case reflect.String:
+		if s, ok := o.(*String); ok {
+			v.SetString(s.Value)
+			return nil
+		}
+
+	case reflect.Slice:
+		if a, ok := o.(*Array); ok {
+			slice := reflect.MakeSlice(t, len(a.Elements), len(a.Elements))
+			for i, elem := range a.Elements {
+				if err := toGo(elem, slice.Index(i)); err != nil {
+					return err
+				}
+			}
+			v.Set(slice)
+			return nil
+		}
+
+	case reflect.Array:
+		if a, ok := o.(*Array); ok {
+			if len(a.Elements) != t.Len() {
+				return fmt.Errorf("object: cannot convert ARRAY of length %d to %s", len(a.Elements), t)
+			}
+			for i, elem := range a.Elements {
+				if err := toGo(elem, v.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+	case reflect.Map:
+		if h, ok := o.(*Hash); ok {
+			m := reflect.MakeMapWithSize(t, len(h.Pairs))
+			for _, pair := range h.Ordered() {
+				key := reflect.New(t.Key()).Elem()
+				if err := toGo(pair.Key, key); err != nil {
+					return err
+				}
+				value := reflect.New(t.Elem()).Elem()
+				if err := toGo(pair.Value, value); err != nil {
+					return err
+				}
+				m.SetMapIndex(key, value)
+			}
+			v.Set(m)
+			return nil
+		}
+
+	case reflect.Struct:
+		if h, ok := o.(*Hash); ok {
+			for _, f := range structFields(t) {
+				pair, ok := h.Pairs[(&String{Value: f.name}).HashKey()]
+				if !ok {
+					continue
+				}
+				if err := toGo(pair.Value, v.Field(f.index)); err != nil {
+					return fmt.Errorf("%w (field %s)", err, f.name)
+				}
+			}
+			return nil
+		}
+	}
+
+	return convertError(o, t)
+}
+
+// natural returns the Go value o converts to when the target is an empty
+// interface.
+func natural(o Object) (any, error) {
+	switch o := o.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return o.Value, nil
+	case *Integer:
+		return o.Value, nil
+	case *Float:
+		return o.Value, nil
+	case *String:
+		return o.Value, nil
+	case *Array:
+		list := make([]any, len(o.Elements))
+		for i, elem := range o.Elements {
+			value, err := natural(elem)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case *Hash:
+		m := make(map[string]any, len(o.Pairs))
+		for _, pair := range o.Ordered() {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				return nil, fmt.Errorf("object: cannot convert HASH with %s key to map[string]any", pair.Key.Type())
+			}
+			value, err := natural(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = value
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("object: cannot convert %s to a Go value", o.Type())
+}
+
+func convertError(o Object, t reflect.Type) error {
+	return fmt.Errorf("object: cannot convert %s to %s", o.Type(), t)
+}
+
+// structField is a field of a struct converted to and from a hash.
+type structField struct {
+	name  string
+	index int
+}
+
+// structFields returns the fields of the struct type t that convert, with
+// the keys they have in hashes.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("monkey"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, index: i})
+	}
+	return fields
+}
@@ -0,0 +1,172 @@
+package object
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+type user struct {
+	Name    string
+	Age     int `monkey:"age"`
+	Emails  []string
+	Manager *user
+	secret  string
+	Ignored bool `monkey:"-"`
+}
+
+func TestFromGo(t *testing.T) {
+	var nilMap map[string]int
+	var nilUser *user
+	n := 7
+
+	tests := []struct {
+		input    any
+		expected string // Inspect of the result.
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{-3, "-3"},
+		{uint8(200), "200"},
+		{2.5, "2.5"},
+		{"hi", "hi"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{map[int][]string{1: {"x"}}, "{1: [x]}"},
+		{map[string]int{"b": 2, "c": 3, "a": 1}, "{a: 1, b: 2, c: 3}"},
+		{map[any]int{"x": 1, 10: 2, 9: 3, true: 4}, "{true: 4, 9: 3, 10: 2, x: 1}"},
+		{nilMap, "null"},
+		{nilUser, "null"},
+		{&n, "7"},
+		{[]any{1, "a", nil}, "[1, a, null]"},
+		{&Integer{Value: 4}, "4"},
+		{[]Object{TRUE, NULL}, "[true, null]"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) failed: %v", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) = %s, want %s", tt.input, obj.Inspect(), tt.expected)
+		}
+	}
+
+	if obj, _ := FromGo(false); obj != FALSE {
+		t.Errorf("FromGo(false) is not FALSE")
+	}
+
+	obj, err := FromGo(user{Name: "ada", Age: 36, secret: "x", Ignored: true})
+	if err != nil {
+		t.Fatalf("FromGo(user) failed: %v", err)
+	}
+	pairs := map[string]string{}
+	for _, pair := range obj.(*Hash).Pairs {
+		pairs[pair.Key.Inspect()] = pair.Value.Inspect()
+	}
+	if expected := map[string]string{"Name": "ada", "age": "36", "Emails": "null", "Manager": "null"}; !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("FromGo(user) = %v, want %v", pairs, expected)
+	}
+
+	type node struct{ Next *node }
+	cycle := &node{}
+	cycle.Next = cycle
+
+	for _, input := range []any{
+		uint64(math.MaxUint64),
+		map[float64]int{1.5: 1},
+		make(chan int),
+		[]func(){nil},
+		cycle,
+	} {
+		if obj, err := FromGo(input); err == nil {
+			t.Errorf("FromGo(%T) = %s, want an error", input, obj.Inspect())
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := &Hash{Pairs: make(map[HashKey]HashPair)}
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i], pairs[i+1])
+		}
+		return h
+	}
+	str := func(s string) *String { return &String{Value: s} }
+	integer := func(i int64) *Integer { return &Integer{Value: i} }
+
+	var i int
+	if err := ToGo(integer(42), &i); err != nil || i != 42 {
+		t.Errorf("ToGo into int = %d, %v", i, err)
+	}
+
+	var f float32
+	if err := ToGo(integer(2), &f); err != nil || f != 2 {
+		t.Errorf("ToGo into float32 = %v, %v", f, err)
+	}
+
+	var list []string
+	if err := ToGo(&Array{Elements: []Object{str("a"), str("b")}}, &list); err != nil || !reflect.DeepEqual(list, []string{"a", "b"}) {
+		t.Errorf("ToGo into []string = %q, %v", list, err)
+	}
+
+	var m map[int64]bool
+	if err := ToGo(hash(integer(1), TRUE), &m); err != nil || !reflect.DeepEqual(m, map[int64]bool{1: true}) {
+		t.Errorf("ToGo into map = %v, %v", m, err)
+	}
+
+	var u user
+	input := hash(
+		str("Name"), str("ada"),
+		str("age"), integer(36),
+		str("Emails"), &Array{Elements: []Object{str("a@b")}},
+		str("Manager"), hash(str("Name"), str("charles")),
+		str("Ignored"), TRUE,
+		str("unknown"), integer(1),
+	)
+	expected := user{Name: "ada", Age: 36, Emails: []string{"a@b"}, Manager: &user{Name: "charles"}}
+	if err := ToGo(input, &u); err != nil || !reflect.DeepEqual(u, expected) {
+		t.Errorf("ToGo into struct = %+v, %v", u, err)
+	}
+
+	var v any
+	if err := ToGo(&Array{Elements: []Object{integer(1), hash(str("k"), NULL)}}, &v); err != nil ||
+		!reflect.DeepEqual(v, []any{int64(1), map[string]any{"k": nil}}) {
+		t.Errorf("ToGo into any = %#v, %v", v, err)
+	}
+
+	var obj Object
+	if err := ToGo(TRUE, &obj); err != nil || obj != TRUE {
+		t.Errorf("ToGo into Object = %v, %v", obj, err)
+	}
+
+	p := &i
+	if err := ToGo(NULL, &p); err != nil || p != nil {
+		t.Errorf("ToGo of null into *int = %v, %v", p, err)
+	}
+
+	var small int8
+	var arr [2]int
+	for _, tt := range []struct {
+		input    Object
+		target   any
+		expected string
+	}{
+		{str("x"), &i, "object: cannot convert STRING to int"},
+		{integer(300), &small, "object: cannot convert 300 to int8: out of range"},
+		{NULL, &i, "object: cannot convert NULL to int"},
+		{&Array{Elements: []Object{integer(1)}}, &arr, "object: cannot convert ARRAY of length 1 to [2]int"},
+		{hash(integer(1), integer(2)), &v, "object: cannot convert HASH with INTEGER key to map[string]any"},
+		{hash(str("age"), str("old")), &u, "object: cannot convert STRING to int (field age)"},
+		{integer(1), i, "object: ToGo target must be a non-nil pointer, got int"},
+	} {
+		err := ToGo(tt.input, tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("ToGo(%s, %T) error = %v, want %q", tt.input.Inspect(), tt.target, err, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package object
+
+import "sort"
+
+// Environment binds names to values. An environment may be enclosed by an
+// outer one, whose bindings it sees unless it binds the same names. A
+// binding made by SetConst is constant: Assign won't change it.
+type Environment struct {
+	store  map[string]Object
+	consts map[string]bool // Allocated by the first SetConst.
+	outer  *Environment
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: nil}
+}
+
+// NewEnclosedEnvironment returns a new environment enclosed by outer.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Get returns the value bound to name in e or, failing that, in the
+// environments enclosing it.
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Assign rebinds name to val in the nearest environment binding name: e
+// itself or one enclosing it. It reports whether it did so; if there is no
+// such binding, or it is constant, nothing changes.
+func (e *Environment) Assign(name string, val Object) bool {
+	for ; e != nil; e = e.outer {
+		if _, ok := e.store[name]; ok {
+			if e.consts[name] {
+				return false
+			}
+			e.store[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+// IsConst reports whether the nearest binding of name, in e or the
+// environments enclosing it, is constant.
+func (e *Environment) IsConst(name string) bool {
+	for ; e != nil; e = e.outer {
+		if _, ok := e.store[name]; ok {
+			return e.consts[name]
+		}
+	}
+	return false
+}
+
+// IsOwnConst reports whether e itself, rather than an environment enclosing
+// it, binds name constantly.
+func (e *Environment) IsOwnConst(name string) bool {
+	return e.consts[name]
+}
+
+// Set binds name to val in e itself, shadowing any outer binding. The
+// binding replaces any constant one of name in e, which callers binding
+// names of programs must first rule out with IsOwnConst.
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	delete(e.consts, name)
+	return val
+}
+
+// SetConst binds name to val in e itself like Set, but makes the binding
+// constant.
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.store[name] = val
+	e.consts[name] = true
+	return val
+}
+
+// Names returns the names bound in e and the environments enclosing it,
+// sorted and without duplicates.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.Bindings() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bindings returns the bindings visible from e: those of e itself and of
+// the environments enclosing it that e doesn't shadow. The map is a copy;
+// changing it doesn't change e.
+func (e *Environment) Bindings() map[string]Object {
+	bindings := make(map[string]Object)
+	for ; e != nil; e = e.outer {
+		for name, val := range e.store {
+			if _, ok := bindings[name]; !ok {
+				bindings[name] = val
+			}
+		}
+	}
+	return bindings
+}
+
+// Export returns the Go values of the bindings visible from e, converted
+// as by ToGo to an empty interface. Bindings of values without a Go
+// counterpart, such as functions, are left out.
+func (e *Environment) Export() map[string]any {
+	exported := make(map[string]any)
+	for name, val := range e.Bindings() {
+		if v, err := natural(val); err == nil {
+			exported[name] = v
+		}
+	}
+	return exported
+}
+
+// Snapshot is the state of an environment and those enclosing it at some
+// point, as recorded by Environment.Snapshot.
+type Snapshot struct {
+	env    *Environment
+	frames []snapshotFrame
+}
+
+type snapshotFrame struct {
+	env    *Environment
+	store  map[string]Object
+	consts map[string]bool
+}
+
+// Snapshot records the bindings of e and the environments enclosing it, so
+// that Restore can later undo any changes made to them. Values are shared
+// rather than copied: only iterators change once created, and one
+// advanced after the snapshot stays advanced when it is restored.
+func (e *Environment) Snapshot() *Snapshot {
+	s := &Snapshot{env: e}
+	for env := e; env != nil; env = env.outer {
+		frame := snapshotFrame{env: env, store: make(map[string]Object, len(env.store))}
+		for name, val := range env.store {
+			frame.store[name] = val
+		}
+		if len(env.consts) > 0 {
+			frame.consts = make(map[string]bool, len(env.consts))
+			for name := range env.consts {
+				frame.consts[name] = true
+			}
+		}
+		s.frames = append(s.frames, frame)
+	}
+	return s
+}
+
+// Restore returns e and the environments enclosing it to the state s
+// recorded, removing bindings made since and undoing assignments. Closures
+// created in the meantime keep working, seeing the restored bindings. s
+// must be a snapshot of e; it can be restored any number of times.
+func (e *Environment) Restore(s *Snapshot) {
+	if s.env != e {
+		panic("object: Restore of a snapshot of another environment")
+	}
+	for _, frame := range s.frames {
+		frame.env.store = make(map[string]Object, len(frame.store))
+		for name, val := range frame.store {
+			frame.env.store[name] = val
+		}
+		frame.env.consts = nil
+		for name := range frame.consts {
+			if frame.env.consts == nil {
+				frame.env.consts = make(map[string]bool, len(frame.consts))
+			}
+			frame.env.consts[name] = true
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvironment(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	outer.Set("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Integer{Value: 3})
+	inner.Set("c", &Integer{Value: 4})
+
+	tests := []struct {
+		env      *Environment
+		name     string
+		expected int64 // 0 if unbound.
+	}{
+		{inner, "a", 1},
+		{inner, "b", 3},
+		{inner, "c", 4},
+		{outer, "b", 2},
+		{outer, "c", 0},
+		{inner, "d", 0},
+	}
+
+	for _, tt := range tests {
+		obj, ok := tt.env.Get(tt.name)
+		if tt.expected == 0 {
+			if ok {
+				t.Errorf("%s unexpectedly bound to %s", tt.name, obj.Inspect())
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s not bound", tt.name)
+			continue
+		}
+		if obj.(*Integer).Value != tt.expected {
+			t.Errorf("%s bound to %s, want %d", tt.name, obj.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestEnvironmentConst(t *testing.T) {
+	outer := NewEnvironment()
+	outer.SetConst("a", &Integer{Value: 1})
+	outer.Set("b", &Integer{Value: 2})
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.IsConst("a") || inner.IsConst("b") || inner.IsConst("c") {
+		t.Errorf("IsConst wrong for a, b or c")
+	}
+	if inner.Assign("a", &Integer{Value: 10}) {
+		t.Errorf("Assign of a constant succeeded")
+	}
+	if obj, _ := inner.Get("a"); obj.(*Integer).Value != 1 {
+		t.Errorf("a bound to %s, want 1", obj.Inspect())
+	}
+
+	inner.Set("a", &Integer{Value: 3})
+	if inner.IsConst("a") || !inner.Assign("a", &Integer{Value: 4}) {
+		t.Errorf("shadowing binding of a is constant")
+	}
+	if !outer.IsConst("a") {
+		t.Errorf("shadowing made the outer a variable")
+	}
+
+	outer.Set("a", &Integer{Value: 5})
+	if outer.IsConst("a") {
+		t.Errorf("Set left a constant")
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	outer.Set("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Integer{Value: 3})
+
+	if !inner.Assign("a", &Integer{Value: 10}) || !inner.Assign("b", &Integer{Value: 30}) {
+		t.Fatalf("Assign of a bound name failed")
+	}
+	if inner.Assign("c", &Integer{Value: 40}) {
+		t.Errorf("Assign of an unbound name succeeded")
+	}
+
+	for _, tt := range []struct {
+		env      *Environment
+		name     string
+		expected int64
+	}{
+		{outer, "a", 10},
+		{outer, "b", 2},
+		{inner, "b", 30},
+	} {
+		obj, _ := tt.env.Get(tt.name)
+		if obj.(*Integer).Value != tt.expected {
+			t.Errorf("%s bound to %s, want %d", tt.name, obj.Inspect(), tt.expected)
+		}
+	}
+	if _, ok := inner.Get("c"); ok {
+		t.Errorf("failed Assign bound c")
+	}
+}
+
+func TestEnvironmentBindings(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	outer.Set("b", &String{Value: "two"})
+	outer.Set("f", &Builtin{})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Array{Elements: []Object{TRUE, NULL}})
+	inner.Set("c", &Float{Value: 2.5})
+
+	if names := inner.Names(); !reflect.DeepEqual(names, []string{"a", "b", "c", "f"}) {
+		t.Errorf("wrong names. got=%q", names)
+	}
+	if names := outer.Names(); !reflect.DeepEqual(names, []string{"a", "b", "f"}) {
+		t.Errorf("wrong outer names. got=%q", names)
+	}
+
+	bindings := inner.Bindings()
+	if len(bindings) != 4 || bindings["b"].Type() != ARRAY_OBJ {
+		t.Errorf("wrong bindings. got=%v", bindings)
+	}
+	bindings["d"] = NULL
+	if _, ok := inner.Get("d"); ok {
+		t.Errorf("changing Bindings changed the environment")
+	}
+
+	expected := map[string]any{"a": int64(1), "b": []any{true, nil}, "c": 2.5}
+	if exported := inner.Export(); !reflect.DeepEqual(exported, expected) {
+		t.Errorf("wrong export. want=%v, got=%v", expected, exported)
+	}
+}
+
+func TestEnvironmentSnapshot(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	outer.SetConst("k", &Integer{Value: 2})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Integer{Value: 3})
+
+	s := inner.Snapshot()
+	for i := 0; i < 2; i++ {
+		inner.Assign("a", &Integer{Value: 10})
+		inner.Assign("b", &Integer{Value: 30})
+		inner.Set("c", &Integer{Value: 40})
+		outer.Set("k", &Integer{Value: 50})
+
+		inner.Restore(s)
+
+		if names := inner.Names(); !reflect.DeepEqual(names, []string{"a", "b", "k"}) {
+			t.Errorf("wrong names after Restore. got=%q", names)
+		}
+		for name, expected := range map[string]int64{"a": 1, "b": 3, "k": 2} {
+			obj, _ := inner.Get(name)
+			if obj.(*Integer).Value != expected {
+				t.Errorf("%s bound to %s after Restore, want %d", name, obj.Inspect(), expected)
+			}
+		}
+		if !inner.IsConst("k") {
+			t.Errorf("k not constant after Restore")
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Restore of another environment's snapshot didn't panic")
+		}
+	}()
+	outer.Restore(s)
+}
@@ -0,0 +1,436 @@
+// Package object defines the values Monkey programs compute with.
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/token"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ  = "INTEGER"
+	FLOAT_OBJ    = "FLOAT"
+	BOOLEAN_OBJ  = "BOOLEAN"
+	NULL_OBJ     = "NULL"
+	STRING_OBJ   = "STRING"
+	ARRAY_OBJ    = "ARRAY"
+	HASH_OBJ     = "HASH"
+	FUNCTION_OBJ = "FUNCTION"
+	BUILTIN_OBJ  = "BUILTIN"
+	ERROR_OBJ    = "ERROR"
+	QUOTE_OBJ    = "QUOTE"
+	MACRO_OBJ    = "MACRO"
+	ITERATOR_OBJ = "ITERATOR"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+)
+
+// Object is implemented by all values.
+type Object interface {
+	Type() ObjectType
+	Inspect() string // A representation of the value for display.
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+// The range of the integers that NewInteger interns.
+const (
+	MinSmallInteger = -128
+	MaxSmallInteger = 1023
+)
+
+// smallIntegers are the interned integers, from MinSmallInteger on.
+var smallIntegers = func() []Integer {
+	ints := make([]Integer, MaxSmallInteger-MinSmallInteger+1)
+	for i := range ints {
+		ints[i].Value = int64(i + MinSmallInteger)
+	}
+	return ints
+}()
+
+// NewInteger returns an Integer of value v. Integers are never modified, so
+// those between MinSmallInteger and MaxSmallInteger are shared rather than
+// allocated: counters, indexes and lengths, which most integers that
+// programs compute are, cost nothing. Unlike booleans and null, integers
+// must still be compared by value.
+func NewInteger(v int64) *Integer {
+	if v >= MinSmallInteger && v <= MaxSmallInteger {
+		return &smallIntegers[v-MinSmallInteger]
+	}
+	return &Integer{Value: v}
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect formats f with a decimal point or exponent, so that it can be
+// told apart from an integer.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// The only values of null, true and false. Evaluation compares booleans and
+// null by identity, so these must be used rather than new values.
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashKey identifies a hashable value when used as a key of a Hash. Equal
+// values have equal HashKeys.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by the values that can be used as hash keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// HashPair is an entry of a Hash, keeping the original key for display.
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps keys to values, remembering the order in which the keys were
+// first added. Set adds pairs in order; pairs written to Pairs directly
+// come after them, in sorted order.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	order []HashKey // The keys added by Set, in order.
+}
+
+// NewHash returns an empty hash.
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set binds key to value in h. A key already in h keeps its place in the
+// order. It is an error for key not to be Hashable.
+func (h *Hash) Set(key, value Object) error {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", key.Type())
+	}
+	hashKey := hashable.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.order = append(h.order, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+	return nil
+}
+
+// Ordered returns the pairs of h in order.
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	seen := make(map[HashKey]bool, len(h.order))
+	for _, key := range h.order {
+		if pair, ok := h.Pairs[key]; ok && !seen[key] {
+			pairs = append(pairs, pair)
+			seen[key] = true
+		}
+	}
+	if len(pairs) == len(h.Pairs) {
+		return pairs
+	}
+
+	var rest []HashPair
+	for key, pair := range h.Pairs {
+		if !seen[key] {
+			rest = append(rest, pair)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return keyLess(rest[i].Key, rest[j].Key) })
+	return append(pairs, rest...)
+}
+
+// sort puts the keys of h in sorted order.
+func (h *Hash) sort() {
+	sort.Slice(h.order, func(i, j int) bool {
+		return keyLess(h.Pairs[h.order[i]].Key, h.Pairs[h.order[j]].Key)
+	})
+}
+
+// keyLess orders hash keys: booleans before integers before strings, false
+// before true, integers by value and strings bytewise.
+func keyLess(a, b Object) bool {
+	rank := func(o Object) int {
+		switch o.(type) {
+		case *Boolean:
+			return 0
+		case *Integer:
+			return 1
+		default:
+			return 2
+		}
+	}
+	if rank(a) != rank(b) {
+		return rank(a) < rank(b)
+	}
+	switch a := a.(type) {
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	}
+	return false
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, pair := range h.Ordered() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Variadic   bool // The last parameter collects the remaining arguments.
+
+	// Env is the environment the function was defined in. Calls evaluate
+	// the body in an environment enclosed by it, making the function a
+	// closure over the bindings visible at its definition.
+	Env *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	if f.Variadic && len(params) > 0 {
+		params[len(params)-1] += "..."
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+
+	return out.String()
+}
+
+// Quote is the value of a quote expression: the code it quotes, with each
+// unquote replaced by the value it evaluated to.
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+// Macro is a macro literal bound by a top-level let statement. Rather than
+// being called at run time, calls to it are replaced before evaluation by
+// the quote it returns, given its arguments as quotes.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment // The environment the macro was defined in.
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	params := make([]string, len(m.Parameters))
+	for i, p := range m.Parameters {
+		params[i] = p.String()
+	}
+	return "macro(" + strings.Join(params, ", ") + ") " + m.Body.String()
+}
+
+// Iterator is a sequence of values produced one at a time, on demand, so
+// that it can be endless or stream over values without collecting them.
+type Iterator struct {
+	// Next returns the next value and true, or false once there are no
+	// more, after which it keeps returning false. Failures are returned as
+	// an *Error and true.
+	Next func() (Object, bool)
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// CompiledFunction is a function compiled to bytecode by the compiler
+// package.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int // Including the parameters.
+	NumParameters int
+
+	// Name is the name the function is bound to, if any, and SourceMap
+	// maps its instructions to the source. Both are only for reporting
+	// errors, and may be empty.
+	Name      string
+	SourceMap code.SourceMap
+
+	// LocalNames and FreeNames are the names of the locals and of the free
+	// variables, by index, for debuggers. They may be empty.
+	LocalNames []string
+	FreeNames  []string
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a compiled function together with the values of the free
+// variables it captured when it was created. It is what a function value
+// is in compiled code, so it has the type of a Function.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// BuiltinFunction is the Go implementation of a builtin function.
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+// ReturnValue wraps the value of a return statement while it unwinds the
+// blocks enclosing the statement. It never escapes a function call or the
+// program.
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// Break signals a break statement while it unwinds the blocks enclosing the
+// statement. Like ReturnValue, it never escapes the loop it ends.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+// Continue signals a continue statement while it unwinds the blocks
+// enclosing the statement, up to the loop it continues.
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// Error is a runtime error. It is a value like any other, so that it can be
+// passed back to the host program.
+type Error struct {
+	Message string
+	Stack   []Frame // The calls the error passed through, innermost first.
+
+	// Details are values describing the error beyond its message, by name,
+	// such as the operands of a failed assertion. May be nil.
+	Details map[string]Object
+}
+
+// A Frame is a function call that was in progress when an Error occurred.
+type Frame struct {
+	Function string         // The called expression as written, e.g. "fib".
+	Pos      token.Position // Where the call is.
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+
+// Inspect renders the message, followed by a line per frame of the stack.
+func (e *Error) Inspect() string {
+	var out strings.Builder
+	out.WriteString("ERROR: " + e.Message)
+	for _, f := range e.Stack {
+		fmt.Fprintf(&out, "\n\tat %s (%s)", f.Function, f.Pos)
+	}
+	return out.String()
+}
@@ -0,0 +1,133 @@
+package object
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/token"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyTypes(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("1 and true have the same hash key")
+	}
+	if (&Boolean{Value: false}).HashKey() != (&Boolean{Value: false}).HashKey() {
+		t.Errorf("booleans with same value have different hash keys")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{&Integer{Value: -5}, "-5"},
+		{&Float{Value: 2}, "2.0"},
+		{&Float{Value: -0.25}, "-0.25"},
+		{&Float{Value: 1e21}, "1e+21"},
+		{&Boolean{Value: true}, "true"},
+		{&Null{}, "null"},
+		{&String{Value: "hi"}, "hi"},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}, "[1, a]"},
+		{&Array{}, "[]"},
+		{&Hash{Pairs: map[HashKey]HashPair{
+			(&String{Value: "k"}).HashKey(): {Key: &String{Value: "k"}, Value: &Integer{Value: 2}},
+		}}, "{k: 2}"},
+		{&Builtin{}, "builtin function"},
+		{&Error{Message: "boom"}, "ERROR: boom"},
+		{&Error{Message: "boom", Stack: []Frame{
+			{Function: "inner", Pos: token.Position{Line: 2, Column: 3}},
+			{Function: "fns[0]", Pos: token.Position{Filename: "a.mk", Line: 5, Column: 1}},
+		}}, "ERROR: boom\n\tat inner (2:3)\n\tat fns[0] (a.mk:5:1)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.obj.Inspect(); got != tt.expected {
+			t.Errorf("%T.Inspect() wrong. want=%q, got=%q", tt.obj, tt.expected, got)
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	str := func(s string) *String { return &String{Value: s} }
+
+	h := NewHash()
+	for _, key := range []Object{str("b"), &Integer{Value: 2}, str("a"), TRUE} {
+		if err := h.Set(key, NULL); err != nil {
+			t.Fatalf("Set(%s) failed: %v", key.Inspect(), err)
+		}
+	}
+	h.Set(str("b"), &Integer{Value: 1})
+	if got := h.Inspect(); got != "{b: 1, 2: null, a: null, true: null}" {
+		t.Errorf("wrong order after Set. got=%q", got)
+	}
+
+	if err := h.Set(&Array{}, NULL); err == nil || err.Error() != "unusable as hash key: ARRAY" {
+		t.Errorf("wrong error for an array key. got=%v", err)
+	}
+
+	// Pairs added directly come last, sorted; deleted ones are skipped.
+	delete(h.Pairs, (&Integer{Value: 2}).HashKey())
+	for _, key := range []Object{str("d"), &Integer{Value: 10}, str("c"), &Integer{Value: 9}, FALSE} {
+		h.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: NULL}
+	}
+	expected := "{b: 1, a: null, true: null, false: null, 9: null, 10: null, c: null, d: null}"
+	if got := h.Inspect(); got != expected {
+		t.Errorf("wrong order with direct writes. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestNewInteger(t *testing.T) {
+	for _, v := range []int64{MinSmallInteger, -1, 0, 1, MaxSmallInteger} {
+		if i := NewInteger(v); i.Value != v || i != NewInteger(v) {
+			t.Errorf("NewInteger(%d) = %d, not interned", v, i.Value)
+		}
+	}
+	for _, v := range []int64{MinSmallInteger - 1, MaxSmallInteger + 1, 1 << 40} {
+		if i := NewInteger(v); i.Value != v || i == NewInteger(v) {
+			t.Errorf("NewInteger(%d) = %d, interned", v, i.Value)
+		}
+	}
+}
+
+func TestIntegerPool(t *testing.T) {
+	var nilPool *IntegerPool
+	if i := nilPool.New(5000); i.Value != 5000 {
+		t.Errorf("nil pool gave %d, want 5000", i.Value)
+	}
+
+	pool := &IntegerPool{}
+	if pool.New(7) != NewInteger(7) {
+		t.Errorf("pool didn't intern 7")
+	}
+	var ints []*Integer
+	for v := int64(0); v < 3*integerBlockSize; v++ {
+		ints = append(ints, pool.New(v+MaxSmallInteger+1))
+	}
+	for v, i := range ints {
+		if want := int64(v) + MaxSmallInteger + 1; i.Value != want {
+			t.Fatalf("integer %d was overwritten: got %d, want %d", v, i.Value, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package object
+
+// integerBlockSize is the number of Integers an IntegerPool allocates at a
+// time.
+const integerBlockSize = 256
+
+// IntegerPool allocates the integers an engine computes in blocks, so that
+// arithmetic in a loop costs one allocation every few hundred results rather
+// than one each. Integers can't be given back to the pool, as nothing tells
+// when a value is no longer referenced; a block is instead freed by the
+// garbage collector once none of its Integers is, which keeps pooling safe
+// but means that a long-lived result keeps the rest of its block alive.
+// Pools therefore suit short-lived intermediates, which is what most
+// integers are.
+//
+// The zero value is an empty pool ready to use, and a nil *IntegerPool
+// allocates as NewInteger does. A pool must not be used concurrently.
+type IntegerPool struct {
+	free []Integer
+}
+
+// New returns an Integer of value v, interned as by NewInteger if it is
+// small, and otherwise taken from the pool's current block.
+func (p *IntegerPool) New(v int64) *Integer {
+	if p == nil || v >= MinSmallInteger && v <= MaxSmallInteger {
+		return NewInteger(v)
+	}
+	if len(p.free) == 0 {
+		p.free = make([]Integer, integerBlockSize)
+	}
+	i := &p.free[0]
+	p.free = p.free[1:]
+	i.Value = v
+	return i
+}
@@ -0,0 +1,1123 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/token"
+)
+
+// Operator precedences, from weakest to strongest binding.
+const (
+	_ int = iota
+	LOWEST
+	ASSIGN      // =
+	COALESCE    // ??
+	OR          // ||
+	AND         // &&
+	EQUALS      // ==
+	LESSGREATER // > or <
+	SUM         // + or |
+	PRODUCT     // * or <<
+	PREFIX      // -X or !X
+	CALL        // myFunction(X)
+	INDEX       // array[index]
+)
+
+var precedences = map[token.TokenType]int{
+	token.ASSIGN:    ASSIGN,
+	token.COALESCE:  COALESCE,
+	token.OR:        OR,
+	token.AND:       AND,
+	token.EQ:        EQUALS,
+	token.NOT_EQ:    EQUALS,
+	token.LT:        LESSGREATER,
+	token.GT:        LESSGREATER,
+	token.PLUS:      SUM,
+	token.MINUS:     SUM,
+	token.PIPE:      SUM,
+	token.CARET:     SUM,
+	token.SLASH:     PRODUCT,
+	token.ASTERISK:  PRODUCT,
+	token.PERCENT:   PRODUCT,
+	token.AMPERSAND: PRODUCT,
+	token.LSHIFT:    PRODUCT,
+	token.RSHIFT:    PRODUCT,
+	token.LPAREN:    CALL,
+	token.LBRACKET:  INDEX,
+}
+
+type (
+	prefixParseFn func() ast.Expression
+	infixParseFn  func(ast.Expression) ast.Expression
+)
+
+// ChainMode selects how the parser treats chained comparisons such as
+// `a < b < c`, which parse as `(a < b) < c` and so compare a boolean.
+type ChainMode int
+
+const (
+	// ChainWarn records a warning for each chained comparison.
+	ChainWarn ChainMode = iota
+	// ChainError records a syntax error for each chained comparison.
+	ChainError
+	// ChainAllow accepts chained comparisons silently.
+	ChainAllow
+)
+
+// Options configures optional parser behaviour. The zero value gives the
+// behaviour of New.
+type Options struct {
+	ComparisonChains ChainMode
+
+	// Trace, if set, receives an indented log of every parse function
+	// entered and exited along with the token it was looking at.
+	Trace io.Writer
+}
+
+type Parser struct {
+	l        *lexer.Lexer
+	opts     Options
+	errors   []string
+	warnings []string
+
+	traceLevel int
+
+	curToken  token.Token
+	peekToken token.Token
+
+	// Comments lexed directly before curToken and peekToken respectively.
+	// Only lexers in lexer.ScanComments mode produce them.
+	curComments  []token.Token
+	peekComments []token.Token
+	comments     ast.CommentMap
+
+	prefixParseFns map[token.TokenType]prefixParseFn
+	infixParseFns  map[token.TokenType]infixParseFn
+}
+
+func New(l *lexer.Lexer) *Parser {
+	return NewWithOptions(l, Options{})
+}
+
+func NewWithOptions(l *lexer.Lexer, opts Options) *Parser {
+	p := &Parser{
+		l:        l,
+		opts:     opts,
+		errors:   []string{},
+		warnings: []string{},
+	}
+
+	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
+	p.registerPrefix(token.IDENT, p.parseIdentifier)
+	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.INTERP_START, p.parseInterpolatedString)
+	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.BANG, p.parsePrefixExpression)
+	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseBraceExpression)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.QUOTE, p.parseQuoteExpression)
+	p.registerPrefix(token.UNQUOTE, p.parseUnquoteExpression)
+
+	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	for _, tt := range []token.TokenType{
+		token.PLUS, token.MINUS, token.SLASH, token.ASTERISK,
+		token.PERCENT, token.AMPERSAND, token.PIPE, token.CARET,
+		token.LSHIFT, token.RSHIFT, token.AND, token.OR, token.COALESCE,
+		token.EQ, token.NOT_EQ, token.LT, token.GT,
+	} {
+		p.registerInfix(tt, p.parseInfixExpression)
+	}
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+
+	// Read two tokens so that curToken and peekToken are both set.
+	p.nextToken()
+	p.nextToken()
+
+	return p
+}
+
+// Reset prepares the parser to parse the input of l, discarding all errors
+// and token state from previous runs. It lets callers that parse many
+// snippets reuse one parser instead of rebuilding its parse function tables.
+// Errors and programs returned before the reset are left untouched.
+func (p *Parser) Reset(l *lexer.Lexer) {
+	p.l = l
+	p.errors = []string{}
+	p.warnings = []string{}
+	p.traceLevel = 0
+
+	p.curToken = token.Token{}
+	p.peekToken = token.Token{}
+	p.curComments = nil
+	p.peekComments = nil
+	p.comments = nil
+
+	p.nextToken()
+	p.nextToken()
+}
+
+// Errors returns the messages for every syntax error encountered so far.
+func (p *Parser) Errors() []string {
+	return p.errors
+}
+
+// Warnings returns the messages for suspicious but valid syntax encountered
+// so far, such as chained comparisons.
+func (p *Parser) Warnings() []string {
+	return p.warnings
+}
+
+func (p *Parser) ParseProgram() *ast.Program {
+	program := &ast.Program{Statements: []ast.Statement{}}
+
+	for !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			program.Statements = append(program.Statements, stmt)
+			p.attachTrailingComment(stmt)
+		}
+		p.nextToken()
+	}
+
+	p.attachComments(program, p.takeComments())
+	program.Comments = p.comments
+	return program
+}
+
+// ErrorList holds the syntax errors found by ParseFile.
+type ErrorList []string
+
+func (el ErrorList) Error() string {
+	switch len(el) {
+	case 0:
+		return "no errors"
+	case 1:
+		return el[0]
+	}
+	return fmt.Sprintf("%s (and %d more errors)", el[0], len(el)-1)
+}
+
+// ParseFile reads a whole program from r and parses it. Token positions and
+// error messages refer to filename. The returned error is either the read
+// error or an ErrorList; the program is returned even when it has syntax
+// errors, so callers can inspect the partial tree.
+func ParseFile(filename string, r io.Reader) (*ast.Program, error) {
+	var src strings.Builder
+	if _, err := io.Copy(&src, r); err != nil {
+		return nil, err
+	}
+
+	p := New(lexer.NewFile(filename, src.String(), 0))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return program, ErrorList(p.Errors())
+	}
+	return program, nil
+}
+
+func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
+	p.prefixParseFns[tokenType] = fn
+}
+
+func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
+	p.infixParseFns[tokenType] = fn
+}
+
+func (p *Parser) nextToken() {
+	p.curToken = p.peekToken
+	p.curComments = p.peekComments
+
+	p.peekComments = nil
+	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.peekComments = append(p.peekComments, p.peekToken)
+		p.peekToken = p.l.NextToken()
+	}
+}
+
+// takeComments returns the comments preceding the current token and clears
+// them, so the outermost node starting at that token is the one that gets
+// them attached.
+func (p *Parser) takeComments() []token.Token {
+	comments := p.curComments
+	p.curComments = nil
+	return comments
+}
+
+// attachTrailingComment associates a comment on the line stmt ends on with
+// stmt. The current token must be the last token of stmt.
+func (p *Parser) attachTrailingComment(stmt ast.Statement) {
+	if len(p.peekComments) == 0 || p.peekComments[0].Pos.Line != p.curToken.End().Line {
+		return
+	}
+	p.attachComments(stmt, p.peekComments[:1])
+	p.peekComments = p.peekComments[1:]
+}
+
+// attachComments associates comments with node, split into groups at blank
+// lines.
+func (p *Parser) attachComments(node ast.Node, comments []token.Token) {
+	if len(comments) == 0 {
+		return
+	}
+	if p.comments == nil {
+		p.comments = ast.CommentMap{}
+	}
+
+	var group *ast.CommentGroup
+	for i, c := range comments {
+		if i == 0 || c.Pos.Line > comments[i-1].Pos.Line+1 {
+			group = &ast.CommentGroup{}
+			p.comments[node] = append(p.comments[node], group)
+		}
+		group.List = append(group.List, &ast.Comment{Token: c})
+	}
+}
+
+func (p *Parser) curTokenIs(t token.TokenType) bool {
+	return p.curToken.Type == t
+}
+
+func (p *Parser) peekTokenIs(t token.TokenType) bool {
+	return p.peekToken.Type == t
+}
+
+// expectPeek advances only if the next token has the expected type, and
+// records an error otherwise.
+func (p *Parser) expectPeek(t token.TokenType) bool {
+	if p.peekTokenIs(t) {
+		p.nextToken()
+		return true
+	}
+	p.peekError(t)
+	return false
+}
+
+// errorf records a syntax error at pos, rendered as "file:line:col: msg".
+func (p *Parser) errorf(pos token.Position, format string, a ...interface{}) {
+	msg := pos.String() + ": " + fmt.Sprintf(format, a...)
+	p.errors = append(p.errors, msg)
+}
+
+func (p *Parser) warnf(pos token.Position, format string, a ...interface{}) {
+	msg := pos.String() + ": " + fmt.Sprintf(format, a...)
+	p.warnings = append(p.warnings, msg)
+}
+
+func (p *Parser) peekError(t token.TokenType) {
+	p.errorf(p.peekToken.Pos, "expected next token to be %s, got %s instead",
+		t, p.peekToken.Type)
+}
+
+func (p *Parser) noPrefixParseFnError(t token.TokenType) {
+	p.errorf(p.curToken.Pos, "no prefix parse function for %s found", t)
+}
+
+func (p *Parser) peekPrecedence() int {
+	if p, ok := precedences[p.peekToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+func (p *Parser) curPrecedence() int {
+	if p, ok := precedences[p.curToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+// Statements.
+
+func (p *Parser) parseStatement() ast.Statement {
+	defer p.untrace(p.trace("parseStatement"))
+	comments := p.takeComments()
+
+	var stmt ast.Statement
+	switch p.curToken.Type {
+	case token.LET:
+		stmt = p.parseLetStatement()
+	case token.CONST:
+		stmt = p.parseConstStatement()
+	case token.RETURN:
+		stmt = p.parseReturnStatement()
+	case token.IMPORT:
+		stmt = p.parseImportStatement()
+	case token.WHILE:
+		stmt = p.parseWhileStatement()
+	case token.FOR:
+		stmt = p.parseForStatement()
+	case token.BREAK:
+		stmt = &ast.BreakStatement{Token: p.curToken}
+		p.skipSemicolon()
+	case token.CONTINUE:
+		stmt = &ast.ContinueStatement{Token: p.curToken}
+		p.skipSemicolon()
+	default:
+		stmt = p.parseExpressionStatement()
+	}
+
+	if stmt != nil {
+		p.attachComments(stmt, comments)
+	}
+	return stmt
+}
+
+// parseLetStatement parses `let x = 5;` as well as the destructuring form
+// `let x, y = f();`.
+func (p *Parser) parseLetStatement() ast.Statement {
+	defer p.untrace(p.trace("parseLetStatement"))
+	stmt := &ast.LetStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		stmt.Names = []*ast.Identifier{stmt.Name}
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			stmt.Names = append(stmt.Names, name)
+		}
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseConstStatement() ast.Statement {
+	defer p.untrace(p.trace("parseConstStatement"))
+	stmt := &ast.ConstStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseReturnStatement parses `return x;` as well as `return a, b;`, which
+// returns a TupleLiteral.
+func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	defer p.untrace(p.trace("parseReturnStatement"))
+	stmt := &ast.ReturnStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.COMMA) {
+		tuple := &ast.TupleLiteral{
+			Token:    p.peekToken,
+			Elements: []ast.Expression{stmt.ReturnValue},
+		}
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+		}
+		stmt.ReturnValue = tuple
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() ast.Statement {
+	defer p.untrace(p.trace("parseImportStatement"))
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	defer p.untrace(p.trace("parseWhileStatement"))
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	p.skipSemicolon()
+
+	return stmt
+}
+
+// parseForStatement parses `for (x in xs) { ... }`.
+func (p *Parser) parseForStatement() ast.Statement {
+	defer p.untrace(p.trace("parseForStatement"))
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	p.skipSemicolon()
+
+	return stmt
+}
+
+// skipSemicolon consumes the optional semicolon ending a statement.
+func (p *Parser) skipSemicolon() {
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+}
+
+func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	defer p.untrace(p.trace("parseExpressionStatement"))
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+
+	stmt.Expression = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	defer p.untrace(p.trace("parseBlockStatement"))
+	block := &ast.BlockStatement{Token: p.curToken, Statements: []ast.Statement{}}
+
+	p.nextToken()
+	p.parseBlockBody(block)
+
+	return block
+}
+
+// parseBlockBody appends statements to block up to the closing brace, which
+// becomes the current token.
+func (p *Parser) parseBlockBody(block *ast.BlockStatement) {
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+			p.attachTrailingComment(stmt)
+		}
+		p.nextToken()
+	}
+
+	if p.curTokenIs(token.RBRACE) {
+		block.Rbrace = p.curToken
+		p.attachComments(block, p.takeComments())
+	}
+}
+
+// Expressions.
+
+func (p *Parser) parseExpression(precedence int) ast.Expression {
+	defer p.untrace(p.trace("parseExpression"))
+	prefix := p.prefixParseFns[p.curToken.Type]
+	if prefix == nil {
+		p.noPrefixParseFnError(p.curToken.Type)
+		return nil
+	}
+	comments := p.takeComments()
+	leftExp := prefix()
+	if leftExp != nil {
+		p.attachComments(leftExp, comments)
+	}
+
+	// Precedence of the comparison last applied to leftExp, so that
+	// `a < b < c` can be told apart from `(a < b) < c`.
+	lastComparison := 0
+
+	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+		infix := p.infixParseFns[p.peekToken.Type]
+		if infix == nil {
+			return leftExp
+		}
+
+		p.nextToken()
+
+		operator := p.curToken
+		leftExp = infix(leftExp)
+
+		if !isComparison(operator.Type) {
+			lastComparison = 0
+			continue
+		}
+		if precedences[operator.Type] == lastComparison {
+			p.comparisonChain(operator.Pos, leftExp)
+		}
+		lastComparison = precedences[operator.Type]
+	}
+
+	return leftExp
+}
+
+func isComparison(t token.TokenType) bool {
+	switch t {
+	case token.LT, token.GT, token.EQ, token.NOT_EQ:
+		return true
+	}
+	return false
+}
+
+// comparisonChain reports a chained comparison according to
+// Options.ComparisonChains.
+func (p *Parser) comparisonChain(pos token.Position, exp ast.Expression) {
+	chain, ok := exp.(*ast.InfixExpression)
+	if !ok || p.opts.ComparisonChains == ChainAllow {
+		return
+	}
+
+	format := "chained comparison %s compares the boolean result of %s"
+	if p.opts.ComparisonChains == ChainError {
+		p.errorf(pos, format, chain, chain.Left)
+	} else {
+		p.warnf(pos, format, chain, chain.Left)
+	}
+}
+
+func (p *Parser) parseIdentifier() ast.Expression {
+	defer p.untrace(p.trace("parseIdentifier"))
+	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseIntegerLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseIntegerLiteral"))
+	lit := &ast.IntegerLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if err != nil {
+		p.errorf(p.curToken.Pos, "could not parse %q as integer", p.curToken.Literal)
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseFloatLiteral"))
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errorf(p.curToken.Pos, "could not parse %q as float", p.curToken.Literal)
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseStringLiteral"))
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	defer p.untrace(p.trace("parseInterpolatedString"))
+	str := &ast.InterpolatedString{
+		Token:   p.curToken,
+		Strings: []string{p.curToken.Literal},
+	}
+
+	for {
+		p.nextToken()
+		str.Exprs = append(str.Exprs, p.parseExpression(LOWEST))
+
+		switch {
+		case p.peekTokenIs(token.INTERP_MID):
+			p.nextToken()
+			str.Strings = append(str.Strings, p.curToken.Literal)
+		case p.peekTokenIs(token.INTERP_END):
+			p.nextToken()
+			str.Strings = append(str.Strings, p.curToken.Literal)
+			str.Close = p.curToken
+			return str
+		default:
+			p.errorf(p.peekToken.Pos, "expected } to close string interpolation, got %s instead",
+				p.peekToken.Type)
+			return nil
+		}
+	}
+}
+
+func (p *Parser) parseBoolean() ast.Expression {
+	defer p.untrace(p.trace("parseBoolean"))
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+func (p *Parser) parsePrefixExpression() ast.Expression {
+	defer p.untrace(p.trace("parsePrefixExpression"))
+	expression := &ast.PrefixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+	}
+
+	p.nextToken()
+	expression.Right = p.parseExpression(PREFIX)
+
+	return expression
+}
+
+func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseInfixExpression"))
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
+// parseAssignExpression parses `name = value`. Assignment associates to the
+// right, so that `a = b = c` assigns c to both.
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseAssignExpression"))
+	expression := &ast.AssignExpression{Token: p.curToken}
+
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		if left != nil {
+			p.errorf(left.Pos(), "cannot assign to %s", left.String())
+		}
+		return nil
+	}
+	expression.Name = name
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	defer p.untrace(p.trace("parseGroupedExpression"))
+	exp := &ast.ParenExpression{Token: p.curToken}
+	p.nextToken()
+
+	exp.Expression = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	exp.Rparen = p.curToken
+
+	return exp
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	defer p.untrace(p.trace("parseIfExpression"))
+	expression := &ast.IfExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	defer p.untrace(p.trace("parseTryExpression"))
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) || !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseFunctionLiteral"))
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters, lit.Variadic = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseFunctionParameters parses a parameter list up to and including the
+// closing parenthesis. It reports whether the last parameter is variadic,
+// i.e. written as `rest...`.
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, bool) {
+	defer p.untrace(p.trace("parseFunctionParameters"))
+	identifiers := []*ast.Identifier{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers, false
+	}
+
+	p.nextToken()
+	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	variadic := false
+	if p.peekTokenIs(token.ELLIPSIS) {
+		p.nextToken()
+		variadic = true
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, false
+	}
+
+	return identifiers, variadic
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseCallExpression"))
+	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments != nil {
+		exp.Rparen = p.curToken
+	}
+	return exp
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseArrayLiteral"))
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements != nil {
+		array.Rbracket = p.curToken
+	}
+	return array
+}
+
+// parseExpressionList parses comma-separated expressions up to and including
+// the closing `end` token. Any element may be spread with a trailing `...`.
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	defer p.untrace(p.trace("parseExpressionList"))
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseListElement())
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseListElement())
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+func (p *Parser) parseListElement() ast.Expression {
+	exp := p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.ELLIPSIS) {
+		p.nextToken()
+		return &ast.SpreadExpression{Token: p.curToken, Value: exp}
+	}
+
+	return exp
+}
+
+// parseIndexExpression parses `left[index]`, or `left[low:high]` when the
+// brackets hold a colon.
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseIndexExpression"))
+	lbracket := p.curToken
+
+	p.nextToken()
+	if p.curTokenIs(token.COLON) {
+		return p.parseSliceExpression(lbracket, left, nil)
+	}
+	index := p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(lbracket, left, index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return &ast.IndexExpression{Token: lbracket, Left: left, Index: index, Rbracket: p.curToken}
+}
+
+// parseSliceExpression parses the rest of a slice expression whose colon is
+// the current token.
+func (p *Parser) parseSliceExpression(lbracket token.Token, left, low ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseSliceExpression"))
+	exp := &ast.SliceExpression{Token: lbracket, Left: left, Low: low}
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.High = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	exp.Rbracket = p.curToken
+
+	return exp
+}
+
+// parseBraceExpression parses the two expressions starting with `{`: hash
+// literals and block expressions. `{}` is an empty hash; otherwise the braces
+// hold a hash exactly when their first expression is followed by a colon.
+func (p *Parser) parseBraceExpression() ast.Expression {
+	defer p.untrace(p.trace("parseBraceExpression"))
+	lbrace := p.curToken
+
+	switch p.peekToken.Type {
+	case token.RBRACE:
+		return p.parseHashLiteral(lbrace, nil)
+	case token.LET, token.CONST, token.RETURN, token.IMPORT,
+		token.WHILE, token.FOR, token.BREAK, token.CONTINUE:
+		return &ast.BlockExpression{Token: lbrace, Block: p.parseBlockStatement()}
+	}
+
+	p.nextToken()
+	first := &ast.ExpressionStatement{Token: p.curToken}
+	first.Expression = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.COLON) {
+		return p.parseHashLiteral(lbrace, first.Expression)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	p.attachTrailingComment(first)
+	p.nextToken()
+
+	block := &ast.BlockStatement{Token: lbrace, Statements: []ast.Statement{first}}
+	p.parseBlockBody(block)
+
+	return &ast.BlockExpression{Token: lbrace, Block: block}
+}
+
+// parseHashLiteral parses the pairs of a hash literal opened by lbrace. If
+// key is not nil it is the already parsed key of the first pair, and the
+// current token is its last token.
+func (p *Parser) parseHashLiteral(lbrace token.Token, key ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseHashLiteral"))
+	hash := &ast.HashLiteral{Token: lbrace, Pairs: []*ast.HashPair{}}
+
+	for key != nil || !p.peekTokenIs(token.RBRACE) {
+		if key == nil {
+			p.nextToken()
+			key = p.parseExpression(LOWEST)
+		}
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, &ast.HashPair{Key: key, Value: value})
+		key = nil
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	hash.Rbrace = p.curToken
+
+	return hash
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseMacroLiteral"))
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	var variadic bool
+	lit.Parameters, variadic = p.parseFunctionParameters()
+	if variadic {
+		p.errorf(p.curToken.Pos, "macro parameters cannot be variadic")
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+func (p *Parser) parseQuoteExpression() ast.Expression {
+	defer p.untrace(p.trace("parseQuoteExpression"))
+	exp := &ast.QuoteExpression{Token: p.curToken}
+	exp.Node = p.parseParenthesizedOperand()
+	if exp.Node == nil {
+		return nil
+	}
+	exp.Rparen = p.curToken
+	return exp
+}
+
+func (p *Parser) parseUnquoteExpression() ast.Expression {
+	defer p.untrace(p.trace("parseUnquoteExpression"))
+	exp := &ast.UnquoteExpression{Token: p.curToken}
+	exp.Node = p.parseParenthesizedOperand()
+	if exp.Node == nil {
+		return nil
+	}
+	exp.Rparen = p.curToken
+	return exp
+}
+
+// parseParenthesizedOperand parses the single `(<expression>)` argument
+// taken by quote and unquote.
+func (p *Parser) parseParenthesizedOperand() ast.Expression {
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
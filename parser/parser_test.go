@@ -0,0 +1,1552 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/lexer"
+)
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	return program
+}
+
+func checkParserErrors(t *testing.T, p *Parser) {
+	t.Helper()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		return
+	}
+
+	t.Errorf("parser has %d errors", len(errors))
+	for _, msg := range errors {
+		t.Errorf("parser error: %q", msg)
+	}
+	t.FailNow()
+}
+
+func singleExpression(t *testing.T, program *ast.Program) ast.Expression {
+	t.Helper()
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	return stmt.Expression
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"let x = 5;", "x", 5},
+		{"let y = true;", "y", true},
+		{"let foobar = y;", "foobar", "y"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
+		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
+			return
+		}
+
+		val := stmt.(*ast.LetStatement).Value
+		if !testLiteralExpression(t, val, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestLetStatementErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let = 5;", "1:5: expected next token to be IDENT, got = instead"},
+		{"let x 5;", "1:7: expected next token to be =, got INT instead"},
+		{"let x, = 5;", "1:8: expected next token to be IDENT, got = instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"const x = 5;", "x", 5},
+		{"const LIMIT = true", "LIMIT", true},
+		{"const foobar = y;", "foobar", "y"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ConstStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ConstStatement. got=%T", program.Statements[0])
+		}
+		if stmt.TokenLiteral() != "const" {
+			t.Errorf("stmt.TokenLiteral not 'const'. got=%q", stmt.TokenLiteral())
+		}
+		if !testIdentifier(t, stmt.Name, tt.expectedIdentifier) {
+			return
+		}
+		if !testLiteralExpression(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestConstStatementErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"const = 5;", "1:7: expected next token to be IDENT, got = instead"},
+		{"const x;", "1:8: expected next token to be =, got ; instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return true;", true},
+		{"return foobar;", "foobar"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ReturnStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+		}
+		if stmt.TokenLiteral() != "return" {
+			t.Fatalf("stmt.TokenLiteral not 'return', got %q", stmt.TokenLiteral())
+		}
+		if !testLiteralExpression(t, stmt.ReturnValue, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestMultipleReturnValues(t *testing.T) {
+	program := parseProgram(t, "return a, 1 + 2, true;")
+
+	stmt, ok := program.Statements[0].(*ast.ReturnStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+	}
+
+	tuple, ok := stmt.ReturnValue.(*ast.TupleLiteral)
+	if !ok {
+		t.Fatalf("stmt.ReturnValue not *ast.TupleLiteral. got=%T", stmt.ReturnValue)
+	}
+	if len(tuple.Elements) != 3 {
+		t.Fatalf("len(tuple.Elements) not 3. got=%d", len(tuple.Elements))
+	}
+
+	testIdentifier(t, tuple.Elements[0], "a")
+	testInfixExpression(t, tuple.Elements[1], 1, "+", 2)
+	testBooleanLiteral(t, tuple.Elements[2], true)
+
+	if stmt.String() != "return a, (1 + 2), true;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestDestructuringLetStatement(t *testing.T) {
+	program := parseProgram(t, "let x, y, z = f();")
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	expected := []string{"x", "y", "z"}
+	if len(stmt.Names) != len(expected) {
+		t.Fatalf("len(stmt.Names) wrong. want=%d, got=%d", len(expected), len(stmt.Names))
+	}
+	for i, name := range expected {
+		testIdentifier(t, stmt.Names[i], name)
+	}
+	if stmt.Name != stmt.Names[0] {
+		t.Errorf("stmt.Name is not stmt.Names[0]")
+	}
+
+	if _, ok := stmt.Value.(*ast.CallExpression); !ok {
+		t.Errorf("stmt.Value not *ast.CallExpression. got=%T", stmt.Value)
+	}
+
+	if stmt.String() != "let x, y, z = f();" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestImportStatement(t *testing.T) {
+	program := parseProgram(t, `import "lib/strings"; import "math"`)
+
+	expected := []string{"lib/strings", "math"}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d",
+			len(expected), len(program.Statements))
+	}
+
+	for i, path := range expected {
+		stmt, ok := program.Statements[i].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ImportStatement. got=%T", program.Statements[i])
+		}
+		if stmt.Path.Value != path {
+			t.Errorf("stmt.Path.Value not %q. got=%q", path, stmt.Path.Value)
+		}
+	}
+
+	if program.String() != `import "lib/strings"; import "math";` {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestImportStatementErrors(t *testing.T) {
+	p := New(lexer.New("import math;"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected errors, got none")
+	}
+	expected := "1:8: expected next token to be STRING, got IDENT instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	input := `let x = 5;
+let y = fn(a) {
+	a +;
+};
+let z 3;`
+
+	program, err := ParseFile("script.monkey", strings.NewReader(input))
+	if program == nil {
+		t.Fatalf("ParseFile returned no program")
+	}
+
+	errors, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("err is not ErrorList. got=%T (%v)", err, err)
+	}
+
+	expected := ErrorList{
+		"script.monkey:3:5: no prefix parse function for ; found",
+		"script.monkey:5:7: expected next token to be =, got INT instead",
+	}
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d (%v)",
+			len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i])
+		}
+	}
+
+	if err.Error() != expected[0]+" (and 1 more errors)" {
+		t.Errorf("err.Error() wrong. got=%q", err.Error())
+	}
+}
+
+func TestParseFileNoErrors(t *testing.T) {
+	program, err := ParseFile("ok.monkey", strings.NewReader("let x = 5; x;"))
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	pos := program.Statements[1].(*ast.ExpressionStatement).Token.Pos
+	if pos.String() != "ok.monkey:1:12" {
+		t.Errorf("wrong position. got=%s", pos)
+	}
+}
+
+func TestReset(t *testing.T) {
+	p := New(lexer.New("let = 5;"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	errorCount := len(errors)
+	if errorCount == 0 {
+		t.Fatalf("expected errors, got none")
+	}
+
+	p.Reset(lexer.NewWithMode("// doc\nlet x = 5; x", lexer.ScanComments))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	if !testLetStatement(t, program.Statements[0], "x") {
+		return
+	}
+	if groups := program.Comments[program.Statements[0]]; len(groups) != 1 || groups[0].Text() != "doc" {
+		t.Errorf("comment not attached after reset. got=%v", program.Comments)
+	}
+
+	p.Reset(lexer.New("y"))
+	second := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if second.String() != "y" {
+		t.Errorf("second.String() wrong. got=%q", second.String())
+	}
+	if second.Comments != nil {
+		t.Errorf("comments leaked across reset. got=%v", second.Comments)
+	}
+	if len(program.Comments) != 1 || len(errors) != errorCount {
+		t.Errorf("reset modified results of an earlier run")
+	}
+}
+
+func TestIdentifierExpression(t *testing.T) {
+	program := parseProgram(t, "foobar;")
+	testIdentifier(t, singleExpression(t, program), "foobar")
+}
+
+func TestIntegerLiteralExpression(t *testing.T) {
+	program := parseProgram(t, "5;")
+	testIntegerLiteral(t, singleExpression(t, program), 5)
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	program := parseProgram(t, "3.25;")
+	exp := singleExpression(t, program)
+
+	lit, ok := exp.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", exp)
+	}
+	if lit.Value != 3.25 {
+		t.Errorf("lit.Value not %v. got=%v", 3.25, lit.Value)
+	}
+	if lit.TokenLiteral() != "3.25" {
+		t.Errorf("lit.TokenLiteral not %q. got=%q", "3.25", lit.TokenLiteral())
+	}
+
+	program = parseProgram(t, "-1.5 * 2")
+	if program.String() != "((-1.5) * 2)" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	program := parseProgram(t, `"hello world";`)
+
+	literal, ok := singleExpression(t, program).(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", singleExpression(t, program))
+	}
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestInterpolatedStringParsing(t *testing.T) {
+	program := parseProgram(t, `"sum is ${a + b}, first is ${xs[0]}!"`)
+
+	str, ok := singleExpression(t, program).(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", singleExpression(t, program))
+	}
+
+	expectedStrings := []string{"sum is ", ", first is ", "!"}
+	if fmt.Sprintf("%q", str.Strings) != fmt.Sprintf("%q", expectedStrings) {
+		t.Errorf("str.Strings wrong. want=%q, got=%q", expectedStrings, str.Strings)
+	}
+	if len(str.Exprs) != 2 {
+		t.Fatalf("len(str.Exprs) not 2. got=%d", len(str.Exprs))
+	}
+	testInfixExpression(t, str.Exprs[0], "a", "+", "b")
+	if _, ok := str.Exprs[1].(*ast.IndexExpression); !ok {
+		t.Errorf("str.Exprs[1] not *ast.IndexExpression. got=%T", str.Exprs[1])
+	}
+}
+
+func TestNestedInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"${x}"`, `"${x}"`},
+		{`"a ${ {"k": 1}["k"] } b"`, `"a ${({"k": 1}["k"])} b"`},
+		{`"outer ${"inner ${y}"} done"`, `"outer ${"inner ${y}"} done"`},
+		{`f("${a}", "${b}")`, `f("${a}", "${b}")`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	p := New(lexer.New(`"a ${x y} b"`))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected errors, got none")
+	}
+	expected := "1:8: expected } to close string interpolation, got IDENT instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestParsingPrefixExpressions(t *testing.T) {
+	prefixTests := []struct {
+		input    string
+		operator string
+		value    interface{}
+	}{
+		{"!5;", "!", 5},
+		{"-15;", "-", 15},
+		{"!foobar;", "!", "foobar"},
+		{"-foobar;", "-", "foobar"},
+		{"!true;", "!", true},
+		{"!false;", "!", false},
+	}
+
+	for _, tt := range prefixTests {
+		program := parseProgram(t, tt.input)
+
+		exp, ok := singleExpression(t, program).(*ast.PrefixExpression)
+		if !ok {
+			t.Fatalf("exp is not *ast.PrefixExpression. got=%T", singleExpression(t, program))
+		}
+		if exp.Operator != tt.operator {
+			t.Fatalf("exp.Operator is not %q. got=%q", tt.operator, exp.Operator)
+		}
+		if !testLiteralExpression(t, exp.Right, tt.value) {
+			return
+		}
+	}
+}
+
+func TestParsingInfixExpressions(t *testing.T) {
+	infixTests := []struct {
+		input      string
+		leftValue  interface{}
+		operator   string
+		rightValue interface{}
+	}{
+		{"5 + 5;", 5, "+", 5},
+		{"5 - 5;", 5, "-", 5},
+		{"5 * 5;", 5, "*", 5},
+		{"5 / 5;", 5, "/", 5},
+		{"5 > 5;", 5, ">", 5},
+		{"5 < 5;", 5, "<", 5},
+		{"5 == 5;", 5, "==", 5},
+		{"5 != 5;", 5, "!=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
+		{"a ?? b", "a", "??", "b"},
+		{"foobar + barfoo;", "foobar", "+", "barfoo"},
+		{"true == true", true, "==", true},
+		{"true != false", true, "!=", false},
+	}
+
+	for _, tt := range infixTests {
+		program := parseProgram(t, tt.input)
+
+		if !testInfixExpression(t, singleExpression(t, program), tt.leftValue, tt.operator, tt.rightValue) {
+			return
+		}
+	}
+}
+
+func TestOperatorPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-a * b", "((-a) * b)"},
+		{"!-a", "(!(-a))"},
+		{"a + b + c", "((a + b) + c)"},
+		{"a + b - c", "((a + b) - c)"},
+		{"a * b * c", "((a * b) * c)"},
+		{"a * b / c", "((a * b) / c)"},
+		{"a + b / c", "(a + (b / c))"},
+		{"a + b * c + d / e - f", "(((a + (b * c)) + (d / e)) - f)"},
+		{"3 + 4; -5 * 5", "(3 + 4); ((-5) * 5)"},
+		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
+		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))"},
+		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
+		{"true", "true"},
+		{"3 > 5 == false", "((3 > 5) == false)"},
+		{"1 + (2 + 3) + 4", "((1 + (2 + 3)) + 4)"},
+		{"(5 + 5) * 2", "((5 + 5) * 2)"},
+		{"-(5 + 5)", "(-(5 + 5))"},
+		{"!(true == true)", "(!(true == true))"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
+		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a | b & c ^ d", "((a | (b & c)) ^ d)"},
+		{"a << b + c >> d", "((a << b) + (c >> d))"},
+		{"a & b == c | d", "((a & b) == (c | d))"},
+		{"-a % b << 1", "(((-a) % b) << 1)"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c", "((a && b) || c)"},
+		{"a == b && c < d || !e", "(((a == b) && (c < d)) || (!e))"},
+		{"a && b && c", "((a && b) && c)"},
+		{"a = b || c", "(a = (b || c))"},
+		{"a ?? b || c", "(a ?? (b || c))"},
+		{"a || b ?? c", "((a || b) ?? c)"},
+		{"a ?? b ?? c", "((a ?? b) ?? c)"},
+		{"a = b ?? c", "(a = (b ?? c))"},
+		{"a ?? b == c", "(a ?? (b == c))"},
+		{"a = b = c + 1", "(a = (b = (c + 1)))"},
+		{"f(a = 1)[0]", "(f((a = 1))[0])"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestComparisonChains(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"a < b < c", []string{
+			"1:7: chained comparison ((a < b) < c) compares the boolean result of (a < b)",
+		}},
+		{"a == b != c == d", []string{
+			"1:8: chained comparison ((a == b) != c) compares the boolean result of (a == b)",
+			"1:13: chained comparison (((a == b) != c) == d) compares the boolean result of ((a == b) != c)",
+		}},
+		{"x > 1 + y > 2", []string{
+			"1:11: chained comparison ((x > (1 + y)) > 2) compares the boolean result of (x > (1 + y))",
+		}},
+		{"(a < b) < c", nil},
+		{"a < b == c > d", nil},
+		{"f(a < b, c < d)", nil},
+	}
+
+	for _, tt := range tests {
+		for _, mode := range []ChainMode{ChainWarn, ChainError, ChainAllow} {
+			p := NewWithOptions(lexer.New(tt.input), Options{ComparisonChains: mode})
+			p.ParseProgram()
+
+			var diagnostics, others []string
+			switch mode {
+			case ChainWarn:
+				diagnostics, others = p.Warnings(), p.Errors()
+			case ChainError:
+				diagnostics, others = p.Errors(), p.Warnings()
+			case ChainAllow:
+				others = append(p.Errors(), p.Warnings()...)
+			}
+
+			expected := tt.expected
+			if mode == ChainAllow {
+				expected = nil
+			}
+			if len(others) != 0 {
+				t.Errorf("mode %d: unexpected diagnostics for %q: %q", mode, tt.input, others)
+			}
+			if fmt.Sprintf("%q", diagnostics) != fmt.Sprintf("%q", expected) && len(diagnostics)+len(expected) > 0 {
+				t.Errorf("mode %d: wrong diagnostics for %q.\nwant=%q\ngot=%q",
+					mode, tt.input, expected, diagnostics)
+			}
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	program := parseProgram(t, `if (x < y) { x }`)
+
+	exp, ok := singleExpression(t, program).(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("exp is not *ast.IfExpression. got=%T", singleExpression(t, program))
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	if len(exp.Consequence.Statements) != 1 {
+		t.Fatalf("consequence is not 1 statement. got=%d", len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not *ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	program := parseProgram(t, `if (x < y) { x } else { y }`)
+
+	exp, ok := singleExpression(t, program).(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("exp is not *ast.IfExpression. got=%T", singleExpression(t, program))
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative is not 1 statement. got=%+v", exp.Alternative)
+	}
+
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not *ast.ExpressionStatement. got=%T",
+			exp.Alternative.Statements[0])
+	}
+	testIdentifier(t, alternative.Expression, "y")
+}
+
+func TestTryExpression(t *testing.T) {
+	program := parseProgram(t, `try { f(x) } catch (err) { err }`)
+
+	exp, ok := singleExpression(t, program).(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("exp is not *ast.TryExpression. got=%T", singleExpression(t, program))
+	}
+	if exp.Body == nil || len(exp.Body.Statements) != 1 {
+		t.Fatalf("exp.Body is not 1 statement. got=%+v", exp.Body)
+	}
+	if exp.Body.String() != "{ f(x) }" {
+		t.Errorf("exp.Body wrong. got=%q", exp.Body.String())
+	}
+	if !testIdentifier(t, exp.Param, "err") {
+		return
+	}
+	if exp.Handler == nil || len(exp.Handler.Statements) != 1 {
+		t.Fatalf("exp.Handler is not 1 statement. got=%+v", exp.Handler)
+	}
+
+	handler, ok := exp.Handler.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not *ast.ExpressionStatement. got=%T",
+			exp.Handler.Statements[0])
+	}
+	testIdentifier(t, handler.Expression, "err")
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"try f()", "1:5: expected next token to be {, got IDENT instead"},
+		{"try { 1 }", "1:10: expected next token to be CATCH, got EOF instead"},
+		{"try { 1 } catch { 2 }", "1:17: expected next token to be (, got { instead"},
+		{"try { 1 } catch (1) { 2 }", "1:18: expected next token to be IDENT, got INT instead"},
+		{"try { 1 } catch (e, f) { 2 }", "1:19: expected next token to be ), got , instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestAssignExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"1 = 2", "1:1: cannot assign to 1"},
+		{"a + b = c", "1:1: cannot assign to (a + b)"},
+		{"(a) = 1", "1:1: cannot assign to a"},
+		{"a[0] = 1", "1:1: cannot assign to (a[0])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	program := parseProgram(t, `while (x < y) { x; break; continue; }`)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("stmt.Body is not 3 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("Statements[1] is not *ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("Statements[2] is not *ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	program := parseProgram(t, `for (x in [1, 2]) { f(x) }; x`)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ForStatement. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+	if stmt.Iterable.String() != "[1, 2]" {
+		t.Errorf("stmt.Iterable wrong. got=%q", stmt.Iterable.String())
+	}
+	if stmt.Body.String() != "{ f(x) }" {
+		t.Errorf("stmt.Body wrong. got=%q", stmt.Body.String())
+	}
+}
+
+func TestLoopStatementErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"while x { 1 }", "1:7: expected next token to be (, got IDENT instead"},
+		{"while (x) 1", "1:11: expected next token to be {, got INT instead"},
+		{"for x in xs { 1 }", "1:5: expected next token to be (, got IDENT instead"},
+		{"for (1 in xs) { 1 }", "1:6: expected next token to be IDENT, got INT instead"},
+		{"for (x, y in xs) { 1 }", "1:7: expected next token to be IN, got , instead"},
+		{"for (x in xs { 1 }", "1:14: expected next token to be ), got { instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	program := parseProgram(t, `fn(x, y) { x + y; }`)
+
+	function, ok := singleExpression(t, program).(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("exp is not *ast.FunctionLiteral. got=%T", singleExpression(t, program))
+	}
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d", len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statement. got=%d",
+			len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not *ast.ExpressionStatement. got=%T",
+			function.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		function := singleExpression(t, program).(*ast.FunctionLiteral)
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestVariadicFunctionParameters(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedVariadic bool
+	}{
+		{"fn(x, y) {}", []string{"x", "y"}, false},
+		{"fn(rest...) {}", []string{"rest"}, true},
+		{"fn(a, b, rest...) {}", []string{"a", "b", "rest"}, true},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		function := singleExpression(t, program).(*ast.FunctionLiteral)
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+		if function.Variadic != tt.expectedVariadic {
+			t.Errorf("function.Variadic wrong for %q. want=%t, got=%t",
+				tt.input, tt.expectedVariadic, function.Variadic)
+		}
+	}
+
+	program := parseProgram(t, "fn(a, rest...) { rest }")
+	if program.String() != "fn(a, rest...) { rest }" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestVariadicParameterErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"fn(rest..., a) {}", "1:11: expected next token to be ), got , instead"},
+		{"macro(rest...) {}", "1:14: macro parameters cannot be variadic"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	program := parseProgram(t, "add(1, 2 * 3, 4 + 5);")
+
+	exp, ok := singleExpression(t, program).(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("exp is not *ast.CallExpression. got=%T", singleExpression(t, program))
+	}
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	program := parseProgram(t, "[1, 2 * 2, 3 + 3]")
+
+	array, ok := singleExpression(t, program).(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.ArrayLiteral. got=%T", singleExpression(t, program))
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingSpreadExpressions(t *testing.T) {
+	tests := []struct {
+		input          string
+		spreadIndexes  []int
+		expectedString string
+	}{
+		{"f(args...)", []int{0}, "f(args...)"},
+		{"f(a, rest...)", []int{1}, "f(a, rest...)"},
+		{"[a, rest...]", []int{1}, "[a, rest...]"},
+		{"[xs..., ys..., 1]", []int{0, 1}, "[xs..., ys..., 1]"},
+		{"f([1, 2] + g()...)", []int{0}, "f(([1, 2] + g())...)"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		exp := singleExpression(t, program)
+
+		var elements []ast.Expression
+		switch exp := exp.(type) {
+		case *ast.CallExpression:
+			elements = exp.Arguments
+		case *ast.ArrayLiteral:
+			elements = exp.Elements
+		default:
+			t.Fatalf("unexpected expression type %T", exp)
+		}
+
+		spreads := []int{}
+		for i, el := range elements {
+			if _, ok := el.(*ast.SpreadExpression); ok {
+				spreads = append(spreads, i)
+			}
+		}
+		if fmt.Sprint(spreads) != fmt.Sprint(tt.spreadIndexes) {
+			t.Errorf("wrong spread elements for %q. want=%v, got=%v",
+				tt.input, tt.spreadIndexes, spreads)
+		}
+
+		if program.String() != tt.expectedString {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expectedString, program.String())
+		}
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	program := parseProgram(t, "myArray[1 + 1]")
+
+	indexExp, ok := singleExpression(t, program).(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", singleExpression(t, program))
+	}
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+	testInfixExpression(t, indexExp.Index, 1, "+", 1)
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:2]", "(a[1:2])"},
+		{"a[:2]", "(a[:2])"},
+		{"a[1:]", "(a[1:])"},
+		{"a[:]", "(a[:])"},
+		{"a[i + 1:len(a) - 1]", "(a[(i + 1):(len(a) - 1)])"},
+		{"a[1:][0]", "((a[1:])[0])"},
+	}
+
+	for _, tt := range tests {
+		exp := singleExpression(t, parseProgram(t, tt.input))
+		if exp.String() != tt.expected {
+			t.Errorf("%q: expected %q. got=%q", tt.input, tt.expected, exp.String())
+		}
+	}
+
+	program := parseProgram(t, "s[1:n]")
+	slice, ok := singleExpression(t, program).(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.SliceExpression. got=%T", singleExpression(t, program))
+	}
+	testIdentifier(t, slice.Left, "s")
+	testIntegerLiteral(t, slice.Low, 1)
+	testIdentifier(t, slice.High, "n")
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	program := parseProgram(t, `{"one": 1, "two": 2, "three": 3}`)
+
+	hash, ok := singleExpression(t, program).(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not *ast.HashLiteral. got=%T", singleExpression(t, program))
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not *ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+		if literal.Value != expected[i].key {
+			t.Errorf("pair %d key wrong. want=%q, got=%q", i, expected[i].key, literal.Value)
+		}
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	program := parseProgram(t, "{}")
+
+	hash, ok := singleExpression(t, program).(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not *ast.HashLiteral. got=%T", singleExpression(t, program))
+	}
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	program := parseProgram(t, `macro(x, y) { x + y; }`)
+
+	macro, ok := singleExpression(t, program).(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("exp is not *ast.MacroLiteral. got=%T", singleExpression(t, program))
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d", len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statement. got=%d",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not *ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestQuoteUnquoteParsing(t *testing.T) {
+	program := parseProgram(t, `quote(unquote(a) + b)`)
+
+	quote, ok := singleExpression(t, program).(*ast.QuoteExpression)
+	if !ok {
+		t.Fatalf("exp is not *ast.QuoteExpression. got=%T", singleExpression(t, program))
+	}
+
+	infix, ok := quote.Node.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("quote.Node is not *ast.InfixExpression. got=%T", quote.Node)
+	}
+
+	unquote, ok := infix.Left.(*ast.UnquoteExpression)
+	if !ok {
+		t.Fatalf("infix.Left is not *ast.UnquoteExpression. got=%T", infix.Left)
+	}
+	testIdentifier(t, unquote.Node, "a")
+	testIdentifier(t, infix.Right, "b")
+
+	if program.String() != "quote((unquote(a) + b))" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestQuoteParsingErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"quote 1", "1:7: expected next token to be (, got INT instead"},
+		{"unquote(1, 2)", "1:10: expected next token to be ), got , instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestCommentMap(t *testing.T) {
+	input := `// Package doc.
+// Second line.
+
+// Another group.
+let x = 5; // Five.
+let add = fn(a, b) {
+	// Sum the arguments.
+	return a + b; // Trailing in a block.
+	// Dangling in a block.
+};
+add(x,
+	// The answer.
+	42);
+let y = { x // Trailing in a block expression.
+};
+// Dangling.`
+
+	l := lexer.NewWithMode(input, lexer.ScanComments)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d",
+			len(program.Statements))
+	}
+
+	let := program.Statements[0]
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	ret := fn.Body.Statements[0]
+	call := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	block := program.Statements[3].(*ast.LetStatement).Value.(*ast.BlockExpression).Block
+
+	tests := []struct {
+		node     ast.Node
+		expected []string
+	}{
+		{let, []string{"Package doc.\nSecond line.", "Another group.", "Five."}},
+		{ret, []string{"Sum the arguments.", "Trailing in a block."}},
+		{fn.Body, []string{"Dangling in a block."}},
+		{call.Arguments[1], []string{"The answer."}},
+		{block.Statements[0], []string{"Trailing in a block expression."}},
+		{program, []string{"Dangling."}},
+	}
+
+	for _, tt := range tests {
+		groups, ok := program.Comments[tt.node]
+		if !ok {
+			t.Errorf("no comments associated with %q", tt.node)
+			continue
+		}
+		if len(groups) != len(tt.expected) {
+			t.Errorf("wrong number of groups for %q. expected=%d, got=%d",
+				tt.node, len(tt.expected), len(groups))
+			continue
+		}
+		for i, group := range groups {
+			if group.Text() != tt.expected[i] {
+				t.Errorf("comment group %d for %q wrong. expected=%q, got=%q",
+					i, tt.node, tt.expected[i], group.Text())
+			}
+		}
+	}
+
+	if len(program.Comments) != len(tests) {
+		t.Errorf("program.Comments has wrong length. want=%d, got=%d",
+			len(tests), len(program.Comments))
+	}
+
+	all := program.Comments.Comments()
+	if len(all) != 9 || all[0].Text() != "Package doc.\nSecond line." || all[8].Text() != "Dangling." {
+		t.Errorf("Comments() not sorted by position. got=%v", all)
+	}
+	if filtered := program.Comments.Filter(fn); len(filtered) != 2 {
+		t.Errorf("Filter(fn) has wrong length. want=2, got=%d", len(filtered))
+	}
+}
+
+func TestCommentsSkippedByDefault(t *testing.T) {
+	program := parseProgram(t, "// comment\nlet x = 5; // trailing")
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+			len(program.Statements))
+	}
+	if program.Comments != nil {
+		t.Errorf("program.Comments not nil. got=%v", program.Comments)
+	}
+}
+
+func TestParenExpression(t *testing.T) {
+	program := parseProgram(t, "(a + b) * ((c))")
+	exp := singleExpression(t, program)
+
+	infix, ok := exp.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("exp is not *ast.InfixExpression. got=%T", exp)
+	}
+
+	left, ok := infix.Left.(*ast.ParenExpression)
+	if !ok {
+		t.Fatalf("infix.Left is not *ast.ParenExpression. got=%T", infix.Left)
+	}
+	if !testInfixExpression(t, left.Expression, "a", "+", "b") {
+		return
+	}
+	if left.Rparen.Literal != ")" {
+		t.Errorf("left.Rparen wrong. got=%+v", left.Rparen)
+	}
+
+	outer, ok := infix.Right.(*ast.ParenExpression)
+	if !ok {
+		t.Fatalf("infix.Right is not *ast.ParenExpression. got=%T", infix.Right)
+	}
+	inner, ok := outer.Expression.(*ast.ParenExpression)
+	if !ok {
+		t.Fatalf("outer.Expression is not *ast.ParenExpression. got=%T", outer.Expression)
+	}
+	testIdentifier(t, inner.Expression, "c")
+}
+
+func TestBlockExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedCount int
+		expected      string
+	}{
+		{"{ x }", 1, "{ x }"},
+		{"{ x; y }", 2, "{ x; y }"},
+		{"{ let t = f(); t * t }", 2, "{ let t = f(); (t * t) }"},
+		{"{ return 1; }", 1, "{ return 1; }"},
+		{"{ {a: 1}[a] }", 1, "{ ({a: 1}[a]) }"},
+		{"{ { 1 } }", 1, "{ { 1 } }"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		block, ok := singleExpression(t, program).(*ast.BlockExpression)
+		if !ok {
+			t.Fatalf("exp for %q is not *ast.BlockExpression. got=%T",
+				tt.input, singleExpression(t, program))
+		}
+		if len(block.Block.Statements) != tt.expectedCount {
+			t.Errorf("wrong number of statements for %q. want=%d, got=%d",
+				tt.input, tt.expectedCount, len(block.Block.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestBlockExpressionsVersusHashes(t *testing.T) {
+	program := parseProgram(t, `let y = { let t = 3; t * t }; let h = {"t": 3}; let e = {};`)
+
+	expected := []string{"*ast.BlockExpression", "*ast.HashLiteral", "*ast.HashLiteral"}
+	for i, typ := range expected {
+		value := program.Statements[i].(*ast.LetStatement).Value
+		if fmt.Sprintf("%T", value) != typ {
+			t.Errorf("statement %d value wrong. want=%s, got=%T", i, typ, value)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var out strings.Builder
+	p := NewWithOptions(lexer.New("-a * 2"), Options{Trace: &out})
+	p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := `BEGIN parseStatement (- "-")
+	BEGIN parseExpressionStatement (- "-")
+		BEGIN parseExpression (- "-")
+			BEGIN parsePrefixExpression (- "-")
+				BEGIN parseExpression (IDENT "a")
+					BEGIN parseIdentifier (IDENT "a")
+					END parseIdentifier (IDENT "a")
+				END parseExpression (IDENT "a")
+			END parsePrefixExpression (IDENT "a")
+			BEGIN parseInfixExpression (* "*")
+				BEGIN parseExpression (INT "2")
+					BEGIN parseIntegerLiteral (INT "2")
+					END parseIntegerLiteral (INT "2")
+				END parseExpression (INT "2")
+			END parseInfixExpression (INT "2")
+		END parseExpression (INT "2")
+	END parseExpressionStatement (INT "2")
+END parseStatement (INT "2")
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
+	if s.TokenLiteral() != "let" {
+		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
+		return false
+	}
+
+	letStmt, ok := s.(*ast.LetStatement)
+	if !ok {
+		t.Errorf("s not *ast.LetStatement. got=%T", s)
+		return false
+	}
+
+	if letStmt.Name.Value != name {
+		t.Errorf("letStmt.Name.Value not %q. got=%q", name, letStmt.Name.Value)
+		return false
+	}
+
+	if letStmt.Name.TokenLiteral() != name {
+		t.Errorf("letStmt.Name.TokenLiteral() not %q. got=%q", name, letStmt.Name.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+func testInfixExpression(t *testing.T, exp ast.Expression, left interface{},
+	operator string, right interface{}) bool {
+
+	opExp, ok := exp.(*ast.InfixExpression)
+	if !ok {
+		t.Errorf("exp is not *ast.InfixExpression. got=%T(%s)", exp, exp)
+		return false
+	}
+
+	if !testLiteralExpression(t, opExp.Left, left) {
+		return false
+	}
+
+	if opExp.Operator != operator {
+		t.Errorf("exp.Operator is not %q. got=%q", operator, opExp.Operator)
+		return false
+	}
+
+	return testLiteralExpression(t, opExp.Right, right)
+}
+
+func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
+	switch v := expected.(type) {
+	case int:
+		return testIntegerLiteral(t, exp, int64(v))
+	case int64:
+		return testIntegerLiteral(t, exp, v)
+	case string:
+		return testIdentifier(t, exp, v)
+	case bool:
+		return testBooleanLiteral(t, exp, v)
+	}
+	t.Errorf("type of exp not handled. got=%T", exp)
+	return false
+}
+
+func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
+	integ, ok := il.(*ast.IntegerLiteral)
+	if !ok {
+		t.Errorf("il not *ast.IntegerLiteral. got=%T", il)
+		return false
+	}
+
+	if integ.Value != value {
+		t.Errorf("integ.Value not %d. got=%d", value, integ.Value)
+		return false
+	}
+
+	if integ.TokenLiteral() != fmt.Sprintf("%d", value) {
+		t.Errorf("integ.TokenLiteral not %d. got=%s", value, integ.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		t.Errorf("exp not *ast.Identifier. got=%T", exp)
+		return false
+	}
+
+	if ident.Value != value {
+		t.Errorf("ident.Value not %q. got=%q", value, ident.Value)
+		return false
+	}
+
+	if ident.TokenLiteral() != value {
+		t.Errorf("ident.TokenLiteral not %q. got=%q", value, ident.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
+	bo, ok := exp.(*ast.Boolean)
+	if !ok {
+		t.Errorf("exp not *ast.Boolean. got=%T", exp)
+		return false
+	}
+
+	if bo.Value != value {
+		t.Errorf("bo.Value not %t. got=%t", value, bo.Value)
+		return false
+	}
+
+	if bo.TokenLiteral() != fmt.Sprintf("%t", value) {
+		t.Errorf("bo.TokenLiteral not %t. got=%s", value, bo.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+const benchmarkInput = `let add = fn(a, b) { return a + b; };
+let values = [1, 2 * 3, add(4, 5), {"key": "value"}["key"]];
+if (add(1, 2) > 2) { values[0] } else { -values[1] };`
+
+func BenchmarkParseNew(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p := New(lexer.New(benchmarkInput))
+		p.ParseProgram()
+	}
+}
+
+func BenchmarkParseReset(b *testing.B) {
+	b.ReportAllocs()
+	p := New(lexer.New(""))
+	for i := 0; i < b.N; i++ {
+		p.Reset(lexer.New(benchmarkInput))
+		p.ParseProgram()
+	}
+}
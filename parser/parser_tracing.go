@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+const traceIndentPlaceholder = "\t"
+
+// trace logs entry into the parse function name, together with the current
+// token, to Options.Trace. It returns name so a function can be traced with
+// a single `defer p.untrace(p.trace("parseFoo"))`.
+func (p *Parser) trace(name string) string {
+	if p.opts.Trace == nil {
+		return name
+	}
+	p.traceLevel++
+	p.tracePrint("BEGIN " + name)
+	return name
+}
+
+func (p *Parser) untrace(name string) {
+	if p.opts.Trace == nil {
+		return
+	}
+	p.tracePrint("END " + name)
+	p.traceLevel--
+}
+
+func (p *Parser) tracePrint(msg string) {
+	indent := strings.Repeat(traceIndentPlaceholder, p.traceLevel-1)
+	fmt.Fprintf(p.opts.Trace, "%s%s (%s %q)\n", indent, msg, p.curToken.Type, p.curToken.Literal)
+}
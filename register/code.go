@@ -0,0 +1,233 @@
+// Package register is an experimental backend for Monkey: a compiler and a
+// virtual machine like those of the compiler and vm packages, except that
+// the machine keeps the values it computes in registers rather than on a
+// stack. It exists to compare the two architectures, on the programs of the
+// benchmarks package among others, and may change or go away.
+//
+// Each call has a window of registers of its own, as many as its function
+// needs. The parameters and lets of the function are its first registers,
+// in order of definition, and its temporaries come after them. An
+// instruction names the registers it reads and writes, so that operands
+// that are locals are read where they are instead of being pushed first,
+// and most expressions take a single instruction.
+//
+// The compiler handles what the compiler package does, with the same
+// semantics: the object system, operators and builtins are shared with the
+// evaluator, which the tests compare both backends against.
+package register
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// Opcode is the operation of an instruction.
+type Opcode byte
+
+// The opcodes, with the meaning of their operands. R[x] is register x of
+// the current call, K[x] constant x, G[x] global x and F[x] the free
+// variable x of the closure being executed. Jump targets are indexes of
+// instructions.
+const (
+	OpLoadConstant   Opcode = iota // R[A] = K[B]
+	OpLoadTrue                     // R[A] = true
+	OpLoadFalse                    // R[A] = false
+	OpLoadNull                     // R[A] = null
+	OpMove                         // R[A] = R[B]
+	OpGetGlobal                    // R[A] = G[B]
+	OpSetGlobal                    // G[B] = R[A]
+	OpGetFree                      // R[A] = F[B]
+	OpGetBuiltin                   // R[A] = builtin B
+	OpCurrentClosure               // R[A] = the closure being executed
+	OpCheckSet                     // fail if R[A], the local B, is unset
+
+	OpAdd           // R[A] = R[B] + R[C]
+	OpSub           // R[A] = R[B] - R[C]
+	OpMul           // R[A] = R[B] * R[C]
+	OpDiv           // R[A] = R[B] / R[C]
+	OpMod           // R[A] = R[B] % R[C]
+	OpBitAnd        // R[A] = R[B] & R[C]
+	OpBitOr         // R[A] = R[B] | R[C]
+	OpBitXor        // R[A] = R[B] ^ R[C]
+	OpShiftLeft     // R[A] = R[B] << R[C]
+	OpShiftRight    // R[A] = R[B] >> R[C]
+	OpEqual         // R[A] = R[B] == R[C]
+	OpNotEqual      // R[A] = R[B] != R[C]
+	OpGreaterThan   // R[A] = R[B] > R[C]
+	OpLessThan      // R[A] = R[B] < R[C]
+	OpMinus         // R[A] = -R[B]
+	OpBang          // R[A] = !R[B]
+	OpIndex         // R[A] = R[B][R[C]]
+	OpJump          // jump to A
+	OpJumpIfFalse   // if R[A] is not truthy, jump to B
+	OpJumpIfTrue    // if R[A] is truthy, jump to B
+	OpJumpIfNotNull // if R[A] is not null, jump to B
+
+	OpArray    // R[A] = [R[B], ..., R[B+C-1]]
+	OpHash     // R[A] = {R[B]: R[B+1], ..., R[B+2C-2]: R[B+2C-1]}
+	OpClosure  // R[A] = closure of the function K[B], capturing R[C], ...
+	OpCall     // R[C] = R[A](R[A+1], ..., R[A+B])
+	OpTailCall // return R[A](R[A+1], ..., R[A+B]), or, for a builtin, R[C] = it
+	OpReturn   // return R[A]
+)
+
+// opNames are the names of the opcodes, for disassembly.
+var opNames = [...]string{
+	OpLoadConstant:   "LOADK",
+	OpLoadTrue:       "LOADTRUE",
+	OpLoadFalse:      "LOADFALSE",
+	OpLoadNull:       "LOADNULL",
+	OpMove:           "MOVE",
+	OpGetGlobal:      "GETGLOBAL",
+	OpSetGlobal:      "SETGLOBAL",
+	OpGetFree:        "GETFREE",
+	OpGetBuiltin:     "GETBUILTIN",
+	OpCurrentClosure: "SELF",
+	OpCheckSet:       "CHECKSET",
+	OpAdd:            "ADD",
+	OpSub:            "SUB",
+	OpMul:            "MUL",
+	OpDiv:            "DIV",
+	OpMod:            "MOD",
+	OpBitAnd:         "BAND",
+	OpBitOr:          "BOR",
+	OpBitXor:         "BXOR",
+	OpShiftLeft:      "SHL",
+	OpShiftRight:     "SHR",
+	OpEqual:          "EQ",
+	OpNotEqual:       "NE",
+	OpGreaterThan:    "GT",
+	OpLessThan:       "LT",
+	OpMinus:          "MINUS",
+	OpBang:           "NOT",
+	OpIndex:          "INDEX",
+	OpJump:           "JUMP",
+	OpJumpIfFalse:    "JUMPIFFALSE",
+	OpJumpIfTrue:     "JUMPIFTRUE",
+	OpJumpIfNotNull:  "JUMPIFNOTNULL",
+	OpArray:          "ARRAY",
+	OpHash:           "HASH",
+	OpClosure:        "CLOSURE",
+	OpCall:           "CALL",
+	OpTailCall:       "TAILCALL",
+	OpReturn:         "RETURN",
+}
+
+// numOperands are the numbers of operands the opcodes use.
+var numOperands = [...]int{
+	OpLoadConstant:   2,
+	OpLoadTrue:       1,
+	OpLoadFalse:      1,
+	OpLoadNull:       1,
+	OpMove:           2,
+	OpGetGlobal:      2,
+	OpSetGlobal:      2,
+	OpGetFree:        2,
+	OpGetBuiltin:     2,
+	OpCurrentClosure: 1,
+	OpCheckSet:       2,
+	OpAdd:            3,
+	OpSub:            3,
+	OpMul:            3,
+	OpDiv:            3,
+	OpMod:            3,
+	OpBitAnd:         3,
+	OpBitOr:          3,
+	OpBitXor:         3,
+	OpShiftLeft:      3,
+	OpShiftRight:     3,
+	OpEqual:          3,
+	OpNotEqual:       3,
+	OpGreaterThan:    3,
+	OpLessThan:       3,
+	OpMinus:          2,
+	OpBang:           2,
+	OpIndex:          3,
+	OpJump:           1,
+	OpJumpIfFalse:    2,
+	OpJumpIfTrue:     2,
+	OpJumpIfNotNull:  2,
+	OpArray:          3,
+	OpHash:           3,
+	OpClosure:        3,
+	OpCall:           3,
+	OpTailCall:       3,
+	OpReturn:         1,
+}
+
+// Instr is an instruction. Unlike those of the stack machine, instructions
+// aren't encoded as bytes: the operands are ints, so that the machine
+// doesn't decode them and registers aren't limited to a byte.
+type Instr struct {
+	Op      Opcode
+	A, B, C int
+}
+
+func (ins Instr) String() string {
+	if int(ins.Op) >= len(opNames) {
+		return fmt.Sprintf("OP%d", ins.Op)
+	}
+	operands := [...]int{ins.A, ins.B, ins.C}
+	s := opNames[ins.Op]
+	for _, o := range operands[:numOperands[ins.Op]] {
+		s += fmt.Sprintf(" %d", o)
+	}
+	return s
+}
+
+// Function is the code of a compiled function, or of the main program.
+type Function struct {
+	Name         string // Name the function is bound to, if any.
+	Instructions []Instr
+
+	NumParameters int
+	NumFree       int // Number of values its closures capture.
+	NumRegisters  int
+
+	// LocalNames and FreeNames are the names of the locals and of the free
+	// variables, by index, for errors.
+	LocalNames []string
+	FreeNames  []string
+}
+
+// Type returns COMPILED_FUNCTION_OBJ, since Functions are constants of the
+// programs they are part of, like object.CompiledFunction.
+func (fn *Function) Type() object.ObjectType { return object.COMPILED_FUNCTION_OBJ }
+
+func (fn *Function) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", fn)
+}
+
+// String disassembles fn, one instruction a line.
+func (fn *Function) String() string {
+	var out bytes.Buffer
+	for i, ins := range fn.Instructions {
+		fmt.Fprintf(&out, "%04d %s\n", i, ins)
+	}
+	return out.String()
+}
+
+// Closure is a function together with the values of the free variables it
+// captured when it was created.
+type Closure struct {
+	Fn   *Function
+	Free []object.Object
+}
+
+// Type returns FUNCTION_OBJ, so that builtins such as map accept closures,
+// which they call back on the VM.
+func (c *Closure) Type() object.ObjectType { return object.FUNCTION_OBJ }
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Program is the result of a compilation.
+type Program struct {
+	Main        *Function
+	Constants   []object.Object
+	NumGlobals  int
+	GlobalNames []string // By index, for errors.
+}
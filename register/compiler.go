@@ -0,0 +1,678 @@
+package register
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/compiler"
+	"github.com/j4nu5/monkey/evaluator"
+	"github.com/j4nu5/monkey/object"
+)
+
+// Compiler compiles a program to the instructions of the register machine.
+// It resolves names with the symbol tables of the compiler package, so
+// scoping is the same as there, and reports errors as *compiler.Errors.
+type Compiler struct {
+	constants  []object.Object
+	symbols    *compiler.SymbolTable
+	numGlobals int
+
+	scope *scope
+}
+
+// scope holds the instructions and registers of the program or a function
+// being compiled.
+type scope struct {
+	outer        *scope
+	instructions []Instr
+
+	// Registers of the locals, by symbol index, and whether each may be
+	// unset, because the let defining it may not have run.
+	locals []int
+	unset  []bool
+
+	// conditional is the number of enclosing branches that may not run.
+	conditional int
+
+	// top is the first free register. Those below floor hold locals, and
+	// are never freed, since locals are visible up to the end of the
+	// function.
+	top, floor   int
+	numRegisters int
+}
+
+// resultRegister is the register of the main program that the expression
+// statements evaluate to, and so the register holding its value at the
+// end.
+const resultRegister = 0
+
+// NewCompiler returns a compiler for a program.
+func NewCompiler() *Compiler {
+	symbols := compiler.NewSymbolTable()
+	for i, name := range evaluator.BuiltinNames {
+		symbols.DefineBuiltin(i, name)
+	}
+
+	c := &Compiler{symbols: symbols, scope: &scope{}}
+	c.pin(c.alloc())
+	c.emit(OpLoadNull, resultRegister)
+	return c
+}
+
+// Program returns the program compiled so far.
+func (c *Compiler) Program() *Program {
+	main := make([]Instr, len(c.scope.instructions), len(c.scope.instructions)+1)
+	copy(main, c.scope.instructions)
+	main = append(main, Instr{Op: OpReturn, A: resultRegister})
+
+	return &Program{
+		Main:        &Function{Instructions: main, NumRegisters: c.scope.numRegisters},
+		Constants:   c.constants,
+		NumGlobals:  c.numGlobals,
+		GlobalNames: c.symbols.Names(),
+	}
+}
+
+// Compile appends the code for program to the program being compiled.
+// Errors are *compiler.Errors reporting the innermost node that failed to
+// compile.
+func (c *Compiler) Compile(program *ast.Program) error {
+	_, err := c.compileStatements(program.Statements, resultRegister)
+	return err
+}
+
+// wrap returns err as a *compiler.Error reporting node, unless it already
+// reports a node.
+func wrap(node ast.Node, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*compiler.Error); ok {
+		return err
+	}
+	return &compiler.Error{Pos: node.Pos(), Node: node, Msg: err.Error()}
+}
+
+// compileStatements compiles statements up to the first return statement
+// among them, since those after it can't be reached, and reports whether
+// there was one. Expression statements evaluate to register dst.
+func (c *Compiler) compileStatements(statements []ast.Statement, dst int) (bool, error) {
+	for _, s := range statements {
+		if err := wrap(s, c.compileStatement(s, dst)); err != nil {
+			return false, err
+		}
+		if _, ok := s.(*ast.ReturnStatement); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Compiler) compileStatement(s ast.Statement, dst int) error {
+	mark := c.scope.top
+	defer c.free(mark)
+
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		return c.compileExpression(s.Expression, dst)
+
+	case *ast.LetStatement:
+		if len(s.Names) > 0 {
+			return fmt.Errorf("cannot compile destructuring let")
+		}
+		return c.compileBinding(s.Name, s.Value)
+
+	case *ast.ConstStatement:
+		return c.compileBinding(s.Name, s.Value)
+
+	case *ast.ReturnStatement:
+		r, err := c.compileOperand(s.ReturnValue)
+		if err != nil {
+			return err
+		}
+		c.emit(OpReturn, r)
+		return nil
+
+	default:
+		return fmt.Errorf("cannot compile %s", strings.TrimPrefix(fmt.Sprintf("%T", s), "*ast."))
+	}
+}
+
+// compileBinding compiles binding name to the value of value in the current
+// scope. The register the value is computed in becomes that of a new
+// local.
+func (c *Compiler) compileBinding(name *ast.Identifier, value ast.Expression) error {
+	r := c.alloc()
+	var err error
+	if fn, ok := value.(*ast.FunctionLiteral); ok {
+		err = wrap(fn, c.compileFunction(fn, name.Value, r))
+	} else {
+		err = c.compileExpression(value, r)
+	}
+	if err != nil {
+		return err
+	}
+
+	symbol := c.symbols.Define(name.Value)
+	switch {
+	case symbol.Scope == compiler.GlobalScope:
+		c.emit(OpSetGlobal, r, symbol.Index)
+		if symbol.Index >= c.numGlobals {
+			c.numGlobals = symbol.Index + 1
+		}
+	case symbol.Index < len(c.scope.locals):
+		c.emit(OpMove, c.scope.locals[symbol.Index], r)
+		if c.scope.conditional == 0 {
+			c.scope.unset[symbol.Index] = false
+		}
+	case c.scope.conditional > 0:
+		// Where the let doesn't run, the local must be unset rather than
+		// hold a temporary, so it gets a register no temporary used.
+		local := c.allocFresh()
+		c.emit(OpMove, local, r)
+		c.scope.locals = append(c.scope.locals, local)
+		c.scope.unset = append(c.scope.unset, true)
+		c.pin(local)
+	default:
+		c.scope.locals = append(c.scope.locals, r)
+		c.scope.unset = append(c.scope.unset, false)
+		c.pin(r)
+	}
+	return nil
+}
+
+// compileExpression compiles node to leave its value in register dst.
+func (c *Compiler) compileExpression(node ast.Expression, dst int) error {
+	mark := c.scope.top
+	err := c.compileExpressionTo(node, dst)
+	c.free(mark)
+	return wrap(node, err)
+}
+
+func (c *Compiler) compileExpressionTo(node ast.Expression, dst int) error {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbols.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+		if symbol.Scope == compiler.LocalScope {
+			if r := c.localRegister(symbol); r != dst {
+				c.emit(OpMove, dst, r)
+			}
+			return nil
+		}
+		return c.loadSymbol(symbol, dst)
+
+	case *ast.IntegerLiteral:
+		return c.loadConstant(&object.Integer{Value: node.Value}, dst)
+
+	case *ast.FloatLiteral:
+		return c.loadConstant(&object.Float{Value: node.Value}, dst)
+
+	case *ast.StringLiteral:
+		return c.loadConstant(&object.String{Value: node.Value}, dst)
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(OpLoadTrue, dst)
+		} else {
+			c.emit(OpLoadFalse, dst)
+		}
+
+	case *ast.PrefixExpression:
+		r, err := c.compileOperand(node.Right)
+		if err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(OpBang, dst, r)
+		case "-":
+			c.emit(OpMinus, dst, r)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		return c.compileInfix(node, dst)
+
+	case *ast.BlockExpression:
+		c.symbols = compiler.NewBlockSymbolTable(c.symbols)
+		_, err := c.compileBlock(node.Block, dst)
+		c.symbols = c.symbols.Outer
+		return err
+
+	case *ast.ParenExpression:
+		return c.compileExpression(node.Expression, dst)
+
+	case *ast.IfExpression:
+		return c.compileIf(node, dst)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "", dst)
+
+	case *ast.CallExpression:
+		// The function and its arguments go to consecutive registers.
+		start := c.allocN(1 + len(node.Arguments))
+		if err := c.compileExpression(node.Function, start); err != nil {
+			return err
+		}
+		if err := c.compileElements(node.Arguments, start+1); err != nil {
+			return err
+		}
+		c.emit(OpCall, start, len(node.Arguments), dst)
+
+	case *ast.ArrayLiteral:
+		return c.compileArray(node.Elements, dst)
+
+	case *ast.TupleLiteral:
+		return c.compileArray(node.Elements, dst)
+
+	case *ast.HashLiteral:
+		start := c.allocN(2 * len(node.Pairs))
+		for i, pair := range node.Pairs {
+			if err := c.compileExpression(pair.Key, start+2*i); err != nil {
+				return err
+			}
+			if err := c.compileExpression(pair.Value, start+2*i+1); err != nil {
+				return err
+			}
+		}
+		c.emit(OpHash, dst, start, len(node.Pairs))
+
+	case *ast.IndexExpression:
+		left, err := c.compileOperandBefore(node.Left, node.Index)
+		if err != nil {
+			return err
+		}
+		index, err := c.compileOperand(node.Index)
+		if err != nil {
+			return err
+		}
+		c.emit(OpIndex, dst, left, index)
+
+	default:
+		return fmt.Errorf("cannot compile %s", strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+	}
+
+	return nil
+}
+
+// compileOperand returns the register holding the value of node: that of
+// the local node names, if it is one, or else a new register it compiles
+// node to.
+func (c *Compiler) compileOperand(node ast.Expression) (int, error) {
+	if ident, ok := node.(*ast.Identifier); ok {
+		if symbol, ok := c.symbols.Resolve(ident.Value); ok && symbol.Scope == compiler.LocalScope {
+			return c.localRegister(symbol), nil
+		}
+	}
+	r := c.alloc()
+	return r, c.compileExpression(node, r)
+}
+
+// compileOperandBefore is compileOperand for an operand evaluated before
+// next. A local is only read where it is if next can't rebind it, as a let
+// in a block of next could.
+func (c *Compiler) compileOperandBefore(node, next ast.Expression) (int, error) {
+	switch next.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return c.compileOperand(node)
+	}
+	r := c.alloc()
+	return r, c.compileExpression(node, r)
+}
+
+// localRegister returns the register of the local s, checking first that
+// it is set if its let may not have run.
+func (c *Compiler) localRegister(s compiler.Symbol) int {
+	r := c.scope.locals[s.Index]
+	if c.scope.unset[s.Index] {
+		c.emit(OpCheckSet, r, s.Index)
+	}
+	return r
+}
+
+// loadSymbol loads the value of s into register dst. Locals are loaded as
+// they are, set or not, for closures to capture.
+func (c *Compiler) loadSymbol(s compiler.Symbol, dst int) error {
+	switch s.Scope {
+	case compiler.GlobalScope:
+		c.emit(OpGetGlobal, dst, s.Index)
+	case compiler.LocalScope:
+		if r := c.scope.locals[s.Index]; r != dst {
+			c.emit(OpMove, dst, r)
+		}
+	case compiler.FreeScope:
+		c.emit(OpGetFree, dst, s.Index)
+	case compiler.FunctionScope:
+		c.emit(OpCurrentClosure, dst)
+	case compiler.BuiltinScope:
+		c.emit(OpGetBuiltin, dst, s.Index)
+	default:
+		return fmt.Errorf("cannot compile %s variable %s", strings.ToLower(string(s.Scope)), s.Name)
+	}
+	return nil
+}
+
+// infixOpcodes are the opcodes of the infix operators that evaluate both
+// operands.
+var infixOpcodes = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"%":  OpMod,
+	"&":  OpBitAnd,
+	"|":  OpBitOr,
+	"^":  OpBitXor,
+	"<<": OpShiftLeft,
+	">>": OpShiftRight,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	">":  OpGreaterThan,
+	"<":  OpLessThan,
+}
+
+// shortCircuitOpcodes are the jumps over the right operand of the infix
+// operators that only evaluate it if the left one doesn't decide the
+// result.
+var shortCircuitOpcodes = map[string]Opcode{
+	"&&": OpJumpIfFalse,
+	"||": OpJumpIfTrue,
+	"??": OpJumpIfNotNull,
+}
+
+func (c *Compiler) compileInfix(node *ast.InfixExpression, dst int) error {
+	if op, ok := shortCircuitOpcodes[node.Operator]; ok {
+		if err := c.compileExpression(node.Left, dst); err != nil {
+			return err
+		}
+		jump := c.emit(op, dst, 9999)
+		c.scope.conditional++
+		err := c.compileExpression(node.Right, dst)
+		c.scope.conditional--
+		if err != nil {
+			return err
+		}
+		c.scope.instructions[jump].B = len(c.scope.instructions)
+		return nil
+	}
+
+	left, err := c.compileOperandBefore(node.Left, node.Right)
+	if err != nil {
+		return err
+	}
+	op, ok := infixOpcodes[node.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+	right, err := c.compileOperand(node.Right)
+	if err != nil {
+		return err
+	}
+	c.emit(op, dst, left, right)
+	return nil
+}
+
+// compileIf compiles an if expression. If the condition is a literal, only
+// the branch it selects is compiled, since the other can't be reached.
+func (c *Compiler) compileIf(node *ast.IfExpression, dst int) error {
+	if truthy, ok := literalTruthiness(node.Condition); ok {
+		var err error
+		switch {
+		case truthy:
+			_, err = c.compileBlock(node.Consequence, dst)
+		case node.Alternative != nil:
+			_, err = c.compileBlock(node.Alternative, dst)
+		default:
+			c.emit(OpLoadNull, dst)
+		}
+		return err
+	}
+
+	cond, err := c.compileOperand(node.Condition)
+	if err != nil {
+		return err
+	}
+	// Emit with bogus targets, patched once the targets are known.
+	jumpIfFalse := c.emit(OpJumpIfFalse, cond, 9999)
+
+	c.scope.conditional++
+	defer func() { c.scope.conditional-- }()
+
+	returns, err := c.compileBlock(node.Consequence, dst)
+	if err != nil {
+		return err
+	}
+
+	// No jump is needed over the alternative if the consequence returns.
+	jump := -1
+	if !returns {
+		jump = c.emit(OpJump, 9999)
+	}
+	c.scope.instructions[jumpIfFalse].B = len(c.scope.instructions)
+
+	if node.Alternative == nil {
+		c.emit(OpLoadNull, dst)
+	} else if _, err := c.compileBlock(node.Alternative, dst); err != nil {
+		return err
+	}
+	if jump >= 0 {
+		c.scope.instructions[jump].A = len(c.scope.instructions)
+	}
+
+	return nil
+}
+
+// literalTruthiness reports whether e is a literal, and if so, whether it
+// is truthy.
+func literalTruthiness(e ast.Expression) (truthy bool, ok bool) {
+	switch e := e.(type) {
+	case *ast.ParenExpression:
+		return literalTruthiness(e.Expression)
+	case *ast.Boolean:
+		return e.Value, true
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+// compileBlock compiles block to leave its value in register dst: that of
+// its last statement if it is an expression statement, or else null. It
+// reports whether the block ends by returning, in which case it leaves
+// nothing.
+func (c *Compiler) compileBlock(block *ast.BlockStatement, dst int) (bool, error) {
+	returns, err := c.compileStatements(block.Statements, dst)
+	if err != nil || returns {
+		return returns, err
+	}
+	if !endsWithExpression(block.Statements) {
+		c.emit(OpLoadNull, dst)
+	}
+	return false, nil
+}
+
+func endsWithExpression(statements []ast.Statement) bool {
+	if len(statements) == 0 {
+		return false
+	}
+	_, ok := statements[len(statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+// compileFunction compiles node to a closure in register dst. If name
+// isn't empty, it is the name the function is bound to, by which its body
+// may refer to it.
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string, dst int) error {
+	if node.Variadic {
+		return fmt.Errorf("cannot compile variadic functions")
+	}
+
+	c.symbols = compiler.NewEnclosedSymbolTable(c.symbols)
+	c.scope = &scope{outer: c.scope}
+	if name != "" {
+		c.symbols.DefineFunctionName(name)
+	}
+	for i, p := range node.Parameters {
+		c.symbols.Define(p.Value)
+		c.scope.locals = append(c.scope.locals, i)
+		c.scope.unset = append(c.scope.unset, false)
+		c.pin(c.alloc())
+	}
+
+	// The value of the last expression statement is returned implicitly.
+	result := c.alloc()
+	returns, err := c.compileStatements(node.Body.Statements, result)
+	if err != nil {
+		return err
+	}
+	if !returns {
+		if !endsWithExpression(node.Body.Statements) {
+			c.emit(OpLoadNull, result)
+		}
+		c.emit(OpReturn, result)
+	}
+
+	fn := &Function{
+		Name:          name,
+		Instructions:  c.scope.instructions,
+		NumParameters: len(node.Parameters),
+		NumFree:       len(c.symbols.FreeSymbols),
+		NumRegisters:  c.scope.numRegisters,
+		LocalNames:    c.symbols.Names(),
+	}
+	markTailCalls(fn.Instructions)
+	freeSymbols := c.symbols.FreeSymbols
+	for _, s := range freeSymbols {
+		fn.FreeNames = append(fn.FreeNames, s.Name)
+	}
+	c.symbols = c.symbols.Outer
+	c.scope = c.scope.outer
+
+	// The captured values go to consecutive registers.
+	start := c.allocN(len(freeSymbols))
+	for i, s := range freeSymbols {
+		if err := c.loadSymbol(s, start+i); err != nil {
+			return err
+		}
+	}
+	c.constants = append(c.constants, fn)
+	c.emit(OpClosure, dst, len(c.constants)-1, start)
+	return nil
+}
+
+// markTailCalls turns the calls of the function body ins whose value it
+// returns into tail calls: those followed by an OpReturn of the register
+// they call into, directly or through jumps, as the branches of an if
+// expression are.
+func markTailCalls(ins []Instr) {
+	for i, call := range ins {
+		if call.Op != OpCall {
+			continue
+		}
+		// Jumps only go forward, but following at most len(ins) of them
+		// guards against cycles anyway.
+		target := i + 1
+		for n := 0; n < len(ins) && target < len(ins) && ins[target].Op == OpJump; n++ {
+			target = ins[target].A
+		}
+		if target < len(ins) && ins[target].Op == OpReturn && ins[target].A == call.C {
+			ins[i].Op = OpTailCall
+		}
+	}
+}
+
+func (c *Compiler) compileArray(elements []ast.Expression, dst int) error {
+	start := c.allocN(len(elements))
+	if err := c.compileElements(elements, start); err != nil {
+		return err
+	}
+	c.emit(OpArray, dst, start, len(elements))
+	return nil
+}
+
+// compileElements compiles the elements of an array or the arguments of a
+// call, which may not be spread, to consecutive registers from start.
+func (c *Compiler) compileElements(elements []ast.Expression, start int) error {
+	for i, e := range elements {
+		if _, ok := e.(*ast.SpreadExpression); ok {
+			return &compiler.Error{Pos: e.Pos(), Node: e, Msg: "cannot compile spread"}
+		}
+		if err := c.compileExpression(e, start+i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadConstant adds obj to the constant pool and emits the instruction that
+// loads it into register dst.
+func (c *Compiler) loadConstant(obj object.Object, dst int) error {
+	c.constants = append(c.constants, obj)
+	c.emit(OpLoadConstant, dst, len(c.constants)-1)
+	return nil
+}
+
+// emit appends an instruction to the current scope and returns its index.
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	ins := Instr{Op: op}
+	for i, o := range operands {
+		switch i {
+		case 0:
+			ins.A = o
+		case 1:
+			ins.B = o
+		case 2:
+			ins.C = o
+		}
+	}
+	c.scope.instructions = append(c.scope.instructions, ins)
+	return len(c.scope.instructions) - 1
+}
+
+// alloc returns a free register of the current scope.
+func (c *Compiler) alloc() int {
+	return c.allocN(1)
+}
+
+// allocN returns the first of n consecutive free registers of the current
+// scope.
+func (c *Compiler) allocN(n int) int {
+	s := c.scope
+	r := s.top
+	s.top += n
+	if s.top > s.numRegisters {
+		s.numRegisters = s.top
+	}
+	return r
+}
+
+// allocFresh returns a register of the current scope that no instruction
+// compiled so far uses, which calls start with unset.
+func (c *Compiler) allocFresh() int {
+	s := c.scope
+	r := s.numRegisters
+	s.top = r + 1
+	s.numRegisters = r + 1
+	return r
+}
+
+// free frees the registers from mark up, except those holding locals.
+func (c *Compiler) free(mark int) {
+	if mark < c.scope.floor {
+		mark = c.scope.floor
+	}
+	c.scope.top = mark
+}
+
+// pin keeps register r from being freed, for a local.
+func (c *Compiler) pin(r int) {
+	c.scope.floor = r + 1
+	if c.scope.top < c.scope.floor {
+		c.scope.top = c.scope.floor
+	}
+}
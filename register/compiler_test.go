@@ -0,0 +1,130 @@
+package register
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/j4nu5/monkey/compiler"
+)
+
+func TestFunctionInstructions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			// Locals are read where they are.
+			`fn(a, b) { a + b }`,
+			[]string{
+				"ADD 2 0 1",
+				"RETURN 2",
+			},
+		},
+		{
+			`fn(n) { if (n < 2) { n } else { n - 1 } }`,
+			[]string{
+				"LOADK 3 0",
+				"LT 2 0 3",
+				"JUMPIFFALSE 2 5",
+				"MOVE 1 0",
+				"JUMP 7",
+				"LOADK 3 1",
+				"SUB 1 0 3",
+				"RETURN 1",
+			},
+		},
+		{
+			// Lets get the register their value is computed in.
+			`fn(x) { let y = x * x; y }`,
+			[]string{
+				"MUL 2 0 0",
+				"MOVE 1 2",
+				"RETURN 1",
+			},
+		},
+		{
+			// The callee and the arguments go to consecutive registers, and
+			// a call whose value is returned is a tail call.
+			`fn(f, x) { f(x, 1) }`,
+			[]string{
+				"MOVE 3 0",
+				"MOVE 4 1",
+				"LOADK 5 0",
+				"TAILCALL 3 2 2",
+				"RETURN 2",
+			},
+		},
+		{
+			`fn(f) { if (f) { f() } else { return f(); } }`,
+			[]string{
+				"JUMPIFFALSE 0 4",
+				"MOVE 2 0",
+				"TAILCALL 2 0 1",
+				"JUMP 7",
+				"MOVE 3 0",
+				"TAILCALL 3 0 2",
+				"RETURN 2",
+				"RETURN 1",
+			},
+		},
+		{
+			`fn(f) { f() + 1 }`,
+			[]string{
+				"MOVE 3 0",
+				"CALL 3 0 2",
+				"LOADK 3 0",
+				"ADD 1 2 3",
+				"RETURN 1",
+			},
+		},
+		{
+			`fn(a) { fn() { a } }`,
+			[]string{
+				"MOVE 2 0",
+				"CLOSURE 1 0 2",
+				"RETURN 1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		program := compile(t, parse(t, tt.input))
+
+		fn := program.Constants[len(program.Constants)-1].(*Function)
+		var got []string
+		for _, ins := range fn.Instructions {
+			got = append(got, ins.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: wrong instructions.\nwant=\n%s\ngot=\n%s",
+				tt.input, strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x", "1:1: undefined variable x"},
+		{"fn() { 1; y }", "1:11: undefined variable y"},
+		{"let f = fn(xs...) { xs }", "1:9: cannot compile variadic functions"},
+		{"len([1]...)", "1:5: cannot compile spread"},
+		{"while (true) { 1 }", "1:1: cannot compile WhileStatement"},
+	}
+
+	for _, tt := range tests {
+		err := NewCompiler().Compile(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("%q: expected error %q, got none", tt.input, tt.expected)
+			continue
+		}
+		if _, ok := err.(*compiler.Error); !ok {
+			t.Errorf("%q: error is %T, want *compiler.Error", tt.input, err)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package register
+
+import (
+	"fmt"
+
+	"github.com/j4nu5/monkey/evaluator"
+	"github.com/j4nu5/monkey/object"
+)
+
+const (
+	MaxRegisters = 1 << 16
+	MaxFrames    = 1024
+)
+
+var (
+	Null  = object.NULL
+	True  = object.TRUE
+	False = object.FALSE
+)
+
+// VM executes a compiled program on the register machine. The operators
+// and builtins behave as they do in the evaluator package, whose
+// implementation they share, and so does calling a function with fewer
+// arguments than parameters, which binds the missing ones to null, or with
+// more, which ignores the extra ones.
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	// registers holds the register windows of the calls in progress, one
+	// after the other, growing as needed.
+	registers []object.Object
+	frames    []frame
+
+	// Builtins, indexed as in evaluator.BuiltinNames, of an interpreter that
+	// calls closures back on the VM.
+	builtins []object.Object
+
+	result object.Object
+}
+
+// frame is a call in progress.
+type frame struct {
+	cl   *Closure
+	pc   int // Index of the next instruction.
+	base int // Index of the first register of the call in registers.
+
+	// ret is the index in registers of the register the call returns to,
+	// or -1 for the main program.
+	ret int
+}
+
+// New returns a VM for running program.
+func New(program *Program) *VM {
+	vm := &VM{
+		registers: make([]object.Object, 256),
+		frames:    make([]frame, 0, MaxFrames),
+	}
+
+	in := evaluator.NewWithOptions(evaluator.Options{Call: vm.call})
+	vm.builtins = make([]object.Object, len(evaluator.BuiltinNames))
+	for i, name := range evaluator.BuiltinNames {
+		vm.builtins[i], _ = in.Builtin(name)
+	}
+
+	vm.Reset(program)
+	return vm
+}
+
+// Reset prepares the VM to run program, discarding the state of previous
+// runs, including globals.
+func (vm *VM) Reset(program *Program) {
+	for i := range vm.registers {
+		vm.registers[i] = nil
+	}
+	if cap(vm.globals) < program.NumGlobals {
+		vm.globals = make([]object.Object, program.NumGlobals)
+	} else {
+		for i := range vm.globals {
+			vm.globals[i] = nil
+		}
+		vm.globals = vm.globals[:program.NumGlobals]
+	}
+
+	vm.constants = program.Constants
+	vm.globalNames = program.GlobalNames
+	vm.result = nil
+	vm.frames = vm.frames[:0]
+	// Run grows the registers to those the main program needs.
+	vm.frames = append(vm.frames, frame{cl: &Closure{Fn: program.Main}, ret: -1})
+}
+
+// Result returns the value of the program after Run: that of its last
+// expression statement, or the value it returned.
+func (vm *VM) Result() object.Object {
+	return vm.result
+}
+
+// Run executes the program, stopping at the first error.
+func (vm *VM) Run() error {
+	if len(vm.frames) == 0 {
+		return nil
+	}
+	f := vm.frames[0]
+	if err := vm.grow(f.base + f.cl.Fn.NumRegisters); err != nil {
+		return err
+	}
+	return vm.run(0)
+}
+
+// run executes instructions until the frame at depth returns, or, for the
+// program at depth 0, until it ends.
+func (vm *VM) run(depth int) error {
+	// The frame, its instructions and its registers are reloaded after
+	// every instruction that may change the frame or grow the registers.
+frames:
+	for len(vm.frames) > depth {
+		f := &vm.frames[len(vm.frames)-1]
+		code := f.cl.Fn.Instructions
+		regs := vm.registers[f.base : f.base+f.cl.Fn.NumRegisters]
+
+		for {
+			ins := code[f.pc]
+			f.pc++
+
+			switch ins.Op {
+			case OpLoadConstant:
+				regs[ins.A] = vm.constants[ins.B]
+			case OpLoadTrue:
+				regs[ins.A] = True
+			case OpLoadFalse:
+				regs[ins.A] = False
+			case OpLoadNull:
+				regs[ins.A] = Null
+			case OpMove:
+				regs[ins.A] = regs[ins.B]
+			case OpGetGlobal:
+				global := vm.globals[ins.B]
+				if global == nil {
+					return notFound(vm.globalNames, ins.B)
+				}
+				regs[ins.A] = global
+			case OpSetGlobal:
+				vm.globals[ins.B] = regs[ins.A]
+			case OpGetFree:
+				free := f.cl.Free[ins.B]
+				if free == nil {
+					return notFound(f.cl.Fn.FreeNames, ins.B)
+				}
+				regs[ins.A] = free
+			case OpGetBuiltin:
+				regs[ins.A] = vm.builtins[ins.B]
+			case OpCurrentClosure:
+				regs[ins.A] = f.cl
+			case OpCheckSet:
+				if regs[ins.A] == nil {
+					return notFound(f.cl.Fn.LocalNames, ins.B)
+				}
+
+			case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpBitAnd, OpBitOr, OpBitXor,
+				OpShiftLeft, OpShiftRight, OpEqual, OpNotEqual, OpGreaterThan, OpLessThan:
+				result := evaluator.Infix(infixOperators[ins.Op], regs[ins.B], regs[ins.C])
+				if err, ok := result.(*object.Error); ok {
+					return fmt.Errorf("%s", err.Message)
+				}
+				regs[ins.A] = result
+			case OpMinus, OpBang:
+				operator := "-"
+				if ins.Op == OpBang {
+					operator = "!"
+				}
+				result := evaluator.Prefix(operator, regs[ins.B])
+				if err, ok := result.(*object.Error); ok {
+					return fmt.Errorf("%s", err.Message)
+				}
+				regs[ins.A] = result
+			case OpIndex:
+				result := evaluator.Index(regs[ins.B], regs[ins.C])
+				if err, ok := result.(*object.Error); ok {
+					return fmt.Errorf("%s", err.Message)
+				}
+				regs[ins.A] = result
+
+			case OpJump:
+				f.pc = ins.A
+			case OpJumpIfFalse:
+				if !isTruthy(regs[ins.A]) {
+					f.pc = ins.B
+				}
+			case OpJumpIfTrue:
+				if isTruthy(regs[ins.A]) {
+					f.pc = ins.B
+				}
+			case OpJumpIfNotNull:
+				if regs[ins.A] != Null {
+					f.pc = ins.B
+				}
+
+			case OpArray:
+				elements := make([]object.Object, ins.C)
+				copy(elements, regs[ins.B:ins.B+ins.C])
+				regs[ins.A] = &object.Array{Elements: elements}
+			case OpHash:
+				hash := object.NewHash()
+				for i := ins.B; i < ins.B+2*ins.C; i += 2 {
+					if err := hash.Set(regs[i], regs[i+1]); err != nil {
+						return err
+					}
+				}
+				regs[ins.A] = hash
+			case OpClosure:
+				fn := vm.constants[ins.B].(*Function)
+				free := make([]object.Object, fn.NumFree)
+				copy(free, regs[ins.C:ins.C+fn.NumFree])
+				regs[ins.A] = &Closure{Fn: fn, Free: free}
+
+			case OpCall:
+				if err := vm.callValue(regs[ins.A], f.base+ins.A+1, ins.B, f.base+ins.C); err != nil {
+					return err
+				}
+				continue frames
+			case OpTailCall:
+				cl, ok := regs[ins.A].(*Closure)
+				if !ok {
+					// Builtins have no frame; the OpReturn after the call
+					// returns their result.
+					if err := vm.callValue(regs[ins.A], f.base+ins.A+1, ins.B, f.base+ins.C); err != nil {
+						return err
+					}
+					continue frames
+				}
+				base, ret := f.base, f.ret
+				copy(vm.registers[base:], regs[ins.A+1:ins.A+1+ins.B])
+				vm.frames = vm.frames[:len(vm.frames)-1]
+				if err := vm.callClosure(cl, base, ins.B, ret); err != nil {
+					return err
+				}
+				continue frames
+			case OpReturn:
+				result := regs[ins.A]
+				vm.frames = vm.frames[:len(vm.frames)-1]
+				if f.ret < 0 {
+					vm.result = result
+				} else {
+					vm.registers[f.ret] = result
+				}
+				continue frames
+
+			default:
+				return fmt.Errorf("unhandled opcode %s", ins)
+			}
+		}
+	}
+
+	return nil
+}
+
+// infixOperators are the infix operators of the binary opcodes, indexed by
+// opcode.
+var infixOperators = [...]string{
+	OpAdd:         "+",
+	OpSub:         "-",
+	OpMul:         "*",
+	OpDiv:         "/",
+	OpMod:         "%",
+	OpBitAnd:      "&",
+	OpBitOr:       "|",
+	OpBitXor:      "^",
+	OpShiftLeft:   "<<",
+	OpShiftRight:  ">>",
+	OpEqual:       "==",
+	OpNotEqual:    "!=",
+	OpGreaterThan: ">",
+	OpLessThan:    "<",
+}
+
+// callValue calls callee with the numArgs arguments in registers from
+// args, to return to register ret. A closure gets a frame whose registers
+// start at args, so that the arguments become its first locals; a builtin
+// is called right away.
+func (vm *VM) callValue(callee object.Object, args, numArgs, ret int) error {
+	switch callee := callee.(type) {
+	case *Closure:
+		return vm.callClosure(callee, args, numArgs, ret)
+
+	case *object.Builtin:
+		// The builtin may call closures, which reuse the registers.
+		argv := make([]object.Object, numArgs)
+		copy(argv, vm.registers[args:args+numArgs])
+		result := callee.Fn(argv...)
+		if err, ok := result.(*object.Error); ok {
+			return fmt.Errorf("%s", err.Message)
+		}
+		if result == nil {
+			result = Null
+		}
+		vm.registers[ret] = result
+		return nil
+
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *Closure, base, numArgs, ret int) error {
+	fn := cl.Fn
+	if err := vm.grow(base + fn.NumRegisters); err != nil {
+		return err
+	}
+	for i := numArgs; i < fn.NumParameters; i++ {
+		vm.registers[base+i] = Null
+	}
+	// The locals of lets that don't run must be unset, rather than hold
+	// values of earlier calls.
+	for i := fn.NumParameters; i < fn.NumRegisters; i++ {
+		vm.registers[base+i] = nil
+	}
+	return vm.pushFrame(cl, base, ret)
+}
+
+// notFound returns the error of reading a variable whose let didn't run:
+// that of the variable at index of names.
+func notFound(names []string, index int) error {
+	if index < len(names) && names[index] != "" {
+		return fmt.Errorf("identifier not found: %s", names[index])
+	}
+	return fmt.Errorf("identifier not found")
+}
+
+func (vm *VM) pushFrame(cl *Closure, base, ret int) error {
+	if len(vm.frames) >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.frames = append(vm.frames, frame{cl: cl, base: base, ret: ret})
+	return nil
+}
+
+// grow makes sure that there are n registers.
+func (vm *VM) grow(n int) error {
+	if n <= len(vm.registers) {
+		return nil
+	}
+	if n > MaxRegisters {
+		return fmt.Errorf("stack overflow")
+	}
+	size := 2 * len(vm.registers)
+	for size < n {
+		size *= 2
+	}
+	if size > MaxRegisters {
+		size = MaxRegisters
+	}
+	registers := make([]object.Object, size)
+	copy(registers, vm.registers)
+	vm.registers = registers
+	return nil
+}
+
+// call calls fn with args and runs it to completion, for the builtins that
+// call functions back. The call gets the registers after those of the
+// current frame. Errors are returned as *object.Error values, as builtins
+// expect.
+func (vm *VM) call(fn object.Object, args []object.Object) object.Object {
+	depth := len(vm.frames)
+	top := vm.frames[depth-1]
+	ret := top.base + top.cl.Fn.NumRegisters
+
+	err := vm.grow(ret + 1 + len(args))
+	if err == nil {
+		copy(vm.registers[ret+1:], args)
+		err = vm.callValue(fn, ret+1, len(args), ret)
+	}
+	if err == nil {
+		err = vm.run(depth)
+	}
+	if err != nil {
+		vm.frames = vm.frames[:depth]
+		return &object.Error{Message: err.Error()}
+	}
+	return vm.registers[ret]
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case Null, False:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,200 @@
+package register
+
+import (
+	"testing"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/compiler"
+	"github.com/j4nu5/monkey/evaluator"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/parser"
+	"github.com/j4nu5/monkey/vm"
+)
+
+// conformance are programs that the evaluator, the stack machine and the
+// register machine must agree on.
+var conformance = []string{
+	`1 + 2 * 3 - 4 / 2 % 3`,
+	`[5 & 3, 5 | 3, 5 ^ 3, 1 << 4, 256 >> 2, -7, 2.5 * 2.0]`,
+	`[1 < 2, 1 > 2, 1 == 1, 1 != 1, true == false, !true, !!5, !null_]`,
+	`[true && 1, false && 1, null_ || 2, 1 || 2, null_ ?? 3, 4 ?? 3]`,
+	`"mon" + "key"`,
+	`[1, "two", [3], {"four": 4}][2][0]`,
+	`{"a": 1, 2: "b", true: [3]}[true]`,
+	`{"a": 1}["b"]`,
+	`[[1, 2], [3]][0][1 + 0]`,
+	`if (1 > 2) { 10 } else { 20 }`,
+	`if (1 < 2) { 10 }`,
+	`if (false) { 10 }`,
+	`if (null_) { 1 } else { let x = 2; x * x }`,
+	`{ let a = 1; a + 1 }`,
+	`let a = 1; let b = a + 1; let a = b * 10; [a, b]`,
+	`const c = 5; c * c`,
+	`{ 1; let y = 2; y }`,
+	`let f = fn() { }; f()`,
+	`let f = fn() { 1; let y = 2; }; f()`,
+	`let f = fn(a, b) { a + b }; f(1, 2, 3)`,
+	`let f = fn(a, b) { b }; f(1)`,
+	`let f = fn(a) { return a * 2; 99 }; f(4)`,
+	`let f = fn(a) { if (a > 0) { return a; }; -a }; [f(3), f(-3)]`,
+	`let f = fn(x) { let y = x + 1; let y = y * 2; y }; f(1)`,
+	`let f = fn(x) { x + if (true) { let x = 10; x } }; f(1)`,
+	`let f = fn(x) { let g = fn(y) { x + y }; g(2) }; f(1)`,
+	`let adder = fn(x) { fn(y) { fn(z) { x + y + z } } }; adder(1)(2)(3)`,
+	`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`,
+	`let outer = fn() { let even = fn(n) { if (n == 0) { true } else { !even(n - 1) } }; even(7) }; outer()`,
+	`let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(10000, 0)`,
+	`let count = fn(n) { if (n == 0) { return 0; } count(n - 1) }; count(5000)`,
+	`let f = fn(g) { g(1) }; f(fn(x) { x + 1 })`,
+	`[len("abc"), str(12), int("7"), min(3, 1, 2), abs(-4), sqrt(16.0)]`,
+	`map([1, 2, 3], fn(x) { x * 2 })`,
+	`let k = 3; filter([1, 2, 3, 4], fn(x) { x % 2 == 0 && x < k })`,
+	`reduce([1, 2, 3], fn(acc, x) { acc + x }, 10)`,
+	`sort([3, 1, 2], fn(a, b) { a > b })`,
+	`let twice = fn(f) { fn(x) { f(f(x)) } }; map([1, 2], twice(fn(x) { x + 3 }))`,
+	`map([[1], [2, 3]], fn(xs) { map(xs, fn(x) { reduce(xs, fn(a, y) { a + y * x }, 0) }) })`,
+	`let len = fn(x) { 42 }; len([])`,
+	`[type(fn() {}), type(len), type(1)]`,
+	`let g = 7; let f = fn() { g * 2 }; f()`,
+	`let f = fn() { return 1; }; 2; f(); 3`,
+	`let f = fn(c) { let b = 2; if (c) { let b = 1; }; b }; [f(true), f(false)]`,
+	`let f = fn(c) { if (c) { let b = 1; }; if (c) { b } else { 0 } }; [f(true), f(false)]`,
+	`let x = 10; let y = { let x = 1; x }; [x, y]`,
+	`let x = 10; let y = { let x = x + 1; { let x = x * 2; x } + x }; [x, y]`,
+	`let f = fn(x) { let y = { let x = 1; let t = 5; t * x }; [x, y] }; f(10)`,
+	`let f = { let t = 5; fn() { t } }; f()`,
+	`let f = fn() { let g = { let t = 5; fn() { t } }; g() }; f()`,
+}
+
+func TestConformance(t *testing.T) {
+	for _, input := range conformance {
+		input = "let null_ = [][0];" + input
+		program := parse(t, input)
+		want := evaluator.Eval(program, object.NewEnvironment())
+
+		if got, err := run(t, program); err != nil {
+			t.Errorf("%q: register machine error: %s", input, err)
+		} else if got.Inspect() != want.Inspect() {
+			t.Errorf("%q: register machine gave %s, evaluator %s", input, got.Inspect(), want.Inspect())
+		}
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+		machine := vm.New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			t.Errorf("%q: vm error: %s", input, err)
+		} else if got := machine.LastPoppedStackElem(); got.Inspect() != want.Inspect() {
+			t.Errorf("%q: vm gave %s, evaluator %s", input, got.Inspect(), want.Inspect())
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "division by zero"},
+		{"1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"1(2)", "not a function: INTEGER"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{"{[1]: 2}", "unusable as hash key: ARRAY"},
+		{"let f = fn() { 1 + f() }; f()", "stack overflow"},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{"len()", "wrong number of arguments. got=0, want=1"},
+		{"map([1], fn(x) { x / 0 })", "division by zero"},
+		{"map([1], 1)", "argument to `map` must be FUNCTION, got INTEGER"},
+		{`"abc"["a"]`, "index operator not supported: STRING"},
+		// Variables whose let didn't run are unset, whatever their
+		// registers held before.
+		{"let c = false; if (c) { let b = 1; }; b == b", "identifier not found: b"},
+		{"let f = fn(c) { 1 + 2; if (c) { let b = 1; }; b }; f(false)", "identifier not found: b"},
+		{"let f = fn(c) { if (c) { let b = 1; }; [b] }; f(false)", "identifier not found: b"},
+		{"let g = fn(a) { let q = 99; q }; let f = fn(a, c) { if (c) { let b = 1; }; b }; g(1); f(1, false)", "identifier not found: b"},
+		{"let f = fn(c) { c && if (true) { let b = 1; b }; b }; f(false)", "identifier not found: b"},
+		{"let f = fn(c) { if (c) { let b = 1; }; fn() { b } }; f(false)()", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(t, parse(t, tt.input))
+		if err == nil {
+			t.Errorf("%q: expected error %q, got none", tt.input, tt.expected)
+		} else if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestBuiltinCallbackAfterError(t *testing.T) {
+	// An error in a closure that a builtin calls unwinds its frames, so that
+	// the builtin's caller carries on.
+	input := `let safe = fn(x) { if (x == 0) { 0 } else { 10 / x } };
+	[map([1, 2], safe), map([5, 0], safe)]`
+
+	got, err := run(t, parse(t, input))
+	if err != nil {
+		t.Fatalf("register machine error: %s", err)
+	}
+	if got.Inspect() != "[[10, 5], [2, 0]]" {
+		t.Errorf("wrong result: %s", got.Inspect())
+	}
+}
+
+func TestReset(t *testing.T) {
+	first := compile(t, parse(t, `let a = 1; let f = fn(x) { x + a }; f(1)`))
+	second := compile(t, parse(t, `let b = 10; b * 2`))
+
+	machine := New(first)
+	for i, tt := range []struct {
+		program *Program
+		want    string
+	}{
+		{first, "2"},
+		{second, "20"},
+		{first, "2"},
+	} {
+		machine.Reset(tt.program)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("run %d: register machine error: %s", i, err)
+		}
+		if got := machine.Result().Inspect(); got != tt.want {
+			t.Errorf("run %d: got %s, want %s", i, got, tt.want)
+		}
+	}
+}
+
+func run(t *testing.T, program *ast.Program) (object.Object, error) {
+	t.Helper()
+
+	machine := New(compile(t, program))
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+	return machine.Result(), nil
+}
+
+func compile(t *testing.T, program *ast.Program) *Program {
+	t.Helper()
+
+	comp := NewCompiler()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Program()
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("%q: parser errors: %v", input, errs)
+	}
+	return program
+}
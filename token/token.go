@@ -1,41 +1,179 @@
 package token
 
+import (
+	"fmt"
+	"strings"
+)
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // Where the token starts.
+}
+
+// End returns the position just past the token's source text. It accounts
+// for the quotes and interpolation delimiters that aren't part of the
+// Literal of string tokens.
+func (t Token) End() Position {
+	switch t.Type {
+	case STRING:
+		return t.Pos.Advance(`"` + t.Literal + `"`)
+	case INTERP_START:
+		return t.Pos.Advance(`"` + t.Literal + "${")
+	case INTERP_MID:
+		return t.Pos.Advance("}" + t.Literal + "${")
+	case INTERP_END:
+		return t.Pos.Advance("}" + t.Literal + `"`)
+	case EOF:
+		return t.Pos
+	}
+	return t.Pos.Advance(t.Literal)
+}
+
+// Position is a location in a source file.
+type Position struct {
+	Filename string // May be empty.
+	Line     int    // Starting at 1.
+	Column   int    // Starting at 1, counted in bytes.
+}
+
+// IsValid reports whether the position carries line information.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Advance returns the position just past text, if text started at p.
+func (p Position) Advance(text string) Position {
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		p.Line += strings.Count(text, "\n")
+		p.Column = 1
+		text = text[i+1:]
+	}
+	p.Column += len(text)
+	return p
+}
+
+// String renders the position as "file:line:col", leaving out the parts that
+// are unknown.
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
 
 const (
 	ILLEGAL TokenType = "ILLEGAL"
 	EOF     TokenType = "EOF"
 
+	// COMMENT is only produced by lexers that preserve trivia.
+	COMMENT TokenType = "COMMENT"
+
 	// Identifiers and literals.
-	IDENT TokenType = "IDENT"
-	INT   TokenType = "INT"
+	IDENT  TokenType = "IDENT"
+	INT    TokenType = "INT"
+	FLOAT  TokenType = "FLOAT"
+	STRING TokenType = "STRING"
+
+	// An interpolated string such as "a ${x} b ${y} c" is lexed as
+	// INTERP_START("a "), <tokens of x>, INTERP_MID(" b "), <tokens of y>,
+	// INTERP_END(" c").
+	INTERP_START TokenType = "INTERP_START"
+	INTERP_MID   TokenType = "INTERP_MID"
+	INTERP_END   TokenType = "INTERP_END"
 
 	// Operators.
-	ASSIGN TokenType = "="
-	PLUS   TokenType = "+"
+	ASSIGN   TokenType = "="
+	PLUS     TokenType = "+"
+	MINUS    TokenType = "-"
+	BANG     TokenType = "!"
+	ASTERISK TokenType = "*"
+	SLASH    TokenType = "/"
+	PERCENT  TokenType = "%"
+
+	AMPERSAND TokenType = "&"
+	PIPE      TokenType = "|"
+	CARET     TokenType = "^"
+	LSHIFT    TokenType = "<<"
+	RSHIFT    TokenType = ">>"
+
+	AND TokenType = "&&"
+	OR  TokenType = "||"
+
+	// COALESCE yields its right operand when the left one is null.
+	COALESCE TokenType = "??"
+
+	LT     TokenType = "<"
+	GT     TokenType = ">"
+	EQ     TokenType = "=="
+	NOT_EQ TokenType = "!="
+
+	// ELLIPSIS spreads an array into call arguments or array elements.
+	ELLIPSIS TokenType = "..."
 
 	// Delimiters.
 	COMMA     TokenType = ","
 	SEMICOLON TokenType = ";"
+	COLON     TokenType = ":"
 
-	LPAREN TokenType = "("
-	RPAREN TokenType = ")"
-	LBRACE TokenType = "{"
-	RBRACE TokenType = "}"
+	LPAREN   TokenType = "("
+	RPAREN   TokenType = ")"
+	LBRACE   TokenType = "{"
+	RBRACE   TokenType = "}"
+	LBRACKET TokenType = "["
+	RBRACKET TokenType = "]"
 
 	// Keywords.
 	FUNCTION TokenType = "FUNCTION"
 	LET      TokenType = "LET"
+	CONST    TokenType = "CONST"
+	TRUE     TokenType = "TRUE"
+	FALSE    TokenType = "FALSE"
+	IF       TokenType = "IF"
+	ELSE     TokenType = "ELSE"
+	TRY      TokenType = "TRY"
+	CATCH    TokenType = "CATCH"
+	RETURN   TokenType = "RETURN"
+	WHILE    TokenType = "WHILE"
+	FOR      TokenType = "FOR"
+	IN       TokenType = "IN"
+	BREAK    TokenType = "BREAK"
+	CONTINUE TokenType = "CONTINUE"
+	IMPORT   TokenType = "IMPORT"
+	MACRO    TokenType = "MACRO"
+	QUOTE    TokenType = "QUOTE"
+	UNQUOTE  TokenType = "UNQUOTE"
 )
 
 var keywords = map[string]TokenType{
-	"fn":  FUNCTION,
-	"let": LET,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"try":      TRY,
+	"catch":    CATCH,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"import":   IMPORT,
+	"macro":    MACRO,
+	"quote":    QUOTE,
+	"unquote":  UNQUOTE,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,190 @@
+package vm
+
+import (
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/token"
+)
+
+// Debugger controls a VM running with it as Options.Debugger, for tools
+// such as a command-line debugger or a debug adapter. The VM stops before
+// the first instruction of the program, at the breakpoints set with
+// SetBreakpoint and where the Step the debugger last returned says, and
+// calls Stopped. While Stopped runs, the program is paused: the debugger
+// may inspect it with StackFrames, GlobalVariables and Stack, and change
+// the breakpoints, but must not run the VM. Stopped returns how to go on.
+//
+// Breakpoints and steps work by line: a frame reaches a line when it
+// executes the first instruction of a call or an instruction on another
+// line than the one it executed before.
+type Debugger interface {
+	Stopped(vm *VM, reason StopReason) Step
+}
+
+// StopReason tells why the VM stopped.
+type StopReason int
+
+const (
+	StopEntry      StopReason = iota // Before the first instruction.
+	StopBreakpoint                   // At a breakpoint.
+	StopStep                         // Where the last Step ended.
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopEntry:
+		return "entry"
+	case StopBreakpoint:
+		return "breakpoint"
+	case StopStep:
+		return "step"
+	default:
+		return "unknown"
+	}
+}
+
+// Step tells a VM how to go on after it stopped. All steps stop at
+// breakpoints on the way.
+type Step int
+
+const (
+	// Continue runs to the next breakpoint.
+	Continue Step = iota
+
+	// StepIn stops at the next line reached, in any function.
+	StepIn
+
+	// StepOver stops at the next line the current function, or one of its
+	// callers, reaches. Since a tail call replaces the frame of the caller,
+	// stepping over one stops in the function called.
+	StepOver
+
+	// StepOut stops once the current function has returned.
+	StepOut
+
+	// StepInstruction stops before the next instruction.
+	StepInstruction
+)
+
+// stepEntry is the step that stops the VM before the first instruction.
+const stepEntry Step = -1
+
+// breakpoint is a line of a source file.
+type breakpoint struct {
+	filename string
+	line     int
+}
+
+// SetBreakpoint makes the VM stop when it reaches line of the file
+// filename, empty for sources without a name, if it runs with a Debugger.
+// Breakpoints are kept across runs and resets.
+func (vm *VM) SetBreakpoint(filename string, line int) {
+	if vm.breakpoints == nil {
+		vm.breakpoints = make(map[breakpoint]bool)
+	}
+	vm.breakpoints[breakpoint{filename, line}] = true
+}
+
+// ClearBreakpoint removes the breakpoint at line of the file filename.
+func (vm *VM) ClearBreakpoint(filename string, line int) {
+	delete(vm.breakpoints, breakpoint{filename, line})
+}
+
+// ClearBreakpoints removes all breakpoints.
+func (vm *VM) ClearBreakpoints() {
+	vm.breakpoints = nil
+}
+
+// debug stops the VM before the instruction at ip of the current frame if
+// the debugger asked to or a breakpoint is reached.
+func (vm *VM) debug(ip int) {
+	d := vm.framesIndex - 1
+	pos := vm.frames[d].cl.Fn.SourceMap.Pos(ip)
+	newLine := ip == 0 || pos.Line != vm.lines[d]
+	vm.lines[d] = pos.Line
+
+	var stop bool
+	reason := StopStep
+	switch vm.step {
+	case stepEntry:
+		stop, reason = true, StopEntry
+	case StepIn:
+		stop = newLine
+	case StepOver:
+		stop = newLine && vm.framesIndex <= vm.stepFrames
+	case StepOut:
+		stop = vm.framesIndex < vm.stepFrames
+	case StepInstruction:
+		stop = true
+	}
+	if newLine && vm.breakpoints[breakpoint{pos.Filename, pos.Line}] {
+		stop, reason = true, StopBreakpoint
+	}
+
+	if stop {
+		vm.step = vm.opts.Debugger.Stopped(vm, reason)
+		vm.stepFrames = vm.framesIndex
+	}
+}
+
+// Variable is a named value of a program.
+type Variable struct {
+	Name  string // Empty if the bytecode doesn't record it.
+	Value object.Object
+}
+
+// StackFrame is a call in progress.
+type StackFrame struct {
+	Function string // "fn" if anonymous, and "main" for the main program.
+
+	// Pos is the position of the instruction the frame executes, which
+	// for all but the innermost frame is a call.
+	Pos token.Position
+
+	Locals []Variable // The parameters and the lets defined so far.
+	Free   []Variable // The variables the function captured.
+}
+
+// StackFrames returns the calls in progress, innermost first.
+func (vm *VM) StackFrames() []StackFrame {
+	frames := make([]StackFrame, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		f := &vm.frames[i]
+		fn := f.cl.Fn
+		frame := StackFrame{Function: mainName, Pos: vm.framePos(i)}
+		if i > 0 {
+			frame.Function = functionName(fn)
+			frame.Locals = variables(fn.LocalNames, vm.stack[f.basePointer:f.basePointer+fn.NumLocals])
+			frame.Free = variables(fn.FreeNames, f.cl.Free)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// GlobalVariables returns the globals defined so far, by index.
+func (vm *VM) GlobalVariables() []Variable {
+	return variables(vm.globalNames, vm.globals)
+}
+
+// variables returns the values that aren't nil, with their names.
+func variables(names []string, values []object.Object) []Variable {
+	var vars []Variable
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		var name string
+		if i < len(names) {
+			name = names[i]
+		}
+		vars = append(vars, Variable{Name: name, Value: v})
+	}
+	return vars
+}
+
+// Stack returns the values on the stack, bottom first, including the
+// locals of the calls in progress. It is only valid until the VM runs
+// again.
+func (vm *VM) Stack() []object.Object {
+	return vm.stack[:vm.sp]
+}
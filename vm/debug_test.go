@@ -0,0 +1,147 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/j4nu5/monkey/compiler"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/parser"
+)
+
+const debugInput = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let x = add(1, 2);
+let y = add(x, 10);
+map([y], fn(v) {
+  v * 2
+})`
+
+// scriptedDebugger records where the VM stops, as the innermost frame and
+// what it shows, and answers with steps in turn, then Continue.
+type scriptedDebugger struct {
+	steps []Step
+	stops []string
+	show  func(vm *VM) string
+}
+
+func (d *scriptedDebugger) Stopped(vm *VM, reason StopReason) Step {
+	frame := vm.StackFrames()[0]
+	stop := fmt.Sprintf("%s %s:%d", reason, frame.Function, frame.Pos.Line)
+	if d.show != nil {
+		stop += " " + d.show(vm)
+	}
+	d.stops = append(d.stops, stop)
+
+	if len(d.steps) == 0 {
+		return Continue
+	}
+	step := d.steps[0]
+	d.steps = d.steps[1:]
+	return step
+}
+
+// runDebugged runs debugInput under d, optimized if optimize is set.
+func runDebugged(t *testing.T, d *scriptedDebugger, optimize bool, breakpoints ...int) {
+	t.Helper()
+
+	p := parser.New(lexer.NewFile("debug.monkey", debugInput, 0))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	if optimize {
+		bytecode = compiler.Optimize(bytecode)
+	}
+	vm := NewWithOptions(bytecode, Options{Debugger: d})
+	for _, line := range breakpoints {
+		vm.SetBreakpoint("debug.monkey", line)
+	}
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if got := vm.LastPoppedStackElem().Inspect(); got != "[26]" {
+		t.Errorf("wrong result under the debugger: %s", got)
+	}
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	// The names of the variables survive optimization.
+	for _, optimize := range []bool{false, true} {
+		d := &scriptedDebugger{show: func(vm *VM) string {
+			var vars []string
+			for _, frame := range vm.StackFrames() {
+				for _, v := range append(frame.Locals, frame.Free...) {
+					vars = append(vars, v.Name+"="+v.Value.Inspect())
+				}
+				vars = append(vars, "|")
+			}
+			for _, v := range vm.GlobalVariables() {
+				vars = append(vars, v.Name)
+			}
+			return strings.Join(vars, " ")
+		}}
+		runDebugged(t, d, optimize, 3, 8)
+
+		// The let of the second call is cleared until it is defined again,
+		// and the closure map calls back stops too.
+		expected := []string{
+			"entry main:1 |",
+			"breakpoint add:3 a=1 b=2 sum=3 | | add",
+			"breakpoint add:3 a=3 b=10 sum=13 | | add x",
+			"breakpoint fn:8 v=13 | | add x y",
+		}
+		if strings.Join(d.stops, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("wrong stops, optimized=%t.\nwant=\n%s\ngot=\n%s", optimize, strings.Join(expected, "\n"), strings.Join(d.stops, "\n"))
+		}
+	}
+}
+
+func TestDebuggerSteps(t *testing.T) {
+	d := &scriptedDebugger{steps: []Step{StepOver, StepIn, StepOver, StepOut, StepOver, StepOver, StepIn, Continue}}
+	runDebugged(t, d, false, 8)
+
+	expected := []string{
+		"entry main:1",
+		"step main:5",
+		"step add:2",
+		"step add:3",
+		"step main:5",
+		"step main:6",
+		"step main:7",
+		"breakpoint fn:8", // Where the step would have stopped too.
+	}
+	if strings.Join(d.stops, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong stops.\nwant=\n%s\ngot=\n%s", strings.Join(expected, "\n"), strings.Join(d.stops, "\n"))
+	}
+}
+
+func TestDebuggerStepInstruction(t *testing.T) {
+	var depths []int
+	d := &scriptedDebugger{show: func(vm *VM) string {
+		depths = append(depths, len(vm.Stack()))
+		return ""
+	}}
+	for i := 0; i < 6; i++ {
+		d.steps = append(d.steps, StepInstruction)
+	}
+	runDebugged(t, d, false)
+
+	// OpClosure, OpSetGlobal, OpGetGlobal, OpConstant, OpConstant, OpCall
+	// and the first instruction of add.
+	if fmt.Sprint(depths) != "[0 1 0 1 2 3 4]" {
+		t.Errorf("wrong stack depths at the instructions: %v", depths)
+	}
+	if last := d.stops[len(d.stops)-1]; last != "step add:2 " {
+		t.Errorf("wrong last stop %q", last)
+	}
+}
@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/object"
+)
+
+// Frame is a call in progress: the closure being executed, the position of
+// its last instruction executed and where its locals start on the stack.
+// The VM keeps its frames in an array allocated once, so calls don't
+// allocate.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+// Instructions returns the instructions of the function the frame executes.
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
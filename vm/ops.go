@@ -0,0 +1,317 @@
+package vm
+
+import (
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/evaluator"
+	"github.com/j4nu5/monkey/object"
+)
+
+// An opHandler executes the instruction at ip of ins, the instructions of
+// the current frame, and leaves the frame's ip at its last byte.
+type opHandler func(vm *VM, ins code.Instructions, ip int) error
+
+// handlers are the handlers of the opcodes, indexed by opcode; those of
+// undefined opcodes are nil. Run dispatches instructions through them, so
+// the per-instruction cost, which BenchmarkDispatch measures, doesn't grow
+// with the number of opcodes.
+var handlers [256]opHandler
+
+func init() {
+	for op, handler := range map[code.Opcode]opHandler{
+		code.OpConstant: (*VM).opConstant,
+		code.OpPop:      (*VM).opPop,
+		code.OpDup:      (*VM).opDup,
+
+		code.OpTrue:  (*VM).opTrue,
+		code.OpFalse: (*VM).opFalse,
+		code.OpNull:  (*VM).opNull,
+
+		code.OpMinus: (*VM).opMinus,
+		code.OpBang:  (*VM).opBang,
+
+		code.OpJump:          (*VM).opJump,
+		code.OpJumpNotTruthy: (*VM).opJumpNotTruthy,
+		code.OpAnd:           (*VM).opShortCircuit,
+		code.OpOr:            (*VM).opShortCircuit,
+		code.OpCoalesce:      (*VM).opShortCircuit,
+
+		code.OpGetGlobal: (*VM).opGetGlobal,
+		code.OpSetGlobal: (*VM).opSetGlobal,
+		code.OpGetLocal:  (*VM).opGetLocal,
+		code.OpSetLocal:  (*VM).opSetLocal,
+
+		code.OpArray: (*VM).opArray,
+		code.OpHash:  (*VM).opHash,
+		code.OpIndex: (*VM).opIndex,
+
+		code.OpIndexConstant: (*VM).opIndexConstant,
+
+		code.OpCall:        (*VM).opCall,
+		code.OpTailCall:    (*VM).opTailCall,
+		code.OpReturnValue: (*VM).opReturnValue,
+		code.OpReturn:      (*VM).opReturn,
+
+		code.OpClosure:        (*VM).opClosure,
+		code.OpGetFree:        (*VM).opGetFree,
+		code.OpCurrentClosure: (*VM).opCurrentClosure,
+		code.OpGetBuiltin:     (*VM).opGetBuiltin,
+	} {
+		handlers[op] = handler
+	}
+	for op, operator := range binaryOperators {
+		if operator != "" {
+			handlers[op] = (*VM).opBinary
+		}
+	}
+}
+
+// binaryOperators are the infix operators of the binary opcodes, indexed by
+// opcode.
+var binaryOperators = [256]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpMod:         "%",
+	code.OpBitAnd:      "&",
+	code.OpBitOr:       "|",
+	code.OpBitXor:      "^",
+	code.OpShiftLeft:   "<<",
+	code.OpShiftRight:  ">>",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+func (vm *VM) opConstant(ins code.Instructions, ip int) error {
+	constIndex := code.ReadUint16(ins[ip+1:])
+	vm.currentFrame().ip += 2
+	return vm.push(vm.constants[constIndex])
+}
+
+func (vm *VM) opPop(ins code.Instructions, ip int) error {
+	vm.pop()
+	return nil
+}
+
+func (vm *VM) opDup(ins code.Instructions, ip int) error {
+	return vm.push(vm.StackTop())
+}
+
+func (vm *VM) opTrue(ins code.Instructions, ip int) error {
+	return vm.push(True)
+}
+
+func (vm *VM) opFalse(ins code.Instructions, ip int) error {
+	return vm.push(False)
+}
+
+func (vm *VM) opNull(ins code.Instructions, ip int) error {
+	return vm.push(Null)
+}
+
+func (vm *VM) opBinary(ins code.Instructions, ip int) error {
+	right := vm.pop()
+	left := vm.pop()
+	return vm.pushResult(evaluator.InfixWithPool(vm.ints, binaryOperators[ins[ip]], left, right))
+}
+
+func (vm *VM) opMinus(ins code.Instructions, ip int) error {
+	return vm.pushResult(evaluator.PrefixWithPool(vm.ints, "-", vm.pop()))
+}
+
+func (vm *VM) opBang(ins code.Instructions, ip int) error {
+	return vm.pushResult(evaluator.Prefix("!", vm.pop()))
+}
+
+func (vm *VM) opJump(ins code.Instructions, ip int) error {
+	pos := int(code.ReadUint16(ins[ip+1:]))
+	vm.currentFrame().ip = pos - 1
+	return nil
+}
+
+func (vm *VM) opJumpNotTruthy(ins code.Instructions, ip int) error {
+	pos := int(code.ReadUint16(ins[ip+1:]))
+	vm.currentFrame().ip += 2
+	if !isTruthy(vm.pop()) {
+		vm.currentFrame().ip = pos - 1
+	}
+	return nil
+}
+
+// opShortCircuit executes OpAnd, OpOr and OpCoalesce.
+func (vm *VM) opShortCircuit(ins code.Instructions, ip int) error {
+	pos := int(code.ReadUint16(ins[ip+1:]))
+	vm.currentFrame().ip += 2
+
+	var decided bool
+	switch top := vm.StackTop(); code.Opcode(ins[ip]) {
+	case code.OpAnd:
+		decided = !isTruthy(top)
+	case code.OpOr:
+		decided = isTruthy(top)
+	default:
+		decided = top != Null
+	}
+	if decided {
+		vm.currentFrame().ip = pos - 1
+	} else {
+		vm.pop()
+	}
+	return nil
+}
+
+func (vm *VM) opSetGlobal(ins code.Instructions, ip int) error {
+	globalIndex := code.ReadUint16(ins[ip+1:])
+	vm.currentFrame().ip += 2
+	vm.globals[globalIndex] = vm.pop()
+	return nil
+}
+
+func (vm *VM) opGetGlobal(ins code.Instructions, ip int) error {
+	globalIndex := code.ReadUint16(ins[ip+1:])
+	vm.currentFrame().ip += 2
+	global := vm.globals[globalIndex]
+	if global == nil {
+		return notFound(vm.globalNames, int(globalIndex))
+	}
+	return vm.push(global)
+}
+
+func (vm *VM) opSetLocal(ins code.Instructions, ip int) error {
+	localIndex := code.ReadUint8(ins[ip+1:])
+	frame := vm.currentFrame()
+	frame.ip++
+	vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+	return nil
+}
+
+func (vm *VM) opGetLocal(ins code.Instructions, ip int) error {
+	localIndex := code.ReadUint8(ins[ip+1:])
+	frame := vm.currentFrame()
+	frame.ip++
+	local := vm.stack[frame.basePointer+int(localIndex)]
+	if local == nil {
+		return notFound(frame.cl.Fn.LocalNames, int(localIndex))
+	}
+	return vm.push(local)
+}
+
+func (vm *VM) opArray(ins code.Instructions, ip int) error {
+	numElements := int(code.ReadUint16(ins[ip+1:]))
+	vm.currentFrame().ip += 2
+
+	elements := make([]object.Object, numElements)
+	copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+	vm.sp -= numElements
+
+	return vm.push(&object.Array{Elements: elements})
+}
+
+func (vm *VM) opHash(ins code.Instructions, ip int) error {
+	numElements := int(code.ReadUint16(ins[ip+1:]))
+	vm.currentFrame().ip += 2
+
+	hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+	if err != nil {
+		return err
+	}
+	vm.sp -= numElements
+
+	return vm.push(hash)
+}
+
+func (vm *VM) opIndex(ins code.Instructions, ip int) error {
+	index := vm.pop()
+	left := vm.pop()
+	return vm.pushResult(evaluator.Index(left, index))
+}
+
+// opIndexConstant looks constant keys up in hashes by their hash key,
+// which it computes once per constant, and so once per site indexing with
+// a string literal. Only the key is cached, so lookups see the current
+// contents of the hash.
+func (vm *VM) opIndexConstant(ins code.Instructions, ip int) error {
+	constIndex := code.ReadUint16(ins[ip+1:])
+	vm.currentFrame().ip += 2
+
+	left := vm.pop()
+	hash, ok := left.(*object.Hash)
+	if !ok {
+		return vm.pushResult(evaluator.Index(left, vm.constants[constIndex]))
+	}
+
+	key := vm.hashKeys[constIndex]
+	if key.Type == "" {
+		key = vm.constants[constIndex].(object.Hashable).HashKey()
+		vm.hashKeys[constIndex] = key
+	}
+	if pair, ok := hash.Pairs[key]; ok {
+		return vm.push(pair.Value)
+	}
+	return vm.push(Null)
+}
+
+func (vm *VM) opCall(ins code.Instructions, ip int) error {
+	numArgs := code.ReadUint8(ins[ip+1:])
+	vm.currentFrame().ip++
+	return vm.callFunction(int(numArgs))
+}
+
+func (vm *VM) opTailCall(ins code.Instructions, ip int) error {
+	numArgs := code.ReadUint8(ins[ip+1:])
+	vm.currentFrame().ip++
+	return vm.tailCallFunction(int(numArgs))
+}
+
+func (vm *VM) opReturnValue(ins code.Instructions, ip int) error {
+	returnValue := vm.pop()
+
+	// A return in the main program ends it, leaving the value popped last
+	// as its result.
+	if vm.framesIndex == 1 {
+		vm.currentFrame().ip = len(ins) - 1
+		return nil
+	}
+
+	frame := vm.popFrame()
+	vm.sp = frame.basePointer - 1
+
+	return vm.push(returnValue)
+}
+
+func (vm *VM) opReturn(ins code.Instructions, ip int) error {
+	frame := vm.popFrame()
+	vm.sp = frame.basePointer - 1
+
+	return vm.push(Null)
+}
+
+func (vm *VM) opClosure(ins code.Instructions, ip int) error {
+	constIndex := code.ReadUint16(ins[ip+1:])
+	numFree := code.ReadUint8(ins[ip+3:])
+	vm.currentFrame().ip += 3
+	return vm.pushClosure(int(constIndex), int(numFree))
+}
+
+func (vm *VM) opGetFree(ins code.Instructions, ip int) error {
+	freeIndex := code.ReadUint8(ins[ip+1:])
+	frame := vm.currentFrame()
+	frame.ip++
+	free := frame.cl.Free[freeIndex]
+	if free == nil {
+		return notFound(frame.cl.Fn.FreeNames, int(freeIndex))
+	}
+	return vm.push(free)
+}
+
+func (vm *VM) opCurrentClosure(ins code.Instructions, ip int) error {
+	return vm.push(vm.currentFrame().cl)
+}
+
+func (vm *VM) opGetBuiltin(ins code.Instructions, ip int) error {
+	builtinIndex := code.ReadUint8(ins[ip+1:])
+	vm.currentFrame().ip++
+	return vm.push(vm.builtins[builtinIndex])
+}
@@ -0,0 +1,133 @@
+package vm
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/j4nu5/monkey/object"
+)
+
+// WritePprof writes the profile to w in the format of pprof, a gzipped
+// profile.proto, so that `go tool pprof` can show it as a graph, a flame
+// graph or by function. Its samples are the call paths of the profile,
+// with the instructions executed and the time spent in the function at the
+// end of the path, and the functions are located at their first line.
+func (p *Profile) WritePprof(w io.Writer) error {
+	var b protoBuffer
+	indexes := map[string]int64{"": 0}
+	table := []string{""}
+	str := func(s string) int64 {
+		i, ok := indexes[s]
+		if !ok {
+			i = int64(len(table))
+			indexes[s] = i
+			table = append(table, s)
+		}
+		return i
+	}
+
+	for _, t := range [][2]string{{"instructions", "count"}, {"time", "nanoseconds"}} {
+		var vt protoBuffer
+		vt.int(1, str(t[0]))
+		vt.int(2, str(t[1]))
+		b.bytes(1, vt)
+	}
+
+	// Functions and their locations share ids.
+	ids := map[*object.CompiledFunction]uint64{}
+	var functions, locations protoBuffer
+	var walk func(n *callNode, stack []uint64)
+	walk = func(n *callNode, stack []uint64) {
+		id, ok := ids[n.fn]
+		if !ok {
+			id = uint64(len(ids) + 1)
+			ids[n.fn] = id
+			pos := n.fn.SourceMap.Pos(0)
+
+			var fn protoBuffer
+			fn.uint(1, id)
+			fn.int(2, str(nodeName(n)))
+			fn.int(4, str(pos.Filename))
+			fn.int(5, int64(pos.Line))
+			functions.bytes(5, fn)
+
+			var line, loc protoBuffer
+			line.uint(1, id)
+			line.int(2, int64(pos.Line))
+			loc.uint(1, id)
+			loc.bytes(4, line)
+			locations.bytes(4, loc)
+		}
+
+		// Samples list the leaf first.
+		stack = append([]uint64{id}, stack...)
+		if n.instructions > 0 {
+			var sample, locs, values protoBuffer
+			for _, id := range stack {
+				locs.varint(id)
+			}
+			values.varint(uint64(n.instructions))
+			values.varint(uint64(n.time))
+			sample.bytes(1, locs)
+			sample.bytes(2, values)
+			b.bytes(2, sample)
+		}
+		for _, c := range n.children {
+			walk(c, stack)
+		}
+	}
+	if p.root.fn != nil {
+		walk(p.root, nil)
+	}
+	b = append(b, locations...)
+	b = append(b, functions...)
+	for _, s := range table {
+		b.string(6, s)
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protoBuffer encodes protocol buffer messages, as much of the encoding as
+// WritePprof needs.
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		*b = append(*b, byte(x)|0x80)
+		x >>= 7
+	}
+	*b = append(*b, byte(x))
+}
+
+// The wire types of fields.
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuffer) uint(field int, x uint64) {
+	b.varint(uint64(field)<<3 | wireVarint)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int(field int, x int64) {
+	b.uint(field, uint64(x))
+}
+
+// bytes encodes the message or packed repeated field m.
+func (b *protoBuffer) bytes(field int, m protoBuffer) {
+	b.varint(uint64(field)<<3 | wireBytes)
+	b.varint(uint64(len(m)))
+	*b = append(*b, m...)
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	b.varint(uint64(field)<<3 | wireBytes)
+	b.varint(uint64(len(s)))
+	*b = append(*b, s...)
+}
@@ -0,0 +1,245 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/token"
+)
+
+// Profile records where programs spend their time: how many instructions
+// each function executes and for how long, by the calls it is reached
+// through, and the same for each opcode. A VM records into the Profile of
+// its Options while it runs, across runs, so that a Profile may also sum up
+// many runs. The time of an instruction is measured until the next one
+// starts, so that calls to builtins count towards the instruction calling
+// them, and profiling slows programs down several times over.
+//
+// A Profile must not be shared by VMs running concurrently.
+type Profile struct {
+	// root is the call tree of the main program. The main program gets a
+	// new function every run, so it is the root whatever its fn.
+	root *callNode
+
+	// nodes are the nodes of the frames in progress, by frame index; those
+	// beyond the current frame may be stale.
+	nodes []*callNode
+
+	opcodes [256]opcodeCounts
+
+	// The instruction being timed, if lastNode isn't nil, and when it
+	// started.
+	lastNode *callNode
+	lastOp   code.Opcode
+	last     time.Time
+}
+
+// callNode is a function in the call tree of a profile, reached through
+// the calls of its ancestors.
+type callNode struct {
+	fn       *object.CompiledFunction
+	parent   *callNode
+	children []*callNode
+
+	calls        int64
+	instructions int64
+	time         time.Duration
+}
+
+type opcodeCounts struct {
+	count int64
+	time  time.Duration
+}
+
+// NewProfile returns an empty Profile.
+func NewProfile() *Profile {
+	root := &callNode{}
+	return &Profile{root: root, nodes: make([]*callNode, MaxFrames)}
+}
+
+// child returns the node of fn called from n.
+func (n *callNode) child(fn *object.CompiledFunction) *callNode {
+	for _, c := range n.children {
+		if c.fn == fn {
+			return c
+		}
+	}
+	c := &callNode{fn: fn, parent: n}
+	n.children = append(n.children, c)
+	return c
+}
+
+// record counts the instruction at ip of the current frame of vm, which is
+// about to execute, and starts timing it.
+func (p *Profile) record(vm *VM, op code.Opcode, ip int) {
+	now := time.Now()
+	p.stop(now)
+
+	d := vm.framesIndex - 1
+	fn := vm.frames[d].cl.Fn
+	n := p.root
+	if d == 0 {
+		n.fn = fn
+	} else {
+		n = p.nodes[d]
+		// The node of the frame below is up to date, since it executed
+		// the call that made this frame.
+		if parent := p.nodes[d-1]; n == nil || n.fn != fn || n.parent != parent {
+			n = parent.child(fn)
+		}
+	}
+	p.nodes[d] = n
+
+	if ip == 0 {
+		n.calls++
+	}
+	n.instructions++
+	p.opcodes[op].count++
+	p.lastNode, p.lastOp, p.last = n, op, now
+}
+
+// stop ends the timing of the last instruction at now.
+func (p *Profile) stop(now time.Time) {
+	if p.lastNode == nil {
+		return
+	}
+	d := now.Sub(p.last)
+	p.lastNode.time += d
+	p.opcodes[p.lastOp].time += d
+	p.lastNode = nil
+}
+
+// FunctionStats are the totals of a function in a Profile, over all the
+// calls it is reached through.
+type FunctionStats struct {
+	Name string         // "fn" if anonymous, and "main" for the main program.
+	Pos  token.Position // Of its first instruction.
+
+	Calls        int64
+	Instructions int64
+	Time         time.Duration // Spent in its own instructions.
+	TotalTime    time.Duration // Including the functions it calls.
+}
+
+// Functions returns the totals of the functions that executed, by
+// decreasing time, which is where to look for hot spots first.
+func (p *Profile) Functions() []FunctionStats {
+	stats := map[*object.CompiledFunction]*FunctionStats{}
+	var order []*object.CompiledFunction
+	onPath := map[*object.CompiledFunction]int{}
+
+	// walk adds the counts of the subtree of n, and returns its time. A
+	// recursive function's total time only counts its outermost calls.
+	var walk func(n *callNode) time.Duration
+	walk = func(n *callNode) time.Duration {
+		s, ok := stats[n.fn]
+		if !ok {
+			s = &FunctionStats{Name: nodeName(n), Pos: n.fn.SourceMap.Pos(0)}
+			stats[n.fn] = s
+			order = append(order, n.fn)
+		}
+		s.Calls += n.calls
+		s.Instructions += n.instructions
+		s.Time += n.time
+
+		onPath[n.fn]++
+		total := n.time
+		for _, c := range n.children {
+			total += walk(c)
+		}
+		onPath[n.fn]--
+		if onPath[n.fn] == 0 {
+			s.TotalTime += total
+		}
+		return total
+	}
+	if p.root.fn == nil {
+		return nil
+	}
+	walk(p.root)
+
+	result := make([]FunctionStats, len(order))
+	for i, fn := range order {
+		result[i] = *stats[fn]
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Time != result[j].Time {
+			return result[i].Time > result[j].Time
+		}
+		return result[i].Instructions > result[j].Instructions
+	})
+	return result
+}
+
+func nodeName(n *callNode) string {
+	if n.parent == nil {
+		return mainName
+	}
+	return functionName(n.fn)
+}
+
+// OpcodeStats are the totals of an opcode in a Profile.
+type OpcodeStats struct {
+	Name  string
+	Count int64
+	Time  time.Duration
+}
+
+// Opcodes returns the totals of the opcodes that executed, by decreasing
+// time.
+func (p *Profile) Opcodes() []OpcodeStats {
+	var result []OpcodeStats
+	for op, c := range p.opcodes {
+		if c.count == 0 {
+			continue
+		}
+		name := fmt.Sprintf("Op%d", op)
+		if def, err := code.Lookup(byte(op)); err == nil {
+			name = def.Name
+		}
+		result = append(result, OpcodeStats{Name: name, Count: c.count, Time: c.time})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Time != result[j].Time {
+			return result[i].Time > result[j].Time
+		}
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+// WriteReport writes the totals of the functions and of the opcodes to w
+// as tables meant for reading.
+func (p *Profile) WriteReport(w io.Writer) error {
+	ew := &errWriter{w: w}
+	fmt.Fprintf(ew, "%12s %12s %10s %14s  %s\n", "self", "total", "calls", "instructions", "function")
+	for _, f := range p.Functions() {
+		fmt.Fprintf(ew, "%12s %12s %10d %14d  %s (%s)\n",
+			f.Time, f.TotalTime, f.Calls, f.Instructions, f.Name, f.Pos)
+	}
+	fmt.Fprintf(ew, "\n%12s %14s  %s\n", "time", "count", "opcode")
+	for _, o := range p.Opcodes() {
+		fmt.Fprintf(ew, "%12s %14d  %s\n", o.Time, o.Count, o.Name)
+	}
+	return ew.err
+}
+
+// errWriter is a Writer that remembers the first error of w and writes
+// nothing after it.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(b []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	var n int
+	n, ew.err = ew.w.Write(b)
+	return n, ew.err
+}
@@ -0,0 +1,159 @@
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+const profileInput = `let f = fn(x) { x + 1 };
+let g = fn(n) { if (n == 0) { 0 } else { f(n); g(n - 1) } };
+g(3);
+map([1, 2], f)`
+
+func runProfiled(t *testing.T, input string, runs int) *Profile {
+	t.Helper()
+
+	profile := NewProfile()
+	bytecode := compile(t, input)
+	vm := NewWithOptions(bytecode, Options{Profile: profile})
+	for i := 0; i < runs; i++ {
+		vm.Reset(bytecode)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	}
+	return profile
+}
+
+func TestProfileFunctions(t *testing.T) {
+	profile := runProfiled(t, profileInput, 2)
+
+	// Tail calls count as calls, and so do calls back from builtins.
+	expected := map[string]struct {
+		calls, instructions int64
+		line                int
+	}{
+		"main": {2, 0, 1},
+		"f":    {10, 40, 1},
+		"g":    {8, 0, 2},
+	}
+	functions := profile.Functions()
+	if len(functions) != len(expected) {
+		t.Fatalf("wrong number of functions. want=%d, got=%+v", len(expected), functions)
+	}
+	var sum int64
+	for _, f := range functions {
+		want, ok := expected[f.Name]
+		if !ok {
+			t.Errorf("unexpected function %q", f.Name)
+			continue
+		}
+		if f.Calls != want.calls {
+			t.Errorf("%s: wrong calls. want=%d, got=%d", f.Name, want.calls, f.Calls)
+		}
+		if want.instructions != 0 && f.Instructions != want.instructions {
+			t.Errorf("%s: wrong instructions. want=%d, got=%d", f.Name, want.instructions, f.Instructions)
+		}
+		if f.Pos.Line != want.line {
+			t.Errorf("%s: wrong line. want=%d, got=%d", f.Name, want.line, f.Pos.Line)
+		}
+		if f.TotalTime < f.Time {
+			t.Errorf("%s: total time %s below self time %s", f.Name, f.TotalTime, f.Time)
+		}
+		sum += f.Instructions
+	}
+
+	var count int64
+	for _, o := range profile.Opcodes() {
+		count += o.Count
+		if o.Name == "OpAdd" && o.Count != 10 {
+			t.Errorf("wrong OpAdd count. want=10, got=%d", o.Count)
+		}
+	}
+	if count != sum {
+		t.Errorf("opcodes count %d instructions, functions %d", count, sum)
+	}
+}
+
+func TestProfileReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := runProfiled(t, profileInput, 1).WriteReport(&out); err != nil {
+		t.Fatalf("report error: %s", err)
+	}
+	for _, want := range []string{"function\n", " main (1:1)\n", " f (1:17)\n", " g (2:", "OpAdd\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestProfilePprof(t *testing.T) {
+	var out bytes.Buffer
+	if err := runProfiled(t, profileInput, 1).WritePprof(&out); err != nil {
+		t.Fatalf("pprof error: %s", err)
+	}
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("not gzipped: %s", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("not gzipped: %s", err)
+	}
+
+	// Count the top-level fields of the profile, and collect its strings.
+	fields := map[uint64]int{}
+	var table []string
+	for len(data) > 0 {
+		key, n := readVarint(t, data)
+		data = data[n:]
+		switch key & 7 {
+		case wireVarint:
+			_, n = readVarint(t, data)
+			data = data[n:]
+		case wireBytes:
+			size, n := readVarint(t, data)
+			data = data[n:]
+			if key>>3 == 6 {
+				table = append(table, string(data[:size]))
+			}
+			data = data[size:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields[key>>3]++
+	}
+
+	// Two sample types, samples for main, f from main, g, f from g and the
+	// three functions and their locations.
+	for field, want := range map[uint64]int{1: 2, 2: 4, 4: 3, 5: 3} {
+		if fields[field] != want {
+			t.Errorf("wrong number of field %d. want=%d, got=%d", field, want, fields[field])
+		}
+	}
+	if len(table) == 0 || table[0] != "" {
+		t.Fatalf("string table doesn't start with \"\": %q", table)
+	}
+	for _, want := range []string{"main", "f", "g", "instructions", "nanoseconds"} {
+		if !strings.Contains(strings.Join(table, "\n")+"\n", want+"\n") {
+			t.Errorf("string table lacks %q: %q", want, table)
+		}
+	}
+}
+
+func readVarint(t *testing.T, data []byte) (uint64, int) {
+	t.Helper()
+
+	var x uint64
+	for i, b := range data {
+		x |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return x, i + 1
+		}
+	}
+	t.Fatalf("truncated varint")
+	return 0, 0
+}
@@ -0,0 +1,596 @@
+// Package vm executes the bytecode the compiler package produces on a stack
+// machine. The operators and builtins behave as they do in the evaluator
+// package, whose implementation they share, and so does calling a function
+// with fewer arguments than parameters, which binds the missing ones to
+// null, or with more, which ignores the extra ones. Runtime errors are
+// *Errors, which locate the failing instruction in the source by the
+// source maps of the bytecode, by which a Debugger also sets breakpoints.
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/j4nu5/monkey/code"
+	"github.com/j4nu5/monkey/compiler"
+	"github.com/j4nu5/monkey/evaluator"
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/token"
+)
+
+const (
+	StackSize = 2048
+	MaxFrames = 1024
+)
+
+// checkInterval is the number of instructions RunContext executes between
+// checks of its context.
+const checkInterval = 1024
+
+var (
+	Null  = object.NULL
+	True  = object.TRUE
+	False = object.FALSE
+)
+
+// Options configures optional VM behaviour. The zero value gives the
+// behaviour of New.
+type Options struct {
+	// Trace, if set, is where the VM writes each instruction as it is about
+	// to execute it, for debugging the compiler and the VM. Lines show the
+	// offset of the instruction, indented by the depth of the call
+	// executing it, the instruction disassembled and the value on top of
+	// the stack.
+	Trace io.Writer
+
+	// PoolIntegers makes the VM allocate the integers its operators compute
+	// from an object.IntegerPool, which trades memory held by long-lived
+	// results for fewer allocations in arithmetic-heavy code. Small
+	// integers are interned either way.
+	PoolIntegers bool
+
+	// Profile, if set, is where the VM records the instructions it
+	// executes and the time they take, by function and by opcode.
+	Profile *Profile
+
+	// Debugger, if set, is stopped at breakpoints and steps and may inspect
+	// the program there.
+	Debugger Debugger
+}
+
+// VM executes the bytecode of a program.
+type VM struct {
+	opts Options
+
+	// observed is whether instructions are passed to observe, for the
+	// Options that follow execution.
+	observed bool
+
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // Always points to the next free slot; the top is stack[sp-1].
+
+	globals []object.Object
+
+	frames      []Frame
+	framesIndex int
+
+	// Context of the running RunContext call, or nil, and the number of
+	// instructions left until it is checked.
+	ctx       context.Context
+	countdown int
+
+	// Builtins, indexed as in evaluator.BuiltinNames, of an interpreter that
+	// calls closures back on the VM.
+	builtins []object.Object
+
+	// ints allocates the integers of arithmetic; it is nil, which allocates
+	// each one, unless Options.PoolIntegers is set.
+	ints *object.IntegerPool
+
+	// Debugging state, with Options.Debugger: the breakpoints, the step the
+	// debugger last returned and the number of frames then, and the line
+	// each frame executed last, by frame index.
+	breakpoints map[breakpoint]bool
+	step        Step
+	stepFrames  int
+	lines       []int
+
+	// globalNames are the names of the globals, from the bytecode.
+	globalNames []string
+
+	// Hash keys of the constants that OpIndexConstant indexes with, by
+	// constant index; those not computed yet are zero.
+	hashKeys []object.HashKey
+
+	// The error the last failed call back from a builtin returned to it,
+	// and the *Error it stands for, which the builtin's failure is
+	// reported as if it returns that error.
+	callbackErr   *object.Error
+	callbackCause error
+}
+
+// Error is the error of an instruction that failed. Pos is where the
+// instruction was compiled from in the source, if the bytecode has a
+// source map, and Stack the calls that were in progress, innermost first,
+// as in an *object.Error. Calls made by tail calls are gone from the stack.
+type Error struct {
+	Msg   string
+	Pos   token.Position
+	Stack []object.Frame
+}
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// New returns a VM for running bytecode with globals of its own and the
+// default Options.
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithOptions(bytecode, Options{})
+}
+
+// NewWithOptions returns a VM for running bytecode with globals of its own,
+// configured by opts.
+func NewWithOptions(bytecode *compiler.Bytecode, opts Options) *VM {
+	vm := &VM{
+		opts:     opts,
+		observed: opts.Trace != nil || opts.Profile != nil || opts.Debugger != nil,
+		stack:    make([]object.Object, StackSize),
+		globals:  make([]object.Object, bytecode.NumGlobals),
+		frames:   make([]Frame, MaxFrames),
+	}
+	if opts.PoolIntegers {
+		vm.ints = &object.IntegerPool{}
+	}
+	if opts.Debugger != nil {
+		vm.lines = make([]int, MaxFrames)
+	}
+
+	in := evaluator.NewWithOptions(evaluator.Options{Call: vm.call})
+	vm.builtins = make([]object.Object, len(evaluator.BuiltinNames))
+	for i, name := range evaluator.BuiltinNames {
+		vm.builtins[i], _ = in.Builtin(name)
+	}
+
+	vm.start(bytecode)
+	return vm
+}
+
+// Reset prepares the VM to run bytecode, discarding the state of previous
+// runs, including globals. It lets callers that run many programs reuse the
+// stack, frames and globals of one VM instead of allocating new ones.
+// Values returned before the reset are left untouched.
+func (vm *VM) Reset(bytecode *compiler.Bytecode) {
+	for i := range vm.stack {
+		vm.stack[i] = nil
+	}
+	if cap(vm.globals) < bytecode.NumGlobals {
+		vm.globals = make([]object.Object, bytecode.NumGlobals)
+	} else {
+		for i := range vm.globals {
+			vm.globals[i] = nil
+		}
+		vm.globals = vm.globals[:bytecode.NumGlobals]
+	}
+	vm.start(bytecode)
+}
+
+// start sets the VM up to run bytecode from the beginning.
+func (vm *VM) start(bytecode *compiler.Bytecode) {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
+
+	vm.constants = bytecode.Constants
+	vm.globalNames = bytecode.GlobalNames
+	if cap(vm.hashKeys) < len(vm.constants) {
+		vm.hashKeys = make([]object.HashKey, len(vm.constants))
+	} else {
+		for i := range vm.hashKeys {
+			vm.hashKeys[i] = object.HashKey{}
+		}
+		vm.hashKeys = vm.hashKeys[:len(vm.constants)]
+	}
+	vm.sp = 0
+	vm.frames[0] = Frame{cl: &object.Closure{Fn: mainFn}, ip: -1}
+	vm.framesIndex = 1
+}
+
+// NewWithGlobalsStore returns a VM for running bytecode with the globals
+// s, as a REPL running one line at a time does. If bytecode defines
+// globals beyond those of s, the VM uses a copy of s extended to hold
+// them, which Globals returns.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	if n := bytecode.NumGlobals - len(s); n > 0 {
+		s = append(s, make([]object.Object, n)...)
+	}
+	vm.globals = s
+	return vm
+}
+
+// Globals returns the globals of the VM, indexed as by the compiler.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// ReadFrom returns a VM for running the bytecode read from r, as written by
+// compiler.WriteTo.
+func ReadFrom(r io.Reader) (*VM, error) {
+	bytecode, err := compiler.ReadFrom(r)
+	if err != nil {
+		return nil, err
+	}
+	return New(bytecode), nil
+}
+
+// StackTop returns the value on top of the stack, or nil if it is empty.
+func (vm *VM) StackTop() object.Object {
+	if vm.sp == 0 {
+		return nil
+	}
+	return vm.stack[vm.sp-1]
+}
+
+// LastPoppedStackElem returns the value popped last, which after Run is the
+// value of the last expression statement of the program.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return &vm.frames[vm.framesIndex-1]
+}
+
+// pushFrame starts executing cl with its locals starting at basePointer.
+func (vm *VM) pushFrame(cl *object.Closure, basePointer int) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.frames[vm.framesIndex] = Frame{cl: cl, ip: -1, basePointer: basePointer}
+	vm.framesIndex++
+	return nil
+}
+
+// popFrame ends the current call and returns the frame it executed in,
+// which stays valid until the next call.
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return &vm.frames[vm.framesIndex]
+}
+
+// Run executes the program, stopping at the first error. The errors of
+// failing instructions are *Errors.
+func (vm *VM) Run() error {
+	return vm.runMain()
+}
+
+// RunContext is like Run, but stops once ctx is done, so that hosts can
+// cancel programs that run too long. The context is checked before the
+// first instruction and then every so many instructions, and a done
+// context makes RunContext return an "evaluation cancelled" or, if its
+// deadline passed, "evaluation timed out" error, as the evaluator's
+// EvalContext does. Calls to builtins are not interrupted.
+func (vm *VM) RunContext(ctx context.Context) error {
+	saved := vm.ctx
+	vm.ctx, vm.countdown = ctx, 1
+	defer func() { vm.ctx = saved }()
+
+	return vm.runMain()
+}
+
+// runMain runs the program, stopping at its entry for the debugger and
+// leaving out of the profile the time after it stops.
+func (vm *VM) runMain() error {
+	vm.step = stepEntry
+	err := vm.run(0)
+	if vm.opts.Profile != nil {
+		vm.opts.Profile.stop(time.Now())
+	}
+	return err
+}
+
+// The errors of RunContext, which aren't those of an instruction.
+var (
+	errCancelled = errors.New("evaluation cancelled")
+	errTimedOut  = errors.New("evaluation timed out")
+)
+
+// interrupted returns the error to stop execution with if the context of
+// RunContext is done, or nil.
+func (vm *VM) interrupted() error {
+	select {
+	case <-vm.ctx.Done():
+		if vm.ctx.Err() == context.DeadlineExceeded {
+			return errTimedOut
+		}
+		return errCancelled
+	default:
+		return nil
+	}
+}
+
+// run executes instructions until the frame at depth returns, or, for the
+// program at depth 0, until it ends.
+func (vm *VM) run(depth int) error {
+	for vm.framesIndex > depth {
+		frame := vm.currentFrame()
+		ins := frame.Instructions()
+		if frame.ip >= len(ins)-1 {
+			break
+		}
+
+		if vm.ctx != nil {
+			if vm.countdown--; vm.countdown == 0 {
+				vm.countdown = checkInterval
+				if err := vm.interrupted(); err != nil {
+					return err
+				}
+			}
+		}
+
+		frame.ip++
+		ip := frame.ip
+
+		if vm.observed {
+			vm.observe(ins, ip)
+		}
+
+		handler := handlers[ins[ip]]
+		if handler == nil {
+			def, err := code.Lookup(ins[ip])
+			if err != nil {
+				return vm.runtimeError(err)
+			}
+			return vm.runtimeError(fmt.Errorf("unhandled opcode %s", def.Name))
+		}
+		if err := handler(vm, ins, ip); err != nil {
+			return vm.runtimeError(err)
+		}
+	}
+
+	return nil
+}
+
+// observe passes the instruction at ip of ins, which is about to execute,
+// to the tracer, profiler and debugger of the Options.
+func (vm *VM) observe(ins code.Instructions, ip int) {
+	if vm.opts.Trace != nil {
+		vm.trace(ins, ip)
+	}
+	if vm.opts.Profile != nil {
+		vm.opts.Profile.record(vm, code.Opcode(ins[ip]), ip)
+	}
+	if vm.opts.Debugger != nil {
+		vm.debug(ip)
+	}
+}
+
+// runtimeError returns err, the error of the current instruction, as an
+// *Error locating it and the calls in progress.
+func (vm *VM) runtimeError(err error) error {
+	if _, ok := err.(*Error); ok || err == errCancelled || err == errTimedOut {
+		return err
+	}
+
+	e := &Error{Msg: err.Error(), Pos: vm.framePos(vm.framesIndex - 1)}
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		name := functionName(vm.frames[i].cl.Fn)
+		e.Stack = append(e.Stack, object.Frame{Function: name, Pos: vm.framePos(i - 1)})
+	}
+	return e
+}
+
+// mainName is the name profiles and debuggers give the main program.
+const mainName = "main"
+
+// notFound returns the error of reading a variable whose let wasn't
+// executed, such as one in a branch that wasn't taken: that of the
+// variable at index of names, which may not record it.
+func notFound(names []string, index int) error {
+	if index < len(names) && names[index] != "" {
+		return fmt.Errorf("identifier not found: %s", names[index])
+	}
+	return fmt.Errorf("identifier not found")
+}
+
+// functionName returns the name of fn for reports, "fn" if it is
+// anonymous.
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "fn"
+	}
+	return fn.Name
+}
+
+// framePos returns the position in the source of the instruction frame i
+// is executing, or for the frames below the current one, the call they
+// are executing.
+func (vm *VM) framePos(i int) token.Position {
+	f := &vm.frames[i]
+	return f.cl.Fn.SourceMap.Pos(f.ip)
+}
+
+// trace writes the instruction at ip of ins to the Trace writer.
+func (vm *VM) trace(ins code.Instructions, ip int) {
+	top := "-"
+	if o := vm.StackTop(); o != nil {
+		top = o.Inspect()
+	}
+	indent := strings.Repeat("  ", vm.framesIndex-1)
+	fmt.Fprintf(vm.opts.Trace, "%s%04d %-24s %s\n", indent, ip, ins.Instruction(ip), top)
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+// pushResult pushes the result of an operation shared with the evaluator,
+// or returns the error it failed with.
+func (vm *VM) pushResult(result object.Object) error {
+	if err, ok := result.(*object.Error); ok {
+		if err == vm.callbackErr {
+			// A builtin failed with the error of a closure it called,
+			// which is reported where the closure failed.
+			return vm.callbackCause
+		}
+		return fmt.Errorf("%s", err.Message)
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// buildHash returns a hash of the keys and values alternating on the stack
+// between startIndex and endIndex.
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := object.NewHash()
+	for i := startIndex; i < endIndex; i += 2 {
+		if err := hash.Set(vm.stack[i], vm.stack[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return hash, nil
+}
+
+// callFunction calls the function below the numArgs arguments on top of
+// the stack. The arguments of a closure become the first locals of its
+// frame; a builtin is called right away, replacing the function and its
+// arguments with its result.
+func (vm *VM) callFunction(numArgs int) error {
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// tailCallFunction is callFunction for a call whose value the current
+// function returns. A closure is executed in the frame of the current
+// function, which it replaces along with its locals.
+func (vm *VM) tailCallFunction(numArgs int) error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok {
+		// Builtins have no frame; the OpReturnValue after the call returns
+		// their result.
+		return vm.callFunction(numArgs)
+	}
+
+	start := vm.popFrame().basePointer - 1
+	copy(vm.stack[start:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = start + 1 + numArgs
+	return vm.callClosure(cl, numArgs)
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+
+	basePointer := vm.sp - numArgs
+	for i := numArgs; i < fn.NumParameters; i++ {
+		if err := vm.push(Null); err != nil {
+			return err
+		}
+	}
+	if basePointer+fn.NumLocals > StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.sp = basePointer + fn.NumLocals
+	// The slots of the lets may hold values of earlier calls, which reads
+	// of lets that weren't executed mustn't see.
+	for i := fn.NumParameters; i < fn.NumLocals; i++ {
+		vm.stack[basePointer+i] = nil
+	}
+
+	return vm.pushFrame(cl, basePointer)
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	// The builtin may call closures, which reuse the stack.
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp -= numArgs + 1
+
+	result := builtin.Fn(args...)
+	if result == nil {
+		result = Null
+	}
+	return vm.pushResult(result)
+}
+
+// call calls fn with args and runs it to completion, for the builtins that
+// call functions back. Errors are returned as *object.Error values, as
+// builtins expect, with the position and stack of where they happened
+// kept for if the builtin fails with them.
+func (vm *VM) call(fn object.Object, args []object.Object) object.Object {
+	depth, sp := vm.framesIndex, vm.sp
+
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err == nil {
+			err = vm.push(arg)
+		}
+	}
+	if err == nil {
+		err = vm.callFunction(len(args))
+	}
+	if err == nil {
+		err = vm.run(depth)
+	}
+	if err != nil {
+		vm.callbackCause = vm.runtimeError(err)
+		vm.framesIndex, vm.sp = depth, sp
+		vm.callbackErr = &object.Error{Message: err.Error()}
+		if e, ok := vm.callbackCause.(*Error); ok {
+			vm.callbackErr.Message = e.Msg
+		}
+		return vm.callbackErr
+	}
+	return vm.pop()
+}
+
+// pushClosure pushes a closure of the compiled function at constIndex that
+// captures the numFree values on top of the stack.
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case Null, False:
+		return false
+	default:
+		return true
+	}
+}
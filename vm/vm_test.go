@@ -0,0 +1,934 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4nu5/monkey/ast"
+	"github.com/j4nu5/monkey/compiler"
+	"github.com/j4nu5/monkey/evaluator"
+	"github.com/j4nu5/monkey/lexer"
+	"github.com/j4nu5/monkey/object"
+	"github.com/j4nu5/monkey/parser"
+	"github.com/j4nu5/monkey/token"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"2", 2},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"4 / 2", 2},
+		{"7 % 3", 1},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"6 & 3 | 8 ^ 1", 11},
+		{"1 << 4 >> 2", 4},
+		{"1.5 + 1", 2.5},
+		{"7 / 2.0", 3.5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1.0", true},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"(1 < 2) == false", false},
+		{"[1, [2]] == [1, [2.0]]", true},
+		{`{"a": 1} != {"a": 1}`, false},
+		{"!true", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{"true && 1", 1},
+		{"false && 1", false},
+		{"0 || 2", 0},
+		{"(1 > 2) || 3", 3},
+		{"[][0] ?? 4", 4},
+		{"false ?? 4", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 }", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 > 2) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 5;", 5},
+		{"1; return 5; 6", 5},
+		{"{ return 5; }", 5},
+		{"let x = 2; if (x > 1) { return x * 10; }; 3", 20},
+		{"let x = 0; if (x > 1) { return x * 10; }; 3", 3},
+		{"let f = fn() { return 1; }; return f() + 4; 9", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"const one = 1; one", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"monkey"[-1]`, "y"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayAndHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+		{"{}", map[interface{}]interface{}{}},
+		{"{1: 2, 2: 3}", map[interface{}]interface{}{1: 2, 2: 3}},
+		{"{1 + 1: 2 * 2, 3 + 3: 4 * 4}", map[interface{}]interface{}{2: 4, 6: 16}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1, 2, 3][-1]", 3},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{`{"a": 1, "b": 2}["b"]`, 2},
+		{`{"a": 1}["b"]`, Null},
+		// The site caches the key, not the value.
+		{`let get = fn(h) { h["a"] }; [get({"a": 1}), get({"a": 2, "b": 3}), get({"b": 4}) ?? 5]`, []int{1, 2, 5}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexConstantAfterReset(t *testing.T) {
+	vm := New(compile(t, `{"a": 1}["a"]`))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	vm.Reset(compile(t, `{"b": 2}["b"]`))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, "after reset", 2, vm.LastPoppedStackElem())
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; b()", 2},
+		{"let early = fn() { return 99; 100; }; early();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { a + b; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+		{"let pair = fn() { return 1, 2 }; pair()[1]", 2},
+		// Missing arguments are null and extra ones are ignored.
+		{"let second = fn(a, b) { b }; second(1)", Null},
+		{"let first = fn(a) { a }; first(1, 2, 3)", 1},
+		{"let f = fn(a) { let b = 2; a + b }; f(1, 5, 6)", 3},
+		{"let f = fn(x) { if (x) { return 1; 2 } else { 3 } }; f(true) * 10 + f(false)", 13},
+		{"let f = fn(x) { if (x) { 1 } else { return 2 }; 3 }; f(true) * 10 + f(false)", 32},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let newClosure = fn(a) { fn() { a; }; };
+			let closure = newClosure(99);
+			closure();`,
+			99,
+		},
+		{
+			`let newAdder = fn(a, b) { fn(c) { a + b + c }; };
+			let adder = newAdder(1, 2);
+			adder(8);`,
+			11,
+		},
+		{
+			`let newAdder = fn(a, b) {
+				let c = a + b;
+				fn(d) { c + d };
+			};
+			let adder = newAdder(1, 2);
+			adder(8);`,
+			11,
+		},
+		{
+			`let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+				};
+			};
+			let newAdderInner = newAdderOuter(1, 2);
+			let adder = newAdderInner(3);
+			adder(8);`,
+			14,
+		},
+		{
+			`let a = 1;
+			let newAdderOuter = fn(b) {
+				fn(c) {
+					fn(d) { a + b + c + d };
+				};
+			};
+			let newAdderInner = newAdderOuter(2);
+			let adder = newAdderInner(3);
+			adder(8);`,
+			14,
+		},
+		{
+			`let newClosure = fn(a, b) {
+				let one = fn() { a; };
+				let two = fn() { b; };
+				fn() { one() + two(); };
+			};
+			let closure = newClosure(9, 90);
+			closure();`,
+			99,
+		},
+		{
+			// Each call captures values of its own.
+			`let counter = fn(n) { fn() { n } };
+			let one = counter(1);
+			let two = counter(2);
+			one() * 10 + two();`,
+			12,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let countDown = fn(x) {
+				if (x == 0) { return 0; } else { countDown(x - 1); }
+			};
+			countDown(1);`,
+			0,
+		},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) {
+					if (x == 0) { return 0; } else { countDown(x - 1); }
+				};
+				countDown(1);
+			};
+			wrapper();`,
+			0,
+		},
+		{
+			`let fibonacci = fn(x) {
+				if (x == 0) { return 0; }
+				if (x == 1) { return 1; }
+				fibonacci(x - 1) + fibonacci(x - 2);
+			};
+			fibonacci(15);`,
+			610,
+		},
+		{
+			// The recursive function captures a local of its own.
+			`let wrapper = fn(step) {
+				let countUp = fn(x, n) {
+					if (n == 0) { x } else { countUp(x + step, n - 1) }
+				};
+				countUp(0, 3);
+			};
+			wrapper(5);`,
+			15,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// TestClosuresMatchEvaluator runs programs with both engines and compares
+// their results.
+func TestTailCalls(t *testing.T) {
+	count := "let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; "
+	tests := []vmTestCase{
+		{count + "count(100000, 0)", 100000},
+		{count + "map([3, 4], fn(n) { count(n * 1000, 0) })", []int{3000, 4000}},
+		{`let g = fn(n) { let x = n * 2; if (n > 3000) { x } else { return g(n + 1); } }; g(0)`, 6002},
+		{`let f = fn(a, b) { if (a == 0) { b } else { f(a - 1) } }; f(3, 1)`, Null},
+		{`let loop = fn(n, f) { if (n == 0) { f() } else { loop(n - 1, f) } };
+		loop(5000, fn() { len("ab") })`, 2},
+		{`let compose = fn(f, g) { fn(x) { g(f(x)) } };
+		let inc = fn(x) { x + 1 };
+		compose(inc, compose(inc, inc))(1)`, 4},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosuresMatchEvaluator(t *testing.T) {
+	inputs := []string{
+		`let make = fn(a) { let b = a * 2; fn(c) { fn() { a + b + c } } }; make(1)(2)()`,
+		`let compose = fn(f, g) { fn(x) { g(f(x)) } };
+		let inc = fn(x) { x + 1 };
+		let double = fn(x) { x * 2 };
+		compose(inc, double)(5)`,
+		`let apply = fn(f, xs) { [f(xs[0]), f(xs[1])] };
+		let scale = fn(k) { apply(fn(x) { x * k }, [1, 2]) };
+		scale(3)`,
+		`let outer = fn(n) { let inner = fn(m) { if (m > n) { m } else { inner(m + 1) } }; inner(0) }; outer(4)`,
+		`let pick = fn(a, b) { fn(first) { if (first) { a } else { b } } }; [pick(1, 2)(true), pick(1, 2)(false)]`,
+		`let f = fn(x) { fn() { x ?? "none" } }; f([][0])()`,
+	}
+
+	testMatchesEvaluator(t, inputs)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2, 3])`, 1},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`first([])`, Null},
+		{`type(len)`, "BUILTIN"},
+		{`type(fn() {})`, "FUNCTION"},
+		{`pi > 3`, true},
+		{`let len = fn(x) { 42 }; len([])`, 42},
+		{`fn() { let first = 1; first }()`, 1},
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`let k = 3; filter([1, 2, 3, 4], fn(x) { x % 2 == 0 && x < k })`, []int{2}},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x }, 10)`, 16},
+		{`map([[1], [2, 3]], len)`, []int{1, 2}},
+		{`let square = memo(fn(x) { x * x }); [square(3), square(3), square(4)]`, []int{9, 9, 16}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinsMatchEvaluator(t *testing.T) {
+	inputs := []string{
+		`[len("abc"), str(12), int("7"), min(3, 1, 2), abs(-4), sqrt(16.0)]`,
+		`sort([3, 1, 2], fn(a, b) { a > b })`,
+		`keys({"a": 1, "b": 2})`,
+		`let twice = fn(f) { fn(x) { f(f(x)) } }; map([1, 2], twice(fn(x) { x + 3 }))`,
+		`collect(take(iter([1, 2, 3]), 2))`,
+		`format("%s-%s", 1, [2])`,
+		`[type(fn() {}), type(len), type(e)]`,
+	}
+
+	testMatchesEvaluator(t, inputs)
+}
+
+// testMatchesEvaluator checks that the VM and the evaluator give inputs the
+// same value.
+func testMatchesEvaluator(t *testing.T, inputs []string) {
+	t.Helper()
+
+	for _, input := range inputs {
+		program := parse(input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", input, err)
+		}
+
+		want := evaluator.Eval(program, object.NewEnvironment())
+		if got := vm.LastPoppedStackElem(); got.Inspect() != want.Inspect() {
+			t.Errorf("%q: vm gave %s, evaluator %s", input, got.Inspect(), want.Inspect())
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "1:1: division by zero"},
+		{"1 + true", "1:1: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: unknown operator: -BOOLEAN"},
+		{"9223372036854775807 + 1", "1:1: integer overflow: 9223372036854775807 + 1"},
+		{"1(2)", "1:1: not a function: INTEGER"},
+		{"1[0]", "1:1: index operator not supported: INTEGER"},
+		{"{[1]: 2}", "1:1: unusable as hash key: ARRAY"},
+		{"let f = fn() { 1 + f() }; f()", "1:20: stack overflow"},
+		{"len(1)", "1:1: argument to `len` not supported, got INTEGER"},
+		{"len()", "1:1: wrong number of arguments. got=0, want=1"},
+		{"map([1], fn(x) { x / 0 })", "1:18: division by zero"},
+		{"map([1], 1)", "1:1: argument to `map` must be FUNCTION, got INTEGER"},
+		{`"abc"["a"]`, "1:1: index operator not supported: STRING"},
+		{`[1, 2]["a"]`, "1:1: index operator not supported: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil {
+			t.Errorf("%q: expected error %q, got none", tt.input, tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestUnsetVariables(t *testing.T) {
+	// A let in a branch that isn't taken leaves its variable unset, and
+	// reading it fails as in the evaluator, rather than seeing a value left
+	// in its slot by an earlier call.
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let c = false; if (c) { let b = 1; }; b + 1", "1:39: identifier not found: b"},
+		{"let c = false; if (c) { let b = 1; }; puts(b)", "1:44: identifier not found: b"},
+		{"let c = false; if (c) { let b = 1; }; len(b)", "1:43: identifier not found: b"},
+		{"let c = false; if (c) { let b = 1; }; [b]", "1:40: identifier not found: b"},
+		{"let f = fn(c) { if (c) { let b = 1; }; type(b) }; f(false)", "1:45: identifier not found: b"},
+		{"let g = fn(a) { let q = 99; q }; let f = fn(a, c) { if (c) { let b = 1; }; b }; g(1); f(1, false)", "1:76: identifier not found: b"},
+		{"let f = fn(c) { if (c) { let b = 1; }; fn() { b } }; f(false)()", "1:40: identifier not found: b"},
+		// Even where the value read isn't used.
+		{"let f = fn(c) { if (c) { let q = 1; }; q; 5 }; f(false)", "1:40: identifier not found: q"},
+		{"let f = fn(c) { if (c) { let q = 1; }; let q = q; 5 }; f(false)", "1:48: identifier not found: q"},
+		{"let c = false; if (c) { let q = 1; }; q; 5", "1:39: identifier not found: q"},
+	}
+
+	// Optimized bytecode must fail the same way.
+	for _, tt := range tests {
+		bytecode := compile(t, tt.input)
+		for _, bytecode := range []*compiler.Bytecode{bytecode, compiler.Optimize(bytecode)} {
+			err := New(bytecode).Run()
+			if err == nil {
+				t.Errorf("%q: expected error %q, got none", tt.input, tt.expected)
+			} else if err.Error() != tt.expected {
+				t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err)
+			}
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   string
+		stack []object.Frame
+	}{
+		{
+			`let divide = fn(a, b) {
+  a / b
+};
+let half = fn(x) {
+  1 + divide(x, 0)
+};
+half(4)`,
+			"2:3",
+			[]object.Frame{
+				{Function: "divide", Pos: token.Position{Line: 5, Column: 7}},
+				{Function: "half", Pos: token.Position{Line: 7, Column: 1}},
+			},
+		},
+		{
+			// Errors in closures that builtins call are reported where
+			// they happen.
+			"let f = fn(x) { x / 0 };\nmap([1], fn(x) { 1 + f(x) })",
+			"1:17",
+			[]object.Frame{
+				{Function: "f", Pos: token.Position{Line: 2, Column: 22}},
+				{Function: "fn", Pos: token.Position{Line: 2, Column: 1}},
+			},
+		},
+		{
+			"let x = 1;\n\n  x + true",
+			"3:3",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(t, tt.input)
+		for _, bytecode := range []*compiler.Bytecode{bytecode, compiler.Optimize(bytecode)} {
+			err := New(bytecode).Run()
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("%q: error is %T (%v), want *Error", tt.input, err, err)
+			}
+			if e.Pos.String() != tt.pos {
+				t.Errorf("%q: wrong position. want=%s, got=%s", tt.input, tt.pos, e.Pos)
+			}
+			if !reflect.DeepEqual(e.Stack, tt.stack) {
+				t.Errorf("%q: wrong stack. want=%v, got=%v", tt.input, tt.stack, e.Stack)
+			}
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fib := "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; "
+	tests := []struct {
+		ctx      context.Context
+		input    string
+		expected string // Error message, or "" for the result 3.
+	}{
+		{context.Background(), fib + "fib(4)", ""},
+		{cancelled, "1 + 2", "evaluation cancelled"},
+		{nil, fib + "fib(100)", "evaluation timed out"},
+		{nil, fib + "map([1], fn(x) { fib(100) })", "evaluation timed out"},
+	}
+
+	for _, tt := range tests {
+		ctx := tt.ctx
+		if ctx == nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+		}
+
+		vm := New(compile(t, tt.input))
+		err := vm.RunContext(ctx)
+		if tt.expected == "" {
+			if err != nil {
+				t.Fatalf("%q: vm error: %s", tt.input, err)
+			}
+			testExpectedObject(t, tt.input, 3, vm.LastPoppedStackElem())
+		} else if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var out bytes.Buffer
+	vm := NewWithOptions(compile(t, "let f = fn(x) { x + 1 }; f(2)"), Options{Trace: &out})
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := `0000 OpClosure 1 0            -
+0004 OpSetGlobal 0            Closure
+0007 OpGetGlobal 0            -
+0010 OpConstant 2             Closure
+0013 OpCall 1                 2
+  0000 OpGetLocal 0             2
+  0002 OpConstant 0             2
+  0005 OpAdd                    1
+  0006 OpReturnValue            3
+0015 OpPop                    3
+`
+	got := regexp.MustCompile(`Closure\[0x[0-9a-f]+\]`).ReplaceAllString(out.String(), "Closure")
+	if got != expected {
+		t.Errorf("wrong trace.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+func TestPoolIntegers(t *testing.T) {
+	// Pooled results stay intact however many more integers are computed
+	// after them.
+	input := `let squares = fn(n, out) {
+  if (n == 0) { return out; }
+  squares(n - 1, push(out, -(n * 100000)))
+};
+let xs = squares(600, []);
+[xs[0], xs[299], xs[599], len(xs), 2000 / 2 + 24, -(1 << 62) * 2]`
+
+	vm := NewWithOptions(compile(t, input), Options{PoolIntegers: true})
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	want := "[-60000000, -30100000, -100000, 600, 1024, -9223372036854775808]"
+	if got := vm.LastPoppedStackElem().Inspect(); got != want {
+		t.Errorf("wrong result. want=%s, got=%s", want, got)
+	}
+}
+
+func TestReset(t *testing.T) {
+	vm := New(compile(t, "let a = [1, 2]; let b = 3; a"))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	first := vm.LastPoppedStackElem()
+
+	// The globals of the first program are gone.
+	vm.Reset(compile(t, "let x = fn() { 4 }; x() + 5"))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, "after reset", 9, vm.LastPoppedStackElem())
+	if len(vm.Globals()) != 1 {
+		t.Errorf("wrong number of globals after reset. got=%d, want=1", len(vm.Globals()))
+	}
+	if b := vm.globals[:2][1]; b != nil {
+		t.Errorf("global kept across reset: %s", b.Inspect())
+	}
+	testExpectedObject(t, "before reset", []int{1, 2}, first)
+
+	// A failed run leaves nothing behind either.
+	vm.Reset(compile(t, "let f = fn() { 1 + f() }; f()"))
+	if err := vm.Run(); err == nil {
+		t.Fatalf("expected a stack overflow")
+	}
+	vm.Reset(compile(t, "6"))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, "after failure", 6, vm.LastPoppedStackElem())
+}
+
+func TestGlobalsStore(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	var globals []object.Object
+
+	// Each line is run with the globals of the previous ones, as in a REPL.
+	lines := []struct {
+		input      string
+		numGlobals int
+		expected   interface{}
+	}{
+		{"let a = 1; a", 1, 1},
+		{"2", 1, 2},
+		{"let b = a + 1; let c = b * 10; c + a", 3, 21},
+		{"let a = c; a", 3, 20},
+	}
+
+	for _, line := range lines {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(line.input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", line.input, err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+		if bytecode.NumGlobals != line.numGlobals {
+			t.Errorf("%q: wrong NumGlobals. got=%d, want=%d", line.input, bytecode.NumGlobals, line.numGlobals)
+		}
+
+		vm := NewWithGlobalsStore(bytecode, globals)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", line.input, err)
+		}
+		testExpectedObject(t, line.input, line.expected, vm.LastPoppedStackElem())
+
+		globals = vm.Globals()
+		if len(globals) != line.numGlobals {
+			t.Errorf("%q: wrong number of globals. got=%d, want=%d", line.input, len(globals), line.numGlobals)
+		}
+	}
+}
+
+func TestCallsDontAllocate(t *testing.T) {
+	allocs := func(calls int) float64 {
+		input := "let f = fn(x) { let y = x; y }; " + strings.Repeat("f(true); ", calls)
+		bytecode := compile(t, input)
+		vm := New(bytecode)
+		return testing.AllocsPerRun(10, func() {
+			vm.Reset(bytecode)
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+		})
+	}
+
+	if one, many := allocs(1), allocs(100); one != many {
+		t.Errorf("calls allocate: %v allocations for one call, %v for 100", one, many)
+	}
+}
+
+func compile(t testing.TB, input string) *compiler.Bytecode {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		// Optimized bytecode must give the same results.
+		bytecode := comp.Bytecode()
+		for _, b := range []*compiler.Bytecode{bytecode, compiler.Optimize(bytecode)} {
+			vm := New(b)
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+
+			stackElem := vm.LastPoppedStackElem()
+			testExpectedObject(t, tt.input, tt.expected, stackElem)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		result, ok := actual.(*object.Integer)
+		if !ok || result.Value != int64(expected) {
+			t.Errorf("%q: want integer %d, got=%s (%T)", input, expected, actual.Inspect(), actual)
+		}
+
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: want float %g, got=%s (%T)", input, expected, actual.Inspect(), actual)
+		}
+
+	case bool:
+		result, ok := actual.(*object.Boolean)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: want boolean %t, got=%s (%T)", input, expected, actual.Inspect(), actual)
+		}
+
+	case string:
+		result, ok := actual.(*object.String)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: want string %q, got=%s (%T)", input, expected, actual.Inspect(), actual)
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("%q: object not Array: %T (%+v)", input, actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("%q: wrong num of elements. want=%d, got=%d",
+				input, len(expected), len(array.Elements))
+			return
+		}
+		for i, expectedElem := range expected {
+			testExpectedObject(t, input, expectedElem, array.Elements[i])
+		}
+
+	case map[interface{}]interface{}:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("%q: object is not Hash. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if len(hash.Pairs) != len(expected) {
+			t.Errorf("%q: hash has wrong number of Pairs. want=%d, got=%d",
+				input, len(expected), len(hash.Pairs))
+			return
+		}
+		for expectedKey, expectedValue := range expected {
+			key := &object.Integer{Value: int64(expectedKey.(int))}
+			pair, ok := hash.Pairs[key.HashKey()]
+			if !ok {
+				t.Errorf("%q: no pair for given key in Pairs", input)
+				continue
+			}
+			testExpectedObject(t, input, expectedValue, pair.Value)
+		}
+
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%q: object is not Null: %T (%+v)", input, actual, actual)
+		}
+
+	default:
+		t.Fatalf("%q: unsupported expected value %T", input, expected)
+	}
+}
+
+func TestReadFrom(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(10)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := compiler.WriteTo(&buf, comp.Bytecode()); err != nil {
+		t.Fatalf("WriteTo: %s", err)
+	}
+
+	// The same bytecode can be run any number of times.
+	data := buf.Bytes()
+	for i := 0; i < 2; i++ {
+		vm, err := ReadFrom(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadFrom: %s", err)
+		}
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, "fact(10)", 3628800, vm.LastPoppedStackElem())
+	}
+
+	if _, err := ReadFrom(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Errorf("truncated bytecode read without error")
+	}
+}
+
+const benchmarkInput = `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(15)`
+
+func BenchmarkRun(b *testing.B) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(benchmarkInput)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(bytecode).Run()
+	}
+}
+
+func BenchmarkRunReset(b *testing.B) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(benchmarkInput)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+	vm := New(bytecode)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vm.Reset(bytecode)
+		vm.Run()
+	}
+}
+
+// BenchmarkDispatch runs instructions that do little besides moving values,
+// so that it mostly measures the cost of dispatching them.
+func BenchmarkDispatch(b *testing.B) {
+	bytecode := compile(b, `
+let loop = fn(n, a, b) {
+  a; b; a; b; a; b; a; b; !a; !b; a && b; a || b; b ?? a;
+  if (n == 0) { a } else { loop(n - 1, b, a) }
+};
+loop(500, true, false)`)
+	vm := New(bytecode)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vm.Reset(bytecode)
+		vm.Run()
+	}
+}
+
+// BenchmarkHashLookups looks up constant keys in a hash over and over, as
+// scripts reading settings do.
+func BenchmarkHashLookups(b *testing.B) {
+	bytecode := compile(b, `
+let config = {"name": "monkey", "retries": 3, "timeout": 30, "verbose": false};
+let loop = fn(n) {
+  config["name"]; config["retries"]; config["timeout"]; config["verbose"];
+  config["name"]; config["retries"]; config["timeout"]; config["verbose"];
+  config["name"]; config["retries"]; config["timeout"]; config["verbose"];
+  if (config["verbose"] || n == 0) { config["timeout"] } else { loop(n - 1) }
+};
+loop(500)`)
+	vm := New(bytecode)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vm.Reset(bytecode)
+		vm.Run()
+	}
+}
+
+// BenchmarkArithmetic computes integers too large to be interned, with and
+// without Options.PoolIntegers.
+func BenchmarkArithmetic(b *testing.B) {
+	bytecode := compile(b, `
+let loop = fn(n, x, sum) {
+  if (n == 0) { return sum; }
+  loop(n - 1, (x * 1103515245 + 12345) % 2147483648, (sum + x) % 1000000007)
+};
+loop(500, 1, 0)`)
+	for _, pool := range []bool{false, true} {
+		name := "alloc"
+		if pool {
+			name = "pool"
+		}
+		b.Run(name, func(b *testing.B) {
+			vm := NewWithOptions(bytecode, Options{PoolIntegers: pool})
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				vm.Reset(bytecode)
+				vm.Run()
+			}
+		})
+	}
+}